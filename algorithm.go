@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"plugin"
+	"slices"
+	"sort"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+	"github.com/ozfive/CIDR-Sensei/cidrsensei/radixtrie"
+)
+
+// algorithms are the algorithms -algorithm selects from, by name. Plugins
+// loaded with -algorithm-plugin add theirs with registerAlgorithm.
+var algorithms = map[string]cidrsensei.Algorithm{
+	"binary-search": binarySearchAlgorithm{},
+	"interval-tree": intervalTreeAlgorithm{},
+	"bitmap":        bitmapAlgorithm{},
+	"radix-trie":    radixTrieAlgorithm{},
+}
+
+// registerAlgorithm makes the algorithm selectable with -algorithm under the
+// name.
+func registerAlgorithm(name string, algorithm cidrsensei.Algorithm) error {
+	if name == "" || algorithm == nil {
+		return fmt.Errorf("an algorithm needs a name and an implementation")
+	}
+	if _, ok := algorithms[name]; ok {
+		return fmt.Errorf("the algorithm %s is already registered", name)
+	}
+	algorithms[name] = algorithm
+	return nil
+}
+
+// algorithmNames returns the names of the registered algorithms, sorted.
+func algorithmNames() []string {
+	return slices.Sorted(maps.Keys(algorithms))
+}
+
+// loadAlgorithmPlugin opens the Go plugin at path, built with
+// -buildmode=plugin, and calls its RegisterAlgorithms function:
+//
+//	func RegisterAlgorithms(register func(name string, algorithm cidrsensei.Algorithm) error) error
+func loadAlgorithmPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("error loading the algorithm plugin %s: %w", path, err)
+	}
+	symbol, err := p.Lookup("RegisterAlgorithms")
+	if err != nil {
+		return fmt.Errorf("the algorithm plugin %s has no RegisterAlgorithms function", path)
+	}
+	register, ok := symbol.(func(func(string, cidrsensei.Algorithm) error) error)
+	if !ok {
+		return fmt.Errorf("the RegisterAlgorithms function of the algorithm plugin %s has the type %T, not func(func(string, cidrsensei.Algorithm) error) error", path, symbol)
+	}
+	if err := register(registerAlgorithm); err != nil {
+		return fmt.Errorf("error registering the algorithms of the plugin %s: %w", path, err)
+	}
+	return nil
+}
+
+// binarySearchAlgorithm finds the range containing each address with a
+// binary search of the ranges merged, whose ends ascend as their starts do
+// however the ranges overlap or nest.
+type binarySearchAlgorithm struct{}
+
+func (binarySearchAlgorithm) Prepare(ranges []cidrsensei.Range) (cidrsensei.ExpandFunc, error) {
+	sorted := cidrsensei.Merge(ranges)
+	return func(r cidrsensei.Range, emit func(uint32) error) error {
+		// Iterate in 64 bits so blocks ending at 255.255.255.255 terminate.
+		for i := uint64(r.Start); i <= uint64(r.End); i++ {
+			ip := uint32(i)
+			idx := sort.Search(len(sorted), func(j int) bool {
+				return sorted[j].End >= ip
+			})
+			if idx < len(sorted) && sorted[idx].Start <= ip {
+				if err := emit(ip); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, nil
+}
+
+// intervalTreeAlgorithm finds the range containing each address with a
+// search of an interval tree of the ranges.
+type intervalTreeAlgorithm struct{}
+
+func (intervalTreeAlgorithm) Prepare(ranges []cidrsensei.Range) (cidrsensei.ExpandFunc, error) {
+	tree := &cidrsensei.IntervalTree{}
+	for _, r := range ranges {
+		if err := tree.Insert(r); err != nil {
+			return nil, fmt.Errorf("error inserting %s into the interval tree: %w", r, err)
+		}
+	}
+	return func(r cidrsensei.Range, emit func(uint32) error) error {
+		for i := uint64(r.Start); i <= uint64(r.End); i++ {
+			ip := uint32(i)
+			if _, ok := tree.Search(ip); ok {
+				if err := emit(ip); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, nil
+}
+
+// bitmapAlgorithm expands the ranges from a roaring bitmap of them, visiting
+// the set bits only rather than looking up each address.
+type bitmapAlgorithm struct{}
+
+func (bitmapAlgorithm) Prepare(ranges []cidrsensei.Range) (cidrsensei.ExpandFunc, error) {
+	b := rangesBitmap(ranges)
+	return func(r cidrsensei.Range, emit func(uint32) error) error {
+		return b.each(r.Start, r.End, emit)
+	}, nil
+}
+
+// radixTrieAlgorithm finds whether each address is in the ranges with a
+// longest-prefix match in a radix trie of the prefixes covering them, which
+// takes at most 32 steps however many prefixes there are.
+type radixTrieAlgorithm struct{}
+
+func (radixTrieAlgorithm) Prepare(ranges []cidrsensei.Range) (cidrsensei.ExpandFunc, error) {
+	trie := &radixtrie.Trie[struct{}]{}
+	for _, r := range ranges {
+		insertRange(trie, r, func(struct{}) struct{} { return struct{}{} })
+	}
+	return func(r cidrsensei.Range, emit func(uint32) error) error {
+		for i := uint64(r.Start); i <= uint64(r.End); i++ {
+			ip := uint32(i)
+			if _, ok := trie.Lookup(ip); ok {
+				if err := emit(ip); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, nil
+}
+
+// insertRange adds the prefixes exactly covering r to trie, each with the
+// value update returns from the one the prefix already has, or the zero
+// value.
+func insertRange[V any](trie *radixtrie.Trie[V], r ipRange, update func(V) V) {
+	for _, prefix := range r.Prefixes() {
+		addr, bits := cidrsensei.Uint32(prefix.Addr()), prefix.Bits()
+		value, _ := trie.Get(addr, bits)
+		// The prefixes are masked, so valid.
+		_ = trie.Insert(addr, bits, update(value))
+	}
+}
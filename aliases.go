@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// checkAliases validates the aliases of the settings file. An alias must
+// not shadow a built-in address set or the @include directive, and must
+// name at least one entry.
+func checkAliases(aliases map[string]aliasEntries) error {
+	for _, name := range slices.Sorted(maps.Keys(aliases)) {
+		switch {
+		case name == "" || strings.ContainsAny(name, "@, \t"):
+			return fmt.Errorf("invalid alias name %q", name)
+		case strings.EqualFold("@"+name, includeDirective):
+			return fmt.Errorf("alias @%s conflicts with the %s directive", name, includeDirective)
+		case builtinSets[strings.ToLower(name)].cidrs != nil:
+			return fmt.Errorf("alias @%s conflicts with the built-in address set of the same name", name)
+		case len(aliases[name]) == 0:
+			return fmt.Errorf("alias @%s has no entries", name)
+		}
+	}
+	return nil
+}
+
+// lookupAlias returns the entries of the alias with the given name, which
+// is matched case-insensitively like the built-in address sets.
+func lookupAlias(aliases map[string]aliasEntries, name string) (string, aliasEntries, bool) {
+	if entries, ok := aliases[name]; ok {
+		return name, entries, true
+	}
+	for alias, entries := range aliases {
+		if strings.EqualFold(alias, name) {
+			return alias, entries, true
+		}
+	}
+	return "", nil, false
+}
+
+// expandAliases replaces every entry naming an alias, such as @corp-lan,
+// with the entries of the alias. Aliases may reference other aliases and
+// built-in address sets, and a cycle of aliases referencing each other is an
+// error.
+func expandAliases(aliases map[string]aliasEntries, entries iter.Seq2[inputEntry, error]) iter.Seq2[inputEntry, error] {
+	if len(aliases) == 0 {
+		return entries
+	}
+	return func(yield func(inputEntry, error) bool) {
+		for entry, err := range entries {
+			if err != nil {
+				yield(entry, err)
+				return
+			}
+			if !yieldAlias(aliases, entry, nil, yield) {
+				return
+			}
+		}
+	}
+}
+
+// yieldAlias yields entry, or the entries of the alias it names, expanding
+// them in turn. expanding holds the aliases being expanded, outermost
+// first. It returns false once yield asks to stop or an error was yielded.
+func yieldAlias(aliases map[string]aliasEntries, entry inputEntry, expanding []string, yield func(inputEntry, error) bool) bool {
+	name, ok := strings.CutPrefix(entry.text, "@")
+	if !ok {
+		return yield(entry, nil)
+	}
+	name, members, ok := lookupAlias(aliases, name)
+	if !ok {
+		return yield(entry, nil)
+	}
+	if slices.Contains(expanding, name) {
+		cycle := append(slices.Clone(expanding), name)
+		yield(inputEntry{}, fmt.Errorf("%s: alias cycle: @%s", entry.origin, strings.Join(cycle, " -> @")))
+		return false
+	}
+
+	expanding = append(expanding, name)
+	for i, text := range members {
+		member := entry
+		member.text = strings.TrimSpace(text)
+		member.origin = fmt.Sprintf("%s via @%s entry %d", entry.origin, name, i+1)
+		if !yieldAlias(aliases, member, expanding, yield) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	defaultAllocatePrefix = 24
+	defaultAllocateFit    = "first"
+)
+
+// runAllocate writes the free subnet allocated within the parent block given
+// to -allocate, treating the CIDR ranges as the subnets already in use.
+func runAllocate(config Config, used []CIDRRange) error {
+	parent, err := parseNormalizedCIDR(config.Allocate)
+	if err != nil {
+		return fmt.Errorf("invalid -allocate parent: %w", err)
+	}
+	subnet, err := allocateSubnet(parent, used, config.AllocatePrefix, config.AllocateFit)
+	if err != nil {
+		return err
+	}
+	return writeCIDRList(os.Stdout, config.OutputFormat, []CIDRRange{subnet})
+}
+
+// allocateSubnet returns a free subnet of the given prefix length within
+// parent that does not overlap any used range. The "first" fit returns the
+// lowest free subnet, while "best" carves it out of the smallest free block
+// that can hold it to limit fragmentation.
+func allocateSubnet(parent CIDRRange, used []CIDRRange, prefix int, fit string) (CIDRRange, error) {
+	parentPrefix, _ := parent.ipNet.Mask.Size()
+	if prefix < parentPrefix || prefix > 32 {
+		return CIDRRange{}, fmt.Errorf("cannot allocate a /%d within %s", prefix, parent)
+	}
+
+	free := subtractIPRanges([]ipRange{{Start: parent.start, End: parent.end}}, mergeIPRanges(toIPRanges(used)))
+	size := uint64(1) << (32 - prefix)
+
+	switch fit {
+	case "first":
+		for _, r := range free {
+			// Round the start of the free range up to the subnet size.
+			start := (uint64(r.Start) + size - 1) &^ (size - 1)
+			if start+size-1 <= uint64(r.End) {
+				return newCIDRRange(uint32(start), prefix), nil
+			}
+		}
+	case "best":
+		// Every free block is aligned, so the smallest one that is large
+		// enough can hold the subnet at its start.
+		var best *CIDRRange
+		for _, block := range rangesToCIDRs(free) {
+			ones, _ := block.ipNet.Mask.Size()
+			if ones <= prefix && (best == nil || block.length < best.length) {
+				best = &block
+			}
+		}
+		if best != nil {
+			return newCIDRRange(best.start, prefix), nil
+		}
+	default:
+		return CIDRRange{}, fmt.Errorf("unsupported -allocate-fit: %s", fit)
+	}
+
+	return CIDRRange{}, fmt.Errorf("no free /%d left in %s", prefix, parent)
+}
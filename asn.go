@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultASNSource   = "ripestat"
+	defaultASNCacheTTL = time.Hour
+	defaultASNRate     = 4.0
+
+	ripestatURL = "https://stat.ripe.net/data/announced-prefixes/data.json"
+	bgpToolsURL = "https://bgp.tools/table.jsonl"
+)
+
+// asnSources lists the backends -asn-source accepts.
+var asnSources = []string{"ripestat", "bgp.tools"}
+
+// asnEntry matches an AS number entry such as AS13335.
+var asnEntry = regexp.MustCompile(`^(?i:as)(\d{1,10})$`)
+
+// parseASNEntry reports whether entry is an AS number such as AS13335, and
+// returns the number.
+func parseASNEntry(entry string) (uint32, bool) {
+	match := asnEntry.FindStringSubmatch(entry)
+	if match == nil {
+		return 0, false
+	}
+	asn, err := strconv.ParseUint(match[1], 10, 32)
+	return uint32(asn), err == nil
+}
+
+// asnBackend looks up the IPv4 prefixes an AS currently announces.
+type asnBackend interface {
+	announcedPrefixes(ctx context.Context, asn uint32) ([]string, error)
+}
+
+// asnResolver expands AS number entries into the prefixes they announce.
+// Answers are cached on disk for the cache TTL, and requests to the backend
+// are spaced out to respect its rate limits.
+type asnResolver struct {
+	ctx     context.Context
+	backend asnBackend
+}
+
+// newASNResolver returns the resolver for the backend selected with
+// -asn-source, downloading from -asn-url when it is set.
+func newASNResolver(ctx context.Context, config Config, fetcher *fetcher) *asnResolver {
+	limiter := newRateLimiter(config.ASNRate)
+	var backend asnBackend
+	switch config.ASNSource {
+	case "bgp.tools":
+		backend = &bgpToolsBackend{fetcher: fetcher, url: config.ASNURL, ttl: config.ASNCacheTTL, limiter: limiter}
+	default:
+		backend = &ripestatBackend{fetcher: fetcher, url: config.ASNURL, ttl: config.ASNCacheTTL, limiter: limiter}
+	}
+	return &asnResolver{ctx: ctx, backend: backend}
+}
+
+// resolve returns the IPv4 prefixes announced by asn.
+func (r *asnResolver) resolve(asn uint32) ([]CIDRRange, error) {
+	prefixes, err := r.backend.announcedPrefixes(r.ctx, asn)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up AS%d: %w", asn, err)
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("error looking up AS%d: no IPv4 prefixes announced", asn)
+	}
+	cidrRanges := make([]CIDRRange, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		cidr, err := parseCIDR(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up AS%d: %w", asn, err)
+		}
+		cidrRanges = append(cidrRanges, cidr)
+	}
+	return cidrRanges, nil
+}
+
+// isIPv4Prefix reports whether prefix is an IPv4 CIDR block.
+func isIPv4Prefix(prefix string) bool {
+	ip, _, err := net.ParseCIDR(prefix)
+	return err == nil && ip.To4() != nil
+}
+
+// ripestatBackend asks the RIPEstat announced-prefixes API, one request per
+// AS.
+type ripestatBackend struct {
+	fetcher *fetcher
+	url     string
+	ttl     time.Duration
+	limiter *rateLimiter
+}
+
+func (b *ripestatBackend) announcedPrefixes(ctx context.Context, asn uint32) ([]string, error) {
+	endpoint := b.url
+	if endpoint == "" {
+		endpoint = ripestatURL
+	}
+	query := url.Values{"resource": {fmt.Sprintf("AS%d", asn)}, "sourceapp": {"cidr-sensei"}}
+	body, err := b.fetcher.fetchMaxAge(ctx, endpoint+"?"+query.Encode(), b.ttl, b.limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Status string `json:"status"`
+		Data   struct {
+			Prefixes []struct {
+				Prefix string `json:"prefix"`
+			} `json:"prefixes"`
+		} `json:"data"`
+		Messages [][]string `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing RIPEstat response: %w", err)
+	}
+	if response.Status != "" && response.Status != "ok" {
+		return nil, fmt.Errorf("RIPEstat returned status %q %v", response.Status, response.Messages)
+	}
+	var prefixes []string
+	for _, p := range response.Data.Prefixes {
+		if isIPv4Prefix(p.Prefix) {
+			prefixes = append(prefixes, p.Prefix)
+		}
+	}
+	return prefixes, nil
+}
+
+// bgpToolsBackend downloads the bgp.tools table of every announced prefix
+// once, and looks the ASes up in it.
+type bgpToolsBackend struct {
+	fetcher *fetcher
+	url     string
+	ttl     time.Duration
+	limiter *rateLimiter
+
+	once     sync.Once
+	prefixes map[uint32][]string
+	err      error
+}
+
+func (b *bgpToolsBackend) announcedPrefixes(ctx context.Context, asn uint32) ([]string, error) {
+	b.once.Do(func() { b.prefixes, b.err = b.load(ctx) })
+	return b.prefixes[asn], b.err
+}
+
+// load downloads the table and indexes its IPv4 prefixes by origin AS.
+func (b *bgpToolsBackend) load(ctx context.Context) (map[uint32][]string, error) {
+	endpoint := b.url
+	if endpoint == "" {
+		endpoint = bgpToolsURL
+	}
+	body, err := b.fetcher.fetchMaxAge(ctx, endpoint, b.ttl, b.limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := make(map[uint32][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var route struct {
+			CIDR string `json:"CIDR"`
+			ASN  uint32 `json:"ASN"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &route); err != nil {
+			return nil, fmt.Errorf("error parsing %s:%d: %w", endpoint, lineNum, err)
+		}
+		if isIPv4Prefix(route.CIDR) {
+			prefixes[route.ASN] = append(prefixes[route.ASN], route.CIDR)
+		}
+	}
+	return prefixes, scanner.Err()
+}
+
+// rateLimiter spaces out requests to at most a given number per second.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newRateLimiter returns a limiter allowing perSecond requests a second, or
+// any number when perSecond is not positive.
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next request may be made, or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil || l.interval == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
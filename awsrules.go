@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// awsRuleFormats lists the formats -aws-rules writes, and awsRuleTypes what
+// it writes them for.
+var (
+	awsRuleFormats = []string{"terraform", "aws-cli"}
+	awsRuleTypes   = []string{"security-group", "prefix-list"}
+)
+
+// Defaults of the -aws-rules options. A security group has room for 60
+// inbound rules by default, while a managed prefix list holds up to 1,000
+// entries.
+const (
+	defaultAWSRuleType      = "security-group"
+	defaultAWSRuleName      = "cidr-sensei"
+	defaultAWSProtocol      = "-1"
+	awsSecurityGroupRules   = 60
+	awsPrefixListMaxEntries = 1000
+)
+
+// awsPorts is the port range of the -aws-rules ingress rules.
+type awsPorts struct {
+	from, to int
+}
+
+// parseAWSPorts parses an -aws-ports port or range of ports, such as 443 or
+// 8000-8999. An empty value is all ports, which is 0 to 0 in Terraform.
+func parseAWSPorts(s string) (awsPorts, error) {
+	if s == "" {
+		return awsPorts{}, nil
+	}
+	fromText, toText, isRange := strings.Cut(s, "-")
+	from, err := strconv.Atoi(fromText)
+	to := from
+	if err == nil && isRange {
+		to, err = strconv.Atoi(toText)
+	}
+	if err != nil || from < 0 || to > 65535 || from > to {
+		return awsPorts{}, fmt.Errorf("invalid -aws-ports: %s (expected a port or range such as 8000-8999)", s)
+	}
+	return awsPorts{from, to}, nil
+}
+
+// awsChunks splits the blocks into the groups that fit in one security
+// group or prefix list each.
+func awsChunks(config Config, blocks []CIDRRange) [][]CIDRRange {
+	size := config.AWSChunkSize
+	if size <= 0 {
+		size = awsSecurityGroupRules
+		if config.AWSRuleType == "prefix-list" {
+			size = awsPrefixListMaxEntries
+		}
+	}
+	var chunks [][]CIDRRange
+	for len(blocks) > size {
+		chunks = append(chunks, blocks[:size])
+		blocks = blocks[size:]
+	}
+	if len(blocks) > 0 {
+		chunks = append(chunks, blocks)
+	}
+	return chunks
+}
+
+// runAWSRules writes the merged CIDR blocks as AWS security group ingress
+// rules or managed prefix lists, in Terraform or as aws-cli input, split
+// into as many groups or lists as the AWS limits require.
+func runAWSRules(config Config, cidrRanges []CIDRRange) error {
+	ports, err := parseAWSPorts(config.AWSPorts)
+	if err != nil {
+		return err
+	}
+	chunks := awsChunks(config, rangesToCIDRs(mergeIPRanges(toIPRanges(cidrRanges))))
+
+	var out io.Writer = os.Stdout
+	if config.OutFile != "" && config.OutFile != "-" {
+		file, err := os.Create(config.OutFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	if config.AWSRules == "terraform" {
+		writeAWSTerraform(w, config, ports, chunks)
+	} else if err := writeAWSCLI(w, config, ports, chunks); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// awsChunkName returns the name of the security group or prefix list of the
+// chunk at index i, numbered when there are several.
+func awsChunkName(name string, i, n int) string {
+	if n == 1 {
+		return name
+	}
+	return fmt.Sprintf("%s-%d", name, i+1)
+}
+
+// writeAWSTerraform writes an aws_security_group with an ingress block, or
+// an aws_ec2_managed_prefix_list, for each chunk.
+func writeAWSTerraform(w io.Writer, config Config, ports awsPorts, chunks [][]CIDRRange) {
+	if config.AWSRuleType == "security-group" {
+		fmt.Fprintln(w, "variable \"vpc_id\" {\n  type = string\n}")
+	}
+	for i, chunk := range chunks {
+		name := awsChunkName(config.AWSName, i, len(chunks))
+		resource := strings.NewReplacer("-", "_", ".", "_").Replace(name)
+		fmt.Fprintln(w)
+		if config.AWSRuleType == "prefix-list" {
+			fmt.Fprintf(w, "resource \"aws_ec2_managed_prefix_list\" %q {\n", resource)
+			fmt.Fprintf(w, "  name           = %q\n", name)
+			fmt.Fprintln(w, "  address_family = \"IPv4\"")
+			fmt.Fprintf(w, "  max_entries    = %d\n", len(chunk))
+			for _, block := range chunk {
+				fmt.Fprintf(w, "\n  entry {\n    cidr = %q\n  }\n", block.String())
+			}
+			fmt.Fprintln(w, "}")
+			continue
+		}
+
+		fmt.Fprintf(w, "resource \"aws_security_group\" %q {\n", resource)
+		fmt.Fprintf(w, "  name        = %q\n", name)
+		fmt.Fprintln(w, "  description = \"Generated by cidr-sensei\"")
+		fmt.Fprintln(w, "  vpc_id      = var.vpc_id")
+		fmt.Fprintln(w, "\n  ingress {")
+		fmt.Fprintf(w, "    from_port   = %d\n", ports.from)
+		fmt.Fprintf(w, "    to_port     = %d\n", ports.to)
+		fmt.Fprintf(w, "    protocol    = %q\n", config.AWSProtocol)
+		fmt.Fprintln(w, "    cidr_blocks = [")
+		for _, block := range chunk {
+			fmt.Fprintf(w, "      %q,\n", block.String())
+		}
+		fmt.Fprintln(w, "    ]\n  }\n}")
+	}
+}
+
+// awsIPPermission is an ingress rule of authorize-security-group-ingress.
+type awsIPPermission struct {
+	IpProtocol string       `json:"IpProtocol"`
+	FromPort   *int         `json:"FromPort,omitempty"`
+	ToPort     *int         `json:"ToPort,omitempty"`
+	IpRanges   []awsIPRange `json:"IpRanges"`
+}
+
+type awsIPRange struct {
+	CidrIp string `json:"CidrIp"`
+}
+
+// awsPrefixListEntry is an entry of create-managed-prefix-list.
+type awsPrefixListEntry struct {
+	Cidr string `json:"Cidr"`
+}
+
+// writeAWSCLI writes a JSON array of the --cli-input-json documents of
+// "aws ec2 authorize-security-group-ingress", for each -aws-group-id, or of
+// "aws ec2 create-managed-prefix-list", one for each chunk.
+func writeAWSCLI(w io.Writer, config Config, ports awsPorts, chunks [][]CIDRRange) error {
+	groupIDs := splitList(config.AWSGroupIDs)
+	if config.AWSRuleType == "security-group" && len(groupIDs) < len(chunks) {
+		return fmt.Errorf("the blocks need %d security groups, but -aws-group-id lists %d", len(chunks), len(groupIDs))
+	}
+
+	documents := make([]any, 0, len(chunks))
+	for i, chunk := range chunks {
+		if config.AWSRuleType == "prefix-list" {
+			entries := make([]awsPrefixListEntry, 0, len(chunk))
+			for _, block := range chunk {
+				entries = append(entries, awsPrefixListEntry{block.String()})
+			}
+			documents = append(documents, map[string]any{
+				"PrefixListName": awsChunkName(config.AWSName, i, len(chunks)),
+				"AddressFamily":  "IPv4",
+				"MaxEntries":     len(chunk),
+				"Entries":        entries,
+			})
+			continue
+		}
+
+		permission := awsIPPermission{IpProtocol: config.AWSProtocol}
+		if config.AWSProtocol != "-1" {
+			permission.FromPort, permission.ToPort = &ports.from, &ports.to
+		}
+		for _, block := range chunk {
+			permission.IpRanges = append(permission.IpRanges, awsIPRange{block.String()})
+		}
+		documents = append(documents, map[string]any{
+			"GroupId":       groupIDs[i],
+			"IpPermissions": []awsIPPermission{permission},
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(documents)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// benchResult is the time one way of expanding the blocks took.
+type benchResult struct {
+	Algorithm    string  `json:"algorithm"`
+	Parallel     bool    `json:"parallel"`
+	Concurrency  int     `json:"concurrency,omitempty"`
+	IPs          uint64  `json:"ips"`
+	Seconds      float64 `json:"seconds"`
+	IPsPerSecond float64 `json:"ips_per_second"`
+}
+
+// runBench implements the bench command: it expands the blocks sequentially
+// and with each algorithm in parallel, discarding the IPs, and reports how
+// long each took. It returns the process exit code.
+func runBench(ctx context.Context, config Config) int {
+	fetcher := newFetcher(config.FetchTimeout, config.FetchRetries, config.CacheDir, config.NoCache)
+	parser := newCIDRParser(ctx, config, fetcher)
+	cidrRanges, err := loadCIDRRanges(config, parser, collectEntries(config.CIDRListStr, "-cidr", inputSources(ctx, config, fetcher)...))
+	if err != nil {
+		slog.Error("cannot load the CIDR blocks", "error", err)
+		return 1
+	}
+	cidrRanges = filterHostAddresses(cidrRanges, config.IncludeNetwork, config.IncludeBroadcast)
+	excludeRanges, err := loadCIDRRanges(config, parser, collectEntries(config.Exclude, "-exclude", excludeSources(ctx, config, fetcher)...))
+	if err != nil {
+		slog.Error("cannot load the -exclude blocks", "error", err)
+		return 1
+	}
+	cidrRanges = dedupeCIDRRanges(excludeCIDRRanges(cidrRanges, mergeIPRanges(toIPRanges(excludeRanges))))
+
+	result, err := timeExpansion("binary-search", false, 0, func(emit func(string) error) error {
+		return expandSequential("binary-search", cidrRanges, nil, interruptible(ctx, emit))
+	})
+	if err != nil {
+		slog.Error("the benchmark failed", "error", err)
+		return 1
+	}
+	results := []benchResult{result}
+	for _, algorithm := range algorithmNames() {
+		result, err := timeExpansion(algorithm, true, config.Concurrency, func(emit func(string) error) error {
+			return cidrToIPsParallel(ctx, cidrRanges, config.Concurrency, algorithm, config.buffers().channelCapacity(), nil, emit)
+		})
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			slog.Error("the benchmark failed", "error", err)
+			return 1
+		}
+		results = append(results, result)
+	}
+
+	header := []string{"algorithm", "parallel", "concurrency", "ips", "seconds", "ips_per_second"}
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		concurrency := strconv.Itoa(r.Concurrency)
+		if !r.Parallel && config.OutputFormat == "terminal" {
+			concurrency = "-"
+		}
+		rows = append(rows, []string{r.Algorithm, strconv.FormatBool(r.Parallel), concurrency, strconv.FormatUint(r.IPs, 10),
+			strconv.FormatFloat(r.Seconds, 'f', 3, 64), strconv.FormatFloat(r.IPsPerSecond, 'f', 0, 64)})
+	}
+	if err := writeReport(os.Stdout, config.OutputFormat, results, header, rows); err != nil {
+		slog.Error("cannot write output", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// timeExpansion runs expand, counting the IPs it emits, and returns how long
+// it took.
+func timeExpansion(algorithm string, parallel bool, concurrency int, expand func(emit func(string) error) error) (benchResult, error) {
+	var ips uint64
+	start := time.Now()
+	err := expand(func(string) error {
+		ips++
+		return nil
+	})
+	if err != nil {
+		return benchResult{}, err
+	}
+	seconds := time.Since(start).Seconds()
+
+	result := benchResult{Algorithm: algorithm, Parallel: parallel, Concurrency: concurrency, IPs: ips, Seconds: seconds}
+	if seconds > 0 {
+		result.IPsPerSecond = float64(ips) / seconds
+	}
+	return result, nil
+}
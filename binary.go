@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// binaryMagic starts the header -binary-header adds to binary output. The
+// header is the magic, a version byte, the length of each address in bytes
+// and two reserved zero bytes.
+const binaryMagic = "CIDRSNSI"
+
+const (
+	binaryVersion    = 1
+	binaryHeaderSize = len(binaryMagic) + 4
+)
+
+// binaryHeader returns the header of binary output with addresses of size
+// bytes.
+func binaryHeader(size int) []byte {
+	return append([]byte(binaryMagic), binaryVersion, byte(size), 0, 0)
+}
+
+// runDecode reads the binary output given to -decode, or stdin when it is
+// "-", and writes the addresses in the -output format. A header is read if
+// the file starts with one.
+func runDecode(config Config) error {
+	var r io.Reader = os.Stdin
+	if config.Decode != "-" {
+		file, err := os.Open(config.Decode)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	br := bufio.NewReader(r)
+
+	size := 4
+	if start, _ := br.Peek(binaryHeaderSize); bytes.HasPrefix(start, []byte(binaryMagic)) {
+		if len(start) < binaryHeaderSize {
+			return fmt.Errorf("%s: truncated header", config.Decode)
+		}
+		if start[len(binaryMagic)] != binaryVersion {
+			return fmt.Errorf("%s: unsupported version %d", config.Decode, start[len(binaryMagic)])
+		}
+		if size = int(start[len(binaryMagic)+1]); size != 4 {
+			return fmt.Errorf("%s: unsupported address length %d (only IPv4 is supported)", config.Decode, size)
+		}
+		br.Discard(binaryHeaderSize)
+	}
+
+	output, err := newIPWriter(config, nil, nil)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, size)
+	for {
+		if _, err = io.ReadFull(br, buf); err != nil {
+			break
+		}
+		if err = output.write(formatIPv4(binary.BigEndian.Uint32(buf))); err != nil {
+			break
+		}
+	}
+	switch {
+	case errors.Is(err, io.EOF):
+		err = nil
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		err = fmt.Errorf("%s: truncated address at the end", config.Decode)
+	}
+	if closeErr := output.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
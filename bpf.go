@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// bpfFormats lists what -bpf writes, and bpfDirections and bpfLinks the
+// values of -bpf-direction and -bpf-link.
+var (
+	bpfFormats    = []string{"expression", "compiled"}
+	bpfDirections = []string{"", "src", "dst"}
+	bpfLinks      = []string{"ethernet", "raw"}
+)
+
+const (
+	// bpfMaxInstructions is the most instructions the kernel accepts in a
+	// classic BPF program (BPF_MAXINSNS).
+	bpfMaxInstructions = 4096
+	// bpfSnapLen is what a compiled filter returns to accept a packet: the
+	// whole packet, as tcpdump does by default.
+	bpfSnapLen = 262144
+
+	bpfLdAbsW = 0x20 // ld [k]
+	bpfLdAbsH = 0x28 // ldh [k]
+	bpfLdAbsB = 0x30 // ldb [k]
+	bpfAndK   = 0x54 // and #k
+	bpfJeqK   = 0x15 // jeq #k
+	bpfRetK   = 0x06 // ret #k
+)
+
+// bpfInstruction is a classic BPF instruction, as tcpdump -ddd prints it.
+type bpfInstruction struct {
+	code   uint16
+	jt, jf uint8
+	k      uint32
+}
+
+// bpfExpression returns the libpcap filter expression matching the blocks,
+// such as "net 10.0.0.0/8 or net 192.168.0.0/16", or "src net ..." with a
+// direction.
+func bpfExpression(blocks []CIDRRange, direction string) string {
+	keyword := "net "
+	if direction != "" {
+		keyword = direction + " net "
+	}
+	terms := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		terms = append(terms, keyword+block.String())
+	}
+	return strings.Join(terms, " or ")
+}
+
+// bpfProgram compiles a filter accepting IPv4 packets whose source or
+// destination address, or both when direction is empty, is in one of the
+// blocks. Each block is tested with a load, a mask and a comparison that
+// skips over an accepting return, so that every jump is short whatever the
+// number of blocks.
+func bpfProgram(blocks []CIDRRange, direction, link string) []bpfInstruction {
+	srcOffset, dstOffset := uint32(26), uint32(30)
+	var program []bpfInstruction
+	if link == "raw" {
+		srcOffset, dstOffset = 12, 16
+		program = append(program,
+			bpfInstruction{code: bpfLdAbsB, k: 0},
+			bpfInstruction{code: bpfAndK, k: 0xf0},
+			bpfInstruction{code: bpfJeqK, jt: 1, k: 0x40},
+			bpfInstruction{code: bpfRetK, k: 0},
+		)
+	} else {
+		program = append(program,
+			bpfInstruction{code: bpfLdAbsH, k: 12},
+			bpfInstruction{code: bpfJeqK, jt: 1, k: 0x0800},
+			bpfInstruction{code: bpfRetK, k: 0},
+		)
+	}
+
+	var offsets []uint32
+	if direction != "dst" {
+		offsets = append(offsets, srcOffset)
+	}
+	if direction != "src" {
+		offsets = append(offsets, dstOffset)
+	}
+	for _, offset := range offsets {
+		for _, block := range blocks {
+			prefix, _ := block.ipNet.Mask.Size()
+			if prefix == 0 {
+				return append(program, bpfInstruction{code: bpfRetK, k: bpfSnapLen})
+			}
+			program = append(program, bpfInstruction{code: bpfLdAbsW, k: offset})
+			if prefix < 32 {
+				program = append(program, bpfInstruction{code: bpfAndK, k: ^uint32(0) << (32 - prefix)})
+			}
+			program = append(program,
+				bpfInstruction{code: bpfJeqK, jf: 1, k: block.start},
+				bpfInstruction{code: bpfRetK, k: bpfSnapLen},
+			)
+		}
+	}
+	return append(program, bpfInstruction{code: bpfRetK, k: 0})
+}
+
+// bpfChunks splits the blocks into filters that each compile to at most
+// bpfMaxInstructions and, with -bpf-max-length, have an expression of at
+// most that many characters. The sizes are counted the way bpfExpression
+// and bpfProgram build them.
+func bpfChunks(blocks []CIDRRange, config Config) [][]CIDRRange {
+	header, directions := 4, 2
+	if config.BPFLink != "raw" {
+		header = 3
+	}
+	if config.BPFDirection != "" {
+		directions = 1
+	}
+
+	var chunks [][]CIDRRange
+	start, length, instructions := 0, 0, header
+	for i, block := range blocks {
+		termLength := len(bpfExpression([]CIDRRange{block}, config.BPFDirection))
+		if i > start {
+			termLength += len(" or ")
+		}
+		blockInstructions := 4 * directions
+		if prefix, _ := block.ipNet.Mask.Size(); prefix == 32 {
+			blockInstructions = 3 * directions
+		}
+		tooLong := config.BPFMaxLength > 0 && length+termLength > config.BPFMaxLength
+		if i > start && (tooLong || instructions+blockInstructions+1 > bpfMaxInstructions) {
+			chunks = append(chunks, blocks[start:i])
+			start, length, instructions = i, 0, header
+			termLength -= len(" or ")
+		}
+		length += termLength
+		instructions += blockInstructions
+	}
+	if start < len(blocks) {
+		chunks = append(chunks, blocks[start:])
+	}
+	return chunks
+}
+
+// runBPF writes the merged CIDR blocks as libpcap filter expressions, one
+// per line, or as compiled programs in tcpdump -ddd format, separated by
+// blank lines, to -outfile or stdout. More than one filter is written when
+// the blocks do not fit in one.
+func runBPF(config Config, cidrRanges []CIDRRange) error {
+	blocks := rangesToCIDRs(mergeIPRanges(toIPRanges(cidrRanges)))
+
+	var out io.Writer = os.Stdout
+	if config.OutFile != "" && config.OutFile != "-" {
+		file, err := os.Create(config.OutFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	for i, chunk := range bpfChunks(blocks, config) {
+		if config.BPF == "expression" {
+			fmt.Fprintln(w, bpfExpression(chunk, config.BPFDirection))
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		writeBPFProgram(w, bpfProgram(chunk, config.BPFDirection, config.BPFLink))
+	}
+	return w.Flush()
+}
+
+// writeBPFProgram writes a program the way tcpdump -ddd does: the number of
+// instructions, then each instruction's code, jumps and constant in decimal.
+// This is what iptables -m bpf --bytecode takes, with commas for newlines.
+func writeBPFProgram(w io.Writer, program []bpfInstruction) {
+	fmt.Fprintln(w, len(program))
+	for _, ins := range program {
+		fmt.Fprintf(w, "%d %d %d %d\n", ins.code, ins.jt, ins.jf, ins.k)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * cidrsensei.h declares the types of the C API of libcidrsensei, built with
+ * make c-shared. The functions are declared in the libcidrsensei.h the build
+ * generates, which includes this file.
+ *
+ * Addresses are IPv4 addresses as host-order 32-bit integers, so 10.0.0.1 is
+ * 0x0a000001.
+ */
+#ifndef CIDRSENSEI_H
+#define CIDRSENSEI_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+/* cs_range is an inclusive range of addresses. */
+typedef struct {
+	uint32_t start;
+	uint32_t end;
+} cs_range;
+
+/* cs_prefix is a CIDR block: its first address and prefix length. */
+typedef struct {
+	uint32_t addr;
+	uint8_t bits;
+} cs_prefix;
+
+/*
+ * cs_emit receives each address of an expansion with the ctx given to
+ * cs_expand. Returning nonzero stops the expansion.
+ */
+typedef int (*cs_emit)(uint32_t addr, void *ctx);
+
+/* The status codes the functions return. */
+enum {
+	CS_OK = 0,
+	/* An entry could not be parsed; see the error message. */
+	CS_ERR_PARSE = -1,
+	/* The output array is too small; *n is set to the length needed. */
+	CS_ERR_SPACE = -2,
+};
+
+#endif
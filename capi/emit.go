@@ -0,0 +1,23 @@
+package main
+
+/*
+#include "cidrsensei.h"
+
+static inline int call_emit(cs_emit emit, uint32_t addr, void *ctx) {
+	return emit(addr, ctx);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// errStopped stops an expansion when its callback returns nonzero.
+var errStopped = errors.New("stopped")
+
+// callEmit calls the C callback emit, which Go cannot call directly.
+func callEmit(emit C.cs_emit, addr uint32, ctx unsafe.Pointer) C.int {
+	return C.call_emit(emit, C.uint32_t(addr), ctx)
+}
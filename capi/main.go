@@ -0,0 +1,123 @@
+// Command capi builds libcidrsensei, a C shared library exposing the range
+// arithmetic of the cidrsensei package to C and to any language with a C
+// foreign function interface:
+//
+//	go build -buildmode=c-shared -o libcidrsensei.so ./capi
+//
+// The build writes libcidrsensei.h, declaring the functions below, next to
+// the library; cidrsensei.h in this directory declares the types they take.
+// Output arrays are allocated by the caller: a function given one that is too
+// small returns CS_ERR_SPACE, with *n set to the length needed.
+package main
+
+/*
+#include <stdlib.h>
+#include "cidrsensei.h"
+*/
+import "C"
+
+import (
+	"net/netip"
+	"unsafe"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+func main() {}
+
+// cs_parse parses a list of CIDR blocks, IPs and address ranges separated by
+// commas or white space into out, in the order given. When it returns
+// CS_ERR_PARSE and err is not NULL, *err is set to the error message, which
+// the caller frees with cs_free.
+//
+//export cs_parse
+func cs_parse(list *C.char, out *C.cs_range, capacity C.size_t, n *C.size_t, err **C.char) C.int {
+	ranges, parseErr := cidrsensei.ParseCIDRs(C.GoString(list))
+	if parseErr != nil {
+		if err != nil {
+			*err = C.CString(parseErr.Error())
+		}
+		return C.CS_ERR_PARSE
+	}
+	return putRanges(ranges, out, capacity, n)
+}
+
+// cs_merge writes the set of the ranges to out: sorted, with overlapping and
+// adjacent ranges joined.
+//
+//export cs_merge
+func cs_merge(in *C.cs_range, length C.size_t, out *C.cs_range, capacity C.size_t, n *C.size_t) C.int {
+	return putRanges(cidrsensei.Merge(getRanges(in, length)), out, capacity, n)
+}
+
+// cs_aggregate writes the fewest CIDR blocks covering the ranges to out, in
+// ascending order.
+//
+//export cs_aggregate
+func cs_aggregate(in *C.cs_range, length C.size_t, out *C.cs_prefix, capacity C.size_t, n *C.size_t) C.int {
+	prefixes := cidrsensei.Prefixes(getRanges(in, length))
+	*n = C.size_t(len(prefixes))
+	if len(prefixes) > int(capacity) {
+		return C.CS_ERR_SPACE
+	}
+	dst := unsafe.Slice(out, len(prefixes))
+	for i, prefix := range prefixes {
+		dst[i] = C.cs_prefix{addr: C.uint32_t(cidrsensei.Uint32(prefix.Addr())), bits: C.uint8_t(prefix.Bits())}
+	}
+	return C.CS_OK
+}
+
+// cs_size returns the number of addresses in the ranges, counting each once.
+//
+//export cs_size
+func cs_size(in *C.cs_range, length C.size_t) C.uint64_t {
+	return C.uint64_t(cidrsensei.Size(cidrsensei.Merge(getRanges(in, length))))
+}
+
+// cs_expand passes each address in the ranges to emit once, in ascending
+// order. It returns CS_OK, or the nonzero value emit returned to stop it.
+//
+//export cs_expand
+func cs_expand(in *C.cs_range, length C.size_t, emit C.cs_emit, ctx unsafe.Pointer) C.int {
+	var status C.int
+	_ = cidrsensei.Expand(getRanges(in, length), func(addr netip.Addr) error {
+		if status = callEmit(emit, cidrsensei.Uint32(addr), ctx); status != 0 {
+			return errStopped
+		}
+		return nil
+	})
+	return status
+}
+
+// cs_free frees memory the library allocated, such as an error message.
+//
+//export cs_free
+func cs_free(p unsafe.Pointer) {
+	C.free(p)
+}
+
+// getRanges copies length ranges from in.
+func getRanges(in *C.cs_range, length C.size_t) []cidrsensei.Range {
+	if length == 0 {
+		return nil
+	}
+	ranges := make([]cidrsensei.Range, length)
+	for i, r := range unsafe.Slice(in, length) {
+		ranges[i] = cidrsensei.Range{Start: uint32(r.start), End: uint32(r.end)}
+	}
+	return ranges
+}
+
+// putRanges copies the ranges to out, when they fit in capacity, and sets *n
+// to their number.
+func putRanges(ranges []cidrsensei.Range, out *C.cs_range, capacity C.size_t, n *C.size_t) C.int {
+	*n = C.size_t(len(ranges))
+	if len(ranges) > int(capacity) {
+		return C.CS_ERR_SPACE
+	}
+	dst := unsafe.Slice(out, len(ranges))
+	for i, r := range ranges {
+		dst[i] = C.cs_range{start: C.uint32_t(r.Start), end: C.uint32_t(r.End)}
+	}
+	return C.CS_OK
+}
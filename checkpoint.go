@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+const defaultCheckpointInterval = 30 * time.Second
+
+// checkpoint records how far an expansion run with -checkpoint got, so that
+// -resume can continue it where it stopped instead of starting over.
+type checkpoint struct {
+	Version string    `json:"version"`
+	Updated time.Time `json:"updated"`
+	// Blocks is the SHA-256 of the merged ranges expanded, which the
+	// expansion resumed must expand too.
+	Blocks string `json:"blocks"`
+	Offset uint64 `json:"offset"`
+	Limit  uint64 `json:"limit"`
+	// Position is the number of IPs of the merged expansion order, from
+	// the first, emitted before the checkpoint was saved. They are the
+	// first RangeOffset IPs of the merged Range, and all those before it.
+	Position    uint64             `json:"position"`
+	Range       string             `json:"range,omitempty"`
+	RangeOffset uint64             `json:"range_offset"`
+	Outputs     []checkpointOutput `json:"outputs"`
+}
+
+// checkpointOutput is the file of an -output, with how much of it was
+// written when the checkpoint was saved.
+type checkpointOutput struct {
+	Format  string `json:"format"`
+	Path    string `json:"path"`
+	Bytes   int64  `json:"bytes"`
+	Records int    `json:"records"`
+}
+
+// resumableSink is a sink whose output can be continued after an
+// interruption. Resume takes up writing to w after the records already
+// written to it, without writing the start of the output again.
+type resumableSink interface {
+	Resume(w io.Writer, records int) error
+}
+
+// checkpointer saves the progress of an expansion to the -checkpoint file
+// at every -checkpoint-interval, and when it is interrupted.
+type checkpointer struct {
+	path     string
+	interval time.Duration
+	index    *rangeIndex
+	state    checkpoint
+	outputs  ipWriters
+	saved    time.Time
+	n        int
+}
+
+// newCheckpointer returns the checkpointer of the expansion of cidrRanges,
+// starting from the -checkpoint file when -resume is given and it exists.
+func newCheckpointer(config Config, cidrRanges []CIDRRange) (*checkpointer, error) {
+	index := newRangeIndex(mergeIPRanges(toIPRanges(cidrRanges)))
+	c := &checkpointer{
+		path:     config.Checkpoint,
+		interval: config.CheckpointInterval,
+		index:    index,
+		saved:    time.Now(),
+		state: checkpoint{
+			Version:  toolVersion(),
+			Blocks:   rangesHash(index.ranges),
+			Offset:   config.Offset,
+			Limit:    config.Limit,
+			Position: config.Offset,
+		},
+	}
+	if !config.Resume {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("no checkpoint to resume from, starting from the first IP", "checkpoint", c.path)
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", c.path, err)
+	}
+	formats := make([]string, 0, len(saved.Outputs))
+	for _, output := range saved.Outputs {
+		formats = append(formats, output.Format)
+	}
+	switch {
+	case saved.Blocks != c.state.Blocks:
+		return nil, fmt.Errorf("the checkpoint %s was saved expanding other blocks", c.path)
+	case saved.Offset != config.Offset || saved.Limit != config.Limit:
+		return nil, fmt.Errorf("the checkpoint %s was saved with -offset=%d and -limit=%d", c.path, saved.Offset, saved.Limit)
+	case !slices.Equal(formats, config.Outputs):
+		return nil, fmt.Errorf("the checkpoint %s was saved writing other outputs (%s)", c.path, strings.Join(formats, ", "))
+	}
+	c.state.Position, c.state.Outputs = saved.Position, saved.Outputs
+	slog.Info("resuming from the checkpoint", "checkpoint", c.path, "position", saved.Position)
+	return c, nil
+}
+
+// resumed returns the outputs to continue, none when starting afresh.
+func (c *checkpointer) resumed() []checkpointOutput {
+	if c == nil {
+		return nil
+	}
+	return c.state.Outputs
+}
+
+// page returns the -offset and -limit of the IPs left to expand, and
+// whether there are none.
+func (c *checkpointer) page() (offset, limit uint64, done bool) {
+	if c.state.Limit == 0 {
+		return c.state.Position, 0, c.state.Position >= c.index.total
+	}
+	end := c.state.Offset + c.state.Limit
+	return c.state.Position, end - c.state.Position, c.state.Position >= min(end, c.index.total)
+}
+
+// track returns emit, counting the IPs emitted and saving the checkpoint
+// every interval.
+func (c *checkpointer) track(emit func(string) error) func(string) error {
+	return func(ip string) error {
+		if err := emit(ip); err != nil {
+			return err
+		}
+		c.state.Position++
+		if c.n++; c.n%interruptCheckInterval == 0 && time.Since(c.saved) >= c.interval {
+			return c.save()
+		}
+		return nil
+	}
+}
+
+// save flushes the outputs and writes the checkpoint file, replacing the
+// previous one at once so that it is never left half written.
+func (c *checkpointer) save() error {
+	c.state.Outputs = c.state.Outputs[:0]
+	for _, w := range c.outputs {
+		output, err := w.checkpoint()
+		if err != nil {
+			return err
+		}
+		c.state.Outputs = append(c.state.Outputs, output)
+	}
+	c.state.Range, c.state.RangeOffset = "", 0
+	if c.state.Position < c.index.total {
+		i := c.index.rangeAt(c.state.Position)
+		c.state.Range, c.state.RangeOffset = c.index.ranges[i].String(), c.state.Position-c.index.offsets[i]
+	}
+	c.state.Updated = time.Now().UTC()
+
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("cannot save the checkpoint: %w", err)
+	}
+	c.saved = time.Now()
+	slog.Debug("checkpoint saved", "checkpoint", c.path, "position", c.state.Position)
+	return nil
+}
+
+// remove deletes the checkpoint of a finished expansion.
+func (c *checkpointer) remove() {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("cannot remove the checkpoint", "checkpoint", c.path, "error", err)
+	}
+}
+
+// rangesHash returns the hex SHA-256 of the bounds of the ranges.
+func rangesHash(ranges []ipRange) string {
+	hash := sha256.New()
+	var buf [8]byte
+	for _, r := range ranges {
+		binary.BigEndian.PutUint32(buf[:4], r.Start)
+		binary.BigEndian.PutUint32(buf[4:], r.End)
+		hash.Write(buf[:])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// checkpointable reports why the outputs of the sink, written to path,
+// cannot be continued by -resume, if they cannot.
+func checkpointable(format string, output outputSinkFormat, sink cidrsensei.OutputSink, path string) error {
+	if _, ok := sink.(resumableSink); !ok || output.writesFile {
+		return fmt.Errorf("the %s output cannot be resumed from a -checkpoint", format)
+	}
+	if path == "" || path == "-" {
+		return fmt.Errorf("the %s output is written to stdout, which cannot be resumed from a -checkpoint (give an -outfile)", format)
+	}
+	return nil
+}
+
+// checkpoint flushes the output to its file and returns how much of it has
+// been written.
+func (w *ipWriter) checkpoint() (checkpointOutput, error) {
+	if err := w.flush(); err != nil {
+		return checkpointOutput{}, err
+	}
+	if err := w.file.Sync(); err != nil {
+		return checkpointOutput{}, err
+	}
+	return checkpointOutput{Format: w.format, Path: w.path, Bytes: w.out.n, Records: w.count}, nil
+}
+
+// resume opens the file of the output again, dropping what was written to
+// it after the checkpoint, and continues writing it after its records.
+func (w *ipWriter) resume(output checkpointOutput) error {
+	sink, ok := w.sink.(resumableSink)
+	if !ok {
+		return fmt.Errorf("the %s output cannot be resumed from a -checkpoint", w.format)
+	}
+	file, err := os.OpenFile(output.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err == nil && info.Size() < output.Bytes {
+		err = fmt.Errorf("%s is shorter than when the checkpoint was saved", output.Path)
+	}
+	if err == nil {
+		err = file.Truncate(output.Bytes)
+	}
+	if err == nil {
+		_, err = file.Seek(output.Bytes, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file, w.path = file, output.Path
+	w.out = &countingWriter{w: file, n: output.Bytes}
+	w.w = bufio.NewWriterSize(w.out, w.bufSize)
+	w.count = output.Records
+	if err := sink.Resume(w.w, output.Records); err != nil {
+		w.closeFile()
+		return err
+	}
+	return nil
+}
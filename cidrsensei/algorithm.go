@@ -0,0 +1,15 @@
+package cidrsensei
+
+// An Algorithm expands ranges into their addresses. The cidr-sensei command
+// selects one with -algorithm, and loads more from Go plugins with
+// -algorithm-plugin.
+type Algorithm interface {
+	// Prepare indexes the ranges of an expansion, and returns the function
+	// expanding each of them. The function may be called from several
+	// goroutines at once.
+	Prepare(ranges []Range) (ExpandFunc, error)
+}
+
+// ExpandFunc passes each address of r covered by the prepared ranges to
+// emit, in ascending order, and stops at the first error emit returns.
+type ExpandFunc func(r Range, emit func(ip uint32) error) error
@@ -0,0 +1,79 @@
+package cidrsensei
+
+import (
+	"iter"
+	"net/netip"
+	"slices"
+)
+
+// Expand passes each address in the ranges to emit once, in ascending
+// order, and stops at the first error emit returns.
+func Expand(ranges []Range, emit func(netip.Addr) error) error {
+	for addr := range All(ranges) {
+		if err := emit(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// All returns an iterator over each address in the ranges once, in
+// ascending order. The addresses are produced as the loop asks for them,
+// without allocating, so ranges of any size can be walked.
+func All(ranges []Range) iter.Seq[netip.Addr] {
+	merged := Merge(ranges)
+	return func(yield func(netip.Addr) bool) {
+		for _, r := range merged {
+			// Iterate in 64 bits so ranges ending at 255.255.255.255 terminate.
+			for ip := uint64(r.Start); ip <= uint64(r.End); ip++ {
+				if !yield(Addr(uint32(ip))) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// An Iterator walks each address in a set of ranges once, in ascending
+// order, for callers that cannot use a range-over-func loop over All:
+//
+//	it := cidrsensei.NewIterator(ranges)
+//	for addr, ok := it.Next(); ok; addr, ok = it.Next() {
+//		...
+//	}
+type Iterator struct {
+	blocks []Range // the ranges as given, which Expand finds the block of each address in
+	ranges []Range // merged
+	next   uint64  // the next address of ranges[0]
+}
+
+// NewIterator returns an Iterator over the addresses in the ranges.
+func NewIterator(ranges []Range) *Iterator {
+	it := &Iterator{blocks: slices.Clone(ranges), ranges: Merge(ranges)}
+	if len(it.ranges) > 0 {
+		it.next = uint64(it.ranges[0].Start)
+	}
+	return it
+}
+
+// Next returns the next address, and false once there are none left.
+func (it *Iterator) Next() (netip.Addr, bool) {
+	if len(it.ranges) == 0 {
+		return netip.Addr{}, false
+	}
+	addr := Addr(uint32(it.next))
+	if it.next++; it.next > uint64(it.ranges[0].End) {
+		if it.ranges = it.ranges[1:]; len(it.ranges) > 0 {
+			it.next = uint64(it.ranges[0].Start)
+		}
+	}
+	return addr, true
+}
+
+// Remaining returns the number of addresses Next has yet to return.
+func (it *Iterator) Remaining() uint64 {
+	if len(it.ranges) == 0 {
+		return 0
+	}
+	return uint64(it.ranges[0].End) - it.next + 1 + Size(it.ranges[1:])
+}
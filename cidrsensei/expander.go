@@ -0,0 +1,153 @@
+package cidrsensei
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+)
+
+// contextCheckInterval is the number of addresses an Expander emits between
+// checks of its context.
+const contextCheckInterval = 4096
+
+// An Expander expands a set of ranges as its Config says:
+//
+//	e, err := cidrsensei.NewExpander(ranges,
+//		cidrsensei.WithExclusions(reserved...),
+//		cidrsensei.WithConcurrency(4),
+//		cidrsensei.WithContext(ctx),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	err = e.Expand(func(addr netip.Addr) error { ... })
+type Expander struct {
+	config Config
+	ranges []Range // merged, without the exclusions
+}
+
+// NewExpander returns the Expander of the ranges with the options applied
+// to the default Config.
+func NewExpander(ranges []Range, opts ...Option) (*Expander, error) {
+	config, err := NewConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewExpanderConfig(ranges, config)
+}
+
+// NewExpanderConfig returns the Expander of the ranges with config, which
+// is validated first.
+func NewExpanderConfig(ranges []Range, config Config) (*Expander, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Expander{config: config, ranges: Subtract(ranges, config.Exclusions)}, nil
+}
+
+// Config returns the Config of the expander.
+func (e *Expander) Config() Config {
+	return e.config
+}
+
+// Size returns the number of addresses Expand emits.
+func (e *Expander) Size() uint64 {
+	return Size(e.ranges)
+}
+
+// Expand passes each address to emit once, and stops at the first error
+// emit returns, or with the error of the context once it is done. With a
+// Concurrency of 1 the addresses are emitted in ascending order; with more,
+// emit is called from several goroutines at once, each emitting a part of
+// the addresses in ascending order.
+func (e *Expander) Expand(emit func(netip.Addr) error) error {
+	ctx, cancel := context.WithCancel(e.config.Context)
+	defer cancel()
+	expand, err := e.config.Algorithm.Prepare(e.ranges)
+	if err != nil {
+		return err
+	}
+
+	parts := splitRanges(e.ranges, e.config.Concurrency)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, part := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := expandPart(ctx, expand, part, emit); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr == nil {
+		return nil
+	}
+	// The workers stopped by the context report it, rather than the
+	// cancellation of the others.
+	if ctxErr := e.config.Context.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return firstErr
+}
+
+// expandPart expands the ranges of a part with expand, checking ctx every
+// contextCheckInterval addresses.
+func expandPart(ctx context.Context, expand ExpandFunc, part []Range, emit func(netip.Addr) error) error {
+	n := 0
+	for _, r := range part {
+		err := expand(r, func(ip uint32) error {
+			if n++; n%contextCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			return emit(Addr(ip))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitRanges splits merged ranges into at most n parts of about as many
+// addresses each, in ascending order.
+func splitRanges(ranges []Range, n int) [][]Range {
+	size := Size(ranges)
+	if size == 0 {
+		return nil
+	}
+	per := (size + uint64(n) - 1) / uint64(n)
+	parts := make([][]Range, 0, n)
+	var part []Range
+	left := per
+	for _, r := range ranges {
+		for {
+			if r.Size() < left {
+				part = append(part, r)
+				left -= r.Size()
+				break
+			}
+			// The part ends within r, or at its end.
+			end := uint32(uint64(r.Start) + left - 1)
+			parts = append(parts, append(part, Range{Start: r.Start, End: end}))
+			part, left = nil, per
+			if end == r.End {
+				break
+			}
+			r.Start = end + 1
+		}
+	}
+	if len(part) > 0 {
+		parts = append(parts, part)
+	}
+	return parts
+}
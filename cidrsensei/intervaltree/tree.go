@@ -0,0 +1,290 @@
+// Package intervaltree stores inclusive intervals of integer keys, each
+// with a value, and finds those containing a key or overlapping an
+// interval, in time logarithmic in the number of intervals plus the number
+// found.
+//
+//	var tree intervaltree.Tree[uint32, string]
+//	tree.Insert(0x0a000000, 0x0affffff, "10.0.0.0/8")
+//	tree.Insert(0x0a010000, 0x0a01ffff, "10.1.0.0/16")
+//	for _, interval := range tree.Stab(0x0a010203) {
+//		fmt.Println(interval.Value) // 10.0.0.0/8, then 10.1.0.0/16
+//	}
+//
+// The tree is an AVL tree of the intervals ordered by their start and end,
+// each node augmented with the highest end of its subtree.
+package intervaltree
+
+import (
+	"fmt"
+	"iter"
+)
+
+// Integer is the constraint of the keys of a Tree.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Interval is the inclusive interval of the keys from Start to End, with
+// its value.
+type Interval[K Integer, V any] struct {
+	Start, End K
+	Value      V
+}
+
+// Contains reports whether key is in the interval.
+func (i Interval[K, V]) Contains(key K) bool {
+	return i.Start <= key && key <= i.End
+}
+
+// Tree is a set of intervals, which may overlap, with a value each. The
+// zero value is an empty tree. A Tree is not safe for concurrent use while
+// it is modified.
+type Tree[K Integer, V any] struct {
+	root *node[K, V]
+	len  int
+}
+
+type node[K Integer, V any] struct {
+	interval    Interval[K, V]
+	maxEnd      K // the highest end in the subtree
+	height      int
+	left, right *node[K, V]
+}
+
+// Len returns the number of intervals in the tree.
+func (t *Tree[K, V]) Len() int {
+	return t.len
+}
+
+// Insert adds the interval from start to end with its value, replacing the
+// value of the interval when it is already in the tree. It returns an
+// error, and leaves the tree unchanged, when start is after end.
+func (t *Tree[K, V]) Insert(start, end K, value V) error {
+	if start > end {
+		return fmt.Errorf("invalid interval [%d, %d]: its start is after its end", start, end)
+	}
+	var added bool
+	t.root = insert(t.root, Interval[K, V]{Start: start, End: end, Value: value}, &added)
+	if added {
+		t.len++
+	}
+	return nil
+}
+
+// Delete removes the interval from start to end, and reports whether it
+// was in the tree.
+func (t *Tree[K, V]) Delete(start, end K) bool {
+	var deleted bool
+	t.root = remove(t.root, start, end, &deleted)
+	if deleted {
+		t.len--
+	}
+	return deleted
+}
+
+// Get returns the value of the interval from start to end, and whether it
+// is in the tree.
+func (t *Tree[K, V]) Get(start, end K) (V, bool) {
+	for n := t.root; n != nil; {
+		switch c := compare(start, end, n.interval); {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n.interval.Value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Stab returns the intervals containing key, ordered by their start and
+// end.
+func (t *Tree[K, V]) Stab(key K) []Interval[K, V] {
+	return t.RangeQuery(key, key)
+}
+
+// RangeQuery returns the intervals overlapping the interval from start to
+// end, ordered by their start and end. It returns none when start is after
+// end.
+func (t *Tree[K, V]) RangeQuery(start, end K) []Interval[K, V] {
+	var found []Interval[K, V]
+	if start <= end {
+		overlapping(t.root, start, end, &found)
+	}
+	return found
+}
+
+// Overlaps reports whether an interval of the tree overlaps the interval
+// from start to end, without collecting them as RangeQuery does.
+func (t *Tree[K, V]) Overlaps(start, end K) bool {
+	for n := t.root; n != nil && start <= end; {
+		switch {
+		case n.interval.Start <= end && start <= n.interval.End:
+			return true
+		case n.left != nil && n.left.maxEnd >= start:
+			// When the left subtree holds no overlap, neither does the
+			// right one: its intervals start after those on the left that
+			// reach start, so after end.
+			n = n.left
+		case n.interval.Start > end:
+			return false
+		default:
+			n = n.right
+		}
+	}
+	return false
+}
+
+// All returns an iterator over the intervals, ordered by their start and
+// end. The tree must not be modified during the iteration.
+func (t *Tree[K, V]) All() iter.Seq[Interval[K, V]] {
+	return func(yield func(Interval[K, V]) bool) {
+		walk(t.root, yield)
+	}
+}
+
+// compare orders the interval from start to end against i.
+func compare[K Integer, V any](start, end K, i Interval[K, V]) int {
+	switch {
+	case start < i.Start:
+		return -1
+	case start > i.Start:
+		return 1
+	case end < i.End:
+		return -1
+	case end > i.End:
+		return 1
+	}
+	return 0
+}
+
+func insert[K Integer, V any](n *node[K, V], interval Interval[K, V], added *bool) *node[K, V] {
+	if n == nil {
+		*added = true
+		return &node[K, V]{interval: interval, maxEnd: interval.End, height: 1}
+	}
+	switch c := compare(interval.Start, interval.End, n.interval); {
+	case c < 0:
+		n.left = insert(n.left, interval, added)
+	case c > 0:
+		n.right = insert(n.right, interval, added)
+	default:
+		n.interval.Value = interval.Value
+		return n
+	}
+	return rebalance(n)
+}
+
+func remove[K Integer, V any](n *node[K, V], start, end K, deleted *bool) *node[K, V] {
+	if n == nil {
+		return nil
+	}
+	switch c := compare(start, end, n.interval); {
+	case c < 0:
+		n.left = remove(n.left, start, end, deleted)
+	case c > 0:
+		n.right = remove(n.right, start, end, deleted)
+	default:
+		*deleted = true
+		if n.left == nil {
+			return n.right
+		}
+		if n.right == nil {
+			return n.left
+		}
+		// Replace the interval with the next one, taken from the right.
+		var next *node[K, V]
+		n.right = removeMin(n.right, &next)
+		n.interval = next.interval
+	}
+	return rebalance(n)
+}
+
+// removeMin removes the first node of the subtree n into min.
+func removeMin[K Integer, V any](n *node[K, V], min **node[K, V]) *node[K, V] {
+	if n.left == nil {
+		*min = n
+		return n.right
+	}
+	n.left = removeMin(n.left, min)
+	return rebalance(n)
+}
+
+func overlapping[K Integer, V any](n *node[K, V], start, end K, found *[]Interval[K, V]) {
+	if n == nil || n.maxEnd < start {
+		return
+	}
+	overlapping(n.left, start, end, found)
+	if n.interval.Start > end {
+		// The intervals on the right start after end too.
+		return
+	}
+	if n.interval.End >= start {
+		*found = append(*found, n.interval)
+	}
+	overlapping(n.right, start, end, found)
+}
+
+func walk[K Integer, V any](n *node[K, V], yield func(Interval[K, V]) bool) bool {
+	if n == nil {
+		return true
+	}
+	return walk(n.left, yield) && yield(n.interval) && walk(n.right, yield)
+}
+
+func height[K Integer, V any](n *node[K, V]) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// update recomputes the height and highest end of n from its children.
+func update[K Integer, V any](n *node[K, V]) {
+	n.height = 1 + max(height(n.left), height(n.right))
+	n.maxEnd = n.interval.End
+	if n.left != nil {
+		n.maxEnd = max(n.maxEnd, n.left.maxEnd)
+	}
+	if n.right != nil {
+		n.maxEnd = max(n.maxEnd, n.right.maxEnd)
+	}
+}
+
+// rebalance updates n and rotates it when its subtrees differ in height by
+// more than one, returning the root of the subtree.
+func rebalance[K Integer, V any](n *node[K, V]) *node[K, V] {
+	update(n)
+	switch balance := height(n.left) - height(n.right); {
+	case balance > 1:
+		if height(n.left.left) < height(n.left.right) {
+			n.left = rotateLeft(n.left)
+		}
+		return rotateRight(n)
+	case balance < -1:
+		if height(n.right.right) < height(n.right.left) {
+			n.right = rotateRight(n.right)
+		}
+		return rotateLeft(n)
+	}
+	return n
+}
+
+func rotateLeft[K Integer, V any](n *node[K, V]) *node[K, V] {
+	r := n.right
+	n.right, r.left = r.left, n
+	update(n)
+	update(r)
+	return r
+}
+
+func rotateRight[K Integer, V any](n *node[K, V]) *node[K, V] {
+	l := n.left
+	n.left, l.right = l.right, n
+	update(n)
+	update(l)
+	return l
+}
@@ -0,0 +1,183 @@
+package intervaltree
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// oracle is the brute-force model of a Tree: its intervals in a slice.
+type oracle []Interval[uint8, int]
+
+func (o *oracle) insert(start, end uint8, value int) {
+	for i := range *o {
+		if (*o)[i].Start == start && (*o)[i].End == end {
+			(*o)[i].Value = value
+			return
+		}
+	}
+	*o = append(*o, Interval[uint8, int]{Start: start, End: end, Value: value})
+}
+
+func (o *oracle) delete(start, end uint8) bool {
+	for i := range *o {
+		if (*o)[i].Start == start && (*o)[i].End == end {
+			*o = slices.Delete(*o, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// overlapping returns the intervals overlapping start to end, ordered as
+// the tree orders them.
+func (o oracle) overlapping(start, end uint8) []Interval[uint8, int] {
+	var found []Interval[uint8, int]
+	for _, i := range o {
+		if i.Start <= end && start <= i.End {
+			found = append(found, i)
+		}
+	}
+	sortIntervals(found)
+	return found
+}
+
+func sortIntervals(intervals []Interval[uint8, int]) {
+	slices.SortFunc(intervals, func(a, b Interval[uint8, int]) int {
+		return compare(a.Start, a.End, b)
+	})
+}
+
+// checkInvariants fails the test unless every node of the tree is balanced,
+// ordered and has its height and highest end right, returning the height.
+func checkInvariants[K Integer, V any](t *testing.T, n *node[K, V]) int {
+	t.Helper()
+	if n == nil {
+		return 0
+	}
+	lh, rh := checkInvariants(t, n.left), checkInvariants(t, n.right)
+	if lh-rh > 1 || rh-lh > 1 {
+		t.Fatalf("node [%d, %d] is unbalanced: %d on the left, %d on the right", n.interval.Start, n.interval.End, lh, rh)
+	}
+	if n.height != 1+max(lh, rh) {
+		t.Fatalf("node [%d, %d] has the height %d, not %d", n.interval.Start, n.interval.End, n.height, 1+max(lh, rh))
+	}
+	maxEnd := n.interval.End
+	if n.left != nil {
+		if compare(n.left.interval.Start, n.left.interval.End, n.interval) >= 0 {
+			t.Fatalf("node [%d, %d] has [%d, %d] on its left", n.interval.Start, n.interval.End, n.left.interval.Start, n.left.interval.End)
+		}
+		maxEnd = max(maxEnd, n.left.maxEnd)
+	}
+	if n.right != nil {
+		if compare(n.right.interval.Start, n.right.interval.End, n.interval) <= 0 {
+			t.Fatalf("node [%d, %d] has [%d, %d] on its right", n.interval.Start, n.interval.End, n.right.interval.Start, n.right.interval.End)
+		}
+		maxEnd = max(maxEnd, n.right.maxEnd)
+	}
+	if n.maxEnd != maxEnd {
+		t.Fatalf("node [%d, %d] has the highest end %d, not %d", n.interval.Start, n.interval.End, n.maxEnd, maxEnd)
+	}
+	return n.height
+}
+
+func TestTreeAgainstOracle(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var tree Tree[uint8, int]
+	var model oracle
+	for step := range 4000 {
+		start := uint8(r.Intn(256))
+		end := start + uint8(r.Intn(256-int(start)))
+		// Delete about as often as insert, so that the tree rebalances on
+		// the way down as well as up.
+		if r.Intn(2) == 0 && len(model) > 0 {
+			if r.Intn(4) > 0 {
+				i := model[r.Intn(len(model))]
+				start, end = i.Start, i.End
+			}
+			if got, want := tree.Delete(start, end), model.delete(start, end); got != want {
+				t.Fatalf("step %d: Delete(%d, %d) = %v, want %v", step, start, end, got, want)
+			}
+		} else {
+			if err := tree.Insert(start, end, step); err != nil {
+				t.Fatalf("step %d: Insert(%d, %d): %v", step, start, end, err)
+			}
+			model.insert(start, end, step)
+		}
+		checkInvariants(t, tree.root)
+		if tree.Len() != len(model) {
+			t.Fatalf("step %d: Len() = %d, want %d", step, tree.Len(), len(model))
+		}
+
+		key := uint8(r.Intn(256))
+		if got, want := tree.Stab(key), model.overlapping(key, key); !slices.Equal(got, want) {
+			t.Fatalf("step %d: Stab(%d) = %v, want %v", step, key, got, want)
+		}
+		qStart := uint8(r.Intn(256))
+		qEnd := qStart + uint8(r.Intn(256-int(qStart)))
+		want := model.overlapping(qStart, qEnd)
+		if got := tree.RangeQuery(qStart, qEnd); !slices.Equal(got, want) {
+			t.Fatalf("step %d: RangeQuery(%d, %d) = %v, want %v", step, qStart, qEnd, got, want)
+		}
+		if got := tree.Overlaps(qStart, qEnd); got != (len(want) > 0) {
+			t.Fatalf("step %d: Overlaps(%d, %d) = %v, want %v", step, qStart, qEnd, got, len(want) > 0)
+		}
+	}
+
+	all := slices.Collect(tree.All())
+	want := slices.Clone(model)
+	sortIntervals(want)
+	if !slices.Equal(all, want) {
+		t.Fatalf("All() = %v, want %v", all, want)
+	}
+	for _, i := range model {
+		if value, ok := tree.Get(i.Start, i.End); !ok || value != i.Value {
+			t.Fatalf("Get(%d, %d) = %d, %v, want %d, true", i.Start, i.End, value, ok, i.Value)
+		}
+	}
+}
+
+func TestDeleteRebalances(t *testing.T) {
+	var tree Tree[int, struct{}]
+	const n = 1 << 10
+	for i := range n {
+		if err := tree.Insert(i, i+10, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Deleting every interval from one end leaves the tree lopsided unless
+	// it is rotated back into balance.
+	for i := range n - 1 {
+		if !tree.Delete(i, i+10) {
+			t.Fatalf("Delete(%d, %d) = false, want true", i, i+10)
+		}
+		checkInvariants(t, tree.root)
+	}
+	if tree.Len() != 1 || tree.root.interval.Start != n-1 {
+		t.Fatalf("the tree holds %d intervals, want [%d, %d] alone", tree.Len(), n-1, n+9)
+	}
+	if tree.Delete(0, 10) {
+		t.Fatal("Delete of an interval not in the tree = true, want false")
+	}
+}
+
+func TestInsert(t *testing.T) {
+	var tree Tree[uint32, string]
+	if err := tree.Insert(10, 5, "reversed"); err == nil {
+		t.Fatal("Insert(10, 5) succeeded, want an error")
+	}
+	if tree.Len() != 0 {
+		t.Fatalf("Len() = %d after a failed Insert, want 0", tree.Len())
+	}
+	for _, value := range []string{"first", "second"} {
+		if err := tree.Insert(1, 2, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, ok := tree.Get(1, 2); tree.Len() != 1 || !ok || value != "second" {
+		t.Fatalf("Insert of an interval already in the tree left %d intervals, the value %q, want 1 and \"second\"", tree.Len(), value)
+	}
+	if found := tree.RangeQuery(3, 2); found != nil {
+		t.Fatalf("RangeQuery(3, 2) = %v, want none", found)
+	}
+}
@@ -0,0 +1,124 @@
+package cidrsensei
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Config is how an Expander expands its ranges. Build one with NewConfig,
+// which starts from the defaults and validates the result, rather than
+// filling it in directly, so that options added later keep their defaults.
+type Config struct {
+	// Concurrency is the number of goroutines expanding at once, 1 by
+	// default.
+	Concurrency int
+	// Algorithm expands the ranges, merging them and walking the addresses
+	// of each by default.
+	Algorithm Algorithm
+	// Exclusions are the ranges whose addresses are left out.
+	Exclusions []Range
+	// Context stops the expansion when it is done, context.Background by
+	// default.
+	Context context.Context
+}
+
+// An Option sets a field of a Config, returning an error for a value it
+// cannot take.
+type Option func(*Config) error
+
+// NewConfig returns the default Config with the options applied, in the
+// order given, or the first error an option or the validation returns.
+func NewConfig(opts ...Option) (Config, error) {
+	c := Config{Concurrency: 1, Algorithm: mergedAlgorithm{}, Context: context.Background()}
+	for _, opt := range opts {
+		if err := opt(&c); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// Validate reports the first field of c that cannot be expanded with.
+func (c Config) Validate() error {
+	switch {
+	case c.Concurrency < 1:
+		return fmt.Errorf("invalid concurrency %d: it must be at least 1", c.Concurrency)
+	case c.Algorithm == nil:
+		return errors.New("no algorithm given")
+	case c.Context == nil:
+		return errors.New("no context given")
+	}
+	for _, r := range c.Exclusions {
+		if r.Start > r.End {
+			return fmt.Errorf("invalid exclusion %s: its start is after its end", r)
+		}
+	}
+	return nil
+}
+
+// WithConcurrency expands with n goroutines at once, which call the emit
+// function of the expansion concurrently, and in no particular order, when
+// n is more than 1.
+func WithConcurrency(n int) Option {
+	return func(c *Config) error {
+		if n < 1 {
+			return fmt.Errorf("invalid concurrency %d: it must be at least 1", n)
+		}
+		c.Concurrency = n
+		return nil
+	}
+}
+
+// WithAlgorithm expands with algorithm.
+func WithAlgorithm(algorithm Algorithm) Option {
+	return func(c *Config) error {
+		if algorithm == nil {
+			return errors.New("no algorithm given")
+		}
+		c.Algorithm = algorithm
+		return nil
+	}
+}
+
+// WithExclusions leaves out the addresses of the ranges, adding to those of
+// earlier WithExclusions options.
+func WithExclusions(ranges ...Range) Option {
+	return func(c *Config) error {
+		c.Exclusions = append(c.Exclusions, ranges...)
+		return nil
+	}
+}
+
+// WithContext stops the expansion with the error of ctx when it is done.
+func WithContext(ctx context.Context) Option {
+	return func(c *Config) error {
+		if ctx == nil {
+			return errors.New("no context given")
+		}
+		c.Context = ctx
+		return nil
+	}
+}
+
+// mergedAlgorithm is the default Algorithm, expanding the addresses of each
+// range the ranges prepared cover.
+type mergedAlgorithm struct{}
+
+func (mergedAlgorithm) Prepare(ranges []Range) (ExpandFunc, error) {
+	merged := Merge(ranges)
+	return func(r Range, emit func(uint32) error) error {
+		for _, covered := range Intersect([]Range{r}, merged) {
+			// Iterate in 64 bits so ranges ending at 255.255.255.255 terminate.
+			for ip := uint64(covered.Start); ip <= uint64(covered.End); ip++ {
+				if err := emit(uint32(ip)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,72 @@
+package cidrsensei
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParseCIDR parses a CIDR block such as 10.0.0.0/8, a single address such
+// as 10.0.0.1, or an inclusive address range such as 10.0.0.1-10.0.0.9.
+// Host bits set in a CIDR block are ignored, so 10.0.0.1/8 is 10.0.0.0/8.
+func ParseCIDR(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	if first, last, ok := strings.Cut(s, "-"); ok {
+		start, err := parseAddr(first)
+		if err != nil {
+			return Range{}, fmt.Errorf("error parsing address range %s: %w", s, err)
+		}
+		end, err := parseAddr(last)
+		if err != nil {
+			return Range{}, fmt.Errorf("error parsing address range %s: %w", s, err)
+		}
+		if start > end {
+			return Range{}, fmt.Errorf("error parsing address range %s: %s is after %s", s, first, last)
+		}
+		return Range{Start: start, End: end}, nil
+	}
+	if !strings.Contains(s, "/") {
+		ip, err := parseAddr(s)
+		if err != nil {
+			return Range{}, err
+		}
+		return Range{Start: ip, End: ip}, nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return Range{}, fmt.Errorf("error parsing CIDR %s: %w", s, err)
+	}
+	if !prefix.Addr().Is4() {
+		return Range{}, fmt.Errorf("error parsing CIDR %s: IPv6 is not supported", s)
+	}
+	return RangeOf(prefix)
+}
+
+// ParseCIDRs parses a list of the entries ParseCIDR takes, separated by
+// commas or white space, returning them in the order given.
+func ParseCIDRs(list string) ([]Range, error) {
+	fields := strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	ranges := make([]Range, 0, len(fields))
+	for _, field := range fields {
+		r, err := ParseCIDR(field)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// parseAddr parses an IPv4 address into its integer value.
+func parseAddr(s string) (uint32, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid IP address: %s", s)
+	}
+	if !addr.Is4() {
+		return 0, fmt.Errorf("invalid IP address: %s (IPv6 is not supported)", s)
+	}
+	return Uint32(addr), nil
+}
@@ -0,0 +1,220 @@
+// Package radixtrie stores IPv4 prefixes, each with a value, and finds the
+// longest of them containing an address, or all of them, in time bounded by
+// the 32 bits of the address whatever the number of prefixes.
+//
+//	var trie radixtrie.Trie[string]
+//	trie.Insert(0x0a000000, 8, "10.0.0.0/8")
+//	trie.Insert(0x0a010000, 16, "10.1.0.0/16")
+//	if prefix, ok := trie.Lookup(0x0a010203); ok {
+//		fmt.Println(prefix.Value) // 10.1.0.0/16
+//	}
+//
+// The trie is a binary trie of the bits of the prefixes, compressed so that
+// each node either holds a prefix or joins two subtries.
+package radixtrie
+
+import (
+	"fmt"
+	"iter"
+	"math/bits"
+)
+
+// Prefix is the prefix of the Bits leading bits of Addr, with its value.
+type Prefix[V any] struct {
+	Addr  uint32
+	Bits  int
+	Value V
+}
+
+// Contains reports whether ip is in the prefix.
+func (p Prefix[V]) Contains(ip uint32) bool {
+	return ip&mask(p.Bits) == p.Addr
+}
+
+// Trie is a set of prefixes, which may be nested, with a value each. The
+// zero value is an empty trie. A Trie is not safe for concurrent use while
+// it is modified.
+type Trie[V any] struct {
+	root *node[V]
+	len  int
+}
+
+type node[V any] struct {
+	prefix Prefix[V]
+	set    bool // the prefix was inserted, rather than the node joining two subtries
+	child  [2]*node[V]
+}
+
+// Len returns the number of prefixes in the trie.
+func (t *Trie[V]) Len() int {
+	return t.len
+}
+
+// Insert adds the prefix of the bits leading bits of addr with its value,
+// replacing the value of the prefix when it is already in the trie. It
+// returns an error, and leaves the trie unchanged, when bits is not from 0
+// to 32 or addr has bits set after them.
+func (t *Trie[V]) Insert(addr uint32, bits int, value V) error {
+	if bits < 0 || bits > 32 {
+		return fmt.Errorf("invalid prefix length %d: it must be from 0 to 32", bits)
+	}
+	if addr&^mask(bits) != 0 {
+		return fmt.Errorf("invalid prefix %#08x/%d: it has bits set after its length", addr, bits)
+	}
+	inserted := &node[V]{prefix: Prefix[V]{Addr: addr, Bits: bits, Value: value}, set: true}
+	for p := &t.root; ; {
+		n := *p
+		if n == nil {
+			*p = inserted
+			t.len++
+			return nil
+		}
+		switch common := commonBits(addr, bits, n.prefix); {
+		case common == bits && common == n.prefix.Bits:
+			if !n.set {
+				t.len++
+			}
+			n.prefix.Value, n.set = value, true
+			return nil
+		case common == n.prefix.Bits:
+			p = &n.child[bit(addr, common)]
+		case common == bits:
+			// The prefix contains n.
+			inserted.child[bit(n.prefix.Addr, common)] = n
+			*p = inserted
+			t.len++
+			return nil
+		default:
+			// The prefix and n diverge after their common bits, so they are
+			// joined under a node of those.
+			join := &node[V]{prefix: Prefix[V]{Addr: addr & mask(common), Bits: common}}
+			join.child[bit(addr, common)] = inserted
+			join.child[bit(n.prefix.Addr, common)] = n
+			*p = join
+			t.len++
+			return nil
+		}
+	}
+}
+
+// Delete removes the prefix of the bits leading bits of addr, and reports
+// whether it was in the trie.
+func (t *Trie[V]) Delete(addr uint32, bits int) bool {
+	var parent **node[V]
+	for p := &t.root; *p != nil && bits >= 0 && bits <= 32; {
+		n := *p
+		if commonBits(addr, bits, n.prefix) < n.prefix.Bits {
+			return false
+		}
+		if n.prefix.Bits < bits {
+			parent, p = p, &n.child[bit(addr, n.prefix.Bits)]
+			continue
+		}
+		if n.prefix.Bits > bits || !n.set {
+			return false
+		}
+		t.len--
+		switch {
+		case n.child[0] != nil && n.child[1] != nil:
+			// n still joins its subtries.
+			var zero V
+			n.prefix.Value, n.set = zero, false
+		case n.child[0] != nil:
+			*p = n.child[0]
+		default:
+			*p = n.child[1]
+		}
+		// A joining parent left with one subtrie is replaced by it.
+		if *p == nil && parent != nil && !(*parent).set {
+			pn := *parent
+			*parent = pn.child[0]
+			if *parent == nil {
+				*parent = pn.child[1]
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Get returns the value of the prefix of the bits leading bits of addr, and
+// whether it is in the trie.
+func (t *Trie[V]) Get(addr uint32, bits int) (V, bool) {
+	for n := t.root; n != nil && bits >= 0 && bits <= 32 && commonBits(addr, bits, n.prefix) == n.prefix.Bits; {
+		if n.prefix.Bits == bits {
+			return n.prefix.Value, n.set
+		}
+		n = n.child[bit(addr, n.prefix.Bits)]
+	}
+	var zero V
+	return zero, false
+}
+
+// Lookup returns the longest prefix containing ip, and whether there is
+// one.
+func (t *Trie[V]) Lookup(ip uint32) (Prefix[V], bool) {
+	var found *node[V]
+	t.walk(ip, func(n *node[V]) { found = n })
+	if found == nil {
+		return Prefix[V]{}, false
+	}
+	return found.prefix, true
+}
+
+// Matches returns the prefixes containing ip, from the shortest to the
+// longest.
+func (t *Trie[V]) Matches(ip uint32) []Prefix[V] {
+	var found []Prefix[V]
+	t.walk(ip, func(n *node[V]) { found = append(found, n.prefix) })
+	return found
+}
+
+// All returns an iterator over the prefixes, ordered by their address and,
+// for the same address, from the shortest. The trie must not be modified
+// during the iteration.
+func (t *Trie[V]) All() iter.Seq[Prefix[V]] {
+	return func(yield func(Prefix[V]) bool) {
+		walkAll(t.root, yield)
+	}
+}
+
+// walk calls visit with each node holding a prefix containing ip, from the
+// root down.
+func (t *Trie[V]) walk(ip uint32, visit func(*node[V])) {
+	for n := t.root; n != nil && ip&mask(n.prefix.Bits) == n.prefix.Addr; {
+		if n.set {
+			visit(n)
+		}
+		if n.prefix.Bits == 32 {
+			return
+		}
+		n = n.child[bit(ip, n.prefix.Bits)]
+	}
+}
+
+func walkAll[V any](n *node[V], yield func(Prefix[V]) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.set && !yield(n.prefix) {
+		return false
+	}
+	return walkAll(n.child[0], yield) && walkAll(n.child[1], yield)
+}
+
+// mask returns the mask of the bits leading bits.
+func mask(bits int) uint32 {
+	return ^uint32(0) << (32 - bits)
+}
+
+// bit returns the bit of addr after its i leading bits, which picks the
+// child of a node of i bits.
+func bit(addr uint32, i int) int {
+	return int(addr >> (31 - i) & 1)
+}
+
+// commonBits returns the number of leading bits the prefix of the bits
+// leading bits of addr shares with p.
+func commonBits[V any](addr uint32, n int, p Prefix[V]) int {
+	return min(bits.LeadingZeros32(addr^p.Addr), n, p.Bits)
+}
@@ -0,0 +1,190 @@
+package radixtrie
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+func TestLookup(t *testing.T) {
+	var trie Trie[string]
+	for _, p := range []struct {
+		addr uint32
+		bits int
+	}{
+		{0x0a000000, 8},  // 10.0.0.0/8
+		{0x0a010000, 16}, // 10.1.0.0/16
+		{0x0a010200, 24}, // 10.1.2.0/24
+		{0x0a010203, 32}, // 10.1.2.3/32
+		{0xc0a80000, 16}, // 192.168.0.0/16
+	} {
+		if err := trie.Insert(p.addr, p.bits, cidrsensei.Addr(p.addr).String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		ip      uint32
+		longest string
+		matches int
+	}{
+		{0x0a010203, "10.1.2.3", 4},
+		{0x0a010204, "10.1.2.0", 3},
+		{0x0a01ff00, "10.1.0.0", 2},
+		{0x0aff0000, "10.0.0.0", 1},
+		{0xc0a8ffff, "192.168.0.0", 1},
+		{0x08080808, "", 0},
+	}
+	for _, tt := range tests {
+		prefix, ok := trie.Lookup(tt.ip)
+		if ok != (tt.longest != "") || prefix.Value != tt.longest {
+			t.Errorf("Lookup(%s) = %q, %v, want %q", cidrsensei.Addr(tt.ip), prefix.Value, ok, tt.longest)
+		}
+		matches := trie.Matches(tt.ip)
+		if len(matches) != tt.matches {
+			t.Errorf("Matches(%s) = %v, want %d prefixes", cidrsensei.Addr(tt.ip), matches, tt.matches)
+		}
+		if !slices.IsSortedFunc(matches, func(a, b Prefix[string]) int { return a.Bits - b.Bits }) {
+			t.Errorf("Matches(%s) = %v, not from the shortest", cidrsensei.Addr(tt.ip), matches)
+		}
+	}
+}
+
+func TestInsert(t *testing.T) {
+	var trie Trie[int]
+	if err := trie.Insert(0x0a000001, 8, 0); err == nil {
+		t.Error("Insert(10.0.0.1/8) succeeded, want an error for its host bits")
+	}
+	if err := trie.Insert(0, 33, 0); err == nil {
+		t.Error("Insert(0.0.0.0/33) succeeded, want an error")
+	}
+	if trie.Len() != 0 {
+		t.Fatalf("Len() = %d after failed inserts, want 0", trie.Len())
+	}
+
+	// The default route, and a prefix inserted again with another value.
+	for i, p := range []struct {
+		addr uint32
+		bits int
+	}{{0, 0}, {0x0a000000, 8}, {0x0a000000, 8}} {
+		if err := trie.Insert(p.addr, p.bits, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if trie.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", trie.Len())
+	}
+	if value, ok := trie.Get(0x0a000000, 8); !ok || value != 2 {
+		t.Errorf("Get(10.0.0.0/8) = %d, %v, want the value inserted last, 2", value, ok)
+	}
+	if prefix, ok := trie.Lookup(0x08080808); !ok || prefix.Bits != 0 {
+		t.Errorf("Lookup(8.8.8.8) = %v, %v, want the default route", prefix, ok)
+	}
+	if !trie.Delete(0, 0) || trie.Delete(0, 0) {
+		t.Error("Delete(0.0.0.0/0) did not delete the default route once")
+	}
+	if _, ok := trie.Lookup(0x08080808); ok {
+		t.Error("Lookup(8.8.8.8) found a prefix after the default route was deleted")
+	}
+}
+
+// TestInsertRange inserts ranges that are not a single prefix as the
+// prefixes covering them, as -algorithm=radix-trie does, and looks up every
+// address in and around them.
+func TestInsertRange(t *testing.T) {
+	ranges := []cidrsensei.Range{
+		{Start: 0x0a000001, End: 0x0a000009}, // 10.0.0.1-10.0.0.9
+		{Start: 0x0a0000fe, End: 0x0a000201}, // 10.0.0.254-10.0.2.1
+		{Start: 0x0a000005, End: 0x0a000005}, // 10.0.0.5, within the first
+		{Start: 0xfffffff0, End: 0xffffffff}, // up to the last address
+	}
+	var trie Trie[int]
+	for i, r := range ranges {
+		for _, prefix := range r.Prefixes() {
+			if err := trie.Insert(cidrsensei.Uint32(prefix.Addr()), prefix.Bits(), i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check := func(ip uint32) {
+		// The most specific range is the smallest containing ip.
+		want := -1
+		for i, r := range ranges {
+			if r.Start <= ip && ip <= r.End && (want < 0 || r.Size() < ranges[want].Size()) {
+				want = i
+			}
+		}
+		prefix, ok := trie.Lookup(ip)
+		if ok != (want >= 0) || ok && prefix.Value != want {
+			t.Errorf("Lookup(%s) = %v, %v, want the range %d", cidrsensei.Addr(ip), prefix, ok, want)
+		}
+	}
+	for ip := uint32(0x0a000000); ip <= 0x0a000300; ip++ {
+		check(ip)
+	}
+	for ip := uint64(0xffffffe0); ip <= 0xffffffff; ip++ {
+		check(uint32(ip))
+	}
+}
+
+func TestAgainstOracle(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for range 50 {
+		var trie Trie[int]
+		model := map[Prefix[struct{}]]int{}
+		for i := range 300 {
+			bits := r.Intn(33)
+			// Few distinct leading bits, so that the prefixes nest.
+			addr := r.Uint32() & 0xff0f0000 & mask(bits)
+			key := Prefix[struct{}]{Addr: addr, Bits: bits}
+			if r.Intn(3) == 0 {
+				_, in := model[key]
+				if trie.Delete(addr, bits) != in {
+					t.Fatalf("Delete(%#08x/%d) = %v, want %v", addr, bits, !in, in)
+				}
+				delete(model, key)
+			} else {
+				if err := trie.Insert(addr, bits, i); err != nil {
+					t.Fatal(err)
+				}
+				model[key] = i
+			}
+			if trie.Len() != len(model) {
+				t.Fatalf("Len() = %d, want %d", trie.Len(), len(model))
+			}
+		}
+
+		var last Prefix[int]
+		n := 0
+		for p := range trie.All() {
+			if n > 0 && (p.Addr < last.Addr || p.Addr == last.Addr && p.Bits <= last.Bits) {
+				t.Fatalf("All() yields %v after %v", p, last)
+			}
+			if value, ok := model[Prefix[struct{}]{Addr: p.Addr, Bits: p.Bits}]; !ok || value != p.Value {
+				t.Fatalf("All() yields %v, not in the model", p)
+			}
+			last, n = p, n+1
+		}
+		if n != len(model) {
+			t.Fatalf("All() yields %d prefixes, want %d", n, len(model))
+		}
+
+		for range 1000 {
+			ip := r.Uint32() & 0xff0fffff
+			var want []Prefix[int]
+			for bits := 0; bits <= 32; bits++ {
+				if value, ok := model[Prefix[struct{}]{Addr: ip & mask(bits), Bits: bits}]; ok {
+					want = append(want, Prefix[int]{Addr: ip & mask(bits), Bits: bits, Value: value})
+				}
+			}
+			if got := trie.Matches(ip); !slices.Equal(got, want) {
+				t.Fatalf("Matches(%s) = %v, want %v", cidrsensei.Addr(ip), got, want)
+			}
+			longest, ok := trie.Lookup(ip)
+			if ok != (len(want) > 0) || ok && longest != want[len(want)-1] {
+				t.Fatalf("Lookup(%s) = %v, %v, want the last of %v", cidrsensei.Addr(ip), longest, ok, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package cidrsensei parses, merges, combines and expands sets of IPv4
+// addresses given as CIDR blocks, the range arithmetic the cidr-sensei
+// command is built on.
+//
+// A set of addresses is a slice of inclusive Ranges. The functions taking
+// a set accept ranges in any order, overlapping or not, and those returning
+// one return it merged: sorted, with no two ranges overlapping or adjacent.
+//
+//	ranges, err := cidrsensei.ParseCIDRs("10.0.0.0/8,192.168.1.0/24")
+//	if err != nil {
+//		return err
+//	}
+//	allowed := cidrsensei.Subtract(ranges, []cidrsensei.Range{{Start: 0x0a000000, End: 0x0a0000ff}})
+//	for _, prefix := range cidrsensei.Prefixes(allowed) {
+//		fmt.Println(prefix)
+//	}
+package cidrsensei
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"net/netip"
+	"sort"
+)
+
+// Range is an inclusive range of IPv4 addresses, as their 32-bit integer
+// values.
+type Range struct {
+	Start, End uint32
+}
+
+// RangeOf returns the range of the addresses of an IPv4 prefix.
+func RangeOf(prefix netip.Prefix) (Range, error) {
+	if !prefix.Addr().Is4() {
+		return Range{}, fmt.Errorf("%s is not an IPv4 prefix", prefix)
+	}
+	start := Uint32(prefix.Masked().Addr())
+	return Range{Start: start, End: start | (math.MaxUint32 >> prefix.Bits())}, nil
+}
+
+// Size returns the number of addresses in the range.
+func (r Range) Size() uint64 {
+	return uint64(r.End) - uint64(r.Start) + 1
+}
+
+// Contains reports whether ip is in the range.
+func (r Range) Contains(ip uint32) bool {
+	return r.Start <= ip && ip <= r.End
+}
+
+// Prefixes returns the fewest CIDR blocks covering exactly the range.
+func (r Range) Prefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	start, end := uint64(r.Start), uint64(r.End)
+	for start <= end {
+		// The largest block starting at start is limited by its alignment...
+		size := uint64(1) << 32
+		if start != 0 {
+			size = start & -start
+		}
+		// ...and by the end of the range.
+		for start+size-1 > end {
+			size >>= 1
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(Addr(uint32(start)), 32-bits.TrailingZeros64(size)))
+		start += size
+	}
+	return prefixes
+}
+
+// String returns the range as a CIDR block when it is exactly one, such as
+// 10.0.0.0/8, and as first-last addresses, such as 10.0.0.1-10.0.0.9,
+// otherwise.
+func (r Range) String() string {
+	if prefixes := r.Prefixes(); len(prefixes) == 1 {
+		return prefixes[0].String()
+	}
+	return Addr(r.Start).String() + "-" + Addr(r.End).String()
+}
+
+// Addr returns the address of a 32-bit integer value.
+func Addr(ip uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)})
+}
+
+// Uint32 returns the 32-bit integer value of an IPv4 address, or of the
+// IPv4 address an IPv4-mapped IPv6 address holds. It returns 0 for any other
+// address.
+func Uint32(addr netip.Addr) uint32 {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return 0
+	}
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// Containing returns the indexes of the ranges containing ip, in the order
+// given.
+func Containing(ranges []Range, ip uint32) []int {
+	var indexes []int
+	for i, r := range ranges {
+		if r.Contains(ip) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Merge returns the set of the ranges: sorted, with overlapping and adjacent
+// ranges joined. The ranges given are not modified.
+func Merge(ranges []Range) []Range {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sorted := make([]Range, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	merged := []Range{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if last.End == math.MaxUint32 || r.Start <= last.End+1 {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Union returns the addresses in either a or b.
+func Union(a, b []Range) []Range {
+	return Merge(append(append(make([]Range, 0, len(a)+len(b)), a...), b...))
+}
+
+// Intersect returns the addresses in both a and b.
+func Intersect(a, b []Range) []Range {
+	a, b = Merge(a), Merge(b)
+	var result []Range
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := max(a[i].Start, b[j].Start), min(a[i].End, b[j].End)
+		if start <= end {
+			result = append(result, Range{Start: start, End: end})
+		}
+		if a[i].End < b[j].End {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// Subtract returns the addresses of ranges that are not in exclude.
+func Subtract(ranges, exclude []Range) []Range {
+	ranges, exclude = Merge(ranges), Merge(exclude)
+	var result []Range
+	i := 0
+	for _, r := range ranges {
+		// Skip exclusions that end before this range starts.
+		for i < len(exclude) && exclude[i].End < r.Start {
+			i++
+		}
+		remaining := true
+		for j := i; j < len(exclude) && exclude[j].Start <= r.End; j++ {
+			if exclude[j].Start > r.Start {
+				result = append(result, Range{Start: r.Start, End: exclude[j].Start - 1})
+			}
+			if exclude[j].End >= r.End {
+				remaining = false
+				break
+			}
+			r.Start = exclude[j].End + 1
+		}
+		if remaining {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Complement returns the addresses of within that are not in ranges.
+func Complement(ranges []Range, within Range) []Range {
+	return Subtract([]Range{within}, ranges)
+}
+
+// Size returns the number of addresses in the ranges, counting an address
+// in several of them once for each; the Size of a merged set is the number
+// of addresses in it.
+func Size(ranges []Range) uint64 {
+	var total uint64
+	for _, r := range ranges {
+		total += r.Size()
+	}
+	return total
+}
+
+// Prefixes returns the fewest CIDR blocks covering exactly the addresses in
+// the ranges, in ascending order.
+func Prefixes(ranges []Range) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, r := range Merge(ranges) {
+		prefixes = append(prefixes, r.Prefixes()...)
+	}
+	return prefixes
+}
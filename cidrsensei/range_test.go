@@ -0,0 +1,25 @@
+package cidrsensei
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestUint32(t *testing.T) {
+	tests := []struct {
+		addr netip.Addr
+		want uint32
+	}{
+		{netip.MustParseAddr("10.1.2.3"), 0x0a010203},
+		{netip.MustParseAddr("255.255.255.255"), 0xffffffff},
+		{netip.MustParseAddr("::ffff:10.1.2.3"), 0x0a010203},
+		{netip.MustParseAddr("2001:db8::1"), 0},
+		{netip.MustParseAddr("::"), 0},
+		{netip.Addr{}, 0},
+	}
+	for _, tt := range tests {
+		if got := Uint32(tt.addr); got != tt.want {
+			t.Errorf("Uint32(%v) = %#x, want %#x", tt.addr, got, tt.want)
+		}
+	}
+}
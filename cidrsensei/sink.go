@@ -0,0 +1,18 @@
+package cidrsensei
+
+import "io"
+
+// An OutputSink writes the addresses of an expansion as the records of an
+// output format. The cidr-sensei command writes each -output through one,
+// and loads more from Go plugins with -output-plugin.
+type OutputSink interface {
+	// Open starts the output on w, which writes to the file at path, or to
+	// stdout when path is empty. Sinks that create the file at path
+	// themselves are given a nil w. A sink is opened again after Close for
+	// each further file of an output split into several.
+	Open(w io.Writer, path string) error
+	// WriteRecord writes the record of an address, such as 10.0.0.1.
+	WriteRecord(ip string) error
+	// Close finishes the output, leaving closing w to the caller.
+	Close() error
+}
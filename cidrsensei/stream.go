@@ -0,0 +1,123 @@
+package cidrsensei
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/netip"
+	"slices"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei/intervaltree"
+)
+
+// Result is an address of an expansion, with the block it came from: the
+// smallest of the ranges expanded containing it, or for ranges of the same
+// size, the one starting last.
+type Result struct {
+	Addr  netip.Addr
+	Block Range
+}
+
+// Expand sends each address the iterator has yet to return, once and in
+// ascending order, with its block, on the returned channel from a goroutine
+// of its own, and closes it at the end. When ctx is done first, the error
+// channel receives its error before both channels are closed. Callers that
+// stop reading early must cancel ctx to end the goroutine, and must not
+// call Next while it runs.
+func (it *Iterator) Expand(ctx context.Context) (<-chan Result, <-chan error) {
+	results := make(chan Result, 1024)
+	errs := make(chan error, 1)
+	segments := blockSegments(it.blocks)
+	go func() {
+		defer close(errs)
+		defer close(results)
+		for addr, ok := it.Next(); ok; addr, ok = it.Next() {
+			ip := Uint32(addr)
+			for uint64(ip) > segments[0].end {
+				segments = segments[1:]
+			}
+			select {
+			case results <- Result{Addr: addr, Block: segments[0].block}:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return results, errs
+}
+
+// blockSegment is a part of the address space whose addresses all have the
+// same block, up to end.
+type blockSegment struct {
+	end   uint64
+	block Range
+}
+
+// blockSegments splits the addresses of the blocks where the smallest block
+// containing them changes, in ascending order. Addresses outside every
+// block are in segments of a zero block.
+func blockSegments(blocks []Range) []blockSegment {
+	var tree intervaltree.Tree[uint32, struct{}]
+	bounds := []uint64{0}
+	for _, b := range blocks {
+		// Blocks are never reversed, and equal ones are the same block.
+		_ = tree.Insert(b.Start, b.End, struct{}{})
+		bounds = append(bounds, uint64(b.Start), uint64(b.End)+1)
+	}
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+
+	segments := make([]blockSegment, 0, len(bounds))
+	for i, start := range bounds {
+		end := uint64(math.MaxUint32)
+		if i+1 < len(bounds) {
+			end = bounds[i+1] - 1
+		}
+		if start > math.MaxUint32 {
+			break
+		}
+		var block Range
+		for j, interval := range tree.Stab(uint32(start)) {
+			r := Range{Start: interval.Start, End: interval.End}
+			if j == 0 || r.Size() < block.Size() || r.Size() == block.Size() && r.Start > block.Start {
+				block = r
+			}
+		}
+		segments = append(segments, blockSegment{end: end, block: block})
+	}
+	return segments
+}
+
+// A Reader reads each address in a set of ranges once, in ascending order,
+// as a line of text, so that an expansion can be copied to a file or socket
+// with io.Copy without holding the addresses in memory.
+type Reader struct {
+	it      *Iterator
+	pending []byte // the rest of a line that did not fit the last read
+}
+
+// NewReader returns a Reader of the addresses in the ranges.
+func NewReader(ranges []Range) *Reader {
+	return &Reader{it: NewIterator(ranges), pending: make([]byte, 0, len("255.255.255.255\n"))}
+}
+
+// Read reads the next lines into p, returning io.EOF after the last.
+func (r *Reader) Read(p []byte) (int, error) {
+	n := copy(p, r.pending)
+	r.pending = r.pending[:copy(r.pending, r.pending[n:])]
+	for n < len(p) {
+		addr, ok := r.it.Next()
+		if !ok {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			break
+		}
+		line := append(addr.AppendTo(r.pending[:0]), '\n')
+		copied := copy(p[n:], line)
+		n += copied
+		r.pending = line[:copy(line, line[copied:])]
+	}
+	return n, nil
+}
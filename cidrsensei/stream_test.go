@@ -0,0 +1,61 @@
+package cidrsensei
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestIteratorExpand(t *testing.T) {
+	outer := Range{Start: 0x0a000000, End: 0x0a0000ff} // 10.0.0.0/24
+	inner := Range{Start: 0x0a000010, End: 0x0a00001f} // 10.0.0.16/28
+	apart := Range{Start: 0x0a000200, End: 0x0a000201} // 10.0.2.0-10.0.2.1
+	last := Range{Start: 0xfffffffe, End: 0xffffffff}  // up to the last address
+
+	results, errs := NewIterator([]Range{apart, inner, outer, last, inner}).Expand(context.Background())
+	var got []Result
+	for r := range results {
+		got = append(got, r)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	want := int(outer.Size() + apart.Size() + last.Size())
+	if len(got) != want {
+		t.Fatalf("Expand sent %d addresses, want %d", len(got), want)
+	}
+	for i, r := range got {
+		ip := Uint32(r.Addr)
+		if i > 0 && ip <= Uint32(got[i-1].Addr) {
+			t.Fatalf("Expand sent %s after %s", r.Addr, got[i-1].Addr)
+		}
+		block := outer
+		switch {
+		case inner.Start <= ip && ip <= inner.End:
+			block = inner
+		case apart.Start <= ip && ip <= apart.End:
+			block = apart
+		case last.Start <= ip:
+			block = last
+		}
+		if r.Block != block {
+			t.Errorf("Expand sent %s with the block %s, want %s", r.Addr, r.Block, block)
+		}
+	}
+}
+
+func TestIteratorExpandCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	it := NewIterator([]Range{{Start: 0, End: 0xffffffff}})
+	results, errs := it.Expand(ctx)
+	if r := <-results; r.Addr != netip.AddrFrom4([4]byte{}) {
+		t.Fatalf("Expand sent %s first, want 0.0.0.0", r.Addr)
+	}
+	cancel()
+	for range results {
+	}
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expand ended with %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,35 @@
+package cidrsensei
+
+import "github.com/ozfive/CIDR-Sensei/cidrsensei/intervaltree"
+
+// IntervalTree finds the ranges containing an address, in a balanced
+// interval tree of the ranges, which may overlap. The zero value is an
+// empty tree. Use the intervaltree package for ranges that carry values.
+type IntervalTree struct {
+	tree intervaltree.Tree[uint32, struct{}]
+}
+
+// Insert adds a range to the tree. It returns an error, and leaves the tree
+// unchanged, when the range starts after its end.
+func (t *IntervalTree) Insert(r Range) error {
+	return t.tree.Insert(r.Start, r.End, struct{}{})
+}
+
+// Search returns the first range, by its start and end, containing ip, and
+// whether there is one.
+func (t *IntervalTree) Search(ip uint32) (Range, bool) {
+	if found := t.tree.Stab(ip); len(found) > 0 {
+		return Range{Start: found[0].Start, End: found[0].End}, true
+	}
+	return Range{}, false
+}
+
+// Stab returns the ranges containing ip, ordered by their start and end.
+func (t *IntervalTree) Stab(ip uint32) []Range {
+	found := t.tree.Stab(ip)
+	ranges := make([]Range, len(found))
+	for i, interval := range found {
+		ranges[i] = Range{Start: interval.Start, End: interval.End}
+	}
+	return ranges
+}
@@ -0,0 +1,39 @@
+package cidrsensei
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIntervalTreeOverlapping(t *testing.T) {
+	var tree IntervalTree
+	outer := Range{Start: 0x0a000000, End: 0x0a03ffff} // 10.0.0.0/14
+	inner := Range{Start: 0x0a020000, End: 0x0a02ffff} // 10.2.0.0/16
+	for _, r := range []Range{outer, inner} {
+		if err := tree.Insert(r); err != nil {
+			t.Fatalf("Insert(%s): %v", r, err)
+		}
+	}
+	tests := []struct {
+		ip   uint32
+		want []Range
+	}{
+		{0x0a010000, []Range{outer}},
+		{0x0a020001, []Range{outer, inner}},
+		{0x0a030000, []Range{outer}},
+		{0x0b000000, nil},
+	}
+	for _, tt := range tests {
+		got := tree.Stab(tt.ip)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Stab(%s) = %v, want %v", Addr(tt.ip), got, tt.want)
+		}
+		r, ok := tree.Search(tt.ip)
+		if ok != (len(tt.want) > 0) || ok && r != tt.want[0] {
+			t.Errorf("Search(%s) = %v, %v, want the first of %v", Addr(tt.ip), r, ok, tt.want)
+		}
+	}
+	if err := tree.Insert(Range{Start: 2, End: 1}); err == nil {
+		t.Error("Insert of a range starting after its end succeeded, want an error")
+	}
+}
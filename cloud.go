@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultAWSURL        = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+	defaultGCPURL        = "https://www.gstatic.com/ipranges/cloud.json"
+	defaultAzureURL      = "https://www.microsoft.com/en-us/download/details.aspx?id=56519"
+	defaultCloudflareURL = "https://www.cloudflare.com/ips-v4"
+)
+
+// azureServiceTagsLink matches the link to the current service tags file on
+// Microsoft's download page, which moves to a new URL every week.
+var azureServiceTagsLink = regexp.MustCompile(`https://download\.microsoft\.com/download/[^"']+/ServiceTags_Public_[0-9]+\.json`)
+
+// cloudFilter selects published cloud ranges by service and region. An
+// empty list matches everything, and matching is case-insensitive.
+type cloudFilter struct {
+	services []string
+	regions  []string
+}
+
+// newCloudFilter returns a filter for comma-separated service and region
+// lists.
+func newCloudFilter(services, regions string) cloudFilter {
+	return cloudFilter{services: splitList(services), regions: splitList(regions)}
+}
+
+// matches reports whether a range published for service in region is
+// selected by the filter.
+func (f cloudFilter) matches(service, region string) bool {
+	return matchesAny(f.services, service) && matchesAny(f.regions, region)
+}
+
+// splitList splits a comma-separated flag value, dropping empty values.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// matchesAny reports whether value case-insensitively equals one of values,
+// or values is empty.
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// awsIPRanges is the subset of ip-ranges.json used to select prefixes.
+type awsIPRanges struct {
+	SyncToken string `json:"syncToken"`
+	Prefixes  []struct {
+		IPPrefix string `json:"ip_prefix"`
+		Region   string `json:"region"`
+		Service  string `json:"service"`
+	} `json:"prefixes"`
+}
+
+// awsEntries returns the IPv4 prefixes published in AWS's ip-ranges.json
+// that match the filter. Each entry's origin names the service and region it
+// was published for.
+func awsEntries(ctx context.Context, fetcher *fetcher, url string, filter cloudFilter) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		body, err := fetcher.fetch(ctx, url)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+
+		var ranges awsIPRanges
+		if err := json.Unmarshal(body, &ranges); err != nil {
+			yield(inputEntry{}, fmt.Errorf("error parsing %s: %w", url, err))
+			return
+		}
+
+		for _, prefix := range ranges.Prefixes {
+			if !filter.matches(prefix.Service, prefix.Region) {
+				continue
+			}
+			entry := inputEntry{
+				text:   prefix.IPPrefix,
+				origin: fmt.Sprintf("aws:%s/%s", prefix.Service, prefix.Region),
+			}
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+// gcpIPRanges is the subset of Google Cloud's cloud.json used to select
+// prefixes. IPv6 prefixes have an empty IPv4Prefix.
+type gcpIPRanges struct {
+	Prefixes []struct {
+		IPv4Prefix string `json:"ipv4Prefix"`
+		Service    string `json:"service"`
+		Scope      string `json:"scope"`
+	} `json:"prefixes"`
+}
+
+// gcpEntries returns the IPv4 prefixes published in Google Cloud's
+// cloud.json that match the filter. The scope of a prefix is its region.
+func gcpEntries(ctx context.Context, fetcher *fetcher, url string, filter cloudFilter) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		body, err := fetcher.fetch(ctx, url)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+
+		var ranges gcpIPRanges
+		if err := json.Unmarshal(body, &ranges); err != nil {
+			yield(inputEntry{}, fmt.Errorf("error parsing %s: %w", url, err))
+			return
+		}
+
+		for _, prefix := range ranges.Prefixes {
+			if prefix.IPv4Prefix == "" || !filter.matches(prefix.Service, prefix.Scope) {
+				continue
+			}
+			entry := inputEntry{
+				text:   prefix.IPv4Prefix,
+				origin: fmt.Sprintf("gcp:%s/%s", prefix.Service, prefix.Scope),
+			}
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+// azureServiceTags is the subset of Azure's ServiceTags JSON used to select
+// prefixes.
+type azureServiceTags struct {
+	Values []struct {
+		Name       string `json:"name"`
+		Properties struct {
+			Region          string   `json:"region"`
+			SystemService   string   `json:"systemService"`
+			AddressPrefixes []string `json:"addressPrefixes"`
+		} `json:"properties"`
+	} `json:"values"`
+}
+
+// azureEntries returns the IPv4 prefixes of the Azure service tags that
+// match the filter. A service matches either the tag name without its region
+// suffix, such as Storage for Storage.EastUS, or the tag's system service.
+// url may point either at a ServiceTags JSON file or at the download page
+// linking to the current one.
+func azureEntries(ctx context.Context, fetcher *fetcher, url string, filter cloudFilter) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		body, err := fetcher.fetch(ctx, url)
+		if err == nil && !json.Valid(body) {
+			link := azureServiceTagsLink.Find(body)
+			if link == nil {
+				yield(inputEntry{}, fmt.Errorf("no service tags file found at %s", url))
+				return
+			}
+			url = string(link)
+			body, err = fetcher.fetch(ctx, url)
+		}
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+
+		var tags azureServiceTags
+		if err := json.Unmarshal(body, &tags); err != nil {
+			yield(inputEntry{}, fmt.Errorf("error parsing %s: %w", url, err))
+			return
+		}
+
+		for _, tag := range tags.Values {
+			service, _, _ := strings.Cut(tag.Name, ".")
+			region := tag.Properties.Region
+			if !filter.matches(service, region) && !filter.matches(tag.Properties.SystemService, region) {
+				continue
+			}
+			for _, prefix := range tag.Properties.AddressPrefixes {
+				if strings.Contains(prefix, ":") {
+					continue
+				}
+				if !yield(inputEntry{text: prefix, origin: "azure:" + tag.Name}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// cloudflareEntries returns the IPv4 ranges Cloudflare publishes as a plain
+// list. Cloudflare does not publish services or regions, so the filter does
+// not apply to them.
+func cloudflareEntries(ctx context.Context, fetcher *fetcher, url string) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		body, err := fetcher.fetch(ctx, url)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+		for entry, err := range readEntries(bytes.NewReader(body), "cloudflare") {
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
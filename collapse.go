@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// runCollapse reads a flat list of IPs from the file given to -collapse, or
+// from stdin when it is "-", and writes the minimal list of CIDR blocks
+// covering exactly those IPs.
+func runCollapse(config Config) error {
+	var r io.Reader = os.Stdin
+	if config.Collapse != "-" {
+		file, err := os.Open(config.Collapse)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	runs, err := readIPRuns(r)
+	if err != nil {
+		return err
+	}
+	return writeCIDRList(os.Stdout, config.OutputFormat, rangesToCIDRs(mergeIPRanges(runs)))
+}
+
+// readIPRuns reads one IP per line and returns the runs of consecutive IPs
+// in the order they were read. Sorted input therefore only needs memory
+// proportional to the number of runs rather than the number of IPs. Blank
+// lines and lines starting with # are ignored.
+func readIPRuns(r io.Reader) ([]ipRange, error) {
+	var runs []ipRange
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parsed := net.ParseIP(line)
+		if parsed == nil || parsed.To4() == nil {
+			return nil, fmt.Errorf("line %d: invalid IPv4 address: %s", lineNum, line)
+		}
+		ip := ipToUint(parsed)
+
+		if n := len(runs); n > 0 && runs[n-1].End != ^uint32(0) && runs[n-1].End+1 == ip {
+			runs[n-1].End = ip
+			continue
+		}
+		runs = append(runs, ipRange{Start: ip, End: ip})
+	}
+	return runs, scanner.Err()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a subcommand, named by the first argument.
+type command struct {
+	name     string
+	summary  string
+	usage    string // the arguments after the name
+	examples []string
+}
+
+// commands lists the subcommands. expand, split, merge, check, bench, shell
+// and tui take the flags of the expansion; the others have flags of their
+// own.
+// Without a command, the arguments are those of expand.
+var commands = []command{
+	{"expand", "Expand CIDR blocks into a list of IPs (the default)", "[OPTIONS]", []string{helpUsage}},
+	{"split", "Expand CIDR blocks into IPs split across numbered files listed in a manifest", "-split-size=SIZE|-split-count=N [OPTIONS]", []string{"split -cidr=10.0.0.0/8 -output=csv -split-size=500MB"}},
+	{"merge", "Merge CIDR blocks into the fewest blocks covering the same addresses", "[OPTIONS]", []string{"merge -cidr=10.0.0.0/9,10.128.0.0/9"}},
+	{"diff", "Report the addresses added and removed between two lists of CIDR blocks", "[OPTIONS] OLD NEW", []string{"diff 10.0.0.0/8 10.0.0.0/9,192.168.0.0/16"}},
+	{"check", "Report which CIDR blocks contain each IP", "[OPTIONS] IP...", []string{"check -cidr=10.0.0.0/8,10.1.0.0/16 10.1.2.3 8.8.8.8"}},
+	{"plan", "Plan a VLSM allocation of subnets within a parent CIDR block", "[OPTIONS]", []string{"plan -parent=10.0.0.0/22 -hosts=web=500,db=200,50"}},
+	{"serve", "Serve expansions, aggregations and membership checks over HTTP and gRPC APIs", "[OPTIONS]", []string{"serve -listen=localhost:8080"}},
+	{"daemon", "Run expansion and aggregation jobs from the API or a spool directory, storing their results", "[OPTIONS]", []string{"daemon -jobs-dir=/var/lib/cidr-sensei -spool=/var/spool/cidr-sensei -workers=4"}},
+	{"bench", "Time the expansion of CIDR blocks with each algorithm", "[OPTIONS]", []string{"bench -cidr=10.0.0.0/12 -concurrency=8"}},
+	{"shell", "Load, expand, check and diff lists of CIDR blocks at an interactive prompt", "[OPTIONS]", []string{"shell", "shell -input=corp.txt -output=json"}},
+	{"tui", "Expand CIDR blocks in a terminal UI showing the progress and a searchable view of the IPs", "[OPTIONS]", []string{"tui -cidr=10.0.0.0/12 -parallel -concurrency=4", "tui -input=corp.txt -output=csv"}},
+	{"ipcalc", "Perform arithmetic on IPv4 addresses", "OPERATION ARGS...", []string{"ipcalc add 10.0.0.1 300"}},
+}
+
+// lookupCommand returns the subcommand named name.
+func lookupCommand(name string) (command, bool) {
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == name })
+	if i < 0 {
+		return command{}, false
+	}
+	return commands[i], true
+}
+
+// splitCommand returns the subcommand the arguments run, and the arguments
+// after its name: expand with all of them when the first is not a command.
+func splitCommand(args []string) (string, []string) {
+	if len(args) > 0 {
+		if _, ok := lookupCommand(args[0]); ok {
+			return args[0], args[1:]
+		}
+	}
+	return "expand", args
+}
+
+// printCommandUsage prints the usage line and description of the command,
+// and for expand the list of the other commands.
+func printCommandUsage(name string) {
+	c, _ := lookupCommand(name)
+	if name == "expand" {
+		fmt.Printf("Usage: %s [expand] %s\n", os.Args[0], c.usage)
+		fmt.Printf("       %s COMMAND [OPTIONS]\n", os.Args[0])
+	} else {
+		fmt.Printf("Usage: %s %s %s\n", os.Args[0], c.name, c.usage)
+	}
+	fmt.Println(c.summary)
+	if name == "expand" {
+		fmt.Println("")
+		fmt.Println("Commands:")
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range commands {
+			fmt.Fprintf(writer, "  %s\t%s\n", c.name, c.summary)
+		}
+		writer.Flush()
+	}
+}
+
+// printCommandExamples prints the examples of the command.
+func printCommandExamples(name string) {
+	c, _ := lookupCommand(name)
+	fmt.Println("")
+	fmt.Println("Examples:")
+	for _, example := range c.examples {
+		fmt.Println(os.Args[0], example)
+	}
+}
+
+// applyCommand sets up config for the expansion command name, with args the
+// arguments left after its flags.
+func applyCommand(name string, config *Config, args []string) ([]string, error) {
+	if config.Script != "" && slices.Contains([]string{"shell", "tui", "bench"}, name) {
+		return args, fmt.Errorf("the %s command does not run -script hooks", name)
+	}
+	switch name {
+	case "merge":
+		config.Merge = true
+	case "split":
+		if config.SplitSize == "" && config.SplitCount == 0 {
+			return args, fmt.Errorf("the split command needs -split-size or -split-count")
+		}
+	case "check":
+		if len(args) > 0 && !(len(args) == 1 && args[0] == "-") {
+			config.Contains = strings.Join(args, ",")
+			args = nil
+		}
+		if config.Contains == "" {
+			return args, fmt.Errorf("the check command needs the IPs to check, as arguments or with -contains")
+		}
+	case "shell":
+		if len(args) > 0 || config.CIDRListStr == "-" || slices.Contains(config.InputFiles, "-") {
+			return args, fmt.Errorf("the shell command reads its commands from stdin, and takes no arguments")
+		}
+		if !slices.Contains(reportFormats, config.OutputFormat) {
+			return args, fmt.Errorf("the shell writes its reports as %s, not %s", strings.Join(reportFormats, ", "), config.OutputFormat)
+		}
+	case "tui":
+		if len(args) > 0 || config.CIDRListStr == "-" || slices.Contains(config.InputFiles, "-") {
+			return args, fmt.Errorf("the tui command reads keys from stdin, and takes no arguments")
+		}
+		if config.report() {
+			return args, fmt.Errorf("the tui command shows the expansion, and cannot be used with reports")
+		}
+	case "bench":
+		if config.report() {
+			return args, fmt.Errorf("the bench command times the expansion, and cannot be used with reports")
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei/intervaltree"
+	"github.com/ozfive/CIDR-Sensei/cidrsensei/radixtrie"
+)
+
+// exitNotContained is the exit code used when at least one IP passed to
+// -contains is not covered by any of the CIDR blocks.
+const exitNotContained = 2
+
+// containsResult records which CIDR blocks contain a single IP.
+type containsResult struct {
+	IP        string   `json:"ip"`
+	Contained bool     `json:"contained"`
+	CIDRs     []string `json:"cidrs"`
+
+	// Metadata holds the metadata of each of the CIDRs, when any has some.
+	Metadata []map[string]string `json:"metadata,omitempty"`
+}
+
+// runContains checks the IPs given to -contains against the CIDR ranges,
+// writes the matches and returns the process exit code.
+func runContains(config Config, cidrRanges []CIDRRange) int {
+	results, err := checkContains(strings.Split(config.Contains, ","), cidrRanges, config.Algorithm)
+	if err != nil {
+		slog.Error("cannot check the IPs", "error", err)
+		return 1
+	}
+
+	withMetadata := slices.ContainsFunc(results, func(r containsResult) bool { return r.Metadata != nil })
+	header := []string{"ip", "contained", "cidrs"}
+	if withMetadata {
+		header = append(header, "metadata")
+	}
+	rows := make([][]string, 0, len(results))
+	allContained := true
+	for _, result := range results {
+		cidrs := strings.Join(result.CIDRs, ";")
+		if !result.Contained {
+			allContained = false
+			if config.OutputFormat == "terminal" {
+				cidrs = "-"
+			}
+		}
+		row := []string{result.IP, strconv.FormatBool(result.Contained), cidrs}
+		if withMetadata {
+			metadata := make([]string, 0, len(result.Metadata))
+			for _, m := range result.Metadata {
+				metadata = append(metadata, formatMetadata(m))
+			}
+			row = append(row, strings.Join(metadata, " | "))
+		}
+		rows = append(rows, row)
+	}
+
+	if err := writeReport(os.Stdout, config.OutputFormat, results, header, rows); err != nil {
+		slog.Error("cannot write output", "error", err)
+		return 1
+	}
+
+	if !allContained {
+		return exitNotContained
+	}
+	return 0
+}
+
+// checkContains reports, for each IP, every CIDR range that contains it,
+// found with the index of algorithm.
+func checkContains(ipList []string, cidrRanges []CIDRRange, algorithm string) ([]containsResult, error) {
+	containing := buildContainsIndex(cidrRanges, algorithm)
+
+	results := make([]containsResult, 0, len(ipList))
+	for _, ipStr := range ipList {
+		ipStr = strings.TrimSpace(ipStr)
+		parsed := net.ParseIP(ipStr)
+		if parsed == nil || parsed.To4() == nil {
+			return nil, fmt.Errorf("invalid IPv4 address: %s", ipStr)
+		}
+		ip := ipToUint(parsed)
+
+		result := containsResult{IP: ipStr, CIDRs: []string{}}
+		matches := containing(ip)
+		for _, cidr := range matches {
+			result.CIDRs = append(result.CIDRs, cidr.String())
+		}
+		if slices.ContainsFunc(matches, func(cidr *CIDRRange) bool { return cidr.metadata != nil }) {
+			for _, cidr := range matches {
+				result.Metadata = append(result.Metadata, cidr.metadata)
+			}
+		}
+		result.Contained = len(result.CIDRs) > 0
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// buildContainsIndex returns the function finding the CIDR ranges
+// containing an IP. With the radix-trie algorithm, the prefixes of the
+// ranges are inserted into a radix trie, each with the ranges it covers,
+// and matched from the shortest. Otherwise the ranges are inserted into an
+// interval tree, each interval with the ranges spanning it, and stabbed.
+func buildContainsIndex(cidrRanges []CIDRRange, algorithm string) func(ip uint32) []*CIDRRange {
+	if algorithm == "radix-trie" {
+		trie := &radixtrie.Trie[[]*CIDRRange]{}
+		for i := range cidrRanges {
+			cidr := &cidrRanges[i]
+			insertRange(trie, ipRange{Start: cidr.start, End: cidr.end}, func(blocks []*CIDRRange) []*CIDRRange { return append(blocks, cidr) })
+		}
+		return func(ip uint32) []*CIDRRange {
+			var matches []*CIDRRange
+			for _, prefix := range trie.Matches(ip) {
+				matches = append(matches, prefix.Value...)
+			}
+			return matches
+		}
+	}
+
+	tree := &intervaltree.Tree[uint32, []*CIDRRange]{}
+	for i := range cidrRanges {
+		cidr := &cidrRanges[i]
+		blocks, _ := tree.Get(cidr.start, cidr.end)
+		// A range never starts after its end.
+		_ = tree.Insert(cidr.start, cidr.end, append(blocks, cidr))
+	}
+	return func(ip uint32) []*CIDRRange {
+		var matches []*CIDRRange
+		for _, interval := range tree.Stab(ip) {
+			matches = append(matches, interval.Value...)
+		}
+		return matches
+	}
+}
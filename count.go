@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+// countResult summarizes the size of an expansion.
+type countResult struct {
+	Ranges    int    `json:"ranges"`
+	Merged    int    `json:"merged_ranges"`
+	Addresses uint64 `json:"addresses"`
+	Hosts     uint64 `json:"usable_hosts"`
+}
+
+// runCount writes the number of unique IPs the CIDR ranges expand to. The
+// ranges are merged first, so overlapping blocks are only counted once. The
+// usable host count leaves out the network and broadcast address of every
+// block except /31 and /32 blocks, which have neither. With -by-source, each
+// source is counted on its own, followed by the total.
+func runCount(config Config, cidrRanges []CIDRRange) error {
+	if config.BySource {
+		return writeSourceCounts(config, cidrRanges)
+	}
+
+	result := countRanges(cidrRanges)
+	header := []string{"ranges", "merged_ranges", "addresses", "usable_hosts"}
+	return writeReport(os.Stdout, config.OutputFormat, result, header, [][]string{result.row()})
+}
+
+// countRanges counts the unique addresses and usable hosts of the ranges.
+func countRanges(cidrRanges []CIDRRange) countResult {
+	merged := mergeIPRanges(toIPRanges(cidrRanges))
+	hosts := mergeIPRanges(toIPRanges(filterHostAddresses(cidrRanges, false, false)))
+	return countResult{
+		Ranges:    len(cidrRanges),
+		Merged:    len(merged),
+		Addresses: totalSize(merged),
+		Hosts:     totalSize(hosts),
+	}
+}
+
+// row returns the count as a table row.
+func (c countResult) row() []string {
+	return []string{
+		strconv.Itoa(c.Ranges),
+		strconv.Itoa(c.Merged),
+		strconv.FormatUint(c.Addresses, 10),
+		strconv.FormatUint(c.Hosts, 10),
+	}
+}
+
+// writeSourceCounts writes a count for every source, in the order the
+// sources were first seen, and one for all of them together.
+func writeSourceCounts(config Config, cidrRanges []CIDRRange) error {
+	type sourceCount struct {
+		Source string `json:"source"`
+		countResult
+	}
+
+	var sources []string
+	bySource := make(map[string][]CIDRRange)
+	for _, cidr := range cidrRanges {
+		if _, ok := bySource[cidr.source]; !ok {
+			sources = append(sources, cidr.source)
+		}
+		bySource[cidr.source] = append(bySource[cidr.source], cidr)
+	}
+
+	counts := make([]sourceCount, 0, len(sources)+1)
+	for _, source := range sources {
+		counts = append(counts, sourceCount{Source: source, countResult: countRanges(bySource[source])})
+	}
+	counts = append(counts, sourceCount{Source: "total", countResult: countRanges(cidrRanges)})
+
+	header := []string{"source", "ranges", "merged_ranges", "addresses", "usable_hosts"}
+	rows := make([][]string, 0, len(counts))
+	for _, count := range counts {
+		rows = append(rows, append([]string{count.Source}, count.row()...))
+	}
+	return writeReport(os.Stdout, config.OutputFormat, counts, header, rows)
+}
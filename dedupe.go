@@ -0,0 +1,66 @@
+package main
+
+// ipBitsetPageBits is the number of addresses in each page of an ipBitset,
+// those of a /16.
+const ipBitsetPageBits = 1 << 16
+
+// ipBitset is a set of IPv4 addresses, a bit for each, kept in pages of a
+// /16 allocated when the first address in them is added. It takes 8 KiB for
+// each /16 it holds addresses of, up to 512 MiB for the whole address space,
+// rather than a hash set's tens of bytes an address.
+type ipBitset struct {
+	pages [1 << 16]*[ipBitsetPageBits / 64]uint64
+	used  int // the number of pages allocated
+}
+
+// add adds ip to the set, and reports whether it was not in it already.
+func (s *ipBitset) add(ip uint32) bool {
+	page := s.pages[ip>>16]
+	if page == nil {
+		page = new([ipBitsetPageBits / 64]uint64)
+		s.pages[ip>>16] = page
+		s.used++
+	}
+	word, bit := &page[ip&0xffff/64], uint64(1)<<(ip%64)
+	if *word&bit != 0 {
+		return false
+	}
+	*word |= bit
+	return true
+}
+
+// deduper is the -dedupe stage of the pipeline, which passes on each IP the
+// first time it is emitted only, so that the IPs of overlapping blocks are
+// written once however they are expanded, without holding the IPs.
+type deduper struct {
+	seen    ipBitset
+	dropped uint64
+}
+
+// newDeduper returns the deduper of the expansion of cidrRanges, or nil when
+// the blocks do not overlap, so that no IP can be emitted twice.
+func newDeduper(cidrRanges []CIDRRange) *deduper {
+	var size uint64
+	for _, r := range toIPRanges(cidrRanges) {
+		size += uint64(r.End) - uint64(r.Start) + 1
+	}
+	if size == newRangeIndex(mergeIPRanges(toIPRanges(cidrRanges))).total {
+		return nil
+	}
+	return &deduper{}
+}
+
+// stage returns next, called with each IP not emitted before.
+func (d *deduper) stage(next func(string) error) func(string) error {
+	return func(ip string) error {
+		n, err := parseIPv4(ip)
+		if err != nil {
+			return err
+		}
+		if !d.seen.add(n) {
+			d.dropped++
+			return nil
+		}
+		return next(ip)
+	}
+}
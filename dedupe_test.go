@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDedupeNestedBlocks(t *testing.T) {
+	blocks := testBlocks(t, "10.0.0.0/14", "10.2.0.0/16")
+	want := slices.Compact(eachIP(blocks))
+	if len(want) != 1<<18 {
+		t.Fatalf("the union of the blocks has %d IPs, want %d", len(want), 1<<18)
+	}
+	for _, algorithm := range algorithmNames() {
+		for _, parallel := range []bool{false, true} {
+			config := Config{Algorithm: algorithm, Parallel: parallel, Concurrency: 4, Dedupe: true}
+			d := newDeduper(blocks)
+			if d == nil {
+				t.Fatal("newDeduper of nested blocks = nil, want a deduper")
+			}
+			var got []uint32
+			emit := pipeline(func(ip string) error {
+				n, err := parseIPv4(ip)
+				got = append(got, n)
+				return err
+			}, d.stage)
+			if err := expandIPs(t.Context(), config, blocks, nil, emit); err != nil {
+				t.Fatal(err)
+			}
+			if got := sorted(got); !slices.Equal(got, want) {
+				t.Errorf("-dedupe -algorithm=%s -parallel=%v wrote %d IPs, want each of the %d once", algorithm, parallel, len(got), len(want))
+			}
+			if size := expansionSize(config, blocks); size != uint64(len(want)) {
+				t.Errorf("expansionSize of -dedupe -algorithm=%s = %d, want %d", algorithm, size, len(want))
+			}
+		}
+	}
+	if d := newDeduper(testBlocks(t, "10.0.0.0/24", "10.0.1.0/24")); d != nil {
+		t.Error("newDeduper of disjoint blocks is not nil")
+	}
+}
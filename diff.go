@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+// diffEntry is a block of addresses in only one of the lists compared.
+type diffEntry struct {
+	Change    string `json:"change"`
+	CIDR      string `json:"cidr"`
+	Addresses uint64 `json:"addresses"`
+}
+
+// runDiff implements the diff command and returns the process exit code: 0
+// when the lists cover the same addresses, 2 when they differ and 1 on
+// errors.
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	outputFormat := flags.String("output", "terminal", "the output format ("+strings.Join(reportFormats, ", ")+")")
+	var logging logOptions
+	logging.addFlags(flags)
+	flags.Usage = func() {
+		printCommandUsage("diff")
+		fmt.Println("")
+		fmt.Println("OLD and NEW are comma-separated lists of CIDR blocks, IPs and address ranges.")
+		fmt.Println("")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		printCommandExamples("diff")
+	}
+	_ = flags.Parse(args)
+	if err := logging.setup(); err != nil {
+		slog.Error("invalid command line", "error", err)
+		return 1
+	}
+
+	if flags.NArg() != 2 {
+		slog.Error("the diff command takes the OLD and NEW lists to compare")
+		return 1
+	}
+	if !slices.Contains(reportFormats, *outputFormat) {
+		slog.Error("invalid command line", "error", unsupportedReportFormat(*outputFormat))
+		return 1
+	}
+	before, err := cidrsensei.ParseCIDRs(flags.Arg(0))
+	if err != nil {
+		slog.Error("cannot parse the OLD list", "error", err)
+		return 1
+	}
+	after, err := cidrsensei.ParseCIDRs(flags.Arg(1))
+	if err != nil {
+		slog.Error("cannot parse the NEW list", "error", err)
+		return 1
+	}
+
+	entries := diffRanges(before, after)
+	if err := writeDiff(os.Stdout, *outputFormat, entries); err != nil {
+		slog.Error("cannot write output", "error", err)
+		return 1
+	}
+	if len(entries) > 0 {
+		return 2
+	}
+	return 0
+}
+
+// writeDiff writes the changes between two lists in the output format.
+func writeDiff(w io.Writer, format string, entries []diffEntry) error {
+	header := []string{"change", "cidr", "addresses"}
+	rows := make([][]string, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, []string{e.Change, e.CIDR, strconv.FormatUint(e.Addresses, 10)})
+	}
+	return writeReport(w, format, entries, header, rows)
+}
+
+// diffRanges returns the fewest blocks covering the addresses added in after
+// and removed from before, in address order.
+func diffRanges(before, after []cidrsensei.Range) []diffEntry {
+	type change struct {
+		entry diffEntry
+		start uint32
+	}
+	var changes []change
+	for _, set := range []struct {
+		name   string
+		ranges []cidrsensei.Range
+	}{
+		{"added", cidrsensei.Subtract(after, before)},
+		{"removed", cidrsensei.Subtract(before, after)},
+	} {
+		for _, prefix := range cidrsensei.Prefixes(set.ranges) {
+			entry := diffEntry{Change: set.name, CIDR: prefix.String(), Addresses: uint64(1) << (32 - prefix.Bits())}
+			changes = append(changes, change{entry, cidrsensei.Uint32(prefix.Addr())})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].start < changes[j].start })
+
+	entries := make([]diffEntry, 0, len(changes))
+	for _, c := range changes {
+		entries = append(entries, c.entry)
+	}
+	return entries
+}
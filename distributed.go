@@ -0,0 +1,211 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	cidrsenseiv1 "github.com/ozfive/CIDR-Sensei/proto/cidrsensei/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	defaultPartitionSize = 1 << 20
+	defaultRemoteRetries = 3
+	// remoteWindow is the number of partitions per remote worker that may be
+	// expanded ahead of the one written next, which bounds the addresses
+	// held in memory while a slow partition is waited for.
+	remoteWindow = 4
+	// remoteBackoff and maxRemoteBackoff are how long a remote worker is
+	// left alone after its first failure, and at most after repeated ones.
+	remoteBackoff    = time.Second
+	maxRemoteBackoff = 30 * time.Second
+	// maxRemoteMessage is the largest Address message a remote worker may
+	// answer with.
+	maxRemoteMessage = 1 << 10
+)
+
+// partition is a part of a distributed expansion, which the coordinator
+// sends to a remote worker.
+type partition struct {
+	index    int
+	r        ipRange
+	attempts int
+}
+
+// partitionResult is the outcome of expanding a partition on a remote
+// worker: its addresses, or the error it failed with.
+type partitionResult struct {
+	p      *partition
+	worker string
+	ips    []uint32
+	err    error
+}
+
+// partitionRanges splits the ranges into partitions of at most size
+// addresses, in the order of the ranges.
+func partitionRanges(ranges []ipRange, size uint64) []*partition {
+	var parts []*partition
+	for _, r := range ranges {
+		for start := uint64(r.Start); start <= uint64(r.End); start += size {
+			end := min(start+size-1, uint64(r.End))
+			parts = append(parts, &partition{index: len(parts), r: ipRange{Start: uint32(start), End: uint32(end)}})
+		}
+	}
+	return parts
+}
+
+// expandRemote distributes the expansion of the blocks across the
+// -remote-workers, serve instances each expanding a partition at a time
+// through the Expand method of the gRPC API, and passes the IPs to emit in
+// ascending order of the blocks, as the sequential expansion does, each
+// block in full. With -dedupe the workers expand the union of the blocks
+// instead, each address once. A partition failing on a worker is
+// retried, on whichever worker is free next, up to -remote-retries times,
+// and a worker that failed is left alone for a while before it is sent
+// another partition.
+func expandRemote(ctx context.Context, config Config, cidrRanges []CIDRRange, emit func(string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ranges := toIPRanges(cidrRanges)
+	slices.SortStableFunc(ranges, func(a, b ipRange) int { return cmp.Compare(a.Start, b.Start) })
+	if config.Dedupe {
+		ranges = mergeIPRanges(ranges)
+	}
+	parts := partitionRanges(ranges, config.PartitionSize)
+	work := make(chan *partition)
+	results := make(chan partitionResult)
+	for _, worker := range config.RemoteWorkers {
+		conn, err := newGRPCClient(worker)
+		if err != nil {
+			return fmt.Errorf("invalid remote worker %s: %w", worker, err)
+		}
+		defer conn.Close()
+		go runRemoteWorker(ctx, cidrsenseiv1.NewCIDRSenseiClient(conn), worker, work, results)
+	}
+
+	queue := slices.Clone(parts) // the partitions to send, in order
+	done := make(map[int][]uint32)
+	window := remoteWindow * len(config.RemoteWorkers)
+	for next := 0; next < len(parts); {
+		// Hold back partitions too far ahead of the one written next
+		var send chan *partition
+		var p *partition
+		if len(queue) > 0 && queue[0].index-next < window {
+			send, p = work, queue[0]
+		}
+
+		select {
+		case send <- p:
+			queue = queue[1:]
+		case result := <-results:
+			if result.err != nil {
+				if ctx.Err() != nil {
+					return errInterrupted
+				}
+				result.p.attempts++
+				if result.p.attempts > config.RemoteRetries {
+					return fmt.Errorf("partition %s failed on %s after %d retries: %w", result.p.r, result.worker, config.RemoteRetries, result.err)
+				}
+				slog.Warn("retrying the partition", "partition", result.p.r, "worker", result.worker, "error", result.err)
+				i, _ := slices.BinarySearchFunc(queue, result.p.index, func(p *partition, index int) int { return p.index - index })
+				queue = slices.Insert(queue, i, result.p)
+				continue
+			}
+			done[result.p.index] = result.ips
+			for ips, ok := done[next]; ok; ips, ok = done[next] {
+				for _, ip := range ips {
+					if err := emit(formatIPv4(ip)); err != nil {
+						return err
+					}
+				}
+				delete(done, next)
+				next++
+			}
+		case <-ctx.Done():
+			return errInterrupted
+		}
+	}
+	return nil
+}
+
+// runRemoteWorker expands the partitions received from work on the remote
+// worker at addr, sending each result to results, until ctx is done. After a
+// failure, it waits before taking another partition, twice as long after
+// each failure in a row.
+func runRemoteWorker(ctx context.Context, client cidrsenseiv1.CIDRSenseiClient, addr string, work <-chan *partition, results chan<- partitionResult) {
+	backoff := time.Duration(0)
+	for {
+		var p *partition
+		select {
+		case <-ctx.Done():
+			return
+		case p = <-work:
+		}
+
+		ips, err := expandOnWorker(ctx, client, addr, p.r)
+		select {
+		case <-ctx.Done():
+			return
+		case results <- partitionResult{p: p, worker: addr, ips: ips, err: err}:
+		}
+
+		if err == nil {
+			backoff = 0
+			continue
+		}
+		backoff = min(max(backoff*2, remoteBackoff), maxRemoteBackoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// newGRPCClient returns a connection calling the gRPC methods of the serve
+// instance at addr over HTTP/2 without TLS, as the serve command answers
+// them.
+func newGRPCClient(addr string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxRemoteMessage)))
+}
+
+// expandOnWorker calls the Expand method of the serve instance at addr for
+// the range, and returns the addresses it answers with.
+func expandOnWorker(ctx context.Context, client cidrsenseiv1.CIDRSenseiClient, addr string, r ipRange) (ips []uint32, err error) {
+	ctx, span := startSpan(ctx, spanClient, "cidrsensei.v1.CIDRSensei/Expand", slog.String("server.address", addr), slog.String("partition", r.String()))
+	defer func() {
+		span.set(slog.Int("addresses", len(ips)))
+		span.finish(err)
+	}()
+
+	if header := traceparent(ctx); header != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "traceparent", header)
+	}
+	stream, err := client.Expand(ctx, &cidrsenseiv1.ExpandRequest{Cidrs: []string{r.String()}})
+	if err != nil {
+		return nil, err
+	}
+	ips = make([]uint32, 0, r.Size())
+	for {
+		address, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, address.GetInteger())
+	}
+	if uint64(len(ips)) != r.Size() {
+		return nil, fmt.Errorf("expected %d addresses, got %d", r.Size(), len(ips))
+	}
+	return ips, nil
+}
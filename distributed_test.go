@@ -0,0 +1,23 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRemoteExpansion(t *testing.T) {
+	workers := []string{testGRPCAddr(t, testServer()), testGRPCAddr(t, testServer())}
+	blocks := testBlocks(t, "10.0.1.0/30", "10.0.0.0/29", "10.0.0.4/30", "10.0.0.0/29", "192.168.0.0/31")
+	local := expand(t, Config{Algorithm: defaultAlgorithm}, blocks)
+
+	// The blocks overlap, and are expanded in full, in the order of the
+	// sequential expansion, across partitions smaller than the blocks
+	config := Config{Algorithm: defaultAlgorithm, RemoteWorkers: workers, PartitionSize: 3, RemoteRetries: defaultRemoteRetries}
+	if got := expand(t, config, blocks); !slices.Equal(got, local) {
+		t.Errorf("the remote expansion wrote %x, want %x as the local one does", got, local)
+	}
+	config.Dedupe = true
+	if got, want := expand(t, config, blocks), slices.Compact(sorted(local)); !slices.Equal(got, want) {
+		t.Errorf("the remote expansion with -dedupe wrote %x, want each address once, %x", got, want)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// envelopeSchema and envelopeSchemaVersion identify the layout of the
+// -json-envelope, whose version changes whenever a member is removed or
+// changes meaning, so that consumers can check they parse what they expect.
+const (
+	envelopeSchema        = "cidr-sensei/expansion"
+	envelopeSchemaVersion = 1
+)
+
+// jsonEnvelope is the metadata of the run json output is wrapped in with
+// -json-envelope: how the addresses were produced before them, and how many
+// there were after them.
+type jsonEnvelope struct {
+	Schema        string            `json:"schema"`
+	SchemaVersion int               `json:"schema_version"`
+	Tool          string            `json:"tool"`
+	Version       string            `json:"version"`
+	Started       time.Time         `json:"started"`
+	Parameters    map[string]string `json:"parameters"`
+	CIDRs         []string          `json:"cidrs"`
+	Exclusions    []string          `json:"exclusions"`
+	Fields        []string          `json:"fields"`
+
+	blocks int
+}
+
+// jsonEnvelopeCounts are the counts of the trailer of the envelope.
+type jsonEnvelopeCounts struct {
+	CIDRs      int `json:"cidrs"`
+	Exclusions int `json:"exclusions"`
+	Blocks     int `json:"blocks"`
+	Addresses  int `json:"addresses"`
+}
+
+// newJSONEnvelope returns the envelope of the expansion of cidrRanges, the
+// blocks left of the -cidr inputs once the -exclude blocks are removed,
+// into records of the fields.
+func newJSONEnvelope(config Config, cidrRanges []CIDRRange, fields *fieldWriter) *jsonEnvelope {
+	inputs := config.Inputs
+	if inputs == nil {
+		inputs = cidrRanges
+	}
+	e := &jsonEnvelope{
+		Schema:        envelopeSchema,
+		SchemaVersion: envelopeSchemaVersion,
+		Tool:          "cidr-sensei",
+		Version:       toolVersion(),
+		Parameters:    flagParameters(),
+		CIDRs:         rangeStrings(inputs),
+		Exclusions:    rangeStrings(config.Exclusions),
+		Fields:        []string{"address"},
+		blocks:        len(cidrRanges),
+	}
+	if fields != nil {
+		e.Fields = fields.fields
+	}
+	return e
+}
+
+// writeHeader writes the envelope up to the start of its addresses member,
+// timestamped with the start of the output.
+func (e *jsonEnvelope) writeHeader(w io.Writer) error {
+	e.Started = time.Now().UTC()
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Continue the object after its last member.
+	data = append(data[:len(data)-len("\n}")], ",\n  \"addresses\": ["...)
+	_, err = w.Write(data)
+	return err
+}
+
+// writeTrailer ends the addresses member after the count written, and the
+// envelope with the counts and the time the output finished.
+func (e *jsonEnvelope) writeTrailer(w io.Writer, count int) error {
+	counts, err := json.MarshalIndent(jsonEnvelopeCounts{
+		CIDRs:      len(e.CIDRs),
+		Exclusions: len(e.Exclusions),
+		Blocks:     e.blocks,
+		Addresses:  count,
+	}, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	end := "\n  ]"
+	if count == 0 {
+		end = "]"
+	}
+	_, err = fmt.Fprintf(w, "%s,\n  \"counts\": %s,\n  \"finished\": %q\n}", end, counts, time.Now().UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// rangeStrings returns the blocks as strings, an empty list for none.
+func rangeStrings(cidrRanges []CIDRRange) []string {
+	blocks := make([]string, 0, len(cidrRanges))
+	for _, cidr := range cidrRanges {
+		blocks = append(blocks, cidr.String())
+	}
+	return blocks
+}
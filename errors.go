@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// The exit codes of the expansion command, besides 0 for success and the
+// exitNotContained of -contains, which orchestration can act on instead of
+// reading the messages logged.
+const (
+	exitFailure   = 1   // any other failure
+	exitParse     = 3   // the command line or an input entry cannot be parsed
+	exitPartial   = 4   // -skip-invalid skipped entries, the rest was expanded
+	exitOutput    = 5   // the output cannot be written
+	exitCancelled = 130 // interrupted by SIGINT or SIGTERM
+)
+
+// entryError is the error of an input entry that cannot be parsed or
+// resolved.
+type entryError struct {
+	entry  string
+	origin string // where the entry was read, such as -cidr or list.txt:3
+	err    error
+}
+
+func (e *entryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.origin, e.err)
+}
+
+func (e *entryError) Unwrap() error {
+	return e.err
+}
+
+// parseError is the error of input that cannot be used as given, other than
+// an entry failing to parse, such as input -strict rejects.
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+// outputError is the error of writing an output.
+type outputError struct {
+	err error
+}
+
+func (e *outputError) Error() string {
+	return e.err.Error()
+}
+
+func (e *outputError) Unwrap() error {
+	return e.err
+}
+
+// partialError reports the entries -skip-invalid skipped.
+type partialError struct {
+	skipped int
+}
+
+func (e *partialError) Error() string {
+	if e.skipped == 1 {
+		return "an invalid entry was skipped"
+	}
+	return fmt.Sprintf("%d invalid entries were skipped", e.skipped)
+}
+
+// errorKind classifies err as a parse, partial, output or cancelled error,
+// or any other error.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, errInterrupted) || errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.As(err, new(*entryError)) || errors.As(err, new(*parseError)):
+		return "parse"
+	case errors.As(err, new(*partialError)):
+		return "partial"
+	case errors.As(err, new(*outputError)):
+		return "output"
+	}
+	return "error"
+}
+
+// exitCode returns the exit code of a command failing with err.
+func exitCode(err error) int {
+	switch errorKind(err) {
+	case "cancelled":
+		return exitCancelled
+	case "parse":
+		return exitParse
+	case "partial":
+		return exitPartial
+	case "output":
+		return exitOutput
+	}
+	return exitFailure
+}
+
+// errorRecord is the JSON line -errors-json writes for an error or warning
+// carrying one.
+type errorRecord struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+	Error   string    `json:"error"`
+	Entry   string    `json:"entry,omitempty"`
+	Origin  string    `json:"origin,omitempty"`
+}
+
+// errorsHandler writes the errors and warnings logged with an error to w as
+// errorRecords, whatever the level the handler it wraps logs.
+type errorsHandler struct {
+	slog.Handler
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (h *errorsHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.Handler.Enabled(ctx, level)
+}
+
+func (h *errorsHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		if err := h.write(r); err != nil {
+			return err
+		}
+	}
+	if h.Handler.Enabled(ctx, r.Level) {
+		return h.Handler.Handle(ctx, r)
+	}
+	return nil
+}
+
+// write writes the record of r when it carries an error.
+func (h *errorsHandler) write(r slog.Record) error {
+	var record *errorRecord
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key != "error" {
+			return true
+		}
+		record = &errorRecord{Time: r.Time.UTC(), Level: r.Level.String(), Kind: "error", Message: r.Message, Error: a.Value.String()}
+		if err, ok := a.Value.Any().(error); ok {
+			record.Kind = errorKind(err)
+			var entryErr *entryError
+			if errors.As(err, &entryErr) {
+				record.Entry, record.Origin = entryErr.entry, entryErr.origin
+			}
+		}
+		return false
+	})
+	if record == nil {
+		return nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.w.Write(append(data, '\n'))
+	return err
+}
+
+func (h *errorsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &errorsHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w, mu: h.mu}
+}
+
+func (h *errorsHandler) WithGroup(name string) slog.Handler {
+	return &errorsHandler{Handler: h.Handler.WithGroup(name), w: h.w, mu: h.mu}
+}
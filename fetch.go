@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFetchTimeout = 30 * time.Second
+	defaultFetchRetries = 3
+
+	// userAgent identifies CIDR-Sensei to servers, some of which, such as
+	// bgp.tools, refuse anonymous clients.
+	userAgent = "CIDR-Sensei (+https://github.com/ozfive/CIDR-Sensei)"
+)
+
+// fetcher downloads input lists over HTTP(S). Responses are cached on disk
+// and revalidated with ETag and If-Modified-Since, so unchanged lists are not
+// downloaded again.
+type fetcher struct {
+	client   *http.Client
+	retries  int
+	cacheDir string // empty disables caching
+
+	// streamClient only times out waiting for a response, so that large
+	// objects can be read for as long as they take.
+	streamClient *http.Client
+	s3           *s3Store
+	gcs          *gcsStore
+}
+
+// httpStatusError is returned for an unsuccessful response.
+type httpStatusError struct {
+	name   string
+	status string
+	header http.Header
+	detail string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.detail != "" {
+		return fmt.Sprintf("error fetching %s: %s: %s", e.name, e.status, e.detail)
+	}
+	return fmt.Sprintf("error fetching %s: %s", e.name, e.status)
+}
+
+// fetchCacheMeta is stored next to each cached response body.
+type fetchCacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// newFetcher returns a fetcher caching responses in cacheDir, or in the
+// user's cache directory when cacheDir is empty. Caching is disabled when
+// noCache is set or no cache directory is available.
+func newFetcher(timeout time.Duration, retries int, cacheDir string, noCache bool) *fetcher {
+	if cacheDir == "" && !noCache {
+		if userCacheDir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(userCacheDir, "cidr-sensei")
+		}
+	}
+	if noCache {
+		cacheDir = ""
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	f := &fetcher{
+		client:       &http.Client{Timeout: timeout},
+		retries:      retries,
+		cacheDir:     cacheDir,
+		streamClient: &http.Client{Transport: transport},
+	}
+	f.s3 = &s3Store{fetcher: f}
+	f.gcs = &gcsStore{fetcher: f}
+	return f
+}
+
+// entries returns the entries of the list at url, read in the given format.
+// When checksum is given, it must match the SHA-256 of the downloaded list.
+func (f *fetcher) entries(ctx context.Context, url, checksum string, format inputFormat) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		body, err := f.fetch(ctx, url)
+		if err == nil && checksum != "" {
+			err = verifySHA256(url, body, checksum)
+		}
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+		for entry, err := range readFormatted(bytes.NewReader(body), url, format) {
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
+
+// fetch downloads url, retrying network errors and server errors with
+// exponential backoff, and returns the response body.
+func (f *fetcher) fetch(ctx context.Context, url string) ([]byte, error) {
+	return f.fetchMaxAge(ctx, url, 0, nil)
+}
+
+// fetchMaxAge is like fetch, but returns a cached response younger than
+// maxAge without asking the server, and waits for limiter before each
+// request. It is meant for APIs whose answers change slowly and that limit
+// how often they are asked, which often do not support revalidation.
+func (f *fetcher) fetchMaxAge(ctx context.Context, url string, maxAge time.Duration, limiter *rateLimiter) ([]byte, error) {
+	if body, meta, ok := f.readCache(url); ok && time.Since(meta.Fetched) < maxAge {
+		return body, nil
+	}
+
+	var body []byte
+	err := f.retry(ctx, func() (bool, error) {
+		if err := limiter.wait(ctx); err != nil {
+			return false, err
+		}
+		var retry bool
+		var err error
+		body, retry, err = f.fetchOnce(ctx, url, maxAge > 0)
+		return retry, err
+	})
+	return body, err
+}
+
+// openStream starts reading the response to the request newRequest returns,
+// retrying the request like fetch does. The body is returned unread and is
+// not cached, so it can be larger than memory.
+func (f *fetcher) openStream(ctx context.Context, name string, newRequest func() (*http.Request, error)) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := f.retry(ctx, func() (bool, error) {
+		req, err := newRequest()
+		if err != nil {
+			return false, fmt.Errorf("error fetching %s: %w", name, err)
+		}
+		resp, err := f.streamClient.Do(req)
+		if err != nil {
+			return ctx.Err() == nil, fmt.Errorf("error fetching %s: %w", name, err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			body = resp.Body
+			return false, nil
+		}
+
+		// Object stores explain errors in a short XML or JSON body.
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, &httpStatusError{name: name, status: resp.Status, header: resp.Header, detail: strings.TrimSpace(string(detail))}
+	})
+	return body, err
+}
+
+// retry calls attempt until it succeeds, fails with an error that is not
+// worth retrying, or has been retried f.retries times, backing off
+// exponentially between attempts.
+func (f *fetcher) retry(ctx context.Context, attempt func() (bool, error)) error {
+	var lastErr error
+	for i := 0; i <= f.retries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(1<<(i-1)) * 500 * time.Millisecond):
+			}
+		}
+
+		retry, err := attempt()
+		if err == nil {
+			return nil
+		}
+		if !retry {
+			return err
+		}
+		slog.Debug("the request failed", "attempt", i+1, "error", err)
+		lastErr = err
+	}
+	return fmt.Errorf("%w (after %d attempts)", lastErr, f.retries+1)
+}
+
+// fetchOnce makes a single request for url and reports whether a failure is
+// worth retrying. The response is cached when it can be revalidated, or
+// always when keep is set.
+func (f *fetcher) fetchOnce(ctx context.Context, url string, keep bool) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	cachedBody, meta, cached := f.readCache(url)
+	if cached {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		slog.Debug("the cached download is up to date", "url", url)
+		return cachedBody, false, nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, true, fmt.Errorf("error fetching %s: %w", url, err)
+		}
+		meta := fetchCacheMeta{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Fetched:      time.Now(),
+		}
+		slog.Debug("downloaded", "url", url, "bytes", len(body))
+		if keep || meta.ETag != "" || meta.LastModified != "" {
+			f.writeCache(url, body, meta)
+		}
+		return body, false, nil
+	default:
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("error fetching %s: %s", url, resp.Status)
+	}
+}
+
+// cachePath returns the path the cached response for url is stored under,
+// with ext appended.
+func (f *fetcher) cachePath(url, ext string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(f.cacheDir, hex.EncodeToString(sum[:])+ext)
+}
+
+// readCache returns the cached response for url, if there is one.
+func (f *fetcher) readCache(url string) ([]byte, fetchCacheMeta, bool) {
+	var meta fetchCacheMeta
+	if f.cacheDir == "" {
+		return nil, meta, false
+	}
+	metaData, err := os.ReadFile(f.cachePath(url, ".json"))
+	if err != nil || json.Unmarshal(metaData, &meta) != nil || meta.URL != url {
+		return nil, meta, false
+	}
+	body, err := os.ReadFile(f.cachePath(url, ".body"))
+	if err != nil {
+		return nil, meta, false
+	}
+	return body, meta, true
+}
+
+// writeCache stores the response for url. The cache is an optimization, so
+// failures only produce a warning.
+func (f *fetcher) writeCache(url string, body []byte, meta fetchCacheMeta) {
+	if f.cacheDir == "" {
+		return
+	}
+	metaData, err := json.Marshal(meta)
+	if err == nil {
+		err = os.MkdirAll(f.cacheDir, 0o755)
+	}
+	if err == nil {
+		err = writeFileAtomic(f.cachePath(url, ".body"), body)
+	}
+	if err == nil {
+		err = writeFileAtomic(f.cachePath(url, ".json"), metaData)
+	}
+	if err != nil {
+		slog.Warn("cannot cache the download", "url", url, "error", err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// verifySHA256 checks that the SHA-256 of data matches the hex checksum.
+func verifySHA256(name string, data []byte, checksum string) error {
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, checksum) {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, checksum)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ipFields lists the fields -fields can select for each IP of JSON, NDJSON
+// and CSV output.
+var ipFields = []string{"address", "integer", "hex", "source", "prefix", "network", "broadcast", "tags"}
+
+const defaultFields = "address"
+
+// parseFields parses a comma-separated list of fields.
+func parseFields(list string) ([]string, error) {
+	fields := splitList(list)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("the -fields flag needs at least one field (expected %s)", strings.Join(ipFields, ", "))
+	}
+	for i, field := range fields {
+		if !slices.Contains(ipFields, field) {
+			return nil, fmt.Errorf("unsupported field: %s (expected one of %s)", field, strings.Join(ipFields, ", "))
+		}
+		if slices.Contains(fields[:i], field) {
+			return nil, fmt.Errorf("the field %s is given more than once", field)
+		}
+	}
+	return fields, nil
+}
+
+// fieldWriter describes each IP with the -fields fields, finding the block
+// the IP came from for the source, prefix, network, broadcast and tags
+// fields. An IP outside every block, which only a -sample or page of
+// overlapping blocks could give, has empty block fields.
+type fieldWriter struct {
+	fields []string
+	index  *sourceIndex
+}
+
+// newFieldWriter returns the fieldWriter of fields, or nil if the bare
+// address is all that was asked for.
+func newFieldWriter(list, algorithm string, cidrRanges []CIDRRange) (*fieldWriter, error) {
+	fields, err := parseFields(list)
+	if err != nil || slices.Equal(fields, []string{"address"}) {
+		return nil, err
+	}
+	return &fieldWriter{fields: fields, index: newSourceIndex(algorithm, cidrRanges)}, nil
+}
+
+// values returns the value of each field of ip: strings, numbers, booleans,
+// the tags of the block, or nil when the IP has no block.
+func (f *fieldWriter) values(ip string) ([]any, error) {
+	n, err := parseIPv4(ip)
+	if err != nil {
+		return nil, err
+	}
+	cidr := f.index.lookup(n)
+	values := make([]any, len(f.fields))
+	for i, field := range f.fields {
+		switch field {
+		case "address":
+			values[i] = ip
+		case "integer":
+			values[i] = n
+		case "hex":
+			values[i] = fmt.Sprintf("0x%08x", n)
+		}
+		if cidr == nil {
+			continue
+		}
+		switch field {
+		case "source":
+			values[i] = cidr.String()
+		case "prefix":
+			values[i], _ = cidr.ipNet.Mask.Size()
+		case "network":
+			values[i] = !cidr.isPointToPoint() && n == cidr.network()
+		case "broadcast":
+			values[i] = !cidr.isPointToPoint() && n == cidr.broadcast()
+		case "tags":
+			values[i] = cidr.metadata
+		}
+	}
+	return values, nil
+}
+
+// csvRecord returns the fields of ip as CSV cells, with tags as
+// name=value pairs separated by semicolons.
+func (f *fieldWriter) csvRecord(ip string) ([]string, error) {
+	values, err := f.values(ip)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch value := value.(type) {
+		case string:
+			record[i] = value
+		case uint32:
+			record[i] = strconv.FormatUint(uint64(value), 10)
+		case int:
+			record[i] = strconv.Itoa(value)
+		case bool:
+			record[i] = strconv.FormatBool(value)
+		case map[string]string:
+			record[i] = formatMetadata(value)
+		}
+	}
+	return record, nil
+}
+
+// jsonObject returns the fields of ip as a JSON object, indented the way
+// json.MarshalIndent indents the objects of an array when indent is set.
+func (f *fieldWriter) jsonObject(ip string, indent bool) (string, error) {
+	values, err := f.values(ip)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, value := range values {
+		var data []byte
+		if indent {
+			data, err = json.MarshalIndent(value, "    ", "  ")
+		} else {
+			data, err = json.Marshal(value)
+		}
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if indent {
+			b.WriteString("\n    ")
+		}
+		b.WriteString(strconv.Quote(f.fields[i]))
+		b.WriteByte(':')
+		if indent {
+			b.WriteByte(' ')
+		}
+		b.Write(data)
+	}
+	if indent {
+		b.WriteString("\n  ")
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
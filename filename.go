@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultFilenameTemplate = "ips_{{.CIDRs}}_{{.Date}}"
+	// maxFilenameCIDRs is the longest .CIDRs of a generated file name; a
+	// longer -cidr list is shortened to its first block and the number of
+	// others.
+	maxFilenameCIDRs = 64
+	// maxFilename is the longest file name most file systems accept, in
+	// bytes.
+	maxFilename = 255
+)
+
+// filenameData is what -filename-template renders generated file names from.
+type filenameData struct {
+	Date      string // the time the output was started, such as 2026-10-14T09-30-00
+	Format    string // the -output format
+	Hash      string // the first 12 hex digits of the SHA-256 of the merged blocks
+	FirstCIDR string // the first -cidr block, or empty without -cidr
+	CIDRs     string // the -cidr list, shortened when it is long
+}
+
+// parseFilenameTemplate parses -filename-template, and checks it renders
+// with the fields of filenameData.
+func parseFilenameTemplate(text string) (*template.Template, error) {
+	tmpl, err := parseHostNameTemplate("filename-template", text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(new(strings.Builder), filenameData{}); err != nil {
+		return nil, fmt.Errorf("invalid -filename-template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// outputFilename returns the generated name of the file the output format
+// of the IPs of cidrRanges is written to: -filename-template rendered,
+// sanitized and given the extension.
+func outputFilename(config Config, cidrRanges []CIDRRange, extension string) (string, error) {
+	tmpl, err := parseFilenameTemplate(config.FilenameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	cidrs := splitList(config.CIDRListStr)
+	data := filenameData{
+		Date:   time.Now().Format("2006-01-02T15-04-05"),
+		Format: config.OutputFormat,
+		Hash:   blocksHash(cidrRanges),
+		CIDRs:  strings.Join(cidrs, ","),
+	}
+	if len(cidrs) > 0 {
+		data.FirstCIDR = cidrs[0]
+	}
+	if len(data.CIDRs) > maxFilenameCIDRs {
+		data.CIDRs = fmt.Sprintf("%s_and_%d_more", cidrs[0], len(cidrs)-1)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid -filename-template: %w", err)
+	}
+	name := sanitizeFilename(b.String())
+	if name == "" {
+		name = "ips"
+	}
+	suffix := "." + extension
+	if len(name)+len(suffix) > maxFilename {
+		tail := "_" + data.Hash
+		name = name[:maxFilename-len(suffix)-len(tail)] + tail
+	}
+	return name + suffix, nil
+}
+
+// sanitizeFilename makes name safe to use as a file name on any system and
+// in a shell: a / becomes a -, so that 10.0.0.0/8 reads 10.0.0.0-8, a comma
+// becomes a _ and any other character but letters, digits and ._+=@- becomes
+// a -. Leading dots and dashes, which would hide the file or read as a flag,
+// are dropped.
+func sanitizeFilename(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("._+=@-", r):
+			return r
+		case r == ',':
+			return '_'
+		}
+		return '-'
+	}, name)
+	return strings.TrimLeft(sanitized, ".-")
+}
+
+// blocksHash returns the first 12 hex digits of the SHA-256 of the merged
+// blocks, one per line, which identifies the addresses an expansion covers
+// whatever the order or form of its input.
+func blocksHash(cidrRanges []CIDRRange) string {
+	hash := sha256.New()
+	for _, block := range rangesToCIDRs(mergeIPRanges(toIPRanges(cidrRanges))) {
+		fmt.Fprintln(hash, block.String())
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"math/bits"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// firewallFormats are the input formats of firewall configurations, whose
+// network objects are extracted as entries.
+var firewallFormats = []string{"iptables", "nftables", "pf", "cisco"}
+
+// firewallFirstLines match the first line, that is not blank or a comment,
+// of each firewall configuration format.
+var firewallFirstLines = map[string]*regexp.Regexp{
+	"iptables": regexp.MustCompile(`^(\*(filter|nat|mangle|raw|security)$|:[A-Z_-]+ \S+ \[|-A )`),
+	"nftables": regexp.MustCompile(`^(flush ruleset|(add |create )?(table|chain|rule|set|element) (ip|ip6|inet|arp|bridge|netdev) |define )`),
+	"pf":       regexp.MustCompile(`^(pass|block|match|antispoof|scrub|anchor|set [a-z-]+ |table\s*<|\w+\s*=\s*["{]?)`),
+	"cisco":    regexp.MustCompile(`^(!|access-list |ip access-list |object network |object-group |hostname |interface |(\d+ )?(permit|deny) )`),
+}
+
+// sniffFirewallFormat returns the firewall format line starts, or "".
+func sniffFirewallFormat(line string) string {
+	for _, format := range firewallFormats {
+		if firewallFirstLines[format].MatchString(line) {
+			return format
+		}
+	}
+	return ""
+}
+
+// isFirewallSeparator reports whether r separates the tokens of a firewall
+// rule. Braces, brackets and commas delimit sets in nftables and pf.
+func isFirewallSeparator(r rune) bool {
+	switch r {
+	case ' ', '\t', ',', '{', '}', '(', ')', '[', ']', '<', '>', '"', '\'', ';', '=':
+		return true
+	}
+	return false
+}
+
+// readFirewallEntries extracts every IPv4 address, CIDR block and address
+// range from a firewall configuration, such as the output of iptables-save
+// or nft list ruleset, a pf.conf or a Cisco IOS or ASA configuration.
+// Negated objects such as !10.0.0.0/8 are extracted too, as the point is to
+// see what the rules refer to. In Cisco configurations, an address followed
+// by a wildcard or subnet mask is read as one block, "host" and "range"
+// objects are understood, remarks and descriptions are skipped, and prefix
+// lists are expanded as readPrefixListEntries does.
+func readFirewallEntries(r io.Reader, name, format string) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1<<20)
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			line := scanner.Text()
+			origin := fmt.Sprintf("%s:%d", name, lineNum)
+			if format == "cisco" {
+				trimmed := strings.TrimSpace(line)
+				if strings.HasPrefix(trimmed, "!") {
+					continue
+				}
+				if strings.HasPrefix(trimmed, "ip prefix-list ") {
+					if !yieldPrefixList(line, origin, yield) {
+						return
+					}
+					continue
+				}
+			} else {
+				line, _, _ = strings.Cut(line, "#")
+			}
+
+			for _, text := range firewallObjects(strings.FieldsFunc(line, isFirewallSeparator), format == "cisco") {
+				if !yield(inputEntry{text: text, origin: origin}, nil) {
+					return
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", name, err))
+		}
+	}
+}
+
+// firewallObjects returns the network objects among the tokens of a rule,
+// as entries.
+func firewallObjects(tokens []string, cisco bool) []string {
+	var objects []string
+	for i := 0; i < len(tokens); i++ {
+		token := strings.TrimPrefix(tokens[i], "!")
+		if cisco {
+			switch strings.ToLower(token) {
+			case "remark", "description":
+				return objects
+			case "range":
+				if i+2 < len(tokens) && isIPv4(tokens[i+1]) && isIPv4(tokens[i+2]) {
+					objects = append(objects, tokens[i+1]+"-"+tokens[i+2])
+					i += 2
+				}
+				continue
+			}
+			if isIPv4(token) && i+1 < len(tokens) && isIPv4(tokens[i+1]) {
+				if prefix, ok := netmaskPrefix(tokens[i+1]); ok && tokens[i+1] != "0.0.0.0" {
+					objects = append(objects, token+"/"+strconv.Itoa(prefix))
+				} else {
+					objects = append(objects, token+" "+tokens[i+1])
+				}
+				i++
+				continue
+			}
+		}
+		if object, ok := firewallObject(token); ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
+
+// firewallObject returns the entry for a token that is an IPv4 address,
+// CIDR block or address range, possibly with a port as in 10.0.0.1:80 or a
+// subnet mask as in 10.0.0.0/255.0.0.0.
+func firewallObject(token string) (string, bool) {
+	if host, port, ok := strings.Cut(token, ":"); ok && isIPv4(host) {
+		if _, err := strconv.ParseUint(port, 10, 16); err == nil {
+			token = host
+		}
+	}
+	switch {
+	case isIPv4(token):
+		return token, true
+	case isAddressRange(token):
+		return token, true
+	}
+	addr, mask, ok := strings.Cut(token, "/")
+	if !ok || !isIPv4(addr) {
+		return "", false
+	}
+	if prefix, err := strconv.Atoi(mask); err == nil && prefix >= 0 && prefix <= 32 {
+		return token, true
+	}
+	if prefix, ok := netmaskPrefix(mask); ok {
+		return addr + "/" + strconv.Itoa(prefix), true
+	}
+	return "", false
+}
+
+// isIPv4 reports whether s is a dotted IPv4 address.
+func isIPv4(s string) bool {
+	return strings.Count(s, ".") == 3 && net.ParseIP(s).To4() != nil
+}
+
+// netmaskPrefix returns the prefix length of a contiguous subnet mask such
+// as 255.255.255.0.
+func netmaskPrefix(s string) (int, bool) {
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return 0, false
+	}
+	mask := ipToUint(ip)
+	prefix := bits.LeadingZeros32(^mask)
+	return prefix, prefix == 32 || mask<<prefix == 0
+}
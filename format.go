@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultInputFormat = "auto"
+
+// inputFormats lists the formats -input-format accepts.
+var inputFormats = slices.Concat([]string{"auto", "plain", "json", "csv", "yaml", "terraform", "prefix-list"}, firewallFormats)
+
+// csvCIDRColumns are the header names of the CSV column holding the CIDR
+// blocks, in order of preference.
+var csvCIDRColumns = []string{"cidr", "prefix", "ip_prefix", "cidr_block", "network", "subnet", "block", "range", "address", "ip"}
+
+// csvHeaderModes are the values -csv-header accepts.
+var csvHeaderModes = []string{"auto", "yes", "no"}
+
+// yamlKeyLine matches a line starting a YAML mapping, e.g. "networks:".
+var yamlKeyLine = regexp.MustCompile(`^[\w.-]+:(\s|$)`)
+
+// inputFormat describes how a list file, stdin or downloaded list is
+// encoded.
+type inputFormat struct {
+	name  string // one of inputFormats
+	field string // the dot-separated path of the CIDR field in JSON and YAML
+
+	csvColumn    string // the name or 1-based index of the CIDR column in CSV
+	csvDelimiter rune   // the CSV column separator, a comma when zero
+	csvHeader    string // one of csvHeaderModes, auto when empty
+}
+
+// autoFormat detects the format of each list and extracts every field that
+// is a CIDR block or IP.
+var autoFormat = inputFormat{name: defaultInputFormat}
+
+// readFormatted reads the entries of r in the given format. In auto mode
+// the format is detected from the extension of name, or from the first line
+// that is not blank or a comment, which keeps plain lists streaming.
+func readFormatted(r io.Reader, name string, format inputFormat) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		formatName := format.name
+		if formatName == "auto" {
+			var err error
+			formatName, r, err = detectFormat(r, name)
+			if err != nil {
+				yield(inputEntry{}, fmt.Errorf("error reading %s: %w", name, err))
+				return
+			}
+		}
+
+		var entries iter.Seq2[inputEntry, error]
+		switch formatName {
+		case "json", "terraform":
+			entries = readJSONEntries(r, name, format.field, formatName == "terraform")
+		case "yaml":
+			entries = readYAMLEntries(r, name, format.field)
+		case "csv":
+			entries = readCSVEntries(r, name, format)
+		case "prefix-list":
+			entries = readPrefixListEntries(r, name)
+		case "iptables", "nftables", "pf", "cisco":
+			entries = readFirewallEntries(r, name, formatName)
+		default:
+			entries = readEntries(r, name)
+		}
+		for entry, err := range entries {
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
+
+// detectFormat returns the format of the list read from r, and a reader
+// that still returns everything read while detecting it.
+func detectFormat(r io.Reader, name string) (string, io.Reader, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".ndjson", ".jsonl":
+		return "json", r, nil
+	case ".tfstate":
+		return "terraform", r, nil
+	case ".csv":
+		return "csv", r, nil
+	case ".yaml", ".yml":
+		return "yaml", r, nil
+	case ".nft":
+		return "nftables", r, nil
+	case ".txt", ".lst", ".list":
+		return "plain", r, nil
+	}
+
+	reader := bufio.NewReader(r)
+	var consumed bytes.Buffer
+	for {
+		line, err := reader.ReadString('\n')
+		consumed.WriteString(line)
+		body := io.MultiReader(&consumed, reader)
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return sniffFormat(trimmed), body, nil
+		}
+		if err == io.EOF {
+			return "plain", body, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+}
+
+// sniffFormat guesses the format of a list from its first meaningful line.
+func sniffFormat(line string) string {
+	switch {
+	case strings.HasPrefix(line, "[") || strings.HasPrefix(line, "{"):
+		return "json"
+	case prefixListFirstLine.MatchString(line):
+		return "prefix-list"
+	case sniffFirewallFormat(line) != "":
+		return sniffFirewallFormat(line)
+	case line == "---" || strings.HasPrefix(line, "- ") || yamlKeyLine.MatchString(line):
+		return "yaml"
+	case strings.Contains(line, ","):
+		return "csv"
+	}
+	return "plain"
+}
+
+// isEntryValue reports whether a value found while extracting fields
+// without an -input-field path is a CIDR block or IP.
+func isEntryValue(s string) bool {
+	if strings.HasPrefix(s, "@") {
+		return false
+	}
+	_, err := parseEntry(s)
+	return err == nil
+}
+
+// splitFieldPath splits a dot-separated field path, where an empty path
+// selects every value that is a CIDR block or IP.
+func splitFieldPath(field string) []string {
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, ".")
+}
+
+// readJSONEntries extracts the entries from a JSON document, or from a
+// stream of documents such as JSON Lines. With a field path, the values at
+// that path are the entries, and arrays along the way are traversed element
+// by element. Without one, the CIDR blocks of the resources of a Terraform
+// state or plan are, as is every string that is a CIDR block or IP in other
+// documents. With terraform set, every document must be a Terraform state
+// or plan.
+func readJSONEntries(r io.Reader, name, field string, terraform bool) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		path := splitFieldPath(field)
+		decoder := json.NewDecoder(r)
+		for doc := 1; ; doc++ {
+			var value any
+			if err := decoder.Decode(&value); err == io.EOF {
+				return
+			} else if err != nil {
+				yield(inputEntry{}, fmt.Errorf("error parsing %s: %w", name, err))
+				return
+			}
+
+			location := name + ":"
+			if doc > 1 {
+				location = fmt.Sprintf("%s:%d:", name, doc)
+			}
+			if (terraform || field == "") && isTerraformDocument(value) {
+				if !walkTerraform(value.(map[string]any), strings.TrimSuffix(location, ":"), yield) {
+					return
+				}
+				continue
+			}
+			if terraform {
+				yield(inputEntry{}, fmt.Errorf("%s is not a Terraform state or plan", name))
+				return
+			}
+			if !walkJSON(value, path, field != "", location+"$", yield) {
+				return
+			}
+		}
+	}
+}
+
+// walkJSON yields the entries within value, which was found at location. It
+// returns false once yield asks to stop or an error was yielded.
+func walkJSON(value any, path []string, explicit bool, location string, yield func(inputEntry, error) bool) bool {
+	switch v := value.(type) {
+	case []any:
+		for i, item := range v {
+			if !walkJSON(item, path, explicit, fmt.Sprintf("%s[%d]", location, i), yield) {
+				return false
+			}
+		}
+	case map[string]any:
+		if len(path) == 0 {
+			if explicit {
+				yield(inputEntry{}, fmt.Errorf("%s: expected a CIDR block, found an object", location))
+				return false
+			}
+			// Decoding into a map loses the order the keys were written
+			// in, so walk them in a deterministic one.
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				if !walkJSON(v[key], nil, false, location+"."+key, yield) {
+					return false
+				}
+			}
+			return true
+		}
+		if item, ok := v[path[0]]; ok {
+			return walkJSON(item, path[1:], explicit, location+"."+path[0], yield)
+		}
+	case string:
+		if len(path) == 0 && (explicit || isEntryValue(v)) {
+			return yield(inputEntry{text: strings.TrimSpace(v), origin: location}, nil)
+		}
+	default:
+		if len(path) == 0 && explicit && v != nil {
+			yield(inputEntry{}, fmt.Errorf("%s: expected a CIDR block, found %v", location, v))
+			return false
+		}
+	}
+	return true
+}
+
+// readYAMLEntries extracts the entries from a YAML stream the same way
+// readJSONEntries does, recording the line each entry was found on.
+func readYAMLEntries(r io.Reader, name, field string) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		path := splitFieldPath(field)
+		decoder := yaml.NewDecoder(r)
+		for {
+			var doc yaml.Node
+			if err := decoder.Decode(&doc); errors.Is(err, io.EOF) {
+				return
+			} else if err != nil {
+				yield(inputEntry{}, fmt.Errorf("error parsing %s: %w", name, err))
+				return
+			}
+			if !walkYAML(&doc, path, field != "", name, yield) {
+				return
+			}
+		}
+	}
+}
+
+// walkYAML yields the entries within node. It returns false once yield asks
+// to stop or an error was yielded.
+func walkYAML(node *yaml.Node, path []string, explicit bool, name string, yield func(inputEntry, error) bool) bool {
+	location := fmt.Sprintf("%s:%d", name, node.Line)
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, item := range node.Content {
+			if !walkYAML(item, path, explicit, name, yield) {
+				return false
+			}
+		}
+	case yaml.AliasNode:
+		return walkYAML(node.Alias, path, explicit, name, yield)
+	case yaml.MappingNode:
+		if len(path) == 0 && explicit {
+			yield(inputEntry{}, fmt.Errorf("%s: expected a CIDR block, found a mapping", location))
+			return false
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			switch {
+			case len(path) == 0:
+				if !walkYAML(value, nil, false, name, yield) {
+					return false
+				}
+			case key == path[0]:
+				return walkYAML(value, path[1:], explicit, name, yield)
+			}
+		}
+	case yaml.ScalarNode:
+		if len(path) > 0 || node.Tag == "!!null" {
+			return true
+		}
+		if explicit || (node.Tag == "!!str" && isEntryValue(node.Value)) {
+			return yield(inputEntry{text: strings.TrimSpace(node.Value), origin: location}, nil)
+		}
+	}
+	return true
+}
+
+// readCSVEntries extracts the entries from the CIDR column of a CSV file,
+// carrying the other columns along as the metadata of each entry. The column
+// is the one named or numbered by -csv-column, or else the first whose
+// header is one of csvCIDRColumns. When no header matches, the first row is
+// treated as data and the column is the first holding a CIDR block or IP.
+func readCSVEntries(r io.Reader, name string, format inputFormat) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.Comment = '#'
+		reader.TrimLeadingSpace = true
+		if format.csvDelimiter != 0 {
+			reader.Comma = format.csvDelimiter
+		}
+
+		column := -1
+		var header []string
+		for first := true; ; first = false {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				yield(inputEntry{}, fmt.Errorf("error parsing %s: %w", name, err))
+				return
+			}
+
+			if first {
+				if column, err = csvColumn(record, format); err != nil {
+					yield(inputEntry{}, fmt.Errorf("%s: %w", name, err))
+					return
+				}
+				if isCSVHeader(record, column, format) {
+					header = record
+					continue
+				}
+				if column < 0 {
+					if column = csvEntryColumn(record); column < 0 {
+						yield(inputEntry{}, fmt.Errorf("%s: no column with a header such as %q or holding CIDR blocks", name, csvCIDRColumns[0]))
+						return
+					}
+				}
+			} else if column < 0 {
+				// The header named no CIDR column, so find it in the
+				// first row of data.
+				if column = csvEntryColumn(record); column < 0 {
+					yield(inputEntry{}, fmt.Errorf("%s: no column with a header such as %q or holding CIDR blocks", name, csvCIDRColumns[0]))
+					return
+				}
+			}
+
+			if column >= len(record) {
+				continue
+			}
+			value := strings.TrimSpace(record[column])
+			if value == "" {
+				continue
+			}
+			line, _ := reader.FieldPos(column)
+			entry := inputEntry{text: value, origin: name + ":" + strconv.Itoa(line), metadata: csvMetadata(header, record, column)}
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+// csvColumn returns the index of the CIDR column given the first row of a
+// CSV file, or -1 when it has to be found in the data.
+func csvColumn(first []string, format inputFormat) (int, error) {
+	if format.csvColumn == "" {
+		if format.csvHeader == "no" {
+			return -1, nil
+		}
+		return csvHeaderColumn(first), nil
+	}
+	if index, err := strconv.Atoi(format.csvColumn); err == nil {
+		return index - 1, nil
+	}
+	for i, name := range first {
+		if strings.EqualFold(strings.TrimSpace(name), format.csvColumn) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no column named %q", format.csvColumn)
+}
+
+// isCSVHeader reports whether the first row of a CSV file is a header. In
+// auto mode it is when the CIDR column was found by name, or when the row
+// holds no CIDR block or IP where the column is, or in any column when the
+// column is not known yet.
+func isCSVHeader(first []string, column int, format inputFormat) bool {
+	switch format.csvHeader {
+	case "yes":
+		return true
+	case "no":
+		return false
+	}
+	if _, err := strconv.Atoi(format.csvColumn); err != nil && column >= 0 {
+		return true
+	}
+	if column < 0 {
+		return csvEntryColumn(first) < 0
+	}
+	return column >= len(first) || !isEntryValue(strings.TrimSpace(first[column]))
+}
+
+// csvMetadata returns the columns of a CSV record besides the CIDR column,
+// named by the header or, without one, by their 1-based index.
+func csvMetadata(header, record []string, column int) map[string]string {
+	var metadata map[string]string
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		if i == column || value == "" {
+			continue
+		}
+		name := "column" + strconv.Itoa(i+1)
+		if i < len(header) && strings.TrimSpace(header[i]) != "" {
+			name = strings.TrimSpace(header[i])
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[name] = value
+	}
+	return metadata
+}
+
+// csvDelimiter parses the -csv-delimiter flag, which is a single character,
+// or \t or tab for tab-separated files.
+func csvDelimiter(s string) (rune, error) {
+	switch s {
+	case "", ",":
+		return ',', nil
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	runes := []rune(s)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' || runes[0] == utf8.RuneError {
+		return 0, fmt.Errorf("invalid -csv-delimiter: %q (expected a single character)", s)
+	}
+	return runes[0], nil
+}
+
+// checkCSVOptions validates the -csv-* flags.
+func checkCSVOptions(config Config) error {
+	if _, err := csvDelimiter(config.CSVDelimiter); err != nil {
+		return err
+	}
+	if !slices.Contains(csvHeaderModes, config.CSVHeader) {
+		return fmt.Errorf("unsupported -csv-header value: %s (expected one of %s)", config.CSVHeader, strings.Join(csvHeaderModes, ", "))
+	}
+	if config.CSVColumn == "" {
+		return nil
+	}
+	if index, err := strconv.Atoi(config.CSVColumn); err == nil {
+		if index < 1 {
+			return fmt.Errorf("invalid -csv-column: %d (columns are numbered from 1)", index)
+		}
+	} else if config.CSVHeader == "no" {
+		return fmt.Errorf("the -csv-column flag must be an index when -csv-header=no")
+	}
+	return nil
+}
+
+// csvHeaderColumn returns the index of the preferred CIDR column in a header
+// row, or -1 when the row is not a header naming one.
+func csvHeaderColumn(header []string) int {
+	for _, want := range csvCIDRColumns {
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), want) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// csvEntryColumn returns the index of the first value in record that is a
+// CIDR block or IP, or -1 when there is none.
+func csvEntryColumn(record []string) int {
+	for i, value := range record {
+		if isEntryValue(strings.TrimSpace(value)) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runGaps writes the unallocated space of the parent block given to -gaps as
+// the minimal list of CIDR blocks not covered by any of the CIDR ranges.
+func runGaps(config Config, cidrRanges []CIDRRange) error {
+	parent, err := parseNormalizedCIDR(config.Gaps)
+	if err != nil {
+		return fmt.Errorf("invalid -gaps parent: %w", err)
+	}
+	return writeCIDRList(os.Stdout, config.OutputFormat, findGaps(parent, cidrRanges))
+}
+
+// findGaps returns the minimal list of CIDR blocks covering the addresses of
+// parent that are not in any of the allocated ranges.
+func findGaps(parent CIDRRange, allocated []CIDRRange) []CIDRRange {
+	free := subtractIPRanges([]ipRange{{Start: parent.start, End: parent.end}}, mergeIPRanges(toIPRanges(allocated)))
+	return rangesToCIDRs(free)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// gcsStore reads objects from Google Cloud Storage with the Cloud Storage
+// client, using Application Default Credentials.
+type gcsStore struct {
+	fetcher *fetcher
+
+	once   sync.Once
+	client *storage.Client
+	err    error
+}
+
+// open starts reading the named object in bucket. Requests go to the
+// emulator set with STORAGE_EMULATOR_HOST, without credentials, if there is
+// one.
+func (s *gcsStore) open(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+	s.once.Do(func() { s.client, s.err = newGCSClient(ctx) })
+	if s.err != nil {
+		return nil, s.err
+	}
+	r, err := s.client.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching gs://%s/%s: %w", bucket, object, err)
+	}
+	return r, nil
+}
+
+// newGCSClient returns a client authenticated with the credentials file
+// named by GOOGLE_APPLICATION_CREDENTIALS or written by gcloud, or with the
+// metadata server on Google Cloud. Requests are anonymous when there are no
+// credentials, so that public objects can still be read.
+func newGCSClient(ctx context.Context) (*storage.Client, error) {
+	client, err := storage.NewClient(ctx, option.WithScopes(storage.ScopeReadOnly), option.WithUserAgent(userAgent))
+	if err == nil {
+		return client, nil
+	}
+	if os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") != "" {
+		return nil, fmt.Errorf("error loading GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+	}
+	return storage.NewClient(ctx, option.WithoutAuthentication(), option.WithUserAgent(userAgent))
+}
@@ -0,0 +1,192 @@
+//go:build ignore
+
+// gen_sets generates sets_table.go, the built-in address sets, from the IANA
+// IPv4 Special-Purpose Address Registry. Run it with go generate to pick up
+// changes to the registry, or pass -src to use a downloaded copy.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+const registryURL = "https://www.iana.org/assignments/iana-ipv4-special-registry/iana-ipv4-special-registry-1.csv"
+
+// record is a row of the registry.
+type record struct {
+	blocks            []netip.Prefix
+	name              string
+	rfc               string
+	globallyReachable bool
+	terminated        bool
+}
+
+// multicast is not part of the special-purpose registry, it has a registry
+// of its own.
+var multicast = netip.MustParsePrefix("224.0.0.0/4")
+
+// set describes how a built-in set is selected from the registry.
+type set struct {
+	name        string
+	description string
+	match       func(record) bool
+	extra       []netip.Prefix
+}
+
+var sets = []set{
+	{name: "this-network", description: `"This network" (RFC 791)`, match: rfc("RFC791")},
+	{name: "rfc1918", description: "Private-Use networks (RFC 1918)", match: rfc("RFC1918")},
+	{name: "rfc6598", description: "Shared Address Space for carrier-grade NAT (RFC 6598)", match: rfc("RFC6598")},
+	{name: "loopback", description: "Loopback (RFC 1122)", match: named("Loopback")},
+	{name: "link-local", description: "Link Local (RFC 3927)", match: named("Link Local")},
+	{name: "ietf-protocol", description: "IETF Protocol Assignments (RFC 6890)", match: named("IETF Protocol Assignments")},
+	{name: "test-net", description: "Documentation, TEST-NET-1 to 3 (RFC 5737)", match: rfc("RFC5737")},
+	{name: "benchmarking", description: "Benchmarking (RFC 2544)", match: rfc("RFC2544")},
+	{name: "multicast", description: "Multicast (RFC 5771)", extra: []netip.Prefix{multicast}},
+	{name: "reserved", description: "Reserved for future use (RFC 1112)", match: named("Reserved")},
+	{name: "broadcast", description: "Limited Broadcast (RFC 919)", match: named("Limited Broadcast")},
+	{name: "special", description: "Every block in the IANA IPv4 Special-Purpose Address Registry", match: func(record) bool { return true }},
+	{name: "bogons", description: "Every block that is not globally reachable, including multicast", match: func(r record) bool { return !r.globallyReachable && !r.terminated }, extra: []netip.Prefix{multicast}},
+}
+
+func rfc(name string) func(record) bool {
+	return func(r record) bool { return strings.Contains(r.rfc, "["+name+"]") }
+}
+
+func named(name string) func(record) bool {
+	return func(r record) bool { return r.name == name }
+}
+
+func main() {
+	src := flag.String("src", registryURL, "the URL or path of the registry CSV")
+	out := flag.String("o", "sets_table.go", "the file to write")
+	flag.Parse()
+
+	data, err := readSource(*src)
+	if err != nil {
+		log.Fatal(err)
+	}
+	records, err := parseRegistry(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by go run gen_sets.go; DO NOT EDIT.\n\n")
+	buf.WriteString("package main\n\n")
+	buf.WriteString("// builtinSets maps the name of each built-in address set to its blocks,\n")
+	buf.WriteString("// as listed in the IANA IPv4 Special-Purpose Address Registry.\n")
+	buf.WriteString("var builtinSets = map[string]builtinSet{\n")
+	for _, s := range sets {
+		blocks := slices.Clone(s.extra)
+		for _, r := range records {
+			if s.match != nil && s.match(r) {
+				blocks = append(blocks, r.blocks...)
+			}
+		}
+		blocks = dropCovered(blocks)
+		if len(blocks) == 0 {
+			log.Fatalf("set %s matches no blocks in the registry", s.name)
+		}
+
+		fmt.Fprintf(&buf, "%q: {\ndescription: %q,\ncidrs: []string{\n", s.name, s.description)
+		for _, block := range blocks {
+			fmt.Fprintf(&buf, "%q,\n", block)
+		}
+		buf.WriteString("},\n},\n")
+	}
+	buf.WriteString("}\n")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readSource(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.ReadFile(src)
+	}
+	resp, err := http.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", src, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parseRegistry parses the registry CSV. Cells may carry footnote markers
+// such as "[2]", and a row may list several blocks.
+func parseRegistry(data []byte) ([]record, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 || rows[0][0] != "Address Block" || rows[0][8] != "Globally Reachable" {
+		return nil, fmt.Errorf("unexpected registry header %q", rows[0])
+	}
+
+	var records []record
+	for _, row := range rows[1:] {
+		r := record{
+			name:              strings.Trim(stripFootnotes(row[1]), `"`),
+			rfc:               strings.ReplaceAll(row[2], " ", ""),
+			globallyReachable: strings.HasPrefix(row[8], "True"),
+			terminated:        row[4] != "N/A",
+		}
+		for _, block := range strings.Split(stripFootnotes(row[0]), ",") {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(block))
+			if err != nil {
+				return nil, err
+			}
+			r.blocks = append(r.blocks, prefix)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func stripFootnotes(s string) string {
+	for {
+		start := strings.Index(s, "[")
+		end := strings.Index(s, "]")
+		if start < 0 || end < start {
+			return strings.TrimSpace(s)
+		}
+		s = s[:start] + s[end+1:]
+	}
+}
+
+// dropCovered sorts the blocks and drops those covered by another block.
+func dropCovered(blocks []netip.Prefix) []netip.Prefix {
+	slices.SortFunc(blocks, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+	var result []netip.Prefix
+	for _, block := range blocks {
+		if len(result) > 0 && result[len(result)-1].Overlaps(block) {
+			continue
+		}
+		result = append(result, block)
+	}
+	return result
+}
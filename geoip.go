@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoipRecord is the subset of a GeoIP2 or GeoLite2 Country, City or ASN
+// record used to select networks.
+type geoipRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN uint32 `maxminddb:"autonomous_system_number"`
+}
+
+// country returns the country the network is located in, or else the one it
+// is registered in.
+func (r geoipRecord) country() string {
+	if r.Country.ISOCode != "" {
+		return r.Country.ISOCode
+	}
+	return r.RegisteredCountry.ISOCode
+}
+
+// geoipFilter selects networks of a GeoIP database by country code, AS
+// number and city. An empty list matches everything.
+type geoipFilter struct {
+	countries []string
+	asns      []uint32
+	cities    []string
+}
+
+// newGeoIPFilter returns the filter selecting the networks given with
+// -geoip-country, -geoip-asn and -geoip-city.
+func newGeoIPFilter(config Config) (geoipFilter, error) {
+	filter := geoipFilter{
+		countries: splitList(config.GeoIPCountries),
+		cities:    splitList(config.GeoIPCities),
+	}
+	for _, asn := range splitList(config.GeoIPASNs) {
+		number, err := parseASN(asn)
+		if err != nil {
+			return filter, err
+		}
+		filter.asns = append(filter.asns, number)
+	}
+	return filter, nil
+}
+
+// parseASN parses an AS number, with or without an "AS" prefix.
+func parseASN(s string) (uint32, error) {
+	digits := strings.TrimPrefix(strings.ToUpper(s), "AS")
+	number, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AS number %q", s)
+	}
+	return uint32(number), nil
+}
+
+// matches reports whether a network with the given record is selected by
+// the filter. A city matches any of its localized names.
+func (f geoipFilter) matches(record geoipRecord) bool {
+	if !matchesAny(f.countries, record.country()) {
+		return false
+	}
+	if len(f.asns) > 0 && !slices.Contains(f.asns, record.ASN) {
+		return false
+	}
+	if len(f.cities) > 0 && !slices.ContainsFunc(f.cities, func(city string) bool {
+		for _, name := range record.City.Names {
+			if strings.EqualFold(name, city) {
+				return true
+			}
+		}
+		return false
+	}) {
+		return false
+	}
+	return true
+}
+
+// label describes the networks with the given record in their origin, e.g.
+// "geoip:NL/Amsterdam" or "geoip:AS13335".
+func (f geoipFilter) label(record geoipRecord) string {
+	var parts []string
+	if country := record.country(); country != "" && len(f.countries) > 0 {
+		parts = append(parts, country)
+	}
+	if city := record.City.Names["en"]; city != "" && len(f.cities) > 0 {
+		parts = append(parts, city)
+	}
+	if len(f.asns) > 0 {
+		parts = append(parts, fmt.Sprintf("AS%d", record.ASN))
+	}
+	return "geoip:" + strings.Join(parts, "/")
+}
+
+// geoipEntries yields the IPv4 networks of the MaxMind DB file at path
+// selected by -geoip-country, -geoip-asn and -geoip-city, in address order.
+func geoipEntries(config Config) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		path := config.GeoIP
+		filter, err := newGeoIPFilter(config)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", path, err))
+			return
+		}
+		defer reader.Close()
+
+		ipv4 := &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+		networks := reader.NetworksWithin(ipv4, maxminddb.SkipAliasedNetworks)
+		for networks.Next() {
+			var record geoipRecord
+			network, err := networks.Network(&record)
+			if err != nil {
+				yield(inputEntry{}, fmt.Errorf("error reading %s: %w", path, err))
+				return
+			}
+			if network.IP.To4() == nil || !filter.matches(record) {
+				continue
+			}
+			if !yield(inputEntry{text: network.String(), origin: filter.label(record)}, nil) {
+				return
+			}
+		}
+		if err := networks.Err(); err != nil {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", path, err))
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+	cidrsenseiv1 "github.com/ozfive/CIDR-Sensei/proto/cidrsensei/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // accept gzip-compressed messages
+	"google.golang.org/grpc/status"
+)
+
+// grpcService is the path prefix of the methods of the gRPC service defined
+// in proto/cidrsensei/v1/cidrsensei.proto.
+var grpcService = "/" + cidrsenseiv1.CIDRSensei_ServiceDesc.ServiceName + "/"
+
+// grpcMethods lists the methods of the gRPC service.
+var grpcMethods = []string{"Expand", "Aggregate", "Contains", "SetOp", "SubmitJob", "GetJob", "CancelJob"}
+
+// grpcServer answers the methods of the gRPC service, the job methods only
+// for the daemon command.
+type grpcServer struct {
+	cidrsenseiv1.UnimplementedCIDRSenseiServer
+	s *server
+}
+
+// newGRPCServer returns the gRPC server of the API, which limits request
+// messages to the -max-request-size and counts the calls in the metrics.
+func (s *server) newGRPCServer() *grpc.Server {
+	g := grpc.NewServer(
+		grpc.MaxRecvMsgSize(int(min(s.maxRequestSize, math.MaxInt32))),
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			resp, err := handler(ctx, req)
+			s.observeGRPC(ctx, info.FullMethod, err)
+			return resp, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			err := handler(srv, stream)
+			s.observeGRPC(stream.Context(), info.FullMethod, err)
+			return err
+		}),
+	)
+	cidrsenseiv1.RegisterCIDRSenseiServer(g, &grpcServer{s: s})
+	return g
+}
+
+// observeGRPC counts a call of the method that ended with err, and records
+// its status on the span of the request.
+func (s *server) observeGRPC(ctx context.Context, fullMethod string, err error) {
+	method, code := path.Base(fullMethod), int(status.Code(err))
+	s.metrics.observeGRPC(method, code)
+	currentSpan(ctx).set(slog.String("rpc.method", method), slog.Int("rpc.grpc.status_code", code))
+}
+
+// handleGRPC passes a call of a method of the gRPC service, which clients
+// make over HTTP/2, to the gRPC server.
+func handleGRPC(g *grpc.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("%s is a gRPC method, called over HTTP/2 with Content-Type: application/grpc", r.URL.Path))
+			return
+		}
+		g.ServeHTTP(w, r)
+	}
+}
+
+// Expand streams each address of the blocks, less the excluded ones, as an
+// Address message, until the client goes away or the server shuts down.
+func (g *grpcServer) Expand(req *cidrsenseiv1.ExpandRequest, stream grpc.ServerStreamingServer[cidrsenseiv1.Address]) error {
+	ranges, err := g.s.expandRanges(expandRequest{CIDRs: req.GetCidrs(), Exclude: req.GetExclude()})
+	if _, ok := err.(*overLimitError); ok {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	start := time.Now()
+	var messages uint64
+	// Send is done with the message once it returns, so one is reused
+	msg := new(cidrsenseiv1.Address)
+	err = cidrsensei.Expand(ranges, func(addr netip.Addr) error {
+		msg.Address, msg.Integer = addr.String(), cidrsensei.Uint32(addr)
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+		messages++
+		return nil
+	})
+	if ctxErr := stream.Context().Err(); err != nil && ctxErr != nil {
+		err = status.FromContextError(ctxErr).Err()
+	}
+	g.s.metrics.observeExpansion("grpc", messages, time.Since(start), err)
+	return err
+}
+
+// Aggregate merges the blocks into the fewest blocks covering them.
+func (g *grpcServer) Aggregate(_ context.Context, req *cidrsenseiv1.AggregateRequest) (*cidrsenseiv1.AggregateResponse, error) {
+	ranges, err := parseRequestRanges(req.GetCidrs())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	merged := cidrsensei.Merge(ranges)
+	return &cidrsenseiv1.AggregateResponse{Cidrs: prefixStrings(merged), Addresses: cidrsensei.Size(merged)}, nil
+}
+
+// Contains reports which of the blocks contain each IP.
+func (g *grpcServer) Contains(_ context.Context, req *cidrsenseiv1.ContainsRequest) (*cidrsenseiv1.ContainsResponse, error) {
+	results, err := checkRequestIPs(checkRequest{CIDRs: req.GetCidrs(), IPs: req.GetIps()})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp := &cidrsenseiv1.ContainsResponse{Results: make([]*cidrsenseiv1.ContainsResult, 0, len(results))}
+	for _, result := range results {
+		resp.Results = append(resp.Results, &cidrsenseiv1.ContainsResult{Ip: result.IP, Contained: result.Contained, Cidrs: result.CIDRs})
+	}
+	return resp, nil
+}
+
+// SetOp combines two lists of blocks.
+func (g *grpcServer) SetOp(_ context.Context, req *cidrsenseiv1.SetOpRequest) (*cidrsenseiv1.SetOpResponse, error) {
+	a, err := parseRequestRanges(req.GetA())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	b, err := parseRequestRanges(req.GetB())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var result []cidrsensei.Range
+	switch req.GetOperation() {
+	case cidrsenseiv1.SetOpRequest_OPERATION_UNION:
+		result = cidrsensei.Union(a, b)
+	case cidrsenseiv1.SetOpRequest_OPERATION_INTERSECT:
+		result = cidrsensei.Intersect(a, b)
+	case cidrsenseiv1.SetOpRequest_OPERATION_SUBTRACT:
+		result = cidrsensei.Subtract(a, b)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported operation: %s (expected OPERATION_UNION, OPERATION_INTERSECT or OPERATION_SUBTRACT)", req.GetOperation())
+	}
+	return &cidrsenseiv1.SetOpResponse{Cidrs: prefixStrings(result), Addresses: cidrsensei.Size(result)}, nil
+}
+
+// SubmitJob queues an expansion or aggregation job.
+func (g *grpcServer) SubmitJob(_ context.Context, req *cidrsenseiv1.SubmitJobRequest) (*cidrsenseiv1.Job, error) {
+	if err := g.checkJobs("SubmitJob"); err != nil {
+		return nil, err
+	}
+	j, err := g.s.jobs.submit(jobRequest{Type: req.GetType(), CIDRs: req.GetCidrs(), Exclude: req.GetExclude(), Output: req.GetOutput()})
+	if errors.Is(err, errQueueFull) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return jobMessage(j), nil
+}
+
+// GetJob returns the status of a job.
+func (g *grpcServer) GetJob(_ context.Context, req *cidrsenseiv1.GetJobRequest) (*cidrsenseiv1.Job, error) {
+	if err := g.checkJobs("GetJob"); err != nil {
+		return nil, err
+	}
+	j, ok := g.s.jobs.get(req.GetId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no job %s", req.GetId())
+	}
+	return jobMessage(j), nil
+}
+
+// CancelJob cancels a job that has not finished, or deletes a finished job
+// and its result.
+func (g *grpcServer) CancelJob(_ context.Context, req *cidrsenseiv1.CancelJobRequest) (*cidrsenseiv1.Job, error) {
+	if err := g.checkJobs("CancelJob"); err != nil {
+		return nil, err
+	}
+	j, ok, err := g.s.jobs.remove(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no job %s", req.GetId())
+	}
+	return jobMessage(j), nil
+}
+
+// checkJobs returns the error of a job method called on the serve command,
+// which has no job queue.
+func (g *grpcServer) checkJobs(method string) error {
+	if g.s.jobs == nil {
+		return status.Errorf(codes.Unimplemented, "%s is answered by the daemon command", method)
+	}
+	return nil
+}
+
+// prefixStrings returns the fewest blocks covering the merged ranges.
+func prefixStrings(ranges []cidrsensei.Range) []string {
+	prefixes := cidrsensei.Prefixes(ranges)
+	blocks := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		blocks[i] = prefix.String()
+	}
+	return blocks
+}
+
+// jobMessage returns the job as a Job message.
+func jobMessage(j job) *cidrsenseiv1.Job {
+	msg := &cidrsenseiv1.Job{
+		Id:        j.ID,
+		Type:      j.Request.Type,
+		Status:    j.Status,
+		Error:     j.Error,
+		Result:    j.Result,
+		Addresses: j.Addresses,
+		Created:   j.Created.Format(time.RFC3339Nano),
+	}
+	if j.Started != nil {
+		msg.Started = j.Started.Format(time.RFC3339Nano)
+	}
+	if j.Finished != nil {
+		msg.Finished = j.Finished.Format(time.RFC3339Nano)
+	}
+	return msg
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	cidrsenseiv1 "github.com/ozfive/CIDR-Sensei/proto/cidrsensei/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testGRPCAddr serves the API of s, gRPC included, over HTTP/2 without TLS
+// as listenAndServe does, and returns the address it listens on.
+func testGRPCAddr(t *testing.T, s *server) string {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(s.handler())
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts.Listener.Addr().String()
+}
+
+// testGRPCServer serves the API of s as testGRPCAddr does, and returns a
+// client of its gRPC service.
+func testGRPCServer(t *testing.T, s *server) cidrsenseiv1.CIDRSenseiClient {
+	t.Helper()
+	conn, err := newGRPCClient(testGRPCAddr(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return cidrsenseiv1.NewCIDRSenseiClient(conn)
+}
+
+func testServer() *server {
+	return &server{maxRequestSize: 1 << 20, maxAddresses: 1 << 16, metrics: newMetrics()}
+}
+
+func TestGRPCExpand(t *testing.T) {
+	client := testGRPCServer(t, testServer())
+	stream, err := client.Expand(t.Context(), &cidrsenseiv1.ExpandRequest{Cidrs: []string{"10.0.0.0/30", "192.168.0.1"}, Exclude: []string{"10.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		address, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := parseIPv4(address.GetAddress()); n != address.GetInteger() {
+			t.Errorf("the Address %s has the integer %d, want %d", address.GetAddress(), address.GetInteger(), n)
+		}
+		got = append(got, address.GetAddress())
+	}
+	if want := []string{"10.0.0.0", "10.0.0.2", "10.0.0.3", "192.168.0.1"}; !slices.Equal(got, want) {
+		t.Fatalf("Expand streamed %v, want %v", got, want)
+	}
+
+	for _, tt := range []struct {
+		cidrs []string
+		code  codes.Code
+	}{
+		{[]string{"10.0.0.0/33"}, codes.InvalidArgument},
+		{[]string{"10.0.0.0/8"}, codes.ResourceExhausted},
+	} {
+		stream, err := client.Expand(t.Context(), &cidrsenseiv1.ExpandRequest{Cidrs: tt.cidrs})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != tt.code {
+			t.Errorf("Expand(%v) failed with %v, want %s", tt.cidrs, err, tt.code)
+		}
+	}
+}
+
+func TestGRPCUnary(t *testing.T) {
+	client := testGRPCServer(t, testServer())
+	ctx := t.Context()
+
+	aggregated, err := client.Aggregate(ctx, &cidrsenseiv1.AggregateRequest{Cidrs: []string{"10.0.0.0/25", "10.0.0.128/25", "10.0.1.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(aggregated.GetCidrs(), []string{"10.0.0.0/23"}) || aggregated.GetAddresses() != 512 {
+		t.Errorf("Aggregate = %v, %d addresses, want 10.0.0.0/23 and 512", aggregated.GetCidrs(), aggregated.GetAddresses())
+	}
+
+	contains, err := client.Contains(ctx, &cidrsenseiv1.ContainsRequest{Cidrs: []string{"10.0.0.0/8", "10.1.0.0/16"}, Ips: []string{"10.1.2.3", "8.8.8.8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := contains.GetResults()
+	if len(results) != 2 || !results[0].GetContained() || len(results[0].GetCidrs()) != 2 || results[1].GetContained() {
+		t.Errorf("Contains = %v, want 10.1.2.3 in both blocks and 8.8.8.8 in none", results)
+	}
+
+	subtracted, err := client.SetOp(ctx, &cidrsenseiv1.SetOpRequest{Operation: cidrsenseiv1.SetOpRequest_OPERATION_SUBTRACT, A: []string{"10.0.0.0/24"}, B: []string{"10.0.0.0/25"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(subtracted.GetCidrs(), []string{"10.0.0.128/25"}) || subtracted.GetAddresses() != 128 {
+		t.Errorf("SetOp(SUBTRACT) = %v, %d addresses, want 10.0.0.128/25 and 128", subtracted.GetCidrs(), subtracted.GetAddresses())
+	}
+	if _, err := client.SetOp(ctx, &cidrsenseiv1.SetOpRequest{A: []string{"10.0.0.0/24"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SetOp without an operation failed with %v, want %s", err, codes.InvalidArgument)
+	}
+	if _, err := client.GetJob(ctx, &cidrsenseiv1.GetJobRequest{Id: "1"}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("GetJob on the serve command failed with %v, want %s", err, codes.Unimplemented)
+	}
+}
+
+func TestGRPCJobs(t *testing.T) {
+	s := testServer()
+	jobs, err := newJobQueue(t.TempDir(), 4, s.metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.jobs = jobs
+	client := testGRPCServer(t, s)
+	ctx := t.Context()
+
+	submitted, err := client.SubmitJob(ctx, &cidrsenseiv1.SubmitJobRequest{Type: "aggregate", Cidrs: []string{"10.0.0.0/25", "10.0.0.128/25"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitted.GetStatus() != jobQueued || submitted.GetCreated() == "" {
+		t.Errorf("SubmitJob = %v, want a queued job", submitted)
+	}
+	got, err := client.GetJob(ctx, &cidrsenseiv1.GetJobRequest{Id: submitted.GetId()})
+	if err != nil || got.GetId() != submitted.GetId() || got.GetType() != "aggregate" {
+		t.Errorf("GetJob = %v, %v, want the job submitted", got, err)
+	}
+	// The queue is not started, so the job is canceled while queued and
+	// deleted once finished
+	canceled, err := client.CancelJob(ctx, &cidrsenseiv1.CancelJobRequest{Id: submitted.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if canceled.GetStatus() != jobCanceled || canceled.GetFinished() == "" {
+		t.Errorf("CancelJob = %v, want a canceled job", canceled)
+	}
+	if _, err := client.CancelJob(ctx, &cidrsenseiv1.CancelJobRequest{Id: submitted.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetJob(ctx, &cidrsenseiv1.GetJobRequest{Id: submitted.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetJob of a deleted job failed with %v, want %s", err, codes.NotFound)
+	}
+	if _, err := client.SubmitJob(ctx, &cidrsenseiv1.SubmitJobRequest{Type: "shrink"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SubmitJob of an unknown type failed with %v, want %s", err, codes.InvalidArgument)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import "net"
+
+// network returns the network address of the block the range belongs to.
+func (c CIDRRange) network() uint32 {
+	return ipToUint(c.ipNet.IP)
+}
+
+// broadcast returns the last address of the block the range belongs to.
+func (c CIDRRange) broadcast() uint32 {
+	return c.network() | ^ipToUint(net.IP(c.ipNet.Mask))
+}
+
+// isPointToPoint reports whether the range belongs to a /31 or /32 block.
+// Following RFC 3021, such blocks have no network or broadcast address: both
+// addresses of a /31 are usable hosts, and a /32 is a single host.
+func (c CIDRRange) isPointToPoint() bool {
+	ones, _ := c.ipNet.Mask.Size()
+	return ones >= 31
+}
+
+// hostBounds returns the first and last usable host addresses of the block
+// the range belongs to.
+func (c CIDRRange) hostBounds() (first, last uint32) {
+	if c.isPointToPoint() {
+		return c.network(), c.broadcast()
+	}
+	return c.network() + 1, c.broadcast() - 1
+}
+
+// isRangePiece reports whether the range is one of the blocks an address
+// range entry such as 10.0.0.1-10.0.0.9, an octet range such as
+// 192.168.0.1-254, or an RIR record of a number of addresses that is not a
+// power of two is split into, rather than a block given as such, so that
+// its first and last addresses are hosts like the others of the entry.
+func (c CIDRRange) isRangePiece() bool {
+	return c.piece || isAddressRange(c.entry) || isOctetRangeEntry(c.entry)
+}
+
+// filterHostAddresses narrows each CIDR range so that its network and/or
+// broadcast address are not expanded. /31 and /32 blocks have neither, and
+// the pieces of address ranges, octet ranges and RIR records are hosts from
+// the first address of the range to the last, so they are always expanded
+// in full.
+func filterHostAddresses(cidrRanges []CIDRRange, includeNetwork, includeBroadcast bool) []CIDRRange {
+	if includeNetwork && includeBroadcast {
+		return cidrRanges
+	}
+
+	filtered := make([]CIDRRange, 0, len(cidrRanges))
+	for _, cidr := range cidrRanges {
+		if !cidr.isPointToPoint() && !cidr.isRangePiece() {
+			if !includeNetwork && cidr.start == cidr.network() {
+				cidr.start++
+			}
+			if !includeBroadcast && cidr.end == cidr.broadcast() {
+				cidr.end--
+			}
+			cidr.length = cidr.end - cidr.start + 1
+		}
+		filtered = append(filtered, cidr)
+	}
+	return filtered
+}
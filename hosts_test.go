@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testEntries returns the ranges of the entries, each recording the entry
+// it was parsed from, as parseCIDRList does.
+func testEntries(t *testing.T, entries ...string) []CIDRRange {
+	t.Helper()
+	var cidrRanges []CIDRRange
+	for _, entry := range entries {
+		ranges, err := parseEntry(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cidr := range ranges {
+			cidr.entry = entry
+			cidrRanges = append(cidrRanges, cidr)
+		}
+	}
+	return cidrRanges
+}
+
+// hostIPs returns the IPs -hosts-only expands the entries into.
+func hostIPs(t *testing.T, entries ...string) []uint32 {
+	t.Helper()
+	return eachIP(filterHostAddresses(testEntries(t, entries...), false, false))
+}
+
+// ipsFrom returns the IPs from start to end.
+func ipsFrom(start, end uint32) []uint32 {
+	var ips []uint32
+	for ip := uint64(start); ip <= uint64(end); ip++ {
+		ips = append(ips, uint32(ip))
+	}
+	return ips
+}
+
+func TestHostsOnlyAddressRanges(t *testing.T) {
+	// 10.0.0.1-10.0.0.9 is split into 10.0.0.1/32, 10.0.0.2/31, 10.0.0.4/30
+	// and 10.0.0.8/31, whose network and broadcast addresses are hosts of the
+	// range all the same.
+	if got, want := hostIPs(t, "10.0.0.1-10.0.0.9"), ipsFrom(0x0a000001, 0x0a000009); !slices.Equal(got, want) {
+		t.Errorf("-hosts-only expands 10.0.0.1-10.0.0.9 into %x, want %x", got, want)
+	}
+	// A block given as such still loses its network and broadcast address.
+	if got, want := hostIPs(t, "10.0.1.0/29", "10.0.0.0-10.0.0.7"), append(ipsFrom(0x0a000000, 0x0a000007), ipsFrom(0x0a000101, 0x0a000106)...); !slices.Equal(got, want) {
+		t.Errorf("-hosts-only expands 10.0.1.0/29 and 10.0.0.0-10.0.0.7 into %x, want %x", got, want)
+	}
+}
+
+func TestHostsOnlyOctetRanges(t *testing.T) {
+	// 192.168.0.1-254 is split into 14 blocks, from 192.168.0.1/32 to
+	// 192.168.0.254/32.
+	if got, want := hostIPs(t, "192.168.0.1-254"), ipsFrom(0xc0a80001, 0xc0a800fe); !slices.Equal(got, want) {
+		t.Errorf("-hosts-only expands 192.168.0.1-254 into %d IPs, want the %d of the range", len(got), len(want))
+	}
+	var want []uint32
+	for third := uint32(0); third <= 1; third++ {
+		want = append(want, ipsFrom(0xc0a80002|third<<8, 0xc0a80063|third<<8)...)
+	}
+	if got := hostIPs(t, "192.168.0-1.2-99"); !slices.Equal(got, want) {
+		t.Errorf("-hosts-only expands 192.168.0-1.2-99 into %d IPs, want the %d of the range", len(got), len(want))
+	}
+}
+
+func TestHostsOnlyRIRRecords(t *testing.T) {
+	// The 768 addresses of 10.0.0.0|768 are split into 10.0.0.0/23 and
+	// 10.0.2.0/24, all of them allocated, while the record of a single
+	// block is that block.
+	delegated := "arin|US|ipv4|10.0.0.0|768|20200101|allocated\narin|US|ipv4|10.1.0.0|256|20200101|allocated\n"
+	var parser cidrParser
+	cidrRanges, err := parser.parseCIDRList(readDelegated(strings.NewReader(delegated), "delegated", rirFilter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(ipsFrom(0x0a000000, 0x0a0002ff), ipsFrom(0x0a010001, 0x0a0100fe)...)
+	if got := eachIP(filterHostAddresses(cidrRanges, false, false)); !slices.Equal(got, want) {
+		t.Errorf("-hosts-only expands 10.0.0.0|768 and 10.1.0.0|256 into %d IPs, want %d", len(got), len(want))
+	}
+}
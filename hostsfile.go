@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// defaultHostNameTemplate is the host name hosts and dnsmasq output pairs
+// each IP with, such as ip-10-0-0-1.
+const defaultHostNameTemplate = "ip-{{.Dashed}}"
+
+// hostsWriter writes each expanded IP with a host name rendered from the
+// -hostname-template template, as a hosts file line ("10.0.0.1 ip-10-0-0-1")
+// or a dnsmasq address option ("address=/ip-10-0-0-1/10.0.0.1").
+type hostsWriter struct {
+	w      io.Writer
+	format string
+	tmpl   *template.Template
+	name   strings.Builder
+}
+
+// newHostsWriter writes hosts or dnsmasq output onto w.
+func newHostsWriter(w io.Writer, format, hostNameTemplate string) (*hostsWriter, error) {
+	tmpl, err := parseHostNameTemplate("hostname-template", hostNameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &hostsWriter{w: w, format: format, tmpl: tmpl}, nil
+}
+
+// write writes the line of an IP.
+func (h *hostsWriter) write(ip string) error {
+	n, err := parseIPv4(ip)
+	if err != nil {
+		return err
+	}
+	h.name.Reset()
+	if err := h.tmpl.Execute(&h.name, newHostNameData(n)); err != nil {
+		return fmt.Errorf("error executing -hostname-template: %w", err)
+	}
+	name := strings.TrimSuffix(h.name.String(), ".")
+	if h.format == "dnsmasq" {
+		_, err = fmt.Fprintf(h.w, "address=/%s/%s\n", name, ip)
+	} else {
+		_, err = fmt.Fprintf(h.w, "%s\t%s\n", ip, name)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// includeDirective starts a line of a list file naming another list file,
+// or a glob pattern of files, whose entries are read in its place.
+const includeDirective = "@include"
+
+// includeTarget returns the path named by an @include directive, and
+// whether the entry is one. A built-in set such as @bogons is not.
+func includeTarget(entry string) (string, bool) {
+	rest, ok := strings.CutPrefix(entry, includeDirective)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// readIncluded yields the entries of the files named by the @include
+// directive entry in the list file at path. A relative target is resolved
+// against the directory of path, or the working directory for stdin. It
+// returns false once yield asks to stop or an error was yielded, such as
+// for a file that includes itself.
+func readIncluded(entry inputEntry, target, path string, format inputFormat, including []string, yield func(inputEntry, error) bool) bool {
+	fail := func(err error) bool {
+		yield(inputEntry{}, fmt.Errorf("%s: %w", entry.origin, err))
+		return false
+	}
+	if target == "" {
+		return fail(fmt.Errorf("%s needs a file to include", includeDirective))
+	}
+	paths, err := resolveInclude(target, path)
+	if err != nil {
+		return fail(err)
+	}
+
+	chain := append(slices.Clone(including), path)
+	for _, included := range paths {
+		if slices.ContainsFunc(chain, func(p string) bool { return sameFile(p, included) }) {
+			return fail(fmt.Errorf("%s cycle: %s -> %s", includeDirective, strings.Join(chain, " -> "), included))
+		}
+		for e, err := range readListFile(included, format, chain) {
+			if err != nil {
+				return fail(err)
+			}
+			if e.source == "" {
+				e.source = included
+			}
+			if !yield(e, nil) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// resolveInclude returns the files an @include directive in the list file
+// at path names: target itself, or the files matching it when it is a glob
+// pattern.
+func resolveInclude(target, path string) ([]string, error) {
+	if !filepath.IsAbs(target) && path != "-" {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	if !strings.ContainsAny(target, "*?[") {
+		return []string{target}, nil
+	}
+	matches, err := filepath.Glob(target)
+	if err == nil && len(matches) == 0 {
+		err = fmt.Errorf("no files match %s", target)
+	}
+	return matches, err
+}
+
+// includedFiles returns the files included by the list file at path,
+// directly or through other included files, and the glob patterns they were
+// included with. Files that cannot be read are left out, as reading the list
+// reports them.
+func includedFiles(path string) (files, patterns []string) {
+	seen := map[string]bool{path: true}
+	var walk func(path string)
+	walk = func(path string) {
+		file, err := os.Open(path)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		for entry, err := range readEntries(file, path) {
+			target, ok := includeTarget(entry.text)
+			if err != nil || !ok || target == "" {
+				continue
+			}
+			paths, _ := resolveInclude(target, path)
+			if strings.ContainsAny(target, "*?[") {
+				if !filepath.IsAbs(target) && path != "-" {
+					target = filepath.Join(filepath.Dir(path), target)
+				}
+				patterns = append(patterns, target)
+			}
+			for _, included := range paths {
+				if !seen[included] {
+					seen[included] = true
+					files = append(files, included)
+					walk(included)
+				}
+			}
+		}
+	}
+	walk(path)
+	return files, patterns
+}
+
+// sameFile reports whether the paths name the same file, following symbolic
+// links.
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	return err == nil && os.SameFile(infoA, infoB)
+}
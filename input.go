@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// collectEntries returns the entries of a comma-separated flag value followed
+// by those of each additional source, such as a list file or URL.
+func collectEntries(list, flagName string, sources ...iter.Seq2[inputEntry, error]) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		for _, entry := range splitEntries(list, flagName) {
+			if !yield(entry, nil) {
+				return
+			}
+		}
+		for _, source := range sources {
+			for entry, err := range source {
+				if !yield(entry, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// inputSources returns the sources of the entries to expand, besides -cidr.
+func inputSources(ctx context.Context, config Config, fetcher *fetcher) []iter.Seq2[inputEntry, error] {
+	sources := fileSources(ctx, fetcher, config.InputFiles, config.inputFormat())
+	if config.ReadStdin {
+		sources = append(sources, fromSource("stdin", readEntryFile("-", config.inputFormat())))
+	}
+	if config.InputURL != "" {
+		sources = append(sources, fromSource(config.InputURL, fetcher.entries(ctx, config.InputURL, config.InputURLSHA256, config.inputFormat())))
+	}
+	filter := newCloudFilter(config.CloudServices, config.CloudRegions)
+	if config.AWS {
+		sources = append(sources, fromSource("aws", awsEntries(ctx, fetcher, config.AWSURL, filter)))
+	}
+	if config.GCP {
+		sources = append(sources, fromSource("gcp", gcpEntries(ctx, fetcher, config.GCPURL, filter)))
+	}
+	if config.Azure {
+		sources = append(sources, fromSource("azure", azureEntries(ctx, fetcher, config.AzureURL, filter)))
+	}
+	if config.Cloudflare {
+		sources = append(sources, fromSource("cloudflare", cloudflareEntries(ctx, fetcher, config.CloudflareURL)))
+	}
+	if config.RIR != "" || config.RIRFile != "" {
+		sources = append(sources, rirSources(ctx, config, fetcher)...)
+	}
+	if config.K8s {
+		sources = append(sources, fromSource("k8s", k8sEntries(ctx, config)))
+	}
+	if config.GeoIP != "" {
+		sources = append(sources, fromSource("geoip", geoipEntries(config)))
+	}
+	if config.MRT != "" {
+		sources = append(sources, fromSource(config.MRT, mrtEntries(ctx, config, fetcher)))
+	}
+	if config.InputBitmap != "" {
+		sources = append(sources, fromSource(config.InputBitmap, bitmapEntries(config.InputBitmap)))
+	}
+	if config.InputSQLite != "" {
+		sources = append(sources, fromSource(config.InputSQLite, readSQLiteEntries(ctx, config)))
+	}
+	return sources
+}
+
+// excludeSources returns the sources of the entries to exclude, besides
+// -exclude.
+func excludeSources(ctx context.Context, config Config, fetcher *fetcher) []iter.Seq2[inputEntry, error] {
+	return fileSources(ctx, fetcher, config.ExcludeFiles, autoFormat)
+}
+
+// fileSources returns a source for every file matching the paths and glob
+// patterns, each file once and in the order given. The matches of a pattern
+// are sorted by name. S3 and Cloud Storage objects are read as they
+// download.
+func fileSources(ctx context.Context, fetcher *fetcher, patterns []string, format inputFormat) []iter.Seq2[inputEntry, error] {
+	var sources []iter.Seq2[inputEntry, error]
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		if isObjectURI(pattern) {
+			if !seen[pattern] {
+				seen[pattern] = true
+				sources = append(sources, fromSource(pattern, readObject(ctx, fetcher, pattern, format)))
+			}
+			continue
+		}
+
+		paths := []string{pattern}
+		if pattern != "-" && strings.ContainsAny(pattern, "*?[") {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				err = fmt.Errorf("error expanding %s: %w", pattern, err)
+			} else if len(matches) == 0 {
+				err = fmt.Errorf("no files match %s", pattern)
+			}
+			if err != nil {
+				sources = append(sources, func(yield func(inputEntry, error) bool) { yield(inputEntry{}, err) })
+				continue
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			source := path
+			if path == "-" {
+				source = "stdin"
+			}
+			sources = append(sources, fromSource(source, readEntryFile(path, format)))
+		}
+	}
+	return sources
+}
+
+// fromSource records the flag, file or provider each entry came from,
+// unless it was already recorded, as for the entries of an included file.
+func fromSource(source string, entries iter.Seq2[inputEntry, error]) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		for entry, err := range entries {
+			if entry.source == "" {
+				entry.source = source
+			}
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
+
+// readEntryFile returns the entries of the list file at path, or of stdin
+// when path is "-". Plain lists are read lazily, line by line, so entries
+// can be processed while a pipe is still being written to. The entries of
+// the files named by @include directives are read in their place.
+func readEntryFile(path string, format inputFormat) iter.Seq2[inputEntry, error] {
+	return readListFile(path, format, nil)
+}
+
+// readListFile reads the list file at path, which was included by the files
+// in including, outermost first.
+func readListFile(path string, format inputFormat, including []string) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		var r io.Reader = os.Stdin
+		name := "stdin"
+		if path != "-" {
+			file, err := os.Open(path)
+			if err != nil {
+				yield(inputEntry{}, err)
+				return
+			}
+			defer file.Close()
+			r, name = file, path
+		}
+
+		for entry, err := range readFormatted(r, name, format) {
+			if target, ok := includeTarget(entry.text); ok && err == nil {
+				if !readIncluded(entry, target, path, format, including, yield) {
+					return
+				}
+				continue
+			}
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
+
+// readEntries reads one entry per line from r, recording the name and line
+// number each came from. Blank lines are skipped, and a # starts a comment
+// that runs to the end of the line.
+func readEntries(r io.Reader, name string) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		scanner := bufio.NewScanner(r)
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if !yield(inputEntry{text: line, origin: fmt.Sprintf("%s:%d", name, lineNum)}, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", name, err))
+		}
+	}
+}
+
+// isStdinPipe reports whether stdin is a pipe or file rather than a terminal.
+func isStdinPipe() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
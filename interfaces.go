@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// interfaceTable holds the IPv4 subnets configured on the local network
+// interfaces, so that an interface name such as eth0 can be given as an
+// entry. The interfaces are listed once, when the first entry that could
+// name one is parsed.
+type interfaceTable struct {
+	once    sync.Once
+	subnets map[string][]CIDRRange
+}
+
+// lookup returns the subnets of the interface named by entry, and whether
+// it names one. An interface without IPv4 addresses is an error, rather
+// than being resolved as a hostname.
+func (t *interfaceTable) lookup(entry string) ([]CIDRRange, bool, error) {
+	if entry == "" || strings.ContainsAny(entry, "/,*@") || net.ParseIP(entry) != nil {
+		return nil, false, nil
+	}
+	t.once.Do(t.load)
+	subnets, ok := t.subnets[entry]
+	if !ok {
+		return nil, false, nil
+	}
+	if len(subnets) == 0 {
+		return nil, true, fmt.Errorf("interface %s has no IPv4 addresses", entry)
+	}
+	return subnets, true, nil
+}
+
+// load lists the interfaces and the subnets of their IPv4 addresses. When
+// the interfaces cannot be listed, no entry names one.
+func (t *interfaceTable) load() {
+	t.subnets = make(map[string][]CIDRRange)
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+	for _, iface := range interfaces {
+		var subnets []CIDRRange
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			prefix, bits := ipNet.Mask.Size()
+			if bits == 128 {
+				prefix -= 96
+			}
+			subnets = append(subnets, newCIDRRange(ipToUint(ipNet.IP.To4().Mask(net.CIDRMask(prefix, 32))), prefix))
+		}
+		t.subnets[iface.Name] = subnets
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// defaultUniverse is the address space -invert complements within when no
+// -universe is given.
+const defaultUniverse = "0.0.0.0/0"
+
+// runInvert writes the minimal list of CIDR blocks covering every address of
+// the universe block that is not in any of the CIDR ranges.
+func runInvert(config Config, cidrRanges []CIDRRange) error {
+	universe, err := parseNormalizedCIDR(config.Universe)
+	if err != nil {
+		return fmt.Errorf("invalid -universe: %w", err)
+	}
+	return writeCIDRList(os.Stdout, config.OutputFormat, findGaps(universe, cidrRanges))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"strconv"
+)
+
+// runIPCalc implements the ipcalc subcommand and returns the process exit
+// code.
+func runIPCalc(args []string) int {
+	flags := flag.NewFlagSet("ipcalc", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s ipcalc OPERATION ARGS...\n", os.Args[0])
+		fmt.Println("Perform arithmetic on IPv4 addresses")
+		fmt.Println("")
+		fmt.Println("Operations:")
+		fmt.Println("  next IP             the address after IP")
+		fmt.Println("  prev IP             the address before IP")
+		fmt.Println("  add IP OFFSET       IP plus OFFSET, which may be negative")
+		fmt.Println("  distance IP1 IP2    the number of addresses from IP1 to IP2")
+		fmt.Println("  toint IP            IP as an unsigned 32-bit integer")
+		fmt.Println("  fromint N           the address of the unsigned 32-bit integer N")
+		fmt.Println("")
+		fmt.Println("Examples:")
+		fmt.Printf("%s ipcalc add 10.0.0.1 300\n", os.Args[0])
+	}
+	_ = flags.Parse(args)
+
+	result, err := ipCalc(flags.Args())
+	if err != nil {
+		slog.Error("cannot compute the result", "error", err)
+		return 1
+	}
+	fmt.Println(result)
+	return 0
+}
+
+// ipCalc performs the operation named by the first argument on the rest.
+func ipCalc(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("an operation is required (next, prev, add, distance, toint, fromint)")
+	}
+	op, operands := args[0], args[1:]
+
+	wantOperands := map[string]int{"next": 1, "prev": 1, "add": 2, "distance": 2, "toint": 1, "fromint": 1}
+	want, ok := wantOperands[op]
+	if !ok {
+		return "", fmt.Errorf("unsupported operation: %s", op)
+	}
+	if len(operands) != want {
+		return "", fmt.Errorf("%s takes %d argument(s), got %d", op, want, len(operands))
+	}
+
+	if op == "fromint" {
+		n, err := strconv.ParseUint(operands[0], 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid integer %s: must be between 0 and %d", operands[0], uint32(math.MaxUint32))
+		}
+		return formatIPv4(uint32(n)), nil
+	}
+
+	ip, err := parseIPv4(operands[0])
+	if err != nil {
+		return "", err
+	}
+
+	switch op {
+	case "next":
+		return formatIPResult(addToIP(ip, 1))
+	case "prev":
+		return formatIPResult(addToIP(ip, -1))
+	case "add":
+		offset, err := strconv.ParseInt(operands[1], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid offset %s", operands[1])
+		}
+		return formatIPResult(addToIP(ip, offset))
+	case "distance":
+		other, err := parseIPv4(operands[1])
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(ipDistance(ip, other), 10), nil
+	default: // toint
+		return strconv.FormatUint(uint64(ip), 10), nil
+	}
+}
+
+// parseIPv4 parses a dotted-quad IPv4 address into its integer form.
+func parseIPv4(s string) (uint32, error) {
+	if n, ok := scanIPv4(s); ok {
+		return n, nil
+	}
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return 0, fmt.Errorf("invalid IPv4 address: %s", s)
+	}
+	return ipToUint(ip), nil
+}
+
+// addToIP returns ip plus offset, or an error if the result falls outside
+// the IPv4 address space.
+func addToIP(ip uint32, offset int64) (uint32, error) {
+	result := int64(ip) + offset
+	if result < 0 || result > math.MaxUint32 {
+		return 0, fmt.Errorf("%s %+d is outside the IPv4 address space", uint2ip(ip), offset)
+	}
+	return uint32(result), nil
+}
+
+// ipDistance returns the number of addresses from a to b, which is negative
+// when b comes before a.
+func ipDistance(a, b uint32) int64 {
+	return int64(b) - int64(a)
+}
+
+// formatIPResult formats the result of an address operation.
+func formatIPResult(ip uint32, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	return formatIPv4(ip), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"unsafe"
+)
+
+// The expansion formats and parses every address it writes, so these do it
+// by hand, without the allocations of net.IP and its String method:
+// appendIPv4 formats into a buffer the caller reuses, and formatIPv4
+// allocates nothing but the string it returns.
+
+// appendIPv4 appends the dotted-quad form of ip, such as 10.0.0.1, to dst.
+func appendIPv4(dst []byte, ip uint32) []byte {
+	dst = appendOctet(dst, byte(ip>>24))
+	dst = appendOctet(append(dst, '.'), byte(ip>>16))
+	dst = appendOctet(append(dst, '.'), byte(ip>>8))
+	return appendOctet(append(dst, '.'), byte(ip))
+}
+
+// appendOctet appends the decimal digits of b to dst.
+func appendOctet(dst []byte, b byte) []byte {
+	switch {
+	case b >= 100:
+		return append(dst, '0'+b/100, '0'+b/10%10, '0'+b%10)
+	case b >= 10:
+		return append(dst, '0'+b/10, '0'+b%10)
+	}
+	return append(dst, '0'+b)
+}
+
+// formatIPv4 returns the dotted-quad form of ip, as uint2ip(ip).String()
+// does.
+func formatIPv4(ip uint32) string {
+	var buf [len("255.255.255.255")]byte
+	return string(appendIPv4(buf[:0], ip))
+}
+
+// An ipFormatter formats the IPs a generator emits. When reuse is set, as
+// it is when every stage and output the IPs pass through is done with each
+// of them by the time emit returns, they are formatted into a buffer reused
+// for the next, without allocating. Otherwise, and for a nil ipFormatter,
+// each is a string of its own.
+type ipFormatter struct {
+	reuse bool
+	buf   []byte
+}
+
+// newIPFormatter returns the formatter of the IPs emitted by an expansion
+// of config.
+func newIPFormatter(config Config) *ipFormatter {
+	return &ipFormatter{reuse: config.ReuseIPs, buf: make([]byte, 0, len("255.255.255.255"))}
+}
+
+// format returns the dotted-quad form of ip, valid only until the next
+// call when the buffer is reused.
+func (f *ipFormatter) format(ip uint32) string {
+	if f == nil || !f.reuse {
+		return formatIPv4(ip)
+	}
+	f.buf = appendIPv4(f.buf[:0], ip)
+	return unsafe.String(unsafe.SliceData(f.buf), len(f.buf))
+}
+
+// scanIPv4 parses the dotted-quad form of an address as formatIPv4 writes
+// it, reporting whether s is one. Octets with leading zeros are not, as
+// net.ParseIP rejects them.
+func scanIPv4(s string) (uint32, bool) {
+	var ip uint32
+	octets, digits, octet := 0, 0, uint32(0)
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == '.' {
+			if digits == 0 || octets == 4 {
+				return 0, false
+			}
+			ip = ip<<8 | octet
+			octets++
+			digits, octet = 0, 0
+			continue
+		}
+		c := s[i]
+		if c < '0' || c > '9' || (digits == 1 && octet == 0) {
+			return 0, false
+		}
+		if octet = octet*10 + uint32(c-'0'); octet > 255 {
+			return 0, false
+		}
+		digits++
+	}
+	return ip, octets == 4
+}
+
+// writeStrings writes the parts of a record to w one after the other, as
+// fmt.Fprint would without boxing them, stopping at the first error.
+func writeStrings(w io.Writer, parts ...string) error {
+	for _, part := range parts {
+		if _, err := io.WriteString(w, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+// ipv4Samples are addresses of every digit count in each octet.
+var ipv4Samples = []uint32{0, 0x01020304, 0x0a000001, 0x0a0a0a0a, 0x7f000001, 0xac10fe01, 0xc0a80164, 0xffffffff}
+
+func TestFormatIPv4(t *testing.T) {
+	f := newIPFormatter(Config{ReuseIPs: true})
+	for _, ip := range ipv4Samples {
+		want := netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}).String()
+		if got := formatIPv4(ip); got != want {
+			t.Errorf("formatIPv4(%#08x) = %q, want %q", ip, got, want)
+		}
+		if got := f.format(ip); got != want {
+			t.Errorf("format(%#08x) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestScanIPv4(t *testing.T) {
+	for _, ip := range ipv4Samples {
+		s := formatIPv4(ip)
+		if got, ok := scanIPv4(s); !ok || got != ip {
+			t.Errorf("scanIPv4(%q) = %#08x, %v, want %#08x", s, got, ok, ip)
+		}
+	}
+	for _, s := range []string{"", "10.0.0", "10.0.0.1.2", "10.0.0.256", "10.0.0.01", "10..0.1", "10.0.0.", "a.b.c.d", "10.0.0.1 "} {
+		if _, ok := scanIPv4(s); ok {
+			t.Errorf("scanIPv4(%q) succeeded, want it rejected", s)
+		}
+		if _, err := netip.ParseAddr(s); err == nil {
+			t.Errorf("netip.ParseAddr(%q) succeeded, want scanIPv4 to reject only what it does", s)
+		}
+	}
+}
+
+func BenchmarkFormatIPv4(b *testing.B) {
+	b.Run("appendIPv4", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, len("255.255.255.255"))
+		for i := range b.N {
+			buf = appendIPv4(buf[:0], ipv4Samples[i%len(ipv4Samples)])
+		}
+	})
+	b.Run("formatIPv4", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			_ = formatIPv4(ipv4Samples[i%len(ipv4Samples)])
+		}
+	})
+	b.Run("netip", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			ip := ipv4Samples[i%len(ipv4Samples)]
+			_ = netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}).String()
+		}
+	})
+}
+
+func BenchmarkScanIPv4(b *testing.B) {
+	samples := make([]string, len(ipv4Samples))
+	for i, ip := range ipv4Samples {
+		samples[i] = formatIPv4(ip)
+	}
+	b.Run("scanIPv4", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			if _, ok := scanIPv4(samples[i%len(samples)]); !ok {
+				b.Fatal("scanIPv4 failed")
+			}
+		}
+	})
+	b.Run("netip", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			if _, err := netip.ParseAddr(samples[i%len(samples)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// retainingSink keeps every record it is given, as sinks that are not
+// flagged borrowsRecords may.
+type retainingSink struct {
+	records *[]string
+}
+
+func (s retainingSink) Open(io.Writer, string) error { return nil }
+
+func (s retainingSink) WriteRecord(ip string) error {
+	*s.records = append(*s.records, ip)
+	return nil
+}
+
+func (s retainingSink) Close() error { return nil }
+
+func TestRetainedRecordsNotReused(t *testing.T) {
+	var records []string
+	outputSinks["retaining"] = outputSinkFormat{
+		extension: "retained",
+		newSink: func(Config, []CIDRRange) (cidrsensei.OutputSink, error) {
+			return retainingSink{&records}, nil
+		},
+	}
+	t.Cleanup(func() { delete(outputSinks, "retaining") })
+
+	blocks := testBlocks(t, "10.0.0.0/24")
+	var want []string
+	for _, ip := range eachIP(blocks) {
+		want = append(want, formatIPv4(ip))
+	}
+	for _, outputs := range [][]string{{"retaining"}, {"csv", "retaining"}} {
+		records = nil
+		dir := t.TempDir()
+		config := Config{Outputs: outputs, OutputDir: dir, FilenameTemplate: defaultFilenameTemplate, Fields: defaultFields, Algorithm: defaultAlgorithm}
+		writers, err := newIPWriters(t.Context(), config, blocks, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// As run decides, with no -script.
+		config.ReuseIPs = writers.borrowsRecords()
+		if config.ReuseIPs {
+			t.Fatalf("the outputs %v borrow their records, but the retaining sink does not", outputs)
+		}
+		if err := expandIPs(t.Context(), config, blocks, nil, writers.write); err != nil {
+			t.Fatal(err)
+		}
+		if err := writers.close(); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(records, want) {
+			t.Fatalf("the sink of %v retained %d records, %v..., want those of 10.0.0.0/24 each as written", outputs, len(records), records[:min(4, len(records))])
+		}
+	}
+
+	csv, err := newIPWriters(t.Context(), Config{Outputs: []string{"csv"}, OutputDir: t.TempDir(), FilenameTemplate: defaultFilenameTemplate, Fields: defaultFields}, blocks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer csv.close()
+	if !csv.borrowsRecords() {
+		t.Error("the csv output does not borrow its records, so its IPs are never formatted into a reused buffer")
+	}
+}
@@ -0,0 +1,595 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+const (
+	defaultJobsDir    = "cidr-sensei-jobs"
+	defaultJobWorkers = 2
+	defaultMaxQueued  = 1000
+	// jobFileSuffix ends the name of the file storing a job in the jobs
+	// directory, next to its result.
+	jobFileSuffix = ".job.json"
+)
+
+// The statuses of a job.
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// jobTypes lists the types of job the daemon runs.
+var jobTypes = []string{"expand", "aggregate"}
+
+// errQueueFull is the error of a job submitted while -max-queued jobs are
+// waiting to run.
+var errQueueFull = errors.New("the job queue is full")
+
+// jobRequest is a job submitted to the daemon, as the body of a POST /jobs
+// request, a SubmitJob call or a file in the -spool directory.
+type jobRequest struct {
+	Type    string   `json:"type"`
+	CIDRs   []string `json:"cidrs"`
+	Exclude []string `json:"exclude,omitempty"`
+	// Output is the format of the result: any format written to a file for
+	// expand jobs, and json, ndjson, yaml or csv for aggregate jobs.
+	Output string `json:"output,omitempty"`
+}
+
+// job is a job and its status, as stored in the jobs directory and answered
+// by the API.
+type job struct {
+	ID        string     `json:"id"`
+	Request   jobRequest `json:"request"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Result    string     `json:"result,omitempty"` // the result file, in the jobs directory
+	Addresses uint64     `json:"addresses"`
+	Created   time.Time  `json:"created"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+// finished reports whether the job has stopped for good.
+func (j *job) finished() bool {
+	return j.Status == jobDone || j.Status == jobFailed || j.Status == jobCanceled
+}
+
+// jobQueue runs the jobs submitted to the daemon, -workers at a time, and
+// stores each job and its result in its directory, so that both survive a
+// restart. Jobs still queued or running when the daemon stops are run again
+// when it starts.
+type jobQueue struct {
+	dir     string
+	queue   chan string // the IDs of the jobs waiting to run
+	mu      sync.Mutex
+	jobs    map[string]*job
+	cancels map[string]context.CancelFunc // of the jobs running
+	wg      sync.WaitGroup
+	metrics *metrics
+}
+
+// runDaemon implements the daemon command and returns the process exit
+// code. It serves the API of the serve command with the job endpoints added,
+// and runs jobs until ctx is done, then lets the jobs running stop and shuts
+// down gracefully.
+func runDaemon(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	options := addServeFlags(flags)
+	dir := flags.String("jobs-dir", defaultJobsDir, "the directory jobs and their results are stored in")
+	spool := flags.String("spool", "", "a directory watched for job files, each submitted and removed once read")
+	workers := flags.Int("workers", defaultJobWorkers, "the number of jobs run at a time")
+	maxQueued := flags.Int("max-queued", defaultMaxQueued, "the most jobs waiting to run before submissions are refused")
+	flags.Usage = func() {
+		printCommandUsage("daemon")
+		printServeEndpoints()
+		fmt.Println("  POST /jobs       submit a job {\"type\": \"expand\"|\"aggregate\", \"cidrs\": [...], \"exclude\": [...], \"output\": FORMAT}")
+		fmt.Println("  GET /jobs        list the jobs")
+		fmt.Println("  GET /jobs/ID     the status of a job")
+		fmt.Println("  GET /jobs/ID/result  the result of a job that is done")
+		fmt.Println("  DELETE /jobs/ID  cancel a job, or delete a finished one with its result")
+		fmt.Println("")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		printCommandExamples("daemon")
+	}
+	_ = flags.Parse(args)
+	if err := options.setup(); err != nil {
+		slog.Error("invalid command line", "error", err)
+		return 1
+	}
+	if *workers < 1 || *maxQueued < 1 {
+		slog.Error("-workers and -max-queued must be at least 1")
+		return 1
+	}
+
+	s, err := options.server()
+	if err != nil {
+		slog.Error("invalid command line", "error", err)
+		return 1
+	}
+	s.jobs, err = newJobQueue(*dir, *maxQueued, s.metrics)
+	if err != nil {
+		slog.Error("cannot load the jobs", "error", err)
+		return 1
+	}
+	s.jobs.start(ctx, *workers)
+	if *spool != "" {
+		if err := s.jobs.watchSpool(ctx, *spool); err != nil {
+			slog.Error("cannot watch the -spool directory", "error", err)
+			return 1
+		}
+	}
+
+	code := listenAndServe(ctx, s, options)
+	s.jobs.wg.Wait()
+	stopTracing()
+	return code
+}
+
+// newJobQueue returns the queue of the jobs stored in dir, creating it if
+// need be, with the jobs that had not finished queued again. The workers
+// record the jobs they run in m.
+func newJobQueue(dir string, maxQueued int, m *metrics) (*jobQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	q := &jobQueue{dir: dir, jobs: make(map[string]*job), cancels: make(map[string]context.CancelFunc), metrics: m}
+
+	paths, err := filepath.Glob(filepath.Join(escapeGlob(dir), "*"+jobFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var pending []*job
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		j := &job{}
+		if err := json.Unmarshal(data, j); err != nil {
+			return nil, fmt.Errorf("invalid job file %s: %w", path, err)
+		}
+		q.jobs[j.ID] = j
+		if !j.finished() {
+			pending = append(pending, j)
+		}
+	}
+
+	// Run the jobs left over in the order they were submitted
+	slices.SortFunc(pending, func(a, b *job) int { return a.Created.Compare(b.Created) })
+	q.queue = make(chan string, max(maxQueued, len(pending)))
+	for _, j := range pending {
+		j.Status, j.Started = jobQueued, nil
+		if err := q.save(j); err != nil {
+			return nil, err
+		}
+		q.queue <- j.ID
+	}
+	return q, nil
+}
+
+// start starts the workers running the jobs, which stop once ctx is done.
+func (q *jobQueue) start(ctx context.Context, workers int) {
+	q.metrics.mu.Lock()
+	q.metrics.workers += workers
+	q.metrics.mu.Unlock()
+	for range workers {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-q.queue:
+					q.run(ctx, id)
+				}
+			}
+		}()
+	}
+}
+
+// submit checks the request and queues the job, returning it as queued.
+func (q *jobQueue) submit(req jobRequest) (job, error) {
+	if err := checkJobRequest(&req); err != nil {
+		return job{}, err
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	j := &job{ID: hex.EncodeToString(id), Request: req, Status: jobQueued, Created: time.Now().UTC()}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.queue <- j.ID:
+	default:
+		return job{}, errQueueFull
+	}
+	q.jobs[j.ID] = j
+	if err := q.save(j); err != nil {
+		return job{}, err
+	}
+	slog.Info("job queued", "job", j.ID, "type", req.Type, "entries", len(req.CIDRs))
+	return *j, nil
+}
+
+// checkJobRequest checks the type, blocks and output format of a job,
+// defaulting the format to json.
+func checkJobRequest(req *jobRequest) error {
+	if !slices.Contains(jobTypes, req.Type) {
+		return fmt.Errorf("unsupported job type %q (expected %s)", req.Type, strings.Join(jobTypes, " or "))
+	}
+	if req.Output == "" {
+		req.Output = "json"
+	}
+	formats := fileOutputFormats()
+	if req.Type == "aggregate" {
+		formats = slices.DeleteFunc(slices.Clone(reportFormats), func(format string) bool { return format == "terminal" })
+	}
+	if !slices.Contains(formats, req.Output) {
+		return fmt.Errorf("unsupported output format for %s jobs: %s (expected one of %s)", req.Type, req.Output, strings.Join(formats, ", "))
+	}
+	if _, err := parseRequestRanges(req.CIDRs); err != nil {
+		return err
+	}
+	_, err := parseRequestRanges(req.Exclude)
+	return err
+}
+
+// get returns a copy of the job with the ID.
+func (q *jobQueue) get(id string) (job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+// list returns a copy of every job, in the order they were submitted.
+func (q *jobQueue) list() []job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]job, 0, len(q.jobs))
+	for _, id := range slices.Sorted(maps.Keys(q.jobs)) {
+		jobs = append(jobs, *q.jobs[id])
+	}
+	slices.SortStableFunc(jobs, func(a, b job) int { return a.Created.Compare(b.Created) })
+	return jobs
+}
+
+// remove cancels a job that has not finished, or deletes a finished job and
+// its result, returning the job as it was left.
+func (q *jobQueue) remove(id string) (job, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return job{}, false, nil
+	}
+	if !j.finished() {
+		// A queued job is skipped when its turn comes
+		if cancel, ok := q.cancels[id]; ok {
+			cancel()
+		}
+		now := time.Now().UTC()
+		j.Status, j.Finished = jobCanceled, &now
+		q.metrics.countJob(jobCanceled)
+		slog.Info("job canceled", "job", id)
+		return *j, true, q.save(j)
+	}
+	delete(q.jobs, id)
+	err := os.Remove(filepath.Join(q.dir, id+jobFileSuffix))
+	if j.Result != "" {
+		if resultErr := os.Remove(filepath.Join(q.dir, j.Result)); err == nil && !errors.Is(resultErr, os.ErrNotExist) {
+			err = resultErr
+		}
+	}
+	return *j, true, err
+}
+
+// run runs the job with the ID, unless it was canceled while queued. A job
+// interrupted by the daemon stopping is left running in its file, so that
+// it is queued again when the daemon starts.
+func (q *jobQueue) run(ctx context.Context, id string) {
+	q.mu.Lock()
+	j := q.jobs[id]
+	if j == nil || j.Status != jobQueued {
+		q.mu.Unlock()
+		return
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	now := time.Now().UTC()
+	j.Status, j.Started = jobRunning, &now
+	q.cancels[id] = cancel
+	req := j.Request
+	_ = q.save(j)
+	q.mu.Unlock()
+	slog.Info("job running", "job", id)
+	q.metrics.startJob()
+
+	jobCtx, span := startSpan(jobCtx, spanInternal, "job", slog.String("job", id), slog.String("type", req.Type), slog.String("output", req.Output))
+	result, addresses, err := runJob(jobCtx, q.dir, id, req)
+	span.set(slog.Uint64("addresses", addresses))
+	span.finish(err)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.cancels, id)
+	elapsed := time.Since(now)
+	if j.Status == jobCanceled || ctx.Err() != nil {
+		removeJobResult(q.dir, result)
+		q.metrics.finishJob(elapsed)
+		if j.Status != jobCanceled {
+			slog.Info("job interrupted, to be run again on restart", "job", id)
+		}
+		return
+	}
+	finished := time.Now().UTC()
+	j.Finished = &finished
+	if err != nil {
+		j.Status, j.Error = jobFailed, err.Error()
+		removeJobResult(q.dir, result)
+		slog.Error("job failed", "job", id, "error", err)
+		addresses = 0
+	} else {
+		j.Status, j.Result, j.Addresses = jobDone, result, addresses
+		slog.Info("job done", "job", id, "addresses", addresses, "duration", finished.Sub(*j.Started).Round(time.Millisecond))
+	}
+	q.metrics.finishJob(elapsed)
+	q.metrics.countJob(j.Status)
+	if req.Type == "expand" {
+		q.metrics.observeExpansion("job", addresses, elapsed, err)
+	}
+	if err := q.save(j); err != nil {
+		slog.Error("cannot save the job", "job", id, "error", err)
+	}
+}
+
+// removeJobResult removes what a job that did not finish wrote of its
+// result.
+func removeJobResult(dir, result string) {
+	if result != "" {
+		_ = os.Remove(filepath.Join(dir, result))
+	}
+}
+
+// runJob runs a job, writing its result to a file named after the ID in
+// dir, and returns the name of the file and the number of addresses the
+// job's blocks cover.
+func runJob(ctx context.Context, dir, id string, req jobRequest) (string, uint64, error) {
+	_, span := startSpan(ctx, spanInternal, "parse", slog.Int("entries", len(req.CIDRs)), slog.Int("excluded_entries", len(req.Exclude)))
+	ranges, err := parseRequestRanges(req.CIDRs)
+	if err != nil {
+		span.finish(err)
+		return "", 0, err
+	}
+	exclude, err := parseRequestRanges(req.Exclude)
+	if err != nil {
+		span.finish(err)
+		return "", 0, err
+	}
+	ranges = cidrsensei.Subtract(ranges, exclude)
+	cidrRanges := rangesToCIDRs(ranges)
+	addresses := cidrsensei.Size(ranges)
+	span.set(slog.Int("blocks", len(cidrRanges)))
+	span.finish(nil)
+
+	if req.Type == "aggregate" {
+		name := id + "." + req.Output
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return "", 0, err
+		}
+		err = writeCIDRList(file, req.Output, cidrRanges)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return name, addresses, err
+	}
+
+	name := id + "." + outputSinks[req.Output].extension
+	config := Config{
+		Outputs:          []string{req.Output},
+		OutFile:          filepath.Join(dir, name),
+		Fields:           defaultFields,
+		OutputTable:      "ips",
+		HostNameTemplate: defaultHostNameTemplate,
+	}
+	w, err := newIPWriters(ctx, config, cidrRanges, nil)
+	if err != nil {
+		return name, 0, err
+	}
+	_, span = startSpan(ctx, spanInternal, "expand", slog.Int("blocks", len(cidrRanges)), slog.Uint64("addresses", addresses))
+	err = pageIPs(cidrRanges, 0, 0, nil, interruptible(ctx, w.write))
+	span.finish(err)
+	if closeErr := w.close(); err == nil {
+		err = closeErr
+	}
+	return name, addresses, err
+}
+
+// save writes the job to its file, replacing the file in a single rename so
+// that it is never read half written.
+func (q *jobQueue) save(j *job) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.dir, j.ID+jobFileSuffix)
+	if err := os.WriteFile(path+".tmp", append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// watchSpool submits the job in each .json file in dir, now and whenever
+// one is written, until ctx is done. A file is removed once its job is
+// queued, and renamed with .failed added when it does not hold a valid job,
+// so it is not read again. Files should be written under another name and
+// renamed into the directory, so that they are never read half written.
+func (q *jobQueue) watchSpool(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return err
+	}
+	q.readSpool(dir)
+
+	go func() {
+		defer watcher.Close()
+		timer := time.NewTimer(0)
+		<-timer.C
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if strings.HasSuffix(event.Name, ".json") && event.Has(fsnotify.Create|fsnotify.Write) {
+					timer.Reset(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("cannot watch the spool directory", "directory", dir, "error", err)
+			case <-timer.C:
+				q.readSpool(dir)
+			}
+		}
+	}()
+	return nil
+}
+
+// readSpool submits the job of each .json file in dir.
+func (q *jobQueue) readSpool(dir string) {
+	paths, _ := filepath.Glob(filepath.Join(escapeGlob(dir), "*.json"))
+	for _, path := range paths {
+		j, err := q.submitFile(path)
+		if errors.Is(err, errQueueFull) {
+			// Left for the next time the directory changes
+			slog.Error("cannot submit the job file", "file", path, "error", err)
+			return
+		}
+		if err != nil {
+			slog.Error("cannot submit the job file", "file", path, "error", err)
+			_ = os.Rename(path, path+".failed")
+			continue
+		}
+		slog.Info("job file submitted", "file", path, "job", j.ID)
+		_ = os.Remove(path)
+	}
+}
+
+// submitFile submits the job in the file at path.
+func (q *jobQueue) submitFile(path string) (job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return job{}, err
+	}
+	var req jobRequest
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return job{}, fmt.Errorf("invalid job file: %w", err)
+	}
+	return q.submit(req)
+}
+
+// handleSubmitJob queues the job of the request, answering with the job and
+// 202, 400 for an invalid job and 503 when the queue is full.
+func (s *server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	var req jobRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+	j, err := s.jobs.submit(req)
+	switch {
+	case errors.Is(err, errQueueFull):
+		writeError(w, http.StatusServiceUnavailable, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		w.Header().Set("Location", "/jobs/"+j.ID)
+		writeJSON(w, http.StatusAccepted, j)
+	}
+}
+
+// handleListJobs answers with every job.
+func (s *server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]job{"jobs": s.jobs.list()})
+}
+
+// handleGetJob answers with the job named in the path.
+func (s *server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job %s", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// handleJobResult answers with the result file of the job named in the
+// path, or 409 when the job is not done.
+func (s *server) handleJobResult(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job %s", r.PathValue("id")))
+		return
+	}
+	if j.Status != jobDone {
+		writeError(w, http.StatusConflict, fmt.Errorf("job %s is %s, not done", j.ID, j.Status))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", j.Result))
+	http.ServeFile(w, r, filepath.Join(s.jobs.dir, j.Result))
+}
+
+// handleDeleteJob cancels the job named in the path, or deletes it once it
+// has finished, answering with the job.
+func (s *server) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
+	j, ok, err := s.jobs.remove(r.PathValue("id"))
+	switch {
+	case !ok:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job %s", r.PathValue("id")))
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, j)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// kafkaKeys, kafkaCompressions and kafkaAcks list the values of -kafka-key,
+// -kafka-compression and -kafka-acks.
+var (
+	kafkaKeys         = []string{"source", "address", "none"}
+	kafkaCompressions = []string{"none", "gzip"}
+	kafkaAcks         = []string{"all", "leader"}
+)
+
+const (
+	defaultKafkaBatchSize = 1000
+	kafkaTimeout          = 30 * time.Second
+	kafkaClientID         = "cidr-sensei"
+)
+
+// parseKafkaURL returns the bootstrap brokers and the topic of a
+// kafka://host:port[,host:port...]/topic sink.
+func parseKafkaURL(output string) ([]string, string, error) {
+	hosts, topic, _ := strings.Cut(strings.TrimPrefix(output, "kafka://"), "/")
+	brokers := splitList(hosts)
+	for _, broker := range brokers {
+		if _, port, err := net.SplitHostPort(broker); err != nil || port == "" {
+			brokers = nil
+		}
+	}
+	if len(brokers) == 0 || topic == "" || strings.Contains(topic, "/") {
+		return nil, "", fmt.Errorf("invalid output sink: %s (expected kafka://host:port[,host:port...]/topic)", output)
+	}
+	return brokers, topic, nil
+}
@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// newKafkaProducer fails on Plan 9, which the Kafka client does not
+// support.
+func newKafkaProducer(config Config, cidrRanges []CIDRRange) (outputSink, error) {
+	return nil, errors.New("kafka:// output is not supported on plan9")
+}
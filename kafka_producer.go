@@ -0,0 +1,112 @@
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaProducer publishes each IP, or merged block, as a message to a Kafka
+// topic with the franz-go client. Messages are sent in batches of
+// -kafka-batch-size, and each batch waits for the brokers to acknowledge or
+// reject every message in it, so a failed delivery stops the run. Keyed
+// messages go to the partition the Java client's default partitioner picks,
+// so that the IPs of a block stay in order; unkeyed ones stick to one
+// partition per batch.
+type kafkaProducer struct {
+	client    *kgo.Client
+	topic     string
+	key       string
+	batchSize int
+	sources   *sourceIndex
+	pending   []*kgo.Record
+}
+
+// newKafkaProducer connects to the -output Kafka cluster.
+func newKafkaProducer(config Config, cidrRanges []CIDRRange) (*kafkaProducer, error) {
+	bootstrap, topic, err := parseKafkaURL(config.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(bootstrap...),
+		kgo.DefaultProduceTopic(topic),
+		kgo.ClientID(kafkaClientID),
+		kgo.DialTimeout(kafkaTimeout),
+		kgo.ProduceRequestTimeout(kafkaTimeout),
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+		kgo.RequestRetries(config.SinkRetries),
+		kgo.RecordRetries(config.SinkRetries),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	}
+	if config.KafkaCompression == "gzip" {
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.GzipCompression()))
+	}
+	if config.KafkaAcks == "leader" {
+		// Idempotent writes need every in-sync replica to acknowledge them
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", config.OutputFormat, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("error connecting to %s: %w", config.OutputFormat, err)
+	}
+	return &kafkaProducer{
+		client:    client,
+		topic:     topic,
+		key:       config.KafkaKey,
+		batchSize: max(config.KafkaBatchSize, 1),
+		sources:   newSourceIndex(config.Algorithm, cidrRanges),
+	}, nil
+}
+
+// send queues an IP, or a block, flushing the queue once a batch is full.
+func (p *kafkaProducer) send(ip string) error {
+	record := &kgo.Record{Value: []byte(ip)}
+	switch p.key {
+	case "address":
+		record.Key = record.Value
+	case "source":
+		record.Key = record.Value
+		if n, err := parseIPv4(ip); err == nil {
+			if cidr := p.sources.lookup(n); cidr != nil {
+				record.Key = []byte(cidr.String())
+			}
+		}
+	}
+	p.pending = append(p.pending, record)
+	if len(p.pending) >= p.batchSize {
+		return p.flush()
+	}
+	return nil
+}
+
+// flush sends the queued messages and waits until each is delivered. The
+// client retries the batches rejected with a retriable error, such as a
+// leader change, up to -sink-retries times.
+func (p *kafkaProducer) flush() error {
+	results := p.client.ProduceSync(context.Background(), p.pending...)
+	p.pending = p.pending[:0]
+	if err := results.FirstErr(); err != nil {
+		return fmt.Errorf("error publishing to Kafka topic %s: %w", p.topic, err)
+	}
+	return nil
+}
+
+// close sends the messages still queued and closes the client.
+func (p *kafkaProducer) close() error {
+	var err error
+	if len(p.pending) > 0 {
+		err = p.flush()
+	}
+	p.client.Close()
+	return err
+}
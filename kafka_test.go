@@ -0,0 +1,241 @@
+//go:build !plan9
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// fakeKafka is a single Kafka broker answering the requests of kafka://
+// output, with a topic of kafkaTestPartitions partitions, which records the
+// messages produced to each partition.
+type fakeKafka struct {
+	addr  string
+	topic string
+	mu    sync.Mutex
+	// messages are the key=value pairs produced, by partition
+	messages map[int32][]string
+	errs     chan error
+}
+
+const kafkaTestPartitions = 3
+
+func startFakeKafka(t *testing.T, topic string) *fakeKafka {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	k := &fakeKafka{addr: l.Addr().String(), topic: topic, messages: make(map[int32][]string), errs: make(chan error, 16)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := k.serve(conn); err != nil && err != io.EOF {
+					k.errs <- err
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		select {
+		case err := <-k.errs:
+			t.Error(err)
+		default:
+		}
+	})
+	return k
+}
+
+// serve answers the requests of a connection, each a size, the request
+// header and the request.
+func (k *fakeKafka) serve(conn net.Conn) error {
+	for {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return err
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return err
+		}
+		key, version := int16(binary.BigEndian.Uint16(msg)), int16(binary.BigEndian.Uint16(msg[2:]))
+		correlation := msg[4:8]
+		clientID := int(binary.BigEndian.Uint16(msg[8:]))
+		body := msg[10+clientID:]
+
+		req := kmsg.RequestForKey(key)
+		if req == nil {
+			return fmt.Errorf("unexpected request key %d", key)
+		}
+		req.SetVersion(version)
+		if req.IsFlexible() {
+			body = body[1:] // no tagged fields in the header
+		}
+		if err := req.ReadFrom(body); err != nil {
+			return fmt.Errorf("cannot decode request %d v%d: %w", key, version, err)
+		}
+		resp, err := k.answer(req)
+		if err != nil {
+			return err
+		}
+		out := append([]byte{0, 0, 0, 0}, correlation...)
+		// The ApiVersions response header never has tagged fields
+		if resp.IsFlexible() && key != 18 {
+			out = append(out, 0)
+		}
+		out = resp.AppendTo(out)
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+		if _, err := conn.Write(out); err != nil {
+			return err
+		}
+	}
+}
+
+func (k *fakeKafka) answer(req kmsg.Request) (kmsg.Response, error) {
+	switch req := req.(type) {
+	case *kmsg.ApiVersionsRequest:
+		resp := req.ResponseKind().(*kmsg.ApiVersionsResponse)
+		for _, key := range []int16{0, 3, 18, 22} {
+			resp.ApiKeys = append(resp.ApiKeys, kmsg.ApiVersionsResponseApiKey{ApiKey: key, MaxVersion: kmsg.RequestForKey(key).MaxVersion()})
+		}
+		return resp, nil
+	case *kmsg.MetadataRequest:
+		resp := req.ResponseKind().(*kmsg.MetadataResponse)
+		host, port, _ := net.SplitHostPort(k.addr)
+		n, _ := strconv.Atoi(port)
+		resp.Brokers = []kmsg.MetadataResponseBroker{{NodeID: 0, Host: host, Port: int32(n)}}
+		topic := kmsg.NewMetadataResponseTopic()
+		topic.Topic = &k.topic
+		for i := range int32(kafkaTestPartitions) {
+			topic.Partitions = append(topic.Partitions, kmsg.MetadataResponseTopicPartition{Partition: i, Leader: 0, Replicas: []int32{0}, ISR: []int32{0}})
+		}
+		resp.Topics = []kmsg.MetadataResponseTopic{topic}
+		return resp, nil
+	case *kmsg.InitProducerIDRequest:
+		resp := req.ResponseKind().(*kmsg.InitProducerIDResponse)
+		resp.ProducerID = 1
+		return resp, nil
+	case *kmsg.ProduceRequest:
+		resp := req.ResponseKind().(*kmsg.ProduceResponse)
+		for _, topic := range req.Topics {
+			t := kmsg.ProduceResponseTopic{Topic: topic.Topic}
+			for _, partition := range topic.Partitions {
+				if err := k.store(partition.Partition, partition.Records); err != nil {
+					return nil, err
+				}
+				t.Partitions = append(t.Partitions, kmsg.ProduceResponseTopicPartition{Partition: partition.Partition})
+			}
+			resp.Topics = append(resp.Topics, t)
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("unexpected request %T", req)
+}
+
+// store decodes the record batches produced to a partition.
+func (k *fakeKafka) store(partition int32, data []byte) error {
+	for len(data) > 0 {
+		var batch kmsg.RecordBatch
+		if err := batch.ReadFrom(data); err != nil {
+			return err
+		}
+		data = data[12+batch.Length:]
+		records := batch.Records
+		if batch.Attributes&7 == 1 {
+			r, err := gzip.NewReader(bytes.NewReader(records))
+			if err != nil {
+				return err
+			}
+			if records, err = io.ReadAll(r); err != nil {
+				return err
+			}
+		}
+		for range batch.NumRecords {
+			length, n := binary.Varint(records)
+			var record kmsg.Record
+			if err := record.ReadFrom(records[:n+int(length)]); err != nil {
+				return err
+			}
+			records = records[n+int(length):]
+			k.mu.Lock()
+			k.messages[partition] = append(k.messages[partition], string(record.Key)+"="+string(record.Value))
+			k.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+func TestKafkaProducer(t *testing.T) {
+	k := startFakeKafka(t, "assets")
+	config := Config{
+		OutputFormat:     "kafka://" + k.addr + "/assets",
+		KafkaKey:         "source",
+		KafkaBatchSize:   3,
+		KafkaCompression: "gzip",
+		KafkaAcks:        "all",
+		SinkRetries:      1,
+		Algorithm:        defaultAlgorithm,
+	}
+	blocks := testBlocks(t, "10.0.0.0/30", "10.0.1.0/30")
+	p, err := newKafkaProducer(config, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ips []string
+	for _, ip := range eachIP(blocks) {
+		ips = append(ips, formatIPv4(ip))
+	}
+	ips = append(ips, "192.168.0.1")
+	for _, ip := range ips {
+		if err := p.send(ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The IPs of a block are keyed by it, and land in one partition in order
+	byKey := make(map[string][]string)
+	partitions := make(map[string]int32)
+	for partition, messages := range k.messages {
+		for _, message := range messages {
+			key, value, _ := bytes.Cut([]byte(message), []byte("="))
+			if other, ok := partitions[string(key)]; ok && other != partition {
+				t.Errorf("the messages keyed %s went to partitions %d and %d", key, other, partition)
+			}
+			partitions[string(key)] = partition
+			byKey[string(key)] = append(byKey[string(key)], string(value))
+		}
+	}
+	want := map[string][]string{
+		"10.0.0.0/30": ips[0:4],
+		"10.0.1.0/30": ips[4:8],
+		"192.168.0.1": ips[8:],
+	}
+	for key, values := range want {
+		if !slices.Equal(byKey[key], values) {
+			t.Errorf("the messages keyed %s are %v, want %v", key, byKey[key], values)
+		}
+	}
+	if len(byKey) != len(want) {
+		t.Errorf("the messages have the keys %v, want 3", byKey)
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultK8sSelect = "pods,services,nodes"
+	k8sPageSize      = 500
+	inClusterDir     = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// k8sSelections lists the kinds of ranges -k8s-select accepts.
+var k8sSelections = []string{"pods", "services", "nodes"}
+
+// kubeconfig is the subset of a kubeconfig file used to reach a cluster.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string   `yaml:"name"`
+		User kubeUser `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// kubeUser holds the credentials of a kubeconfig user.
+type kubeUser struct {
+	Token                 string `yaml:"token"`
+	TokenFile             string `yaml:"tokenFile"`
+	ClientCertificate     string `yaml:"client-certificate"`
+	ClientCertificateData string `yaml:"client-certificate-data"`
+	ClientKey             string `yaml:"client-key"`
+	ClientKeyData         string `yaml:"client-key-data"`
+	Username              string `yaml:"username"`
+	Password              string `yaml:"password"`
+	Exec                  *struct {
+		APIVersion string   `yaml:"apiVersion"`
+		Command    string   `yaml:"command"`
+		Args       []string `yaml:"args"`
+		Env        []struct {
+			Name  string `yaml:"name"`
+			Value string `yaml:"value"`
+		} `yaml:"env"`
+	} `yaml:"exec"`
+}
+
+// kubeClient makes requests to the Kubernetes API server.
+type kubeClient struct {
+	server string
+	client *http.Client
+	token  string
+
+	// username and password are used for basic authentication when there
+	// is no token.
+	username string
+	password string
+}
+
+// newKubeClient returns a client for the context of the kubeconfig file at
+// path, or for the cluster the process runs in when path is empty and it
+// runs in a pod.
+func newKubeClient(ctx context.Context, path, contextName string) (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if path == "" && host != "" && port != "" {
+		return inClusterClient(host, port)
+	}
+	if path == "" {
+		path = kubeconfigPath()
+	}
+	return kubeconfigClient(ctx, path, contextName)
+}
+
+// kubeconfigPath returns the kubeconfig file kubectl uses by default: the
+// first file in KUBECONFIG, or ~/.kube/config.
+func kubeconfigPath() string {
+	if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 && paths[0] != "" {
+		return paths[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+// inClusterClient returns a client authenticating with the service account
+// token mounted into the pod.
+func inClusterClient(host, port string) (*kubeClient, error) {
+	token, err := os.ReadFile(filepath.Join(inClusterDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the service account token: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(inClusterDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the service account CA: %w", err)
+	}
+	tlsConfig, err := kubeTLSConfig(ca, false, "")
+	if err != nil {
+		return nil, err
+	}
+	return &kubeClient{
+		server: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}},
+		token:  strings.TrimSpace(string(token)),
+	}, nil
+}
+
+// kubeconfigClient returns a client for the named context of the kubeconfig
+// file at path, or for its current context.
+func kubeconfigClient(ctx context.Context, path, contextName string) (*kubeClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading kubeconfig: %w", err)
+	}
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	// Relative paths in a kubeconfig are relative to the file.
+	resolve := func(file string) string {
+		if file != "" && !filepath.IsAbs(file) {
+			return filepath.Join(filepath.Dir(path), file)
+		}
+		return file
+	}
+
+	for _, c := range config.Contexts {
+		if c.Name != contextName {
+			continue
+		}
+		client := &kubeClient{}
+		tlsConfig := &tls.Config{}
+		for _, cluster := range config.Clusters {
+			if cluster.Name != c.Context.Cluster {
+				continue
+			}
+			ca, err := inlineOrFile(cluster.Cluster.CertificateAuthorityData, resolve(cluster.Cluster.CertificateAuthority))
+			if err != nil {
+				return nil, fmt.Errorf("error reading the CA of cluster %s: %w", cluster.Name, err)
+			}
+			if tlsConfig, err = kubeTLSConfig(ca, cluster.Cluster.InsecureSkipTLSVerify, cluster.Cluster.TLSServerName); err != nil {
+				return nil, err
+			}
+			client.server = strings.TrimSuffix(cluster.Cluster.Server, "/")
+		}
+		if client.server == "" {
+			return nil, fmt.Errorf("%s: context %s has no cluster with a server", path, contextName)
+		}
+
+		for _, user := range config.Users {
+			if user.Name != c.Context.User {
+				continue
+			}
+			u := user.User
+			if u.Exec != nil {
+				if strings.ContainsRune(u.Exec.Command, filepath.Separator) {
+					u.Exec.Command = resolve(u.Exec.Command)
+				}
+				if u, err = execCredential(ctx, u); err != nil {
+					return nil, fmt.Errorf("error running the credential plugin of user %s: %w", user.Name, err)
+				}
+			}
+			switch {
+			case u.Token != "":
+				client.token = u.Token
+			case u.TokenFile != "":
+				token, err := os.ReadFile(resolve(u.TokenFile))
+				if err != nil {
+					return nil, fmt.Errorf("error reading the token of user %s: %w", user.Name, err)
+				}
+				client.token = strings.TrimSpace(string(token))
+			case u.Username != "":
+				client.username, client.password = u.Username, u.Password
+			}
+			cert, err := inlineOrFile(u.ClientCertificateData, resolve(u.ClientCertificate))
+			if err != nil {
+				return nil, fmt.Errorf("error reading the certificate of user %s: %w", user.Name, err)
+			}
+			key, err := inlineOrFile(u.ClientKeyData, resolve(u.ClientKey))
+			if err != nil {
+				return nil, fmt.Errorf("error reading the key of user %s: %w", user.Name, err)
+			}
+			if cert != nil {
+				pair, err := tls.X509KeyPair(cert, key)
+				if err != nil {
+					return nil, fmt.Errorf("error loading the certificate of user %s: %w", user.Name, err)
+				}
+				tlsConfig.Certificates = []tls.Certificate{pair}
+			}
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.client = &http.Client{Transport: transport}
+		return client, nil
+	}
+	if contextName == "" {
+		return nil, fmt.Errorf("%s has no current context; select one with -k8s-context", path)
+	}
+	return nil, fmt.Errorf("%s has no context %q", path, contextName)
+}
+
+// inlineOrFile returns the base64-encoded data, or else the contents of
+// file, or nil when neither is set.
+func inlineOrFile(data, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
+
+// kubeTLSConfig returns the TLS configuration trusting the PEM-encoded ca,
+// or the system roots when it is nil.
+func kubeTLSConfig(ca []byte, insecure bool, serverName string) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure, ServerName: serverName}
+	if ca != nil {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid cluster CA certificate")
+		}
+	}
+	return config, nil
+}
+
+// execCredential runs the credential plugin of user, such as aws eks
+// get-token or gke-gcloud-auth-plugin, and returns the user with the token
+// or client certificate it printed.
+func execCredential(ctx context.Context, user kubeUser) (kubeUser, error) {
+	info, _ := json.Marshal(map[string]any{
+		"apiVersion": user.Exec.APIVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]any{"interactive": false},
+	})
+	cmd := exec.CommandContext(ctx, user.Exec.Command, user.Exec.Args...)
+	cmd.Env = append(os.Environ(), "KUBERNETES_EXEC_INFO="+string(info))
+	for _, env := range user.Exec.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return user, err
+	}
+
+	var credential struct {
+		Status struct {
+			Token                 string `json:"token"`
+			ClientCertificateData string `json:"clientCertificateData"`
+			ClientKeyData         string `json:"clientKeyData"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &credential); err != nil {
+		return user, fmt.Errorf("error parsing its output: %w", err)
+	}
+	user.Token = credential.Status.Token
+	if credential.Status.ClientCertificateData != "" {
+		// The plugin returns PEM, while kubeconfig data is base64-encoded.
+		user.ClientCertificateData = base64.StdEncoding.EncodeToString([]byte(credential.Status.ClientCertificateData))
+		user.ClientKeyData = base64.StdEncoding.EncodeToString([]byte(credential.Status.ClientKeyData))
+	}
+	return user, nil
+}
+
+// list yields the items of every page of the list at path, such as
+// /api/v1/nodes. It reports whether the API server serves the resource,
+// which newer resources such as ServiceCIDRs may not be.
+func (c *kubeClient) list(ctx context.Context, path string, item func(json.RawMessage) error) (bool, error) {
+	next := ""
+	for {
+		query := url.Values{"limit": {fmt.Sprint(k8sPageSize)}}
+		if next != "" {
+			query.Set("continue", next)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path+"?"+query.Encode(), nil)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return false, fmt.Errorf("error listing %s: %w", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return false, fmt.Errorf("error listing %s: %w", path, err)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			var status struct {
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(body, &status)
+			return false, &httpStatusError{name: path, status: resp.Status, header: resp.Header, detail: status.Message}
+		}
+
+		var page struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&page); err != nil {
+			return false, fmt.Errorf("error parsing %s: %w", path, err)
+		}
+		for _, raw := range page.Items {
+			if err := item(raw); err != nil {
+				return false, fmt.Errorf("error parsing %s: %w", path, err)
+			}
+		}
+		if next = page.Metadata.Continue; next == "" {
+			return true, nil
+		}
+	}
+}
+
+// k8sObject is the subset of a node, service or ServiceCIDR used to collect
+// ranges.
+type k8sObject struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		PodCIDR    string   `json:"podCIDR"`
+		PodCIDRs   []string `json:"podCIDRs"`
+		CIDRs      []string `json:"cidrs"`
+		ClusterIPs []string `json:"clusterIPs"`
+	} `json:"spec"`
+	Status struct {
+		Addresses []struct {
+			Type    string `json:"type"`
+			Address string `json:"address"`
+		} `json:"addresses"`
+	} `json:"status"`
+}
+
+// k8sEntries yields the Pod CIDRs of the nodes, the Service CIDRs and the
+// node addresses of the cluster, as selected with -k8s-select. Clusters
+// without the ServiceCIDR API, before Kubernetes 1.33, do not expose the
+// Service CIDR, so the cluster IPs of the services are used instead.
+func k8sEntries(ctx context.Context, config Config) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		selected := splitList(config.K8sSelect)
+		client, err := newKubeClient(ctx, config.Kubeconfig, config.K8sContext)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+
+		var entries []inputEntry
+		add := func(text, origin string) {
+			if ip, _, err := net.ParseCIDR(text); (err == nil && ip.To4() != nil) || net.ParseIP(text).To4() != nil {
+				entries = append(entries, inputEntry{text: text, origin: "k8s:" + origin})
+			}
+		}
+		decode := func(handle func(k8sObject)) func(json.RawMessage) error {
+			return func(raw json.RawMessage) error {
+				var object k8sObject
+				if err := json.Unmarshal(raw, &object); err != nil {
+					return err
+				}
+				handle(object)
+				return nil
+			}
+		}
+
+		if matchesAny(selected, "pods") || matchesAny(selected, "nodes") {
+			_, err := client.list(ctx, "/api/v1/nodes", decode(func(node k8sObject) {
+				if matchesAny(selected, "pods") {
+					cidrs := node.Spec.PodCIDRs
+					if len(cidrs) == 0 && node.Spec.PodCIDR != "" {
+						cidrs = []string{node.Spec.PodCIDR}
+					}
+					for _, cidr := range cidrs {
+						add(cidr, "node/"+node.Metadata.Name+"/pods")
+					}
+				}
+				if matchesAny(selected, "nodes") {
+					for _, address := range node.Status.Addresses {
+						if address.Type == "InternalIP" || address.Type == "ExternalIP" {
+							add(address.Address, "node/"+node.Metadata.Name+"/"+address.Type)
+						}
+					}
+				}
+			}))
+			if err != nil {
+				yield(inputEntry{}, err)
+				return
+			}
+		}
+
+		if matchesAny(selected, "services") {
+			served := false
+			for _, path := range []string{"/apis/networking.k8s.io/v1/servicecidrs", "/apis/networking.k8s.io/v1beta1/servicecidrs"} {
+				if served, err = client.list(ctx, path, decode(func(serviceCIDR k8sObject) {
+					for _, cidr := range serviceCIDR.Spec.CIDRs {
+						add(cidr, "servicecidr/"+serviceCIDR.Metadata.Name)
+					}
+				})); err != nil || served {
+					break
+				}
+			}
+			if err == nil && !served {
+				_, err = client.list(ctx, "/api/v1/services", decode(func(service k8sObject) {
+					for _, ip := range service.Spec.ClusterIPs {
+						add(ip, "service/"+service.Metadata.Namespace+"/"+service.Metadata.Name)
+					}
+				}))
+			}
+			if err != nil {
+				yield(inputEntry{}, err)
+				return
+			}
+		}
+
+		for _, entry := range entries {
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
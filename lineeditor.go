@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// maxHistory is the number of lines a lineEditor remembers.
+const maxHistory = 1000
+
+// errLineInterrupted is returned by readLine when Ctrl-C abandons the line.
+var errLineInterrupted = errors.New("line interrupted")
+
+// lineEditor reads lines from a terminal with readline-style editing: the
+// cursor keys, Home and End, Ctrl-A, Ctrl-E, Ctrl-K, Ctrl-U and Ctrl-W, a
+// history browsed with the up and down keys, and Tab completion. When its
+// input is not a terminal it reads plain lines, without a prompt, so scripts
+// can be piped in.
+type lineEditor struct {
+	in       *os.File
+	r        *bufio.Reader
+	out      io.Writer
+	terminal bool
+	history  []string
+	// complete returns the candidates for the word ending at the end of
+	// line, and where that word starts.
+	complete func(line string) (start int, candidates []string)
+}
+
+// newLineEditor returns a lineEditor reading from in and echoing to out.
+func newLineEditor(in *os.File, out io.Writer) *lineEditor {
+	return &lineEditor{in: in, r: bufio.NewReader(in), out: out, terminal: isTerminal(in)}
+}
+
+// addHistory appends a line entered to the history, unless it repeats the
+// last one.
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// readLine reads a line after showing the prompt, returning io.EOF at the
+// end of the input or on Ctrl-D at an empty line, and errLineInterrupted on
+// Ctrl-C.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !e.terminal {
+		line, err := e.r.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	// Raw mode also turns off output processing, so lines end in \r\n.
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var line []rune
+	pos := 0
+	browsing := len(e.history) // the history entry shown, len(history) for the line typed
+	typed := ""
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	show := func(s string) {
+		line = []rune(s)
+		pos = len(line)
+		redraw()
+	}
+	fmt.Fprint(e.out, prompt)
+
+	for {
+		key, _, err := e.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errLineInterrupted
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+				redraw()
+			}
+		case 1: // Ctrl-A
+			pos = 0
+			redraw()
+		case 5: // Ctrl-E
+			pos = len(line)
+			redraw()
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+				redraw()
+			}
+		case 6: // Ctrl-F
+			if pos < len(line) {
+				pos++
+				redraw()
+			}
+		case 11: // Ctrl-K
+			line = line[:pos]
+			redraw()
+		case 21: // Ctrl-U
+			line = append([]rune{}, line[pos:]...)
+			pos = 0
+			redraw()
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start--
+			}
+			line = append(line[:start], line[pos:]...)
+			pos = start
+			redraw()
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			redraw()
+		case 127, 8: // Backspace
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+				redraw()
+			}
+		case '\t':
+			line, pos = e.completeLine(prompt, line, pos)
+			redraw()
+		case 27: // an escape sequence, such as a cursor key
+			switch readEscape(e.r) {
+			case "[A", "OA": // Up
+				if browsing > 0 {
+					if browsing == len(e.history) {
+						typed = string(line)
+					}
+					browsing--
+					show(e.history[browsing])
+				}
+			case "[B", "OB": // Down
+				if browsing < len(e.history) {
+					browsing++
+					if browsing == len(e.history) {
+						show(typed)
+					} else {
+						show(e.history[browsing])
+					}
+				}
+			case "[C", "OC": // Right
+				if pos < len(line) {
+					pos++
+					redraw()
+				}
+			case "[D", "OD": // Left
+				if pos > 0 {
+					pos--
+					redraw()
+				}
+			case "[H", "OH", "[1~", "[7~": // Home
+				pos = 0
+				redraw()
+			case "[F", "OF", "[4~", "[8~": // End
+				pos = len(line)
+				redraw()
+			case "[3~": // Delete
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+					redraw()
+				}
+			}
+		default:
+			if unicode.IsPrint(key) {
+				line = append(line[:pos], append([]rune{key}, line[pos:]...)...)
+				pos++
+				redraw()
+			}
+		}
+	}
+}
+
+// readEscape reads the rest of an escape sequence after the escape key.
+func readEscape(r *bufio.Reader) string {
+	var seq []rune
+	for {
+		key, _, err := r.ReadRune()
+		if err != nil {
+			return string(seq)
+		}
+		seq = append(seq, key)
+		// A sequence ends at its first letter or ~ after the opening [ or O
+		if len(seq) > 1 && (unicode.IsLetter(key) || key == '~') || len(seq) == 1 && key != '[' && key != 'O' {
+			return string(seq)
+		}
+	}
+}
+
+// completeLine completes the word before the cursor: with its only
+// candidate followed by a space, or with the prefix its candidates share,
+// listing them when the prefix adds nothing.
+func (e *lineEditor) completeLine(prompt string, line []rune, pos int) ([]rune, int) {
+	if e.complete == nil {
+		return line, pos
+	}
+	before := string(line[:pos])
+	start, candidates := e.complete(before)
+	if len(candidates) == 0 {
+		return line, pos
+	}
+	word := before[start:]
+	completion := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "/") {
+		completion += " "
+	}
+	if len(completion) <= len(word) {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+		return line, pos
+	}
+	insert := []rune(completion[len(word):])
+	line = append(line[:pos], append(insert, line[pos:]...)...)
+	return line, pos + len(insert)
+}
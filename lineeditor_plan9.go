@@ -0,0 +1,17 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// isTerminal reports whether f is a terminal, which on Plan 9 it is never
+// taken to be, so that the shell reads plain lines without editing them.
+func isTerminal(f *os.File) bool {
+	return false
+}
+
+// makeRaw returns an error: line editing is not supported on Plan 9.
+func makeRaw(f *os.File) (func() error, error) {
+	return nil, errors.New("line editing is not supported on plan9")
+}
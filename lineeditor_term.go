@@ -0,0 +1,24 @@
+//go:build !plan9
+
+package main
+
+import (
+	"os"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(f.Fd())
+}
+
+// makeRaw puts the terminal f into raw mode, reading each key as it is
+// pressed without echoing it, and returns the function restoring its mode.
+func makeRaw(f *os.File) (func() error, error) {
+	state, err := term.MakeRaw(f.Fd())
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return term.Restore(f.Fd(), state) }, nil
+}
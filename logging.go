@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// logFormats lists the formats -log-format can select: plain lines for
+// people, like "Error: cannot load the CIDR blocks: ...", and the key=value
+// text and JSON records of log/slog for log aggregation.
+var logFormats = []string{"plain", "text", "json"}
+
+// logOptions are the flags configuring the messages the commands log: the
+// errors they fail with, warnings, and progress such as "Listening on
+// ...".
+type logOptions struct {
+	Verbose bool
+	Quiet   bool
+	Format  string
+	File    string
+	// ErrorsJSON is the file errors are written to as JSON lines as well,
+	// - for stderr.
+	ErrorsJSON string
+}
+
+// addFlags registers the logging flags with flags.
+func (o *logOptions) addFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&o.Verbose, "v", false, "log debug messages as well")
+	flags.BoolVar(&o.Quiet, "q", false, "log only errors")
+	flags.StringVar(&o.Format, "log-format", "plain", "the format of log messages ("+strings.Join(logFormats, ", ")+")")
+	flags.StringVar(&o.File, "log-file", "", "the file log messages are appended to (default stderr)")
+	flags.StringVar(&o.ErrorsJSON, "errors-json", "", "also write each error, and each entry -skip-invalid skips, as a JSON line classifying it to this file, or - for stderr")
+}
+
+// setup makes the logger the options describe the default of log/slog.
+func (o logOptions) setup() error {
+	if o.Verbose && o.Quiet {
+		return fmt.Errorf("the -v and -q flags cannot be combined")
+	}
+	if !slices.Contains(logFormats, o.Format) {
+		return fmt.Errorf("unsupported -log-format: %s (expected %s)", o.Format, strings.Join(logFormats, ", "))
+	}
+	level := slog.LevelInfo
+	switch {
+	case o.Verbose:
+		level = slog.LevelDebug
+	case o.Quiet:
+		level = slog.LevelError
+	}
+
+	var w io.Writer = os.Stderr
+	if o.File != "" {
+		f, err := os.OpenFile(o.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return fmt.Errorf("error opening the -log-file: %w", err)
+		}
+		w = f
+	}
+	handler := newLogHandler(w, o.Format, level)
+	if o.ErrorsJSON != "" {
+		var errorsW io.Writer = os.Stderr
+		if o.ErrorsJSON != "-" {
+			f, err := os.OpenFile(o.ErrorsJSON, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				return fmt.Errorf("error opening the -errors-json file: %w", err)
+			}
+			errorsW = f
+		}
+		handler = &errorsHandler{Handler: handler, w: errorsW, mu: new(sync.Mutex)}
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func newLogHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	switch format {
+	case "text":
+		return slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})
+	case "json":
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	}
+	return &plainHandler{w: w, mu: new(sync.Mutex), level: level}
+}
+
+func init() {
+	// Log plainly to stderr until the flags are parsed
+	slog.SetDefault(slog.New(newLogHandler(os.Stderr, "plain", slog.LevelInfo)))
+}
+
+// plainHandler writes each record as a line for people: the message after
+// a prefix naming its level, except for info messages, then the error it
+// carries and its other attributes as key=value pairs.
+type plainHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Level
+	attrs []slog.Attr
+	group string // the prefix of the keys of attributes in a group
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	case r.Level < slog.LevelInfo:
+		b.WriteString("Debug: ")
+	}
+	b.WriteString(r.Message)
+
+	attrs := slices.Clone(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, h.qualify(a))
+		return true
+	})
+	for _, a := range attrs {
+		if a.Key == "error" {
+			b.WriteString(": " + a.Value.String())
+		}
+	}
+	for _, a := range attrs {
+		if a.Key != "error" && !a.Equal(slog.Attr{}) {
+			value := a.Value.Resolve().String()
+			if value == "" || strings.ContainsAny(value, " \"=") {
+				value = strconv.Quote(value)
+			}
+			b.WriteString(" " + a.Key + "=" + value)
+		}
+	}
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		clone.attrs = append(clone.attrs, h.qualify(a))
+	}
+	return &clone
+}
+
+func (h *plainHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.group = h.group + name + "."
+	return &clone
+}
+
+// qualify prefixes the key of a with the groups of the handler.
+func (h *plainHandler) qualify(a slog.Attr) slog.Attr {
+	if h.group != "" && a.Key != "error" {
+		a.Key = h.group + a.Key
+	}
+	return a
+}
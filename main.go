@@ -4,24 +4,31 @@ import (
 	"bufio"
 	"context"
 	"encoding/binary"
-	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"iter"
+	"log/slog"
+	"math/rand/v2"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
 )
 
 const (
 	defaultConcurrency = 100
 	defaultAlgorithm   = "binary-search"
-	helpUsage          = "CIDR-Sensei -cidr=\"10.0.0.0/8,172.16.0.0/12,192.168.0.0/16\" -concurrency=100 -output json"
+	helpUsage          = "-cidr=\"10.0.0.0/8,172.16.0.0/12,192.168.0.0/16\" -concurrency=100 -output json"
 )
 
 type CIDRRange struct {
@@ -29,111 +36,1154 @@ type CIDRRange struct {
 	start  uint32
 	end    uint32
 	length uint32
+	entry  string // the input entry the range was parsed from
+	origin string // where the entry came from, e.g. "-cidr entry 3"
+	source string // the flag, file or provider the entry came from
+	piece  bool   // the entry is one of the blocks a range of addresses was split into
+
+	metadata map[string]string // the fields carried along with the entry
+}
+
+// String returns the CIDR notation for the range.
+func (c CIDRRange) String() string {
+	return c.ipNet.String()
 }
 
 type Config struct {
-	OutputFormat string
-	CIDRListStr  string
+	OutputFormat      string   // the first of Outputs
+	Outputs           []string // every -output given
+	OutputDir         string
+	FilenameTemplate  string
+	OutFile           string
+	OutputTable       string
+	SplitSize         string
+	SplitCount        int
+	Manifest          string
+	Fields            string
+	XLSXLayout        string
+	SinkRetries       int
+	KafkaKey          string
+	KafkaBatchSize    int
+	KafkaCompression  string
+	KafkaAcks         string
+	RedisKey          string
+	RedisType         string
+	RedisBatchSize    int
+	PostgresTyped     bool
+	PostgresBatchSize int
+	TemplateFile      string
+	HostNameTemplate  string
+	BinaryHeader      bool
+	CIDRListStr       string
+	InputFiles        []string
+	InputFormat       string
+	InputField        string
+	CSVColumn         string
+	CSVDelimiter      string
+	CSVHeader         string
+	ReadStdin         bool
+
+	InputURL       string
+	InputURLSHA256 string
+	FetchTimeout   time.Duration
+	FetchRetries   int
+	CacheDir       string
+	NoCache        bool
+
+	AWS           bool
+	AWSURL        string
+	GCP           bool
+	GCPURL        string
+	Azure         bool
+	AzureURL      string
+	Cloudflare    bool
+	CloudflareURL string
+	CloudServices string
+	CloudRegions  string
+
+	RIR          string
+	RIRFile      string
+	RIRCountries string
+	RIRStatuses  string
+
+	K8s        bool
+	Kubeconfig string
+	K8sContext string
+	K8sSelect  string
+
+	GeoIP          string
+	GeoIPCountries string
+	GeoIPASNs      string
+	GeoIPCities    string
+
+	MRT             string
+	MRTOrigins      string
+	MRTPrefixLength string
+
+	InputBitmap string
+
+	InputSQLite  string
+	SQLiteQuery  string
+	SQLiteTable  string
+	SQLiteColumn string
+
+	// Aliases are the named aliases of the settings file.
+	Aliases map[string]aliasEntries
+
 	Parallel     bool
 	Concurrency  int
 	Algorithm    string
+	Contains     string
+	Exclude      string
+	ExcludeFiles []string
+	Count        bool
+	BySource     bool
+	Sample       uint64
+	Seed         uint64
+	Offset       uint64
+	Limit        uint64
+	Rate         float64
+	BufferSize   string
+	ReuseIPs     bool // set by run when the IPs can be formatted into a reused buffer
+	Dedupe       bool
+	Collapse     string
+	Decode       string
+	Gaps         string
+	Overlaps     bool
+	Invert       bool
+	Universe     string
+	Merge        bool
+	ListSets     bool
+	Watch        bool
+
+	// JSONEnvelope wraps json output in an envelope of the metadata of the
+	// run, listing the Inputs and Exclusions blocks, which run records once
+	// they are loaded.
+	JSONEnvelope bool
+	Inputs       []CIDRRange
+	Exclusions   []CIDRRange
+
+	// Checkpoint is the file the progress of the expansion is saved to
+	// every CheckpointInterval, which Resume continues from.
+	Checkpoint         string
+	CheckpointInterval time.Duration
+	Resume             bool
+
+	// AlgorithmPlugins and OutputPlugins are the Go plugins registering
+	// more algorithms and output formats.
+	AlgorithmPlugins []string
+	OutputPlugins    []string
+
+	// RemoteWorkers are the serve instances the expansion is distributed
+	// across, in partitions of PartitionSize addresses.
+	RemoteWorkers []string
+	PartitionSize uint64
+	RemoteRetries int
+
+	// Script is the Starlark file whose hooks filter, rewrite and tag the
+	// blocks and IPs.
+	Script string
+
+	Logging logOptions
+	// OTLPEndpoint is the OpenTelemetry collector the spans of the run are
+	// exported to.
+	OTLPEndpoint string
+
+	Allocate       string
+	AllocatePrefix int
+	AllocateFit    string
+
+	Rules      string
+	RuleChain  string
+	RuleAction string
+	RuleSet    string
+	RuleTable  string
+
+	AWSRules     string
+	AWSRuleType  string
+	AWSName      string
+	AWSProtocol  string
+	AWSPorts     string
+	AWSChunkSize int
+	AWSGroupIDs  string
+
+	BPF          string
+	BPFDirection string
+	BPFLink      string
+	BPFMaxLength int
+
+	Push       string
+	PushDryRun bool
+
+	ScanTargets   string
+	ScanAggregate bool
+	ScanShardSize uint64
+
+	ReverseZones bool
+	PTRTemplate  string
+	ZoneTTL      int
+	SOAMName     string
+	SOARName     string
+	ZoneNS       string
+
+	ShowNormalized  bool
+	Strict          bool
+	StrictMinPrefix int
+	SkipInvalid     bool
+
+	ASNSource   string
+	ASNURL      string
+	ASNCacheTTL time.Duration
+	ASNRate     float64
+
+	DNSServers         string
+	ResolveTimeout     time.Duration
+	ResolveConcurrency int
+
+	HostsOnly        bool
+	IncludeNetwork   bool
+	IncludeBroadcast bool
 }
 
 func main() {
+	// Handle OS interrupts
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Run a subcommand when one is given, and expand the blocks otherwise
+	name, args := splitCommand(os.Args[1:])
+	switch name {
+	case "plan":
+		os.Exit(runPlan(args))
+	case "ipcalc":
+		os.Exit(runIPCalc(args))
+	case "diff":
+		os.Exit(runDiff(args))
+	case "serve":
+		os.Exit(runServe(ctx, args))
+	case "daemon":
+		os.Exit(runDaemon(ctx, args))
+	}
+
 	// Parse flags and handle configuration
-	config, err := parseFlags()
+	config, err := parseFlags(name, args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		fmt.Println("Error: ", err)
-		os.Exit(1)
+		slog.Error("invalid command line", "error", &parseError{err})
+		os.Exit(exitParse)
 	}
 
-	// Handle OS interrupts
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+	if config.ListSets {
+		os.Exit(runListSets(config))
+	}
+
+	if name == "shell" {
+		// The shell interrupts the command running on SIGINT, not itself
+		stop()
+		os.Exit(runShell(config))
+	}
+
+	if err := startTracing(config.OTLPEndpoint); err != nil {
+		slog.Error("invalid command line", "error", &parseError{err})
+		os.Exit(exitParse)
+	}
+	var code int
+	switch {
+	case name == "bench":
+		code = runBench(ctx, config)
+	case name == "tui":
+		code = runTUI(ctx, config)
+	case config.Watch:
+		code = runWatch(ctx, config)
+	default:
+		code = run(ctx, config)
+	}
+	stopTracing()
+	os.Exit(code)
+}
+
+// run expands the CIDR blocks, or runs the report selected by config, and
+// returns the process exit code.
+func run(ctx context.Context, config Config) (code int) {
+	ctx, span := startSpan(ctx, spanInternal, "run", slog.String("outputs", strings.Join(config.Outputs, ",")))
+	defer func() {
+		span.set(slog.Int("exit_code", code))
+		span.finish(exitError(code))
+	}()
+
+	// Collapse a list of IPs into CIDR blocks when requested
+	if config.Collapse != "" {
+		if err := runCollapse(config); err != nil {
+			slog.Error("cannot collapse the IPs", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Decode binary output when requested
+	if config.Decode != "" {
+		if err := runDecode(config); err != nil {
+			slog.Error("cannot decode the binary output", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
 
 	// Parse CIDR list
-	cidrRanges, err := parseCIDRList(strings.Split(config.CIDRListStr, ","))
+	fetcher := newFetcher(config.FetchTimeout, config.FetchRetries, config.CacheDir, config.NoCache)
+	parser := newCIDRParser(ctx, config, fetcher)
+	defer func() {
+		// Exit with a partial failure when -skip-invalid skipped entries
+		if code == 0 && parser.skipped > 0 {
+			slog.Warn("the output is incomplete", "error", &partialError{parser.skipped})
+			code = exitPartial
+		}
+	}()
+	_, parseSpan := startSpan(ctx, spanInternal, "parse", slog.String("list", "-cidr"))
+	cidrRanges, err := loadCIDRRanges(config, parser, collectEntries(config.CIDRListStr, "-cidr", inputSources(ctx, config, fetcher)...))
+	parseSpan.set(slog.Int("blocks", len(cidrRanges)))
+	parseSpan.finish(err)
+	if err != nil {
+		slog.Error("cannot load the CIDR blocks", "error", err)
+		return exitCode(err)
+	}
+
+	// Run the block hook of the -script on the blocks
+	var hooks *script
+	if config.Script != "" {
+		if hooks, err = loadScript(config.Script); err == nil {
+			cidrRanges, err = hooks.filterBlocks(cidrRanges)
+		}
+		if err != nil {
+			slog.Error("the -script failed", "error", err)
+			return exitCode(err)
+		}
+	}
+	slog.Debug("blocks loaded", "blocks", len(cidrRanges))
+	config.Inputs = cidrRanges
+
+	// Check membership instead of expanding when requested
+	if config.Contains != "" {
+		return runContains(config, cidrRanges)
+	}
+
+	// Report the free space within a parent block when requested
+	if config.Gaps != "" {
+		if err := runGaps(config, cidrRanges); err != nil {
+			slog.Error("cannot report the gaps", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Allocate a free subnet when requested
+	if config.Allocate != "" {
+		if err := runAllocate(config, cidrRanges); err != nil {
+			slog.Error("cannot allocate a subnet", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Report the complement of the blocks when requested
+	if config.Invert {
+		if err := runInvert(config, cidrRanges); err != nil {
+			slog.Error("cannot compute the complement", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Report overlapping blocks when requested
+	if config.Overlaps {
+		if err := runOverlaps(config, cidrRanges); err != nil {
+			slog.Error("cannot write output", "error", &outputError{err})
+			return exitOutput
+		}
+		return 0
+	}
+
+	// Drop network and broadcast addresses when requested
+	cidrRanges = filterHostAddresses(cidrRanges, config.IncludeNetwork, config.IncludeBroadcast)
+
+	// Remove excluded addresses
+	_, parseSpan = startSpan(ctx, spanInternal, "parse", slog.String("list", "-exclude"))
+	excludeRanges, err := loadCIDRRanges(config, parser, collectEntries(config.Exclude, "-exclude", excludeSources(ctx, config, fetcher)...))
+	parseSpan.set(slog.Int("blocks", len(excludeRanges)))
+	parseSpan.finish(err)
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		os.Exit(1)
+		slog.Error("cannot load the -exclude blocks", "error", err)
+		return exitCode(err)
+	}
+	config.Exclusions = excludeRanges
+	_, excludeSpan := startSpan(ctx, spanInternal, "exclude", slog.Int("blocks", len(cidrRanges)), slog.Int("excluded_blocks", len(excludeRanges)))
+	cidrRanges = excludeCIDRRanges(cidrRanges, mergeIPRanges(toIPRanges(excludeRanges)))
+	excludeSpan.finish(nil)
+
+	// Write firewall rules instead of expanding when requested
+	if config.Rules != "" {
+		if err := runRules(config, cidrRanges); err != nil {
+			slog.Error("cannot write the firewall rules", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Write AWS security groups or prefix lists instead of expanding when requested
+	if config.AWSRules != "" {
+		if err := runAWSRules(config, cidrRanges); err != nil {
+			slog.Error("cannot write the AWS rules", "error", err)
+			return exitCode(err)
+		}
+		return 0
 	}
 
+	// Write packet filters instead of expanding when requested
+	if config.BPF != "" {
+		if err := runBPF(config, cidrRanges); err != nil {
+			slog.Error("cannot write the packet filters", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Sync a remote IP list instead of expanding when requested
+	if config.Push != "" {
+		if err := runPush(ctx, config, fetcher, cidrRanges); err != nil {
+			slog.Error("cannot push the blocks", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Write a scanner target list instead of expanding when requested
+	if config.ScanTargets != "" {
+		if err := runScanTargets(config, cidrRanges); err != nil {
+			slog.Error("cannot write the scanner targets", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Write reverse DNS zones instead of expanding when requested
+	if config.ReverseZones {
+		if err := runReverseZones(config, cidrRanges); err != nil {
+			slog.Error("cannot write the reverse zones", "error", err)
+			return exitCode(err)
+		}
+		return 0
+	}
+
+	// Output the merged blocks instead of expanding them when requested
+	if config.Merge && isSinkURL(config.OutputFormat) {
+		if err := writeCIDRSink(config, mergeCIDRRanges(ctx, cidrRanges)); err != nil {
+			slog.Error("cannot write output", "error", &outputError{err})
+			return exitOutput
+		}
+		return 0
+	}
+	if config.Merge {
+		if err := writeCIDRList(os.Stdout, config.OutputFormat, mergeCIDRRanges(ctx, cidrRanges)); err != nil {
+			slog.Error("cannot write output", "error", &outputError{err})
+			return exitOutput
+		}
+		return 0
+	}
+
+	// Report the size of the expansion without performing it when requested
+	if config.Count {
+		if err := runCount(config, cidrRanges); err != nil {
+			slog.Error("cannot write output", "error", &outputError{err})
+			return exitOutput
+		}
+		return 0
+	}
+
+	// Expand blocks listed by several sources only once
+	_, dedupeSpan := startSpan(ctx, spanInternal, "dedupe", slog.Int("blocks", len(cidrRanges)))
+	cidrRanges = dedupeCIDRRanges(cidrRanges)
+	dedupeSpan.set(slog.Int("distinct_blocks", len(cidrRanges)))
+	dedupeSpan.finish(nil)
+
 	// Start processing
 	startTime := time.Now()
 
-	var ips []string
-	if config.Parallel {
-		ips, err = cidrToIPsParallel(ctx, cidrRanges, config.Concurrency, config.Algorithm)
-	} else {
-		ips, err = cidrToIPsBinarySearch(cidrRanges)
+	// Continue from the -checkpoint when resuming
+	var checkpoint *checkpointer
+	if config.Checkpoint != "" {
+		if checkpoint, err = newCheckpointer(config, cidrRanges); err != nil {
+			slog.Error("cannot resume the expansion", "error", err)
+			return exitCode(err)
+		}
 	}
 
+	output, err := newIPWriters(ctx, config, cidrRanges, checkpoint.resumed())
 	if err != nil {
-		fmt.Printf("Error: %s\n", err)
-		os.Exit(1)
+		slog.Error("cannot write output", "error", &outputError{err})
+		return exitOutput
+	}
+	// The IPs are counted for the checkpoint as they are expanded, then
+	// deduplicated, filtered by the script, paced and written, stopping on
+	// SIGINT with the output written until then.
+	var track, unique, filter, pace stage
+	done := false
+	if checkpoint != nil {
+		checkpoint.outputs = output
+		config.Offset, config.Limit, done = checkpoint.page()
+		track = checkpoint.track
+	}
+	var dedupe *deduper
+	if config.Dedupe {
+		if dedupe = newDeduper(cidrRanges); dedupe != nil {
+			unique = dedupe.stage
+		}
+	}
+	if hooks != nil {
+		filter = func(next func(string) error) func(string) error {
+			return hooks.filterAddresses(cidrRanges, config.Algorithm, next)
+		}
+	}
+	if config.Rate > 0 {
+		pace = func(next func(string) error) func(string) error {
+			return rateLimited(ctx, config.Rate, output.flush, next)
+		}
+	}
+	interrupt := func(next func(string) error) func(string) error {
+		return interruptible(ctx, next)
+	}
+	emit := pipeline(output.write, track, unique, filter, pace, interrupt)
+	// The script may keep the IPs it is given, and so may some outputs.
+	config.ReuseIPs = hooks == nil && output.borrowsRecords()
+	if !done {
+		err = expandIPs(ctx, config, cidrRanges, nil, emit)
+	}
+	if checkpoint != nil && errors.Is(err, errInterrupted) {
+		if saveErr := checkpoint.save(); saveErr != nil {
+			slog.Error("cannot save the checkpoint", "error", saveErr)
+		} else {
+			slog.Info("checkpoint saved, continue the expansion with -resume", "checkpoint", config.Checkpoint)
+		}
+	}
+	if closeErr := output.close(); err == nil && closeErr != nil {
+		slog.Error("cannot write output", "error", closeErr)
+		return exitCode(closeErr)
 	}
-
-	// Handle output
-	err = handleOutput(config.OutputFormat, ips, config.CIDRListStr)
 	if err != nil {
-		fmt.Printf("Error writing output: %v\n", err)
+		slog.Error("the expansion failed", "error", err)
+		return exitCode(err)
+	}
+	if checkpoint != nil {
+		checkpoint.remove()
+	}
+	if dedupe != nil && dedupe.dropped > 0 {
+		slog.Info("dropped duplicate IPs of overlapping blocks", "duplicates", dedupe.dropped, "bitset_pages", dedupe.seen.used)
 	}
+	if config.Manifest != "" {
+		if err := writeManifest(config, output); err != nil {
+			slog.Error("cannot write the manifest", "error", err)
+			return exitCode(err)
+		}
+	}
+
+	slog.Info("expansion complete", "duration", time.Since(startTime).Round(time.Millisecond))
+	return 0
+}
 
-	fmt.Printf("Took %.2f seconds to complete.\n", time.Since(startTime).Seconds())
+// expandIPs passes the IPs config selects to emit: a -sample or a page of
+// them, or all of them, expanded in parallel with -parallel or by the
+// -remote-workers. progress, when not nil, counts the IPs of each parallel
+// worker, or all of them in its first counter otherwise.
+func expandIPs(ctx context.Context, config Config, cidrRanges []CIDRRange, progress []workerProgress, emit func(string) error) (err error) {
+	ctx, span := startSpan(ctx, spanInternal, "expand", slog.String("algorithm", config.Algorithm), slog.Int("blocks", len(cidrRanges)))
+	if config.expandsInParallel() {
+		span.set(slog.Int("concurrency", config.Concurrency))
+	}
+	if span.IsRecording() {
+		var addresses uint64
+		traced := emit
+		emit = func(ip string) error {
+			addresses++
+			return traced(ip)
+		}
+		defer func() {
+			span.set(slog.Uint64("addresses", addresses))
+			span.finish(err)
+		}()
+	}
+	if config.expandsInParallel() {
+		return cidrToIPsParallel(ctx, cidrRanges, config.Concurrency, config.Algorithm, config.buffers().channelCapacity(), progress, emit)
+	}
+	if progress != nil {
+		counted := emit
+		emit = func(ip string) error {
+			progress[0].add(1)
+			return counted(ip)
+		}
+	}
+	if len(config.RemoteWorkers) > 0 {
+		return expandRemote(ctx, config, cidrRanges, emit)
+	}
+	if config.Sample > 0 {
+		return emitIPs(sampleIPs(cidrRanges, config.Sample, config.Seed), emit)
+	}
+	if config.Offset > 0 || config.Limit > 0 || config.Checkpoint != "" {
+		return pageIPs(cidrRanges, config.Offset, config.Limit, newIPFormatter(config), emit)
+	}
+	return expandSequential(config.Algorithm, cidrRanges, newIPFormatter(config), emit)
 }
 
-func parseFlags() (Config, error) {
+// parseFlags parses the flags of the expansion command name, which is
+// expand or one of the commands presetting its flags, from args.
+func parseFlags(name string, args []string) (Config, error) {
 	var config Config
-	flag.StringVar(&config.OutputFormat, "output", "terminal", "the output format (json, csv, or terminal)")
+	config.Outputs = []string{"terminal"}
+	outputs := &outputFlag{values: &config.Outputs, replace: true}
+	flag.Var(outputs, "output", "the output format ("+strings.Join(outputFormats, ", ")+"), or a network sink to stream the IPs to (tcp://host:port, udp://host:port, syslog://host[:port], syslog+tcp://host[:port], kafka://host:port[,host:port...]/topic, redis://[[user]:password@]host[:port][/db], postgres://[user[:password]@]host[:port]/database) (repeatable, to write several in one pass)")
+	flag.Var((*listFlag)(&config.OutputPlugins), "output-plugin", "a Go plugin registering more -output formats (repeatable)")
+	flag.StringVar(&config.Script, "script", "", "a Starlark script whose block and address functions filter, rewrite and tag the blocks and IPs before output")
+	config.Logging.addFlags(flag.CommandLine)
+	flag.StringVar(&config.OTLPEndpoint, "otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "the base URL of an OpenTelemetry collector to export traces to over OTLP/HTTP, such as http://localhost:4318")
+	flag.StringVar(&config.OutputDir, "output-dir", "", "the directory output files are written to (default current directory)")
+	flag.StringVar(&config.FilenameTemplate, "filename-template", defaultFilenameTemplate, "the Go text/template of generated output file names, without the extension ({{.Date}}, {{.Format}}, {{.Hash}}, {{.FirstCIDR}}, {{.CIDRs}})")
+	flag.StringVar(&config.OutFile, "outfile", "", "the file the expanded IPs are written to, or - for stdout (default a generated name, or stdout for terminal output)")
+	flag.StringVar(&config.OutputTable, "output-table", "ips", "the table sqlite output is written to")
+	flag.StringVar(&config.SplitSize, "split-size", "", "split file output into numbered files of about this size, such as 500MB or 2GiB, listed in a manifest")
+	flag.IntVar(&config.SplitCount, "split-count", 0, "split file output evenly into this many numbered files, listed in a manifest")
+	flag.StringVar(&config.Fields, "fields", defaultFields, "a comma-separated list of the fields of each IP in json, ndjson, csv and xlsx output ("+strings.Join(ipFields, ", ")+")")
+	flag.StringVar(&config.XLSXLayout, "xlsx-layout", "source", "the worksheets of xlsx output (source for one for each block the IPs came from, single)")
+	flag.BoolVar(&config.JSONEnvelope, "json-envelope", false, "wrap json output in an object recording the schema version, the tool version, the blocks expanded and excluded, when the output started and finished, and the counts")
+	flag.StringVar(&config.Manifest, "manifest", "", "write a JSON manifest of the output files, with their record counts and SHA-256 checksums, the flags given and the version, to this file")
+	flag.IntVar(&config.SinkRetries, "sink-retries", 5, "the number of times to reconnect and retry a failed write to a network -output sink")
+	flag.StringVar(&config.KafkaKey, "kafka-key", "source", "the key of kafka:// output messages (source for the block the IP came from, address, none)")
+	flag.IntVar(&config.KafkaBatchSize, "kafka-batch-size", defaultKafkaBatchSize, "the number of kafka:// output messages sent before waiting for their delivery")
+	flag.StringVar(&config.KafkaCompression, "kafka-compression", "none", "the compression of kafka:// output batches (none, gzip)")
+	flag.StringVar(&config.RedisKey, "redis-key", defaultRedisKey, "the key redis:// output replaces with the IPs")
+	flag.StringVar(&config.RedisType, "redis-type", "set", "what redis:// output writes (set of the IPs, bitmap with the bit of each IP's integer value set)")
+	flag.IntVar(&config.RedisBatchSize, "redis-batch-size", defaultRedisBatchSize, "the number of IPs redis:// output writes in one pipelined round trip")
+	flag.BoolVar(&config.PostgresTyped, "pg-typed", false, "make the address and source columns postgres:// output creates inet and cidr instead of text")
+	flag.IntVar(&config.PostgresBatchSize, "pg-batch-size", defaultPostgresBatchRows, "the number of rows postgres:// output copies in each transaction")
+	flag.StringVar(&config.KafkaAcks, "kafka-acks", "all", "the acknowledgement kafka:// output waits for (all for every in-sync replica, leader)")
+	flag.BoolVar(&config.BinaryHeader, "binary-header", false, "start binary output with a header identifying the format")
+	flag.StringVar(&config.HostNameTemplate, "hostname-template", defaultHostNameTemplate, "the Go text/template of the host names hosts and dnsmasq output pairs each IP with")
+	flag.StringVar(&config.TemplateFile, "template-file", "", "the Go text/template file template output renders each IP with")
 	flag.StringVar(&config.CIDRListStr, "cidr", "", "a comma-separated list of CIDR blocks to expand into IPs")
+	flag.Var((*listFlag)(&config.InputFiles), "input", "a file or glob pattern of files of CIDR blocks to expand, one per line (repeatable)")
+	flag.StringVar(&config.InputFormat, "input-format", defaultInputFormat, "the format of -input, stdin and -input-url lists (auto, plain, json, csv, yaml, terraform, prefix-list, iptables, nftables, pf, cisco)")
+	flag.StringVar(&config.InputField, "input-field", "", "the dot-separated path of the field holding the CIDR blocks in JSON and YAML input (e.g. prefixes.ip_prefix)")
+	flag.StringVar(&config.CSVColumn, "csv-column", "", "the name or 1-based index of the column holding the CIDR blocks in CSV input")
+	flag.StringVar(&config.CSVDelimiter, "csv-delimiter", ",", "the character separating the columns of CSV input (\\t or tab for tabs)")
+	flag.StringVar(&config.CSVHeader, "csv-header", "auto", "whether the first row of CSV input is a header (auto, yes, no)")
+	flag.StringVar(&config.InputURL, "input-url", "", "a URL of a list of CIDR blocks to expand, one per line")
+	flag.StringVar(&config.InputURLSHA256, "input-url-sha256", "", "the expected SHA-256 checksum of the -input-url list")
+	flag.DurationVar(&config.FetchTimeout, "fetch-timeout", defaultFetchTimeout, "the timeout for each download attempt")
+	flag.IntVar(&config.FetchRetries, "fetch-retries", defaultFetchRetries, "the number of times to retry a failed download")
+	flag.StringVar(&config.CacheDir, "cache-dir", "", "the directory downloaded lists are cached in (default user cache directory)")
+	flag.BoolVar(&config.NoCache, "no-cache", false, "always download lists instead of revalidating a cached copy")
+	flag.BoolVar(&config.AWS, "aws", false, "expand the IPv4 ranges published in AWS's ip-ranges.json")
+	flag.StringVar(&config.AWSURL, "aws-url", defaultAWSURL, "the URL of AWS's ip-ranges.json")
+	flag.BoolVar(&config.GCP, "gcp", false, "expand the IPv4 ranges published in Google Cloud's cloud.json")
+	flag.StringVar(&config.GCPURL, "gcp-url", defaultGCPURL, "the URL of Google Cloud's cloud.json")
+	flag.BoolVar(&config.Azure, "azure", false, "expand the IPv4 ranges of Azure's service tags")
+	flag.StringVar(&config.AzureURL, "azure-url", defaultAzureURL, "the URL of Azure's ServiceTags JSON, or of the download page linking to it")
+	flag.BoolVar(&config.Cloudflare, "cloudflare", false, "expand the IPv4 ranges Cloudflare publishes")
+	flag.StringVar(&config.CloudflareURL, "cloudflare-url", defaultCloudflareURL, "the URL of Cloudflare's IPv4 range list")
+	flag.StringVar(&config.CloudServices, "cloud-service", "", "a comma-separated list of services to select cloud ranges for (e.g. EC2,S3,CLOUDFRONT)")
+	flag.StringVar(&config.CloudRegions, "cloud-region", "", "a comma-separated list of regions to select cloud ranges for (e.g. us-east-1)")
+	flag.StringVar(&config.RIR, "rir", "", "a comma-separated list of registries to expand the delegated blocks of (afrinic, apnic, arin, lacnic, ripencc, or all)")
+	flag.StringVar(&config.RIRFile, "rir-file", "", "a delegated statistics file to read instead of downloading the -rir files")
+	flag.StringVar(&config.RIRCountries, "rir-country", "", "a comma-separated list of country codes to select delegated blocks for (e.g. NL,DE)")
+	flag.StringVar(&config.RIRStatuses, "rir-status", defaultRIRStatus, "a comma-separated list of statuses to select delegated blocks for (allocated, assigned, available, reserved)")
+	flag.BoolVar(&config.K8s, "k8s", false, "expand the Pod CIDRs, Service CIDRs and node addresses of a Kubernetes cluster")
+	flag.StringVar(&config.Kubeconfig, "kubeconfig", "", "the kubeconfig file to reach the -k8s cluster with (default in-cluster, KUBECONFIG or ~/.kube/config)")
+	flag.StringVar(&config.K8sContext, "k8s-context", "", "the kubeconfig context of the -k8s cluster (default current context)")
+	flag.StringVar(&config.K8sSelect, "k8s-select", defaultK8sSelect, "a comma-separated list of the -k8s ranges to expand (pods, services, nodes)")
+	flag.StringVar(&config.GeoIP, "geoip", "", "a MaxMind DB file, such as GeoLite2-City.mmdb, to expand the selected networks of")
+	flag.StringVar(&config.GeoIPCountries, "geoip-country", "", "a comma-separated list of country codes to select -geoip networks for (e.g. NL,DE)")
+	flag.StringVar(&config.GeoIPASNs, "geoip-asn", "", "a comma-separated list of AS numbers to select -geoip networks for (e.g. AS13335)")
+	flag.StringVar(&config.GeoIPCities, "geoip-city", "", "a comma-separated list of cities to select -geoip networks for (e.g. Amsterdam)")
+	flag.StringVar(&config.MRT, "mrt", "", "an MRT RIB dump file, URL or object, such as a RouteViews or RIPE RIS bview, to expand the IPv4 prefixes of")
+	flag.StringVar(&config.MRTOrigins, "mrt-origin", "", "a comma-separated list of origin AS numbers to select -mrt prefixes for (e.g. AS13335)")
+	flag.StringVar(&config.MRTPrefixLength, "mrt-prefix-length", "", "the prefix length, or range of lengths, to select -mrt prefixes for (e.g. 16-24)")
+	flag.StringVar(&config.InputBitmap, "input-bitmap", "", "a roaring bitmap file, such as written by -output=roaring, of IPs to expand")
+	flag.StringVar(&config.InputSQLite, "input-sqlite", "", "a SQLite database file (or file: URI) to read CIDR blocks to expand from")
+	flag.StringVar(&config.SQLiteQuery, "sqlite-query", "", "the SQL query selecting the -input-sqlite rows holding CIDR blocks")
+	flag.StringVar(&config.SQLiteTable, "sqlite-table", "", "the -input-sqlite table holding CIDR blocks, instead of a -sqlite-query")
+	flag.StringVar(&config.SQLiteColumn, "sqlite-column", "", "the column holding the CIDR blocks in the -input-sqlite rows (default detected)")
 	flag.BoolVar(&config.Parallel, "parallel", false, "enable parallel processing")
 	flag.IntVar(&config.Concurrency, "concurrency", defaultConcurrency, "set the number of workers for parallel processing")
-	flag.StringVar(&config.Algorithm, "algorithm", defaultAlgorithm, "the algorithm to use for expanding CIDR blocks into IPs (binary-search, interval-tree)")
+	remoteWorkers := flag.String("remote-workers", "", "a comma-separated list of the host:port addresses of serve instances to distribute the expansion across")
+	flag.Uint64Var(&config.PartitionSize, "partition-size", defaultPartitionSize, "the most addresses of each partition of the expansion sent to a -remote-workers instance")
+	flag.IntVar(&config.RemoteRetries, "remote-retries", defaultRemoteRetries, "how many times a partition failing on a -remote-workers instance is retried")
+	flag.StringVar(&config.Algorithm, "algorithm", defaultAlgorithm, "the algorithm to use for expanding CIDR blocks into IPs ("+strings.Join(algorithmNames(), ", ")+", or one registered by an -algorithm-plugin)")
+	flag.Var((*listFlag)(&config.AlgorithmPlugins), "algorithm-plugin", "a Go plugin registering more -algorithm choices (repeatable)")
+	flag.StringVar(&config.Contains, "contains", "", "a comma-separated list of IPs to check against the CIDR blocks instead of expanding them")
+	flag.StringVar(&config.Exclude, "exclude", "", "a comma-separated list of CIDR blocks to leave out of the expansion")
+	flag.Var((*listFlag)(&config.ExcludeFiles), "exclude-input", "a file or glob pattern of files of CIDR blocks to leave out of the expansion, one per line (repeatable)")
+	flag.BoolVar(&config.Merge, "merge", false, "output the merged CIDR blocks covering the addresses instead of expanding them")
+	flag.BoolVar(&config.Count, "count", false, "print the number of IPs the CIDR blocks would expand to without expanding them")
+	flag.BoolVar(&config.BySource, "by-source", false, "break the -count report down by the flag, file or provider each block came from")
+	flag.Uint64Var(&config.Sample, "sample", 0, "emit a uniform random sample of this many IPs instead of the full expansion")
+	flag.Uint64Var(&config.Seed, "seed", 0, "the seed for -sample, for reproducible samples (default random)")
+	flag.Uint64Var(&config.Offset, "offset", 0, "skip this many IPs of the merged expansion order before emitting")
+	flag.Uint64Var(&config.Limit, "limit", 0, "emit at most this many IPs of the merged expansion order (default no limit)")
+	flag.Float64Var(&config.Rate, "rate", 0, "emit at most this many IPs a second, to avoid flooding the system the output feeds (default no limit)")
+	flag.BoolVar(&config.Dedupe, "dedupe", false, "write each IP once when the blocks overlap, tracking the IPs written in a bitset of the /16s they are in")
+	flag.StringVar(&config.BufferSize, "buffer-size", defaultBufferSize, "the memory the buffers between the expansion and the outputs share, such as 256KiB or 16MiB")
+	flag.StringVar(&config.Checkpoint, "checkpoint", "", "save the progress of the expansion to this file every -checkpoint-interval and when interrupted, so that -resume can continue it")
+	flag.DurationVar(&config.CheckpointInterval, "checkpoint-interval", defaultCheckpointInterval, "how often the -checkpoint is saved")
+	flag.BoolVar(&config.Resume, "resume", false, "continue the expansion from the -checkpoint file, appending to the output files it lists")
+	flag.BoolVar(&config.Watch, "watch", false, "keep running and expand the input files again whenever they change")
+	flag.BoolVar(&config.ListSets, "list-sets", false, "list the built-in address sets that can be given as @name entries")
+	flag.StringVar(&config.Collapse, "collapse", "", "collapse a file of IPs (or - for stdin) into the minimal list of CIDR blocks")
+	flag.StringVar(&config.Decode, "decode", "", "read a file of binary output (or - for stdin) and write the IPs in the -output format")
+	flag.StringVar(&config.Gaps, "gaps", "", "report the parts of this parent CIDR block not covered by the -cidr blocks")
+	flag.BoolVar(&config.Overlaps, "overlaps", false, "report every pair of -cidr blocks that overlap instead of expanding them")
+	flag.BoolVar(&config.Invert, "invert", false, "output the CIDR blocks covering everything not in the -cidr blocks")
+	flag.StringVar(&config.Universe, "universe", defaultUniverse, "the CIDR block -invert computes the complement within")
+	flag.StringVar(&config.Rules, "rules", "", "write firewall rules for this firewall (iptables, nftables) matching the merged CIDR blocks instead of expanding them")
+	flag.StringVar(&config.RuleChain, "rule-chain", defaultRuleChain, "the chain of the -rules rules")
+	flag.StringVar(&config.RuleAction, "rule-action", defaultRuleAction, "the action of the -rules rules (e.g. drop, accept, reject)")
+	flag.StringVar(&config.RuleSet, "rule-set", defaultRuleSet, "the name of the nftables set -rules defines")
+	flag.StringVar(&config.RuleTable, "rule-table", defaultRuleTable, "the table of the -rules rules")
+	flag.StringVar(&config.AWSRules, "aws-rules", "", "write AWS security groups or prefix lists of the merged CIDR blocks in this format (terraform, aws-cli) instead of expanding them")
+	flag.StringVar(&config.AWSRuleType, "aws-rule-type", defaultAWSRuleType, "what -aws-rules writes (security-group, prefix-list)")
+	flag.StringVar(&config.AWSName, "aws-name", defaultAWSRuleName, "the name of the -aws-rules security groups or prefix lists, numbered when there are several")
+	flag.StringVar(&config.AWSProtocol, "aws-protocol", defaultAWSProtocol, "the protocol of the -aws-rules ingress rules (tcp, udp, icmp, or -1 for all)")
+	flag.StringVar(&config.AWSPorts, "aws-ports", "", "the port or port range of the -aws-rules ingress rules, such as 443 or 8000-8999 (default all)")
+	flag.IntVar(&config.AWSChunkSize, "aws-chunk-size", 0, "the most blocks in one -aws-rules security group or prefix list (default 60 rules per group, 1000 entries per list)")
+	flag.StringVar(&config.AWSGroupIDs, "aws-group-id", "", "comma separated IDs of the security groups the aws-cli -aws-rules documents add rules to, one per chunk")
+	flag.StringVar(&config.BPF, "bpf", "", "write a packet filter matching the merged CIDR blocks, as a libpcap expression or a compiled classic BPF program (expression, compiled), instead of expanding them")
+	flag.StringVar(&config.BPFDirection, "bpf-direction", "", "match only the source or destination address in -bpf filters (src, dst) (default either)")
+	flag.StringVar(&config.BPFLink, "bpf-link", "ethernet", "the link layer of the packets compiled -bpf programs filter (ethernet, raw for bare IP packets)")
+	flag.IntVar(&config.BPFMaxLength, "bpf-max-length", 0, "split -bpf expressions longer than this many characters into several filters (default no limit)")
+	flag.StringVar(&config.Push, "push", "", "make this remote IP list (cloudflare://ACCOUNT_ID/LIST_ID or wafv2://REGIONAL|CLOUDFRONT/NAME/ID) hold the merged CIDR blocks instead of expanding them")
+	flag.BoolVar(&config.PushDryRun, "push-dry-run", false, "print the changes -push would make without making them")
+	flag.StringVar(&config.ScanTargets, "scan-targets", "", "write a target list for this scanner (nmap, masscan) instead of expanding the CIDR blocks")
+	flag.BoolVar(&config.ScanAggregate, "scan-aggregate", false, "merge the -scan-targets blocks into the fewest targets")
+	flag.Uint64Var(&config.ScanShardSize, "scan-shard-size", 0, "split the -scan-targets list into -outfile files of at most this many addresses each")
+	flag.BoolVar(&config.ReverseZones, "reverse-zones", false, "write in-addr.arpa zone file skeletons for the CIDR blocks instead of expanding them")
+	flag.StringVar(&config.PTRTemplate, "ptr-template", defaultPTRTemplate, "the Go text/template of the host names -reverse-zones PTR records point to")
+	flag.IntVar(&config.ZoneTTL, "zone-ttl", defaultZoneTTL, "the default TTL, in seconds, of -reverse-zones zones")
+	flag.StringVar(&config.SOAMName, "soa-mname", defaultSOAMName, "the primary name server in the SOA record of -reverse-zones zones")
+	flag.StringVar(&config.SOARName, "soa-rname", defaultSOARName, "the administrator mailbox in the SOA record of -reverse-zones zones (e.g. hostmaster@example.com)")
+	flag.StringVar(&config.ZoneNS, "zone-ns", "", "a comma-separated list of the name servers of -reverse-zones zones (default -soa-mname)")
+	flag.BoolVar(&config.ShowNormalized, "show-normalized", false, "report input entries that were rewritten into canonical CIDR notation on stderr")
+	flag.BoolVar(&config.Strict, "strict", false, "reject entries with host bits set, duplicate entries and overly broad prefixes instead of normalizing them")
+	flag.IntVar(&config.StrictMinPrefix, "strict-min-prefix", defaultStrictMinPrefix, "the shortest prefix length -strict accepts")
+	flag.BoolVar(&config.SkipInvalid, "skip-invalid", false, "skip the entries that cannot be parsed or resolved, with a warning, expanding the rest and exiting with code 4")
+	flag.StringVar(&config.ASNSource, "asn-source", defaultASNSource, "the service to look up the prefixes announced by AS number entries with (ripestat, bgp.tools)")
+	flag.StringVar(&config.ASNURL, "asn-url", "", "the URL of the -asn-source API or table, to use a mirror")
+	flag.DurationVar(&config.ASNCacheTTL, "asn-cache-ttl", defaultASNCacheTTL, "how long the announced prefixes of an AS are cached before they are looked up again")
+	flag.Float64Var(&config.ASNRate, "asn-rate", defaultASNRate, "the maximum number of -asn-source requests a second (0 for no limit)")
+	flag.StringVar(&config.DNSServers, "dns-servers", "", "a comma-separated list of DNS servers to resolve hostnames with (default system resolver)")
+	flag.DurationVar(&config.ResolveTimeout, "resolve-timeout", defaultResolveTimeout, "the timeout for resolving each hostname")
+	flag.IntVar(&config.ResolveConcurrency, "resolve-concurrency", defaultResolveConcurrency, "the maximum number of hostnames to resolve at once")
+	flag.StringVar(&config.Allocate, "allocate", "", "allocate a free subnet within this parent CIDR block, treating the -cidr blocks as used")
+	flag.IntVar(&config.AllocatePrefix, "allocate-prefix", defaultAllocatePrefix, "the prefix length of the subnet -allocate returns")
+	flag.StringVar(&config.AllocateFit, "allocate-fit", defaultAllocateFit, "how -allocate picks the subnet (first, best)")
+	flag.BoolVar(&config.HostsOnly, "hosts-only", false, "skip the network and broadcast address of each CIDR block")
+	flag.BoolVar(&config.IncludeNetwork, "include-network", true, "include the network address of each CIDR block")
+	flag.BoolVar(&config.IncludeBroadcast, "include-broadcast", true, "include the broadcast address of each CIDR block")
 	flag.Usage = func() {
-		fmt.Printf("Usage: %s [OPTIONS]\n", os.Args[0])
-		fmt.Println("Expand a comma-separated list of CIDR blocks into a list of IPs")
+		printCommandUsage(name)
 		fmt.Println("")
 		fmt.Println("Options:")
 		flag.PrintDefaults()
-		fmt.Println("")
-		fmt.Println("Examples:")
-		fmt.Println(helpUsage)
+		printCommandExamples(name)
+	}
+	settings, err := loadSettings(flag.CommandLine)
+	if err != nil {
+		return config, err
+	}
+	config.Aliases = settings.Aliases
+	// The first -output on the command line replaces the settings file's
+	outputs.replace = true
+	// Return parse errors, for main to exit with exitParse rather than 2
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return config, err
+	}
+	if err := config.Logging.setup(); err != nil {
+		return config, err
+	}
+	config.OutputFormat = config.Outputs[0]
+	args, err = applyCommand(name, &config, flag.Args())
+	if err != nil {
+		return config, err
 	}
-	flag.Parse()
 
 	// Validate flags
-	if config.CIDRListStr == "" {
-		return config, fmt.Errorf("the -cidr flag is required")
+	// Read entries from stdin for "-cidr -", a "-" argument, or when they
+	// are piped in without -cidr or -input
+	if len(args) > 1 || (len(args) == 1 && args[0] != "-") {
+		return config, fmt.Errorf("unexpected argument %q (a - argument must come after all flags)", args[0])
+	}
+	if config.CIDRListStr == "-" || len(args) == 1 {
+		config.ReadStdin = true
+	} else if name != "shell" && name != "tui" && !config.hasSource() && config.Collapse == "" && config.Decode == "" && !config.ListSets && isStdinPipe() {
+		config.ReadStdin = true
+	}
+	if config.CIDRListStr == "-" {
+		config.CIDRListStr = ""
+	}
+
+	if name != "shell" && !config.hasSource() && !config.ReadStdin && config.Collapse == "" && config.Decode == "" && config.Allocate == "" && !config.ListSets {
+		return config, fmt.Errorf("the -cidr flag or an input source such as -input is required")
+	}
+
+	if config.Watch && (config.ReadStdin || config.Collapse == "-" || config.Decode == "-" || slices.Contains(config.InputFiles, "-")) {
+		return config, fmt.Errorf("the -watch flag cannot be used with stdin")
+	}
+
+	for _, path := range config.OutputPlugins {
+		if err := loadOutputPlugin(path); err != nil {
+			return config, err
+		}
+	}
+	sinks := false
+	for _, output := range config.Outputs {
+		if !isSinkURL(output) {
+			if _, ok := outputSinks[output]; !ok {
+				return config, fmt.Errorf("unsupported output format: %s (expected one of %s)", output, strings.Join(outputFormats, ", "))
+			}
+			continue
+		}
+		sinks = true
+		if err := checkSinkURL(output); err != nil {
+			return config, err
+		}
+		if config.Merge && config.RedisType == "bitmap" && strings.HasPrefix(output, "redis") {
+			return config, fmt.Errorf("a redis:// bitmap holds IPs, and cannot be written with -merge")
+		}
+		if config.Merge && strings.HasPrefix(output, "postgres") {
+			return config, fmt.Errorf("postgres:// output holds rows of IPs, and cannot be written with -merge")
+		}
+	}
+	if sinks {
+		if config.OutFile != "" {
+			return config, fmt.Errorf("the -outfile flag cannot be used with a network -output sink")
+		}
+		if !slices.Contains(kafkaKeys, config.KafkaKey) {
+			return config, fmt.Errorf("unsupported -kafka-key: %s (expected one of %s)", config.KafkaKey, strings.Join(kafkaKeys, ", "))
+		}
+		if !slices.Contains(kafkaCompressions, config.KafkaCompression) {
+			return config, fmt.Errorf("unsupported -kafka-compression: %s (expected one of %s)", config.KafkaCompression, strings.Join(kafkaCompressions, ", "))
+		}
+		if !slices.Contains(kafkaAcks, config.KafkaAcks) {
+			return config, fmt.Errorf("unsupported -kafka-acks: %s (expected one of %s)", config.KafkaAcks, strings.Join(kafkaAcks, ", "))
+		}
+		if !slices.Contains(redisTypes, config.RedisType) {
+			return config, fmt.Errorf("unsupported -redis-type: %s (expected one of %s)", config.RedisType, strings.Join(redisTypes, ", "))
+		}
+	}
+	if len(config.Outputs) > 1 {
+		if err := checkOutputs(config); err != nil {
+			return config, err
+		}
+	}
+	if err := checkSplit(config); err != nil {
+		return config, err
+	}
+	if _, err := parseFields(config.Fields); err != nil {
+		return config, err
+	}
+	if _, err := parseFilenameTemplate(config.FilenameTemplate); err != nil {
+		return config, err
+	}
+	if !slices.Contains(xlsxLayouts, config.XLSXLayout) {
+		return config, fmt.Errorf("unsupported -xlsx-layout: %s (expected one of %s)", config.XLSXLayout, strings.Join(xlsxLayouts, ", "))
+	}
+	if config.Manifest != "" && (config.report() || config.Rules != "" || config.AWSRules != "" || config.BPF != "" || config.Push != "" || config.ScanTargets != "" || config.ReverseZones) {
+		return config, fmt.Errorf("the -manifest flag lists the files of an expansion, and cannot be used with reports")
+	}
+	if slices.Contains(config.Outputs, "template") != (config.TemplateFile != "") {
+		return config, fmt.Errorf("the -template-file flag and -output=template must be used together")
+	}
+	if config.TemplateFile != "" {
+		if _, err := parseTemplateFile(config.TemplateFile); err != nil {
+			return config, err
+		}
+	}
+	if slices.Contains(config.Outputs, "hosts") || slices.Contains(config.Outputs, "dnsmasq") {
+		if _, err := parseHostNameTemplate("hostname-template", config.HostNameTemplate); err != nil {
+			return config, err
+		}
+	}
+	if config.Rules != "" && !slices.Contains(ruleFormats, config.Rules) {
+		return config, fmt.Errorf("unsupported -rules firewall: %s (expected one of %s)", config.Rules, strings.Join(ruleFormats, ", "))
+	}
+	if config.AWSRules != "" {
+		if !slices.Contains(awsRuleFormats, config.AWSRules) {
+			return config, fmt.Errorf("unsupported -aws-rules format: %s (expected one of %s)", config.AWSRules, strings.Join(awsRuleFormats, ", "))
+		}
+		if !slices.Contains(awsRuleTypes, config.AWSRuleType) {
+			return config, fmt.Errorf("unsupported -aws-rule-type: %s (expected one of %s)", config.AWSRuleType, strings.Join(awsRuleTypes, ", "))
+		}
+		if _, err := parseAWSPorts(config.AWSPorts); err != nil {
+			return config, err
+		}
+	}
+	if config.BPF != "" && !slices.Contains(bpfFormats, config.BPF) {
+		return config, fmt.Errorf("unsupported -bpf format: %s (expected one of %s)", config.BPF, strings.Join(bpfFormats, ", "))
+	}
+	if !slices.Contains(bpfDirections, config.BPFDirection) {
+		return config, fmt.Errorf("unsupported -bpf-direction: %s (expected src or dst)", config.BPFDirection)
+	}
+	if !slices.Contains(bpfLinks, config.BPFLink) {
+		return config, fmt.Errorf("unsupported -bpf-link: %s (expected one of %s)", config.BPFLink, strings.Join(bpfLinks, ", "))
+	}
+	if config.Push != "" {
+		if _, err := parsePushTarget(config.Push); err != nil {
+			return config, err
+		}
+	}
+	if config.PushDryRun && config.Push == "" {
+		return config, fmt.Errorf("the -push-dry-run flag needs -push")
+	}
+	if config.ScanTargets != "" && !slices.Contains(scanTools, config.ScanTargets) {
+		return config, fmt.Errorf("unsupported -scan-targets scanner: %s (expected one of %s)", config.ScanTargets, strings.Join(scanTools, ", "))
+	}
+	if config.ScanShardSize > 0 && (config.ScanTargets == "" || config.OutFile == "" || config.OutFile == "-") {
+		return config, fmt.Errorf("the -scan-shard-size flag needs -scan-targets and an -outfile to name the files after")
+	}
+	if config.ReverseZones {
+		if _, err := parseHostNameTemplate("ptr-template", config.PTRTemplate); err != nil {
+			return config, err
+		}
+	}
+
+	if !slices.Contains(inputFormats, config.InputFormat) {
+		return config, fmt.Errorf("unsupported input format: %s (expected one of %s)", config.InputFormat, strings.Join(inputFormats, ", "))
+	}
+
+	if err := checkCSVOptions(config); err != nil {
+		return config, err
+	}
+
+	for _, kind := range splitList(config.K8sSelect) {
+		if !slices.Contains(k8sSelections, strings.ToLower(kind)) {
+			return config, fmt.Errorf("unsupported -k8s-select value: %s (expected %s)", kind, strings.Join(k8sSelections, ", "))
+		}
+	}
+
+	if config.GeoIP != "" && config.GeoIPCountries == "" && config.GeoIPASNs == "" && config.GeoIPCities == "" {
+		return config, fmt.Errorf("the -geoip flag needs -geoip-country, -geoip-asn or -geoip-city to select networks")
+	}
+
+	if config.MRT != "" {
+		if _, err := newMRTFilter(config); err != nil {
+			return config, err
+		}
+	}
+
+	if config.InputSQLite != "" {
+		if _, err := sqliteQuery(config); err != nil {
+			return config, err
+		}
+	}
+
+	if !slices.Contains(asnSources, config.ASNSource) {
+		return config, fmt.Errorf("unsupported AS number source: %s (expected one of %s)", config.ASNSource, strings.Join(asnSources, ", "))
 	}
 
 	if config.Concurrency <= 0 {
 		config.Concurrency = defaultConcurrency
 	}
 
-	if config.Algorithm != "binary-search" && config.Algorithm != "interval-tree" {
-		config.Algorithm = defaultAlgorithm
+	if config.FetchRetries < 0 {
+		config.FetchRetries = 0
+	}
+
+	if config.ResolveConcurrency <= 0 {
+		config.ResolveConcurrency = defaultResolveConcurrency
+	}
+
+	for _, path := range config.AlgorithmPlugins {
+		if err := loadAlgorithmPlugin(path); err != nil {
+			return config, err
+		}
+	}
+	if _, ok := algorithms[config.Algorithm]; !ok {
+		return config, fmt.Errorf("unsupported algorithm: %s (expected one of %s)", config.Algorithm, strings.Join(algorithmNames(), ", "))
+	}
+
+	if config.Sample > 0 && (config.Offset > 0 || config.Limit > 0) {
+		return config, fmt.Errorf("the -sample flag cannot be combined with -offset or -limit")
+	}
+
+	config.RemoteWorkers = splitList(*remoteWorkers)
+	if len(config.RemoteWorkers) > 0 {
+		if config.Parallel || config.Sample > 0 || config.Offset > 0 || config.Limit > 0 {
+			return config, fmt.Errorf("the -remote-workers flag cannot be combined with -parallel, -sample, -offset or -limit")
+		}
+		if config.PartitionSize == 0 {
+			return config, fmt.Errorf("the -partition-size must be at least 1")
+		}
+	}
+
+	if config.Rate < 0 {
+		return config, fmt.Errorf("the -rate must not be negative")
+	}
+	if _, err := parseBufferSize(config.BufferSize); err != nil {
+		return config, err
+	}
+
+	if config.Resume && config.Checkpoint == "" {
+		return config, fmt.Errorf("the -resume flag needs the -checkpoint file to resume from")
+	}
+	if config.Checkpoint != "" {
+		if config.Parallel || config.Sample > 0 || len(config.RemoteWorkers) > 0 || config.SplitSize != "" || config.SplitCount > 0 || config.Watch || name == "tui" {
+			return config, fmt.Errorf("the -checkpoint flag cannot be combined with -parallel, -sample, -remote-workers, -split-size, -split-count, -watch or the tui command")
+		}
+		if config.CheckpointInterval <= 0 {
+			return config, fmt.Errorf("the -checkpoint-interval must be positive")
+		}
+	}
+
+	// Use a random seed for -sample unless one was given
+	if !isFlagSet("seed") {
+		config.Seed = rand.Uint64()
+	}
+
+	// -hosts-only only overrides the -include-* flags that were not given explicitly
+	if config.HostsOnly {
+		if !isFlagSet("include-network") {
+			config.IncludeNetwork = false
+		}
+		if !isFlagSet("include-broadcast") {
+			config.IncludeBroadcast = false
+		}
 	}
 
 	return config, nil
 }
 
-// cidrToIPsParallel expands CIDR ranges into IPs using parallel processing.
-func cidrToIPsParallel(ctx context.Context, cidrRanges []CIDRRange, concurrency int, algorithm string) ([]string, error) {
-	ips := make([]string, 0)
-	ipChan := make(chan string, 1000)
+// inputFormat returns the format -input, stdin and -input-url lists are
+// read in.
+func (c Config) inputFormat() inputFormat {
+	delimiter, _ := csvDelimiter(c.CSVDelimiter)
+	return inputFormat{name: c.InputFormat, field: c.InputField, csvColumn: c.CSVColumn, csvDelimiter: delimiter, csvHeader: c.CSVHeader}
+}
+
+// hasSource reports whether any entries to expand were given, besides
+// those read from stdin.
+func (c Config) hasSource() bool {
+	return c.CIDRListStr != "" || len(c.InputFiles) > 0 || c.InputURL != "" ||
+		c.AWS || c.GCP || c.Azure || c.Cloudflare ||
+		c.RIR != "" || c.RIRFile != "" || c.K8s || c.GeoIP != "" || c.MRT != "" || c.InputBitmap != "" || c.InputSQLite != ""
+}
+
+// report reports whether a report or list of blocks is written in the
+// -output format instead of the expansion.
+func (c Config) report() bool {
+	return c.Collapse != "" || c.Decode != "" || c.Contains != "" || c.Gaps != "" || c.Allocate != "" ||
+		c.Invert || c.Overlaps || c.Merge || c.Count || c.ListSets
+}
+
+// expandsInParallel reports whether the whole expansion runs in -parallel,
+// rather than a sample or a page of it.
+func (c Config) expandsInParallel() bool {
+	return c.Parallel && c.Sample == 0 && c.Offset == 0 && c.Limit == 0
+}
+
+// listFlag is a flag that can be given several times, collecting each value.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// outputFlag is the -output flag, which can be given several times to write
+// the expansion in several formats at once. A value given while replace is
+// set replaces the ones before it, so that the command line overrides the
+// default and the settings file instead of adding to them.
+type outputFlag struct {
+	values  *[]string
+	replace bool
+}
+
+func (o *outputFlag) String() string {
+	if o.values == nil {
+		return ""
+	}
+	return strings.Join(*o.values, ",")
+}
+
+func (o *outputFlag) Set(value string) error {
+	if o.replace {
+		*o.values = nil
+		o.replace = false
+	}
+	*o.values = append(*o.values, value)
+	return nil
+}
+
+// checkOutputs reports whether several -output values can be written
+// together: only when expanding IPs, each once, to generated file names and
+// with at most one of them on stdout.
+func checkOutputs(config Config) error {
+	if config.report() {
+		return fmt.Errorf("several -output formats can only be written when expanding IPs")
+	}
+	if config.OutFile != "" {
+		return fmt.Errorf("the -outfile flag cannot be used with several -output formats, which are written to generated names in -output-dir")
+	}
+	for i, output := range config.Outputs {
+		if slices.Contains(config.Outputs[:i], output) {
+			return fmt.Errorf("the -output %s is given more than once", output)
+		}
+	}
+	if slices.Contains(config.Outputs, "terminal") && slices.Contains(config.Outputs, "template") {
+		return fmt.Errorf("terminal and template output both write to stdout, and cannot be used together")
+	}
+	return nil
+}
+
+// isFlagSet reports whether the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// cidrToIPsParallel expands CIDR ranges into IPs using parallel processing,
+// passing each IP to emit as soon as a worker produces it, through a channel
+// holding up to capacity IPs. It stops at the first error emit returns.
+// progress, when not nil, holds a counter for each worker.
+func cidrToIPsParallel(ctx context.Context, cidrRanges []CIDRRange, concurrency int, algorithm string, capacity int, progress []workerProgress, emit func(string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ipChan := make(chan string, capacity)
 	errChan := make(chan error, 1)
 	var wg sync.WaitGroup
 
 	// Determine the processing function based on the algorithm.
-	processFunc, err := getProcessFunc(algorithm, cidrRanges)
+	processFunc, err := getProcessFunc(ctx, algorithm, cidrRanges)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Start worker goroutines.
+	// Start worker goroutines, sharing the chunks of the blocks.
+	chunks := make(chan parallelChunk, concurrency)
+	go sendParallelChunks(ctx, cidrRanges, chunks)
 	for i := 0; i < concurrency; i++ {
+		var p *workerProgress
+		if progress != nil {
+			p = &progress[i]
+		}
 		wg.Add(1)
-		go worker(ctx, &wg, cidrRanges, processFunc, ipChan, errChan)
+		go worker(ctx, i, &wg, chunks, processFunc, p, ipChan, errChan)
 	}
 
 	// Close channels once all workers are done.
@@ -143,141 +1193,415 @@ func cidrToIPsParallel(ctx context.Context, cidrRanges []CIDRRange, concurrency
 		close(errChan)
 	}()
 
-	// Collect IPs from the channel.
+	// Output IPs as they arrive from the channel.
 	for ip := range ipChan {
-		ips = append(ips, ip)
+		if err := emit(ip); err != nil {
+			// Let the workers finish their current range and exit.
+			go func() {
+				for range ipChan {
+				}
+			}()
+			return err
+		}
 	}
 
 	// Check for errors.
 	if err, ok := <-errChan; ok {
-		return nil, err
+		return err
 	}
 
-	return ips, nil
+	return nil
 }
 
-// getProcessFunc returns the appropriate processing function based on the algorithm.
-func getProcessFunc(algorithm string, cidrRanges []CIDRRange) (func(CIDRRange, chan<- string) error, error) {
-	switch algorithm {
-	case "interval-tree":
-		tree := buildIntervalTree(cidrRanges)
-		return processIntervalTree(tree), nil
-	case "binary-search":
-		sort.Slice(cidrRanges, func(i, j int) bool { return cidrRanges[i].start < cidrRanges[j].start })
-		return processBinarySearch(cidrRanges), nil
-	default:
-		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+// getProcessFunc prepares the registered algorithm for the CIDR ranges, and
+// returns the function expanding each of them into ipChan, which stops with
+// errInterrupted once ctx is done and counts the IPs into progress.
+func getProcessFunc(ctx context.Context, algorithm string, cidrRanges []CIDRRange) (func(CIDRRange, chan<- string, *workerProgress) error, error) {
+	expand, err := prepareAlgorithm(algorithm, cidrRanges)
+	if err != nil {
+		return nil, err
 	}
+	return func(cidr CIDRRange, ipChan chan<- string, progress *workerProgress) error {
+		n := 0
+		defer func() { progress.add(n % interruptCheckInterval) }()
+		return expand(ipRange{Start: cidr.start, End: cidr.end}, func(ip uint32) error {
+			if n++; n%interruptCheckInterval == 0 {
+				progress.add(interruptCheckInterval)
+				if ctx.Err() != nil {
+					return errInterrupted
+				}
+			}
+			ipChan <- formatIPv4(ip)
+			return nil
+		})
+	}, nil
 }
 
-// processIntervalTree returns a function that processes CIDR ranges using an interval tree.
-func processIntervalTree(tree *intervalTree) func(CIDRRange, chan<- string) error {
-	return func(cidr CIDRRange, ipChan chan<- string) error {
-		for ip := cidr.start; ip <= cidr.end; ip++ {
-			if c := tree.Search(ip); c != nil {
-				ipChan <- uint2ip(ip).String()
-			}
+// interruptCheckInterval is the number of IPs expanded between checks of
+// whether the run was interrupted.
+const interruptCheckInterval = 4096
+
+// errInterrupted is the error of an expansion stopped by SIGINT or SIGTERM.
+var errInterrupted = errors.New("interrupted")
+
+// interruptible returns emit, stopping the expansion with errInterrupted
+// once ctx is done, which it checks every interruptCheckInterval IPs.
+func interruptible(ctx context.Context, emit func(string) error) func(string) error {
+	n := 0
+	return func(ip string) error {
+		if n++; n%interruptCheckInterval == 0 && ctx.Err() != nil {
+			return errInterrupted
 		}
-		return nil
+		return emit(ip)
+	}
+}
+
+// workerProgress counts the IPs a worker has expanded, and records the block
+// it is expanding, for the terminal UI to show while the expansion runs. The
+// methods of a nil workerProgress do nothing.
+type workerProgress struct {
+	ips   atomic.Uint64
+	block atomic.Pointer[CIDRRange]
+}
+
+// add counts n more IPs.
+func (p *workerProgress) add(n int) {
+	if p != nil {
+		p.ips.Add(uint64(n))
 	}
 }
 
-// processBinarySearch returns a function that processes CIDR ranges using binary search.
-func processBinarySearch(cidrRanges []CIDRRange) func(CIDRRange, chan<- string) error {
-	return func(cidr CIDRRange, ipChan chan<- string) error {
-		for ip := cidr.start; ip <= cidr.end; ip++ {
-			idx := sort.Search(len(cidrRanges), func(j int) bool {
-				return cidrRanges[j].end >= ip
-			})
-			if idx < len(cidrRanges) && cidrRanges[idx].start <= ip {
-				ipChan <- uint2ip(ip).String()
+// begin records the block the worker moves on to.
+func (p *workerProgress) begin(cidr *CIDRRange) {
+	if p != nil {
+		p.block.Store(cidr)
+	}
+}
+
+// parallelChunkSize is the most IPs of a block a -parallel worker expands
+// at a time, so that a large block is shared between the workers rather
+// than expanded by one of them while the others sit idle.
+const parallelChunkSize = 1 << 16
+
+// parallelChunk is a part of a block for a -parallel worker to expand.
+type parallelChunk struct {
+	block *CIDRRange // the block the chunk is part of
+	cidr  CIDRRange  // the block, narrowed to the IPs of the chunk
+}
+
+// sendParallelChunks sends each block to chunks once, split into chunks of
+// at most parallelChunkSize IPs, and closes it at the end, or once ctx is
+// done.
+func sendParallelChunks(ctx context.Context, cidrRanges []CIDRRange, chunks chan<- parallelChunk) {
+	defer close(chunks)
+	for i := range cidrRanges {
+		block := &cidrRanges[i]
+		// Iterate in 64 bits so blocks ending at 255.255.255.255 terminate.
+		for start := uint64(block.start); start <= uint64(block.end); start += parallelChunkSize {
+			chunk := parallelChunk{block: block, cidr: *block}
+			chunk.cidr.start = uint32(start)
+			chunk.cidr.end = uint32(min(start+parallelChunkSize-1, uint64(block.end)))
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return
 			}
 		}
-		return nil
 	}
 }
 
-// worker processes CIDR ranges and sends IPs to the ipChan.
-func worker(ctx context.Context, wg *sync.WaitGroup, cidrRanges []CIDRRange, processFunc func(CIDRRange, chan<- string) error, ipChan chan<- string, errChan chan<- error) {
+// worker expands the chunks it takes from chunks, until there are none
+// left, and sends the IPs to the ipChan.
+func worker(ctx context.Context, id int, wg *sync.WaitGroup, chunks <-chan parallelChunk, processFunc func(CIDRRange, chan<- string, *workerProgress) error, progress *workerProgress, ipChan chan<- string, errChan chan<- error) {
 	defer wg.Done()
-	for _, cidr := range cidrRanges {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			err := processFunc(cidr, ipChan)
-			if err != nil {
-				select {
-				case errChan <- err:
-				default:
-				}
-				return
+	defer progress.begin(nil)
+	_, span := startSpan(ctx, spanInternal, "worker", slog.Int("worker", id))
+	var expanded int
+	var addresses uint64
+	var err error
+	defer func() {
+		span.set(slog.Int("chunks", expanded), slog.Uint64("addresses", addresses))
+		span.finish(err)
+	}()
+	for chunk := range chunks {
+		progress.begin(chunk.block)
+		if err = processFunc(chunk.cidr, ipChan, progress); err != nil {
+			select {
+			case errChan <- err:
+			default:
 			}
+			return
 		}
+		expanded++
+		addresses += uint64(chunk.cidr.end-chunk.cidr.start) + 1
+	}
+}
+
+// prepareAlgorithm prepares the registered algorithm named algorithm for
+// the CIDR ranges.
+func prepareAlgorithm(algorithm string, cidrRanges []CIDRRange) (cidrsensei.ExpandFunc, error) {
+	a, ok := algorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	expand, err := a.Prepare(toIPRanges(cidrRanges))
+	if err != nil {
+		return nil, fmt.Errorf("error preparing the %s algorithm: %w", algorithm, err)
 	}
+	return expand, nil
 }
 
-func cidrToIPsBinarySearch(cidrRanges []CIDRRange) ([]string, error) {
-	// Your existing sequential binary search implementation
-	// Ensure it's optimized and remains after refactoring
-	var ips []string
+// expandSequential expands CIDR ranges into IPs sequentially with the
+// registered algorithm, passing each IP, formatted by format, to emit in
+// ascending order of the blocks.
+func expandSequential(algorithm string, cidrRanges []CIDRRange, format *ipFormatter, emit func(string) error) error {
+	expand, err := prepareAlgorithm(algorithm, cidrRanges)
+	if err != nil {
+		return err
+	}
 
 	// Sort the CIDR ranges by their start IP
 	sortedCIDRRanges := make([]CIDRRange, len(cidrRanges))
 	copy(sortedCIDRRanges, cidrRanges)
-	sort.Slice(sortedCIDRRanges, func(i, j int) bool {
+	sort.SliceStable(sortedCIDRRanges, func(i, j int) bool {
 		return sortedCIDRRanges[i].start < sortedCIDRRanges[j].start
 	})
 
-	// Expand the CIDR ranges into a list of IPs using binary search
 	for _, cidrRange := range sortedCIDRRanges {
-		for i := cidrRange.start; i <= cidrRange.end; i++ {
-			ip := uint2ip(i)
-			idx := sort.Search(len(sortedCIDRRanges), func(j int) bool {
-				return sortedCIDRRanges[j].end >= i
-			})
-			if idx < len(sortedCIDRRanges) && sortedCIDRRanges[idx].start <= i {
-				ips = append(ips, ip.String())
-			}
+		err := expand(ipRange{Start: cidrRange.start, End: cidrRange.end}, func(ip uint32) error {
+			return emit(format.format(ip))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitIPs passes each of the IPs to emit.
+func emitIPs(ips []string, emit func(string) error) error {
+	for _, ip := range ips {
+		if err := emit(ip); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// cidrParser parses input entries into CIDR ranges.
+type cidrParser struct {
+	resolver   *hostResolver
+	asns       *asnResolver
+	aliases    map[string]aliasEntries
+	interfaces interfaceTable
+
+	// skipInvalid skips the entries that cannot be parsed, counting them
+	// in skipped, instead of failing.
+	skipInvalid bool
+	skipped     int
+}
+
+// newCIDRParser returns a cidrParser configured from the command-line flags.
+func newCIDRParser(ctx context.Context, config Config, fetcher *fetcher) *cidrParser {
+	return &cidrParser{
+		resolver: newHostResolver(ctx, config.DNSServers, config.ResolveTimeout, config.ResolveConcurrency),
+		asns:     newASNResolver(ctx, config, fetcher),
+		aliases:  config.Aliases,
+
+		skipInvalid: config.SkipInvalid,
+	}
+}
+
+// inputEntry is a single input entry along with where it came from.
+type inputEntry struct {
+	text     string
+	origin   string
+	source   string
+	piece    bool              // one of the blocks a record's range of addresses is split into
+	metadata map[string]string // other fields of the record, e.g. CSV columns
+}
+
+// splitEntries splits the comma-separated list given to a flag into entries.
+func splitEntries(list, flagName string) []inputEntry {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
 
-	return ips, nil
+	var entries []inputEntry
+	for i, text := range strings.Split(list, ",") {
+		entries = append(entries, inputEntry{
+			text:   strings.TrimSpace(text),
+			origin: fmt.Sprintf("%s entry %d", flagName, i+1),
+			source: flagName,
+		})
+	}
+	return entries
 }
 
-// buildIntervalTree constructs an interval tree from CIDR ranges.
-func buildIntervalTree(cidrRanges []CIDRRange) *intervalTree {
-	tree := &intervalTree{}
-	for _, cidr := range cidrRanges {
-		err := tree.Insert(cidr.start, cidr.end, &cidr)
+// parseCIDRList parses every entry as it is received, so parsing overlaps
+// with reading a slow input such as a pipe. Entries naming a local network
+// interface are its subnets. Hostname and AS number entries are resolved
+// concurrently, and the resulting ranges are returned in input order.
+func (p *cidrParser) parseCIDRList(entries iter.Seq2[inputEntry, error]) ([]CIDRRange, error) {
+	type result struct {
+		entry  inputEntry
+		ranges []CIDRRange
+		err    error
+	}
+
+	var results []*result
+	var wg sync.WaitGroup
+	var readErr error
+	for entry, err := range expandAliases(p.aliases, entries) {
 		if err != nil {
-			fmt.Printf("Failed to insert CIDR range into interval tree: %v\n", err)
+			readErr = err
+			break
 		}
+
+		r := &result{entry: entry}
+		results = append(results, r)
+		if asn, ok := parseASNEntry(entry.text); ok {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.ranges, r.err = p.asns.resolve(asn)
+			}()
+			continue
+		}
+		if subnets, ok, err := p.interfaces.lookup(entry.text); ok {
+			r.ranges, r.err = subnets, err
+			continue
+		}
+		if host, prefix, ok := parseHostnameEntry(entry.text); ok {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.ranges, r.err = p.resolver.resolve(host, prefix)
+			}()
+			continue
+		}
+		r.ranges, r.err = parseEntry(entry.text)
+	}
+	wg.Wait()
+	if readErr != nil {
+		return nil, readErr
 	}
-	return tree
-}
 
-func parseCIDRList(cidrList []string) ([]CIDRRange, error) {
 	var cidrRanges []CIDRRange
-	for _, cidrStr := range cidrList {
-		ip, ipNet, err := net.ParseCIDR(cidrStr)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing CIDR %s: %w", cidrStr, err)
-		}
-		start := ipToUint(ip)
-		mask := ipNet.Mask
-		// Calculate the end IP based on the mask
-		end := start | ^ipToUint(net.IP(mask))
-		cidrRanges = append(cidrRanges, CIDRRange{
-			ipNet:  ipNet,
-			start:  start,
-			end:    end,
-			length: end - start + 1,
-		})
+	for _, r := range results {
+		if r.err != nil {
+			err := &entryError{entry: r.entry.text, origin: r.entry.origin, err: r.err}
+			if !p.skipInvalid {
+				return nil, err
+			}
+			slog.Warn("skipped an invalid entry", "error", err)
+			p.skipped++
+			continue
+		}
+		for _, cidr := range r.ranges {
+			cidr.entry = r.entry.text
+			cidr.origin = r.entry.origin
+			cidr.source = r.entry.source
+			cidr.piece = r.entry.piece
+			cidr.metadata = r.entry.metadata
+			cidrRanges = append(cidrRanges, cidr)
+		}
+	}
+	return cidrRanges, nil
+}
+
+// loadCIDRRanges parses the entries, rejects sloppy input in strict mode
+// and normalizes the resulting ranges to their canonical form.
+func loadCIDRRanges(config Config, parser *cidrParser, entries iter.Seq2[inputEntry, error]) ([]CIDRRange, error) {
+	cidrRanges, err := parser.parseCIDRList(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Strict {
+		if err := checkStrict(cidrRanges, config.StrictMinPrefix); err != nil {
+			return nil, &parseError{err}
+		}
+	}
+
+	cidrRanges, normalizations := normalizeCIDRRanges(cidrRanges)
+	if config.ShowNormalized {
+		reportNormalizations(os.Stderr, normalizations)
 	}
 	return cidrRanges, nil
 }
 
+// parseEntry parses a single input entry into one or more CIDR ranges. An
+// entry is either a CIDR block, a bare IP, an ACL-style "address wildcard"
+// pair, an address range such as 10.0.0.1-10.0.0.9, an nmap-style octet
+// range such as 192.168.0-5.* or the name of a built-in address set such as
+// @rfc1918.
+func parseEntry(entry string) ([]CIDRRange, error) {
+	if _, ok := includeTarget(entry); ok {
+		return nil, fmt.Errorf("%s directives are only supported in list files", includeDirective)
+	}
+	if name, ok := strings.CutPrefix(entry, "@"); ok {
+		return parseBuiltinSet(name)
+	}
+
+	if isAddressRange(entry) {
+		return parseAddressRange(entry)
+	}
+
+	if isOctetRangeEntry(entry) {
+		return parseOctetRange(entry)
+	}
+
+	if fields := strings.Fields(entry); len(fields) == 2 {
+		return parseWildcard(fields[0], fields[1])
+	}
+
+	if ip := net.ParseIP(entry).To4(); ip != nil {
+		return []CIDRRange{newCIDRRange(ipToUint(ip), 32)}, nil
+	}
+
+	cidrRange, err := parseCIDR(entry)
+	if err != nil {
+		return nil, err
+	}
+	return []CIDRRange{cidrRange}, nil
+}
+
+// parseCIDR parses a CIDR block such as 10.0.0.0/8. The range starts at the
+// address as written, so host bits are kept until the range is normalized.
+func parseCIDR(cidrStr string) (CIDRRange, error) {
+	ip, ipNet, err := net.ParseCIDR(cidrStr)
+	if err != nil {
+		return CIDRRange{}, fmt.Errorf("error parsing CIDR %s: %w", cidrStr, err)
+	}
+	if ip.To4() == nil {
+		return CIDRRange{}, fmt.Errorf("error parsing CIDR %s: IPv6 is not supported", cidrStr)
+	}
+	start := ipToUint(ip)
+	mask := ipNet.Mask
+	// Calculate the end IP based on the mask
+	end := start | ^ipToUint(net.IP(mask))
+	return CIDRRange{
+		ipNet:  ipNet,
+		start:  start,
+		end:    end,
+		length: end - start + 1,
+	}, nil
+}
+
+// newCIDRRange returns the CIDR range of the block starting at network with
+// the given prefix length.
+func newCIDRRange(network uint32, prefix int) CIDRRange {
+	mask := net.CIDRMask(prefix, 32)
+	end := network | ^ipToUint(net.IP(mask))
+	return CIDRRange{
+		ipNet:  &net.IPNet{IP: uint2ip(network), Mask: mask},
+		start:  network,
+		end:    end,
+		length: end - network + 1,
+	}
+}
+
 func ipToUint(ip net.IP) uint32 {
 	ipv4 := ip.To4()
 	if ipv4 == nil {
@@ -293,142 +1617,254 @@ func uint2ip(ip uint32) net.IP {
 	return result
 }
 
-// intervalNode represents a node in the interval tree.
-type intervalNode struct {
-	start, end  uint32
-	left, right *intervalNode
-	cidr        *CIDRRange
-}
-
-// intervalTree represents the interval tree structure.
-type intervalTree struct {
-	root *intervalNode
+// ipWriter writes expanded IPs through the OutputSink of the requested output
+// format as they are produced, so that an expansion never has to be held in
+// memory. Output goes to the -outfile file or stdout, or by default to a file
+// named after the -cidr list for formats with a file extension and to stdout
+// for the others. With -split-size or -split-count, it goes to a series of
+// numbered files.
+type ipWriter struct {
+	format     string
+	sink       cidrsensei.OutputSink
+	writesFile bool     // the sink creates the output file itself
+	file       *os.File // nil when writing to stdout
+	path       string   // the file written to, empty for stdout
+	out        *countingWriter
+	w          *bufio.Writer // nil when the sink writes the file itself
+	bufSize    int           // the size of w
+	borrows    bool          // the sink is done with each record once written
+	split      *outputSplit
+	count      int
+	span       *span // the writing of the output, ended by close
 }
 
-// Insert adds a new interval to the tree.
-func (t *intervalTree) Insert(start, end uint32, cidr *CIDRRange) error {
-	node := &intervalNode{start: start, end: end, cidr: cidr}
-	if t.root == nil {
-		t.root = node
-		return nil
+// newIPWriter creates the output file for the -output format. Generated file
+// names are in -output-dir, while an explicit -outfile is used as given.
+// Parquet and SQLite rows name the block of cidrRanges each IP was expanded
+// from. The file of resumed, when not nil, is continued instead.
+func newIPWriter(config Config, cidrRanges []CIDRRange, resumed *checkpointOutput) (*ipWriter, error) {
+	format := config.OutputFormat
+	if isSinkURL(format) {
+		if config.Checkpoint != "" {
+			return nil, fmt.Errorf("the %s output cannot be resumed from a -checkpoint", format)
+		}
+		sink, err := newNetworkSink(config, cidrRanges)
+		if err != nil {
+			return nil, err
+		}
+		w := &ipWriter{format: "sink", sink: sink, writesFile: true, bufSize: config.buffers().writerSize(config)}
+		if err := w.open(""); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+	output, ok := outputSinks[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported output format: %s", format)
+	}
+	sink, err := output.newSink(config, cidrRanges)
+	if err != nil {
+		return nil, err
+	}
+	w := &ipWriter{format: format, sink: sink, writesFile: output.writesFile, bufSize: config.buffers().writerSize(config), borrows: output.borrowsRecords}
+	if resumed != nil {
+		if err := w.resume(*resumed); err != nil {
+			return nil, err
+		}
+		return w, nil
 	}
-	return t.root.insert(node)
-}
 
-// insert recursively inserts a node into the interval tree.
-func (n *intervalNode) insert(newNode *intervalNode) error {
-	if newNode.end < n.start {
-		if n.left == nil {
-			n.left = newNode
-			return nil
+	path := config.OutFile
+	if path == "" && output.extension != "" {
+		if config.OutputDir != "" {
+			if err := os.MkdirAll(config.OutputDir, 0o755); err != nil {
+				return nil, err
+			}
 		}
-		return n.left.insert(newNode)
-	} else if newNode.start > n.end {
-		if n.right == nil {
-			n.right = newNode
-			return nil
+		filename, err := outputFilename(config, cidrRanges, output.extension)
+		if err != nil {
+			return nil, err
 		}
-		return n.right.insert(newNode)
+		path = filepath.Join(config.OutputDir, filename)
 	}
-	return fmt.Errorf("overlapping intervals are not supported: [%d, %d] overlaps with [%d, %d]", newNode.start, newNode.end, n.start, n.end)
-}
-
-// Search finds the CIDRRange containing the given IP.
-func (t *intervalTree) Search(ip uint32) *CIDRRange {
-	return t.root.search(ip)
-}
-
-// search recursively searches for the IP in the interval tree.
-func (n *intervalNode) search(ip uint32) *CIDRRange {
-	if n == nil {
-		return nil
+	if config.SplitSize != "" || config.SplitCount > 0 {
+		split, err := newOutputSplit(config, path, cidrRanges)
+		if err != nil {
+			return nil, err
+		}
+		w.split = split
+		path = split.next()
 	}
-	if ip < n.start {
-		return n.left.search(ip)
-	} else if ip > n.end {
-		return n.right.search(ip)
+	if config.Checkpoint != "" {
+		if err := checkpointable(format, output, sink, path); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.open(path); err != nil {
+		return nil, err
 	}
-	return n.cidr
+	return w, nil
 }
 
-func outputJSON(ips []string, filename string) error {
-	type IP struct {
-		Address string `json:"address"`
+// open opens the sink on the file at path, or on stdout for an empty path
+// or -.
+func (w *ipWriter) open(path string) error {
+	if path == "-" {
+		path = ""
 	}
-
-	var data []IP
-	for _, ip := range ips {
-		data = append(data, IP{ip})
+	if w.writesFile {
+		w.path = path
+		return w.sink.Open(nil, path)
 	}
-
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
+	if path == "" {
+		w.w = bufio.NewWriterSize(os.Stdout, w.bufSize)
+	} else {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		w.file, w.path = file, path
+		w.out = &countingWriter{w: file}
+		w.w = bufio.NewWriterSize(w.out, w.bufSize)
+	}
+	if err := w.sink.Open(w.w, path); err != nil {
+		w.closeFile()
 		return err
 	}
+	return nil
+}
 
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
+// write writes a single IP, moving on to the next file of a split output
+// first when the current one is full.
+func (w *ipWriter) write(ip string) error {
+	if w.split != nil && w.split.full(w) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
 	}
+	w.count++
+	return w.sink.WriteRecord(ip)
+}
 
-	defer func() {
-		cerr := file.Close()
-		if err == nil {
-			err = cerr
+// close finishes the output and closes the output file, writing the
+// manifest of a split output.
+func (w *ipWriter) close() error {
+	err := w.finish()
+	if w.split != nil {
+		w.split.done(w.count)
+		if manifestErr := w.split.writeManifest(); err == nil {
+			err = manifestErr
 		}
-	}()
+	}
+	w.span.set(slog.Int("addresses", w.count))
+	w.span.finish(err)
+	return err
+}
 
-	writer := bufio.NewWriter(file)
-	_, err = writer.Write(jsonData)
-	if err != nil {
-		return err
+// finish closes the sink and the current file.
+func (w *ipWriter) finish() error {
+	err := w.sink.Close()
+	if closeErr := w.closeFile(); err == nil {
+		err = closeErr
 	}
+	return err
+}
 
-	return writer.Flush()
+// flush writes out what the sink and the output buffer, for sinks writing
+// to the output.
+func (w *ipWriter) flush() error {
+	if flusher, ok := w.sink.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return err
+		}
+	}
+	if w.w == nil {
+		return nil
+	}
+	return w.w.Flush()
 }
 
-func outputCSV(ips []string, filename string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
+// closeFile flushes the output and closes the current file.
+func (w *ipWriter) closeFile() error {
+	if w.w == nil {
+		return nil
 	}
-	defer func() {
-		cerr := file.Close()
-		if err == nil {
-			err = cerr
+	err := w.w.Flush()
+	if w.file != nil {
+		if closeErr := w.file.Close(); err == nil {
+			err = closeErr
 		}
-	}()
+	}
+	return err
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// ipWriters writes each IP to the writer of every -output, so that several
+// formats are written in a single pass over the expansion.
+type ipWriters []*ipWriter
 
-	for _, ip := range ips {
-		if err := writer.Write([]string{ip}); err != nil {
-			return err
+// newIPWriters creates the writer of each -output, each traced by a span of
+// ctx until it is closed. The outputs of a checkpoint are continued when
+// resumed lists them.
+func newIPWriters(ctx context.Context, config Config, cidrRanges []CIDRRange, resumed []checkpointOutput) (ipWriters, error) {
+	var writers ipWriters
+	for i, output := range config.Outputs {
+		config.OutputFormat = output
+		_, span := startSpan(ctx, spanInternal, "output", slog.String("format", output))
+		var resumedOutput *checkpointOutput
+		if i < len(resumed) {
+			resumedOutput = &resumed[i]
+		}
+		w, err := newIPWriter(config, cidrRanges, resumedOutput)
+		if err != nil {
+			span.finish(err)
+			writers.close()
+			return nil, err
 		}
+		span.set(slog.String("path", w.path))
+		w.span = span
+		writers = append(writers, w)
 	}
+	return writers, nil
+}
 
+// write writes a single IP to every output.
+func (ws ipWriters) write(ip string) error {
+	for _, w := range ws {
+		if err := w.write(ip); err != nil {
+			return &outputError{err}
+		}
+	}
 	return nil
 }
 
-func outputTerminal(ips []string) {
-	for _, ip := range ips {
-		fmt.Println(ip)
+// flush writes out what every output buffers.
+func (ws ipWriters) flush() error {
+	for _, w := range ws {
+		if err := w.flush(); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func handleOutput(format string, ips []string, cidrListStr string) error {
-	switch format {
-	case "json":
-		filename := fmt.Sprintf("ips_%s_%s.json", strings.ReplaceAll(cidrListStr, "/", "-"), time.Now().Format("2006-01-02T15-04-05"))
-		return outputJSON(ips, filename)
-	case "csv":
-		filename := fmt.Sprintf("ips_%s_%s.csv", strings.ReplaceAll(cidrListStr, "/", "-"), time.Now().Format("2006-01-02T15-04-05"))
-		return outputCSV(ips, filename)
-	case "terminal":
-		outputTerminal(ips)
-		return nil
-	default:
-		return fmt.Errorf("unsupported output format: %s", format)
+// borrowsRecords reports whether every output is done with each IP once it
+// is written, so that the IPs can be formatted into a reused buffer.
+func (ws ipWriters) borrowsRecords() bool {
+	for _, w := range ws {
+		if !w.borrows {
+			return false
+		}
+	}
+	return true
+}
+
+// close finishes every output, returning the first error.
+func (ws ipWriters) close() error {
+	var err error
+	for _, w := range ws {
+		if closeErr := w.close(); err == nil && closeErr != nil {
+			err = &outputError{closeErr}
+		}
 	}
+	return err
 }
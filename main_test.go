@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+// testBlocks returns the blocks of the CIDRs, as the -cidr list gives them.
+func testBlocks(t *testing.T, cidrs ...string) []CIDRRange {
+	t.Helper()
+	blocks := make([]CIDRRange, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+		blocks = append(blocks, newCIDRRange(ipToUint(network.IP), ones))
+	}
+	return blocks
+}
+
+// expand returns the IPs the expansion of blocks with config emits, in the
+// order emitted.
+func expand(t *testing.T, config Config, blocks []CIDRRange) []uint32 {
+	t.Helper()
+	var ips []uint32
+	err := expandIPs(context.Background(), config, blocks, nil, func(ip string) error {
+		n, err := parseIPv4(ip)
+		ips = append(ips, n)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("the expansion with -algorithm=%s failed: %v", config.Algorithm, err)
+	}
+	return ips
+}
+
+// eachIP returns the IPs of each of the blocks, those of overlapping blocks
+// once for each block, in ascending order.
+func eachIP(blocks []CIDRRange) []uint32 {
+	var ips []uint32
+	for _, block := range blocks {
+		for ip := uint64(block.start); ip <= uint64(block.end); ip++ {
+			ips = append(ips, uint32(ip))
+		}
+	}
+	slices.Sort(ips)
+	return ips
+}
+
+// sorted returns the ips in ascending order.
+func sorted(ips []uint32) []uint32 {
+	return slices.Sorted(slices.Values(ips))
+}
+
+func TestExpansionAlgorithms(t *testing.T) {
+	tests := []struct {
+		name  string
+		cidrs []string
+	}{
+		{"disjoint", []string{"10.0.0.0/24", "192.168.0.0/30", "172.16.0.0/28"}},
+		{"nested", []string{"10.0.0.0/14", "10.2.0.0/16"}},
+		{"nested at the same start", []string{"10.0.0.0/16", "10.0.0.0/24", "10.0.0.0/28"}},
+		{"nested deeply", []string{"10.0.0.0/14", "10.1.0.0/16", "10.1.2.0/24", "10.1.2.128/25", "10.3.0.0/18"}},
+		{"duplicated", []string{"10.0.0.0/22", "10.0.0.0/22"}},
+		{"adjacent", []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/23"}},
+		{"overlapping and unsorted", []string{"10.0.1.0/24", "10.0.0.0/22", "10.0.3.128/25", "9.255.255.0/24"}},
+		{"up to the last address", []string{"255.255.0.0/16", "255.255.255.0/24", "255.255.255.255/32"}},
+	}
+	for _, tt := range tests {
+		blocks := testBlocks(t, tt.cidrs...)
+		want := eachIP(blocks)
+		for _, algorithm := range algorithmNames() {
+			// Each block is expanded in full, however the blocks overlap
+			sequential := expand(t, Config{Algorithm: algorithm}, blocks)
+			if got := sorted(sequential); !slices.Equal(got, want) {
+				t.Errorf("%s: the sequential expansion with -algorithm=%s wrote %d IPs, want %d", tt.name, algorithm, len(got), len(want))
+			}
+			for _, concurrency := range []int{1, 3, 8} {
+				config := Config{Algorithm: algorithm, Parallel: true, Concurrency: concurrency}
+				if got := sorted(expand(t, config, blocks)); !slices.Equal(got, sorted(sequential)) {
+					t.Errorf("%s: the expansion with -algorithm=%s -parallel -concurrency=%d wrote %d IPs, not those of the sequential expansion, %d", tt.name, algorithm, concurrency, len(got), len(sequential))
+				}
+			}
+		}
+	}
+}
+
+// firstAddressAlgorithm expands each range into its first address only, so
+// that the expansions using it can be told apart from the others.
+type firstAddressAlgorithm struct{}
+
+func (firstAddressAlgorithm) Prepare([]ipRange) (cidrsensei.ExpandFunc, error) {
+	return func(r ipRange, emit func(uint32) error) error {
+		return emit(r.Start)
+	}, nil
+}
+
+func TestRegisteredAlgorithm(t *testing.T) {
+	if err := registerAlgorithm("first-address", firstAddressAlgorithm{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(algorithms, "first-address") })
+	blocks := testBlocks(t, "10.0.1.0/24", "10.0.0.0/24")
+	want := []uint32{0x0a000000, 0x0a000100}
+	for _, config := range []Config{
+		{Algorithm: "first-address"},
+		{Algorithm: "first-address", Parallel: true, Concurrency: 2},
+	} {
+		if got := sorted(expand(t, config, blocks)); !slices.Equal(got, want) {
+			t.Errorf("the expansion with -parallel=%v wrote %x, want %x", config.Parallel, got, want)
+		}
+	}
+
+	err := expandIPs(t.Context(), Config{Algorithm: "unknown"}, blocks, nil, func(string) error { return nil })
+	if err == nil || err.Error() != "unsupported algorithm: unknown" {
+		t.Errorf("the expansion with an unknown algorithm failed with %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// version is the version of CIDR-Sensei, set at build time with
+// -ldflags "-X main.version=1.2.3".
+var version string
+
+// toolVersion returns the version recorded in manifests: the one set at
+// build time, or else the module version go install recorded.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// manifest describes the files an expansion wrote, so that a pipeline can
+// check they are complete and unchanged, and how they were made.
+type manifest struct {
+	Tool       string            `json:"tool"`
+	Version    string            `json:"version"`
+	Created    time.Time         `json:"created"`
+	Parameters map[string]string `json:"parameters"`
+	Records    int               `json:"records"`
+	Files      []manifestFile    `json:"files"`
+}
+
+// manifestFile is an output file listed in a manifest.
+type manifestFile struct {
+	Name    string `json:"name"`
+	Format  string `json:"format"`
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+	SHA256  string `json:"sha256"`
+}
+
+// writeManifest writes the -manifest file listing every file the outputs
+// wrote, with the number of IPs in each, its size and SHA-256 checksum,
+// along with the flags given on the command line and the number of IPs the
+// expansion produced. File names are relative to the manifest's directory.
+// Output written to stdout or a network sink has no file to list.
+func writeManifest(config Config, outputs ipWriters) error {
+	m := manifest{
+		Tool:       "cidr-sensei",
+		Version:    toolVersion(),
+		Created:    time.Now().UTC(),
+		Parameters: flagParameters(),
+		Records:    outputs.records(),
+		Files:      []manifestFile{},
+	}
+
+	dir := filepath.Dir(config.Manifest)
+	for _, w := range outputs {
+		for _, file := range w.files() {
+			size, sum, err := sha256File(file.Name)
+			if err != nil {
+				return err
+			}
+			file.Bytes, file.SHA256 = size, sum
+			if rel, err := filepath.Rel(dir, file.Name); err == nil {
+				file.Name = filepath.ToSlash(rel)
+			}
+			m.Files = append(m.Files, file)
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(config.Manifest, append(data, '\n'), 0o644)
+}
+
+// flagParameters returns the value of each flag given on the command line,
+// by name.
+func flagParameters() map[string]string {
+	parameters := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		parameters[f.Name] = f.Value.String()
+	})
+	return parameters
+}
+
+// records returns the number of IPs the expansion wrote to the outputs.
+// Each of them is written every IP, so it is the number any of them wrote.
+func (ws ipWriters) records() int {
+	if len(ws) == 0 {
+		return 0
+	}
+	return ws[0].records()
+}
+
+// records returns the number of IPs w wrote, in all the files of a split
+// output.
+func (w *ipWriter) records() int {
+	if w.split == nil {
+		return w.count
+	}
+	n := 0
+	for _, file := range w.split.written {
+		n += file.Records
+	}
+	return n
+}
+
+// files returns the files w wrote, with their paths as names.
+func (w *ipWriter) files() []manifestFile {
+	if w.split != nil {
+		files := make([]manifestFile, 0, len(w.split.written))
+		for _, file := range w.split.written {
+			files = append(files, manifestFile{Name: filepath.Join(filepath.Dir(w.split.base), file.Name), Format: w.format, Records: file.Records})
+		}
+		return files
+	}
+	if w.path == "" {
+		return nil
+	}
+	return []manifestFile{{Name: w.path, Format: w.format, Records: w.count}}
+}
+
+// sha256File returns the size and hex SHA-256 checksum of the file at path.
+func sha256File(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestRecords(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{
+		Outputs:          []string{"csv", "ndjson"},
+		OutputDir:        dir,
+		FilenameTemplate: defaultFilenameTemplate,
+		Fields:           defaultFields,
+		Manifest:         filepath.Join(dir, "manifest.json"),
+		Algorithm:        defaultAlgorithm,
+	}
+	blocks := testBlocks(t, "10.0.0.0/30")
+	outputs, err := newIPWriters(t.Context(), config, blocks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expandIPs(t.Context(), config, blocks, nil, outputs.write); err != nil {
+		t.Fatal(err)
+	}
+	if err := outputs.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(config, outputs); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(config.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	// The 4 IPs are written to both outputs, but produced once.
+	if m.Records != 4 {
+		t.Errorf("the manifest records %d IPs, want 4", m.Records)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("the manifest lists %d files, want 2", len(m.Files))
+	}
+	for _, file := range m.Files {
+		if file.Records != 4 {
+			t.Errorf("the manifest records %d IPs in %s, want 4", file.Records, file.Name)
+		}
+	}
+}
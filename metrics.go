@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// requestBuckets and expansionBuckets are the upper bounds, in seconds, of
+// the buckets of the request and expansion duration histograms.
+var (
+	requestBuckets   = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	expansionBuckets = []float64{0.01, 0.1, 1, 10, 60, 300, 1800, 3600}
+)
+
+// metrics are the measures of a server that GET /metrics reports in the
+// text format of Prometheus: its requests, the addresses its expansions
+// emit and how long they take, the errors writing them, and for the daemon
+// how busy its job workers are.
+type metrics struct {
+	mu                 sync.Mutex
+	started            time.Time
+	requests           map[[2]string]uint64  // by handler and status code
+	requestDurations   map[string]*histogram // by handler
+	inFlight           int
+	grpcCalls          map[[2]string]uint64  // by method and gRPC status code
+	addresses          map[string]uint64     // by API
+	expansionDurations map[string]*histogram // by API
+	outputErrors       map[string]uint64     // by API
+	jobs               map[string]uint64     // finished jobs by status
+	workers, busy      int
+	busySeconds        float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		started:            time.Now(),
+		requests:           make(map[[2]string]uint64),
+		requestDurations:   make(map[string]*histogram),
+		grpcCalls:          make(map[[2]string]uint64),
+		addresses:          make(map[string]uint64),
+		expansionDurations: make(map[string]*histogram),
+		outputErrors:       make(map[string]uint64),
+		jobs:               make(map[string]uint64),
+	}
+}
+
+// histogram counts observations in cumulative buckets, as Prometheus
+// histograms do.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // the observations in each bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// startRequest counts a request in flight, and returns w recording the
+// status code of its response for finishRequest.
+func (m *metrics) startRequest(w http.ResponseWriter) *statusWriter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight++
+	return &statusWriter{ResponseWriter: w, start: time.Now()}
+}
+
+// finishRequest counts a request answered by the handler with the pattern.
+func (m *metrics) finishRequest(w *statusWriter, handler string) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	m.requests[[2]string{handler, strconv.Itoa(w.status)}]++
+	if m.requestDurations[handler] == nil {
+		m.requestDurations[handler] = newHistogram(requestBuckets)
+	}
+	m.requestDurations[handler].observe(time.Since(w.start).Seconds())
+}
+
+// observeGRPC counts a call of the gRPC method that ended with the code.
+func (m *metrics) observeGRPC(method string, code int) {
+	if !slices.Contains(grpcMethods, method) {
+		method = "unknown"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.grpcCalls[[2]string{method, strconv.Itoa(code)}]++
+}
+
+// observeExpansion records an expansion through one of the APIs, which
+// emitted the addresses in elapsed and ended with err. Errors other than
+// the server shutting down are counted as output errors.
+func (m *metrics) observeExpansion(api string, addresses uint64, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addresses[api] += addresses
+	if m.expansionDurations[api] == nil {
+		m.expansionDurations[api] = newHistogram(expansionBuckets)
+	}
+	m.expansionDurations[api].observe(elapsed.Seconds())
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, errInterrupted) {
+		m.outputErrors[api]++
+	}
+}
+
+// startJob and finishJob record a job worker taking up a job, and
+// finishing with it after elapsed.
+func (m *metrics) startJob() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.busy++
+}
+
+func (m *metrics) finishJob(elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.busy--
+	m.busySeconds += elapsed.Seconds()
+}
+
+// countJob counts a job that finished with the status.
+func (m *metrics) countJob(status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[status]++
+}
+
+// handleMetrics answers GET /metrics with the metrics of s.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	bw := bufio.NewWriter(w)
+	s.metrics.write(bw, s.jobs)
+	_ = bw.Flush()
+}
+
+// write writes the metrics in the Prometheus text format, with the gauges
+// of the job queue when there is one.
+func (m *metrics) write(w io.Writer, jobs *jobQueue) {
+	queued := 0
+	if jobs != nil {
+		for _, j := range jobs.list() {
+			if j.Status == jobQueued {
+				queued++
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeMetricHeader(w, "cidr_sensei_start_time_seconds", "gauge", "The time the server started, in seconds since the epoch.")
+	fmt.Fprintf(w, "cidr_sensei_start_time_seconds %d\n", m.started.Unix())
+
+	writeMetricHeader(w, "cidr_sensei_http_requests_total", "counter", "The HTTP requests answered, by handler and status code.")
+	for _, key := range slices.SortedFunc(maps.Keys(m.requests), compareKeys) {
+		fmt.Fprintf(w, "cidr_sensei_http_requests_total{handler=%s,code=%s} %d\n", metricLabel(key[0]), metricLabel(key[1]), m.requests[key])
+	}
+	writeMetricHeader(w, "cidr_sensei_http_request_duration_seconds", "histogram", "The time taken to answer HTTP requests, by handler.")
+	for _, handler := range slices.Sorted(maps.Keys(m.requestDurations)) {
+		writeHistogram(w, "cidr_sensei_http_request_duration_seconds", "handler="+metricLabel(handler), m.requestDurations[handler])
+	}
+	writeMetricHeader(w, "cidr_sensei_http_requests_in_flight", "gauge", "The HTTP requests being answered.")
+	fmt.Fprintf(w, "cidr_sensei_http_requests_in_flight %d\n", m.inFlight)
+
+	writeMetricHeader(w, "cidr_sensei_grpc_calls_total", "counter", "The gRPC calls answered, by method and gRPC status code.")
+	for _, key := range slices.SortedFunc(maps.Keys(m.grpcCalls), compareKeys) {
+		fmt.Fprintf(w, "cidr_sensei_grpc_calls_total{method=%s,code=%s} %d\n", metricLabel(key[0]), metricLabel(key[1]), m.grpcCalls[key])
+	}
+
+	writeMetricHeader(w, "cidr_sensei_addresses_emitted_total", "counter", "The addresses written by expansions, by API.")
+	for _, api := range slices.Sorted(maps.Keys(m.addresses)) {
+		fmt.Fprintf(w, "cidr_sensei_addresses_emitted_total{api=%s} %d\n", metricLabel(api), m.addresses[api])
+	}
+	writeMetricHeader(w, "cidr_sensei_expansion_duration_seconds", "histogram", "The time taken by expansions, by API.")
+	for _, api := range slices.Sorted(maps.Keys(m.expansionDurations)) {
+		writeHistogram(w, "cidr_sensei_expansion_duration_seconds", "api="+metricLabel(api), m.expansionDurations[api])
+	}
+	writeMetricHeader(w, "cidr_sensei_output_errors_total", "counter", "The expansions that failed writing their output, by API.")
+	for _, api := range slices.Sorted(maps.Keys(m.outputErrors)) {
+		fmt.Fprintf(w, "cidr_sensei_output_errors_total{api=%s} %d\n", metricLabel(api), m.outputErrors[api])
+	}
+
+	if jobs == nil {
+		return
+	}
+	writeMetricHeader(w, "cidr_sensei_jobs_total", "counter", "The jobs that finished, by status.")
+	for _, status := range slices.Sorted(maps.Keys(m.jobs)) {
+		fmt.Fprintf(w, "cidr_sensei_jobs_total{status=%s} %d\n", metricLabel(status), m.jobs[status])
+	}
+	writeMetricHeader(w, "cidr_sensei_jobs_queued", "gauge", "The jobs waiting for a worker.")
+	fmt.Fprintf(w, "cidr_sensei_jobs_queued %d\n", queued)
+	writeMetricHeader(w, "cidr_sensei_job_workers", "gauge", "The workers running jobs.")
+	fmt.Fprintf(w, "cidr_sensei_job_workers %d\n", m.workers)
+	writeMetricHeader(w, "cidr_sensei_job_workers_busy", "gauge", "The workers running a job right now.")
+	fmt.Fprintf(w, "cidr_sensei_job_workers_busy %d\n", m.busy)
+	writeMetricHeader(w, "cidr_sensei_job_worker_busy_seconds_total", "counter", "The time the workers spent running jobs that finished.")
+	fmt.Fprintf(w, "cidr_sensei_job_worker_busy_seconds_total %s\n", formatMetricValue(m.busySeconds))
+}
+
+func compareKeys(a, b [2]string) int {
+	if c := strings.Compare(a[0], b[0]); c != 0 {
+		return c
+	}
+	return strings.Compare(a[1], b[1])
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeHistogram writes the buckets, sum and count of the histogram, with
+// the labels, a list of name="value" pairs.
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatMetricValue(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatMetricValue(h.sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabel returns the value quoted as a label value.
+func metricLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// statusWriter records the status code of the response it writes.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	start  time.Time
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack takes over the connection of a WebSocket, whose response is
+// Switching Protocols.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
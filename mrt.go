@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MRT record types and subtypes (RFC 6396, RFC 8050) holding IPv4 routes.
+const (
+	mrtTableDump   = 12
+	mrtTableDumpV2 = 13
+
+	mrtTableDumpIPv4         = 1
+	mrtRIBIPv4Unicast        = 2
+	mrtRIBIPv4UnicastAddPath = 8
+)
+
+// BGP path attributes and AS_PATH segment types (RFC 4271, RFC 6793).
+const (
+	bgpAttrASPath  = 2
+	bgpAttrAS4Path = 17
+
+	bgpASSet      = 1
+	bgpASSequence = 2
+)
+
+// mrtFilter selects the routes of an MRT dump by origin AS and prefix
+// length. An empty list of origins matches every route.
+type mrtFilter struct {
+	origins   []uint32
+	minLength int
+	maxLength int
+}
+
+// newMRTFilter returns the filter selecting the routes given with
+// -mrt-origin and -mrt-prefix-length.
+func newMRTFilter(config Config) (mrtFilter, error) {
+	filter := mrtFilter{maxLength: 32}
+	for _, asn := range splitList(config.MRTOrigins) {
+		number, err := parseASN(asn)
+		if err != nil {
+			return filter, err
+		}
+		filter.origins = append(filter.origins, number)
+	}
+	if config.MRTPrefixLength != "" {
+		low, high, found := strings.Cut(config.MRTPrefixLength, "-")
+		if !found {
+			high = low
+		}
+		var err error
+		if filter.minLength, err = parsePrefixLength(strings.TrimPrefix(strings.TrimSpace(low), "/")); err != nil {
+			return filter, fmt.Errorf("invalid -mrt-prefix-length %q (expected a length or range such as 16-24)", config.MRTPrefixLength)
+		}
+		if filter.maxLength, err = parsePrefixLength(strings.TrimPrefix(strings.TrimSpace(high), "/")); err != nil || filter.maxLength < filter.minLength {
+			return filter, fmt.Errorf("invalid -mrt-prefix-length %q (expected a length or range such as 16-24)", config.MRTPrefixLength)
+		}
+	}
+	return filter, nil
+}
+
+// matches reports whether a prefix with the given length, originated by
+// any of origins, is selected by the filter.
+func (f mrtFilter) matches(length int, origins []uint32) bool {
+	if length < f.minLength || length > f.maxLength {
+		return false
+	}
+	if len(f.origins) == 0 {
+		return true
+	}
+	for _, origin := range origins {
+		if slices.Contains(f.origins, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// mrtEntries returns the IPv4 prefixes of the MRT RIB dump given with -mrt,
+// such as a RouteViews or RIPE RIS bview, that the filter selects. Each
+// prefix is reported by its origin AS, e.g. "rib.20260101.0000.bz2:AS13335".
+func mrtEntries(ctx context.Context, config Config, fetcher *fetcher) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		filter, err := newMRTFilter(config)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+		body, err := openMRT(ctx, fetcher, config.MRT)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+		defer body.Close()
+
+		r, err := decompress(body)
+		if err != nil {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", config.MRT, err))
+			return
+		}
+		for entry, err := range readMRT(r, config.MRT, filter) {
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
+
+// openMRT opens an MRT dump, which is a local file, a URL or an object in
+// S3 or Google Cloud Storage. Dumps are read as they download.
+func openMRT(ctx context.Context, fetcher *fetcher, path string) (io.ReadCloser, error) {
+	switch {
+	case strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://"):
+		return fetcher.openStream(ctx, path, func() (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+			if err == nil {
+				req.Header.Set("User-Agent", userAgent)
+			}
+			return req, err
+		})
+	case isObjectURI(path):
+		scheme, rest, _ := strings.Cut(path, "://")
+		bucket, key, ok := strings.Cut(rest, "/")
+		if !ok || bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid object URI %s (expected %s://bucket/key)", path, scheme)
+		}
+		if scheme == "s3" {
+			return fetcher.s3.open(ctx, bucket, key)
+		}
+		return fetcher.gcs.open(ctx, bucket, key)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// decompress returns a reader of r, decompressing it when it starts with
+// the magic number of gzip (RIPE RIS) or bzip2 (RouteViews).
+func decompress(r io.Reader) (io.Reader, error) {
+	reader := bufio.NewReaderSize(r, 1<<16)
+	magic, err := reader.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return gzip.NewReader(reader)
+	case string(magic) == "BZh":
+		return bzip2.NewReader(reader), nil
+	}
+	return reader, nil
+}
+
+// readMRT yields the IPv4 prefixes of the TABLE_DUMP and TABLE_DUMP_V2 RIB
+// records in an MRT stream. Other records, such as BGP4MP updates and IPv6
+// RIBs, are skipped. Each prefix is yielded once, even though TABLE_DUMP
+// has a record for every peer that announced it.
+func readMRT(r io.Reader, name string, filter mrtFilter) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		var header [12]byte
+		var previous string
+		for record := 1; ; record++ {
+			if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+				return
+			} else if err != nil {
+				yield(inputEntry{}, fmt.Errorf("error reading %s: record %d: %w", name, record, truncated(err)))
+				return
+			}
+			recordType := binary.BigEndian.Uint16(header[4:6])
+			subtype := binary.BigEndian.Uint16(header[6:8])
+			body := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+			if _, err := io.ReadFull(r, body); err != nil {
+				yield(inputEntry{}, fmt.Errorf("error reading %s: record %d: %w", name, record, truncated(err)))
+				return
+			}
+
+			var route mrtRoute
+			var err error
+			switch {
+			case recordType == mrtTableDumpV2 && (subtype == mrtRIBIPv4Unicast || subtype == mrtRIBIPv4UnicastAddPath):
+				route, err = parseRIBIPv4(body, subtype == mrtRIBIPv4UnicastAddPath)
+			case recordType == mrtTableDump && subtype == mrtTableDumpIPv4:
+				route, err = parseTableDumpIPv4(body)
+			default:
+				continue
+			}
+			if err != nil {
+				yield(inputEntry{}, fmt.Errorf("error reading %s: record %d: %w", name, record, err))
+				return
+			}
+
+			prefix := route.prefix.String()
+			length, _ := route.prefix.Mask.Size()
+			if prefix == previous || !filter.matches(length, route.origins) {
+				continue
+			}
+			previous = prefix
+			origin := name
+			if len(route.origins) > 0 {
+				origin += ":AS" + strconv.FormatUint(uint64(route.origins[0]), 10)
+			}
+			if !yield(inputEntry{text: prefix, origin: origin}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// truncated reports an MRT record cut short as such, rather than as an
+// unexpected EOF.
+func truncated(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return errors.New("truncated record")
+	}
+	return err
+}
+
+// mrtRoute is a prefix in a RIB dump along with the ASes originating it,
+// which are more than one when it is announced by several or the path ends
+// in an AS_SET.
+type mrtRoute struct {
+	prefix  *net.IPNet
+	origins []uint32
+}
+
+// parseRIBIPv4 parses a TABLE_DUMP_V2 RIB_IPV4_UNICAST record, which holds
+// a prefix and the route every peer has to it.
+func parseRIBIPv4(body []byte, addPath bool) (mrtRoute, error) {
+	var route mrtRoute
+	if len(body) < 5 {
+		return route, errors.New("truncated record")
+	}
+	length := int(body[4])
+	size := (length + 7) / 8
+	if length > 32 || len(body) < 5+size+2 {
+		return route, errors.New("invalid prefix")
+	}
+	var ip [4]byte
+	copy(ip[:], body[5:5+size])
+	route.prefix = &net.IPNet{IP: net.IP(ip[:]).Mask(net.CIDRMask(length, 32)), Mask: net.CIDRMask(length, 32)}
+
+	rest := body[5+size:]
+	count := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	entryHeader := 8 // peer index, originated time and attribute length
+	if addPath {
+		entryHeader += 4
+	}
+	for range count {
+		if len(rest) < entryHeader {
+			return route, errors.New("truncated RIB entry")
+		}
+		attrLen := int(binary.BigEndian.Uint16(rest[entryHeader-2:]))
+		if len(rest) < entryHeader+attrLen {
+			return route, errors.New("truncated RIB entry")
+		}
+		for _, origin := range originASes(rest[entryHeader:entryHeader+attrLen], 4) {
+			if !slices.Contains(route.origins, origin) {
+				route.origins = append(route.origins, origin)
+			}
+		}
+		rest = rest[entryHeader+attrLen:]
+	}
+	return route, nil
+}
+
+// parseTableDumpIPv4 parses a TABLE_DUMP record for an IPv4 prefix, which
+// holds the route of a single peer with 2-byte AS numbers.
+func parseTableDumpIPv4(body []byte) (mrtRoute, error) {
+	var route mrtRoute
+	if len(body) < 22 {
+		return route, errors.New("truncated record")
+	}
+	length := int(body[8])
+	if length > 32 {
+		return route, errors.New("invalid prefix")
+	}
+	route.prefix = &net.IPNet{IP: net.IP(body[4:8]).Mask(net.CIDRMask(length, 32)), Mask: net.CIDRMask(length, 32)}
+	attrLen := int(binary.BigEndian.Uint16(body[20:22]))
+	if len(body) < 22+attrLen {
+		return route, errors.New("truncated attributes")
+	}
+	route.origins = originASes(body[22:22+attrLen], 2)
+	return route, nil
+}
+
+// originASes returns the ASes originating a route with the given BGP path
+// attributes: the last AS of the AS_PATH, or every AS of a final AS_SET.
+// asSize is the size of the AS numbers in AS_PATH, 4 in TABLE_DUMP_V2, and
+// an AS4_PATH takes precedence over a 2-byte AS_PATH.
+func originASes(attrs []byte, asSize int) []uint32 {
+	var path, path4 []byte
+	for len(attrs) >= 3 {
+		flags, attrType := attrs[0], attrs[1]
+		header, length := 3, int(attrs[2])
+		if flags&0x10 != 0 { // extended length
+			if len(attrs) < 4 {
+				return nil
+			}
+			header, length = 4, int(binary.BigEndian.Uint16(attrs[2:4]))
+		}
+		if len(attrs) < header+length {
+			return nil
+		}
+		switch attrType {
+		case bgpAttrASPath:
+			path = attrs[header : header+length]
+		case bgpAttrAS4Path:
+			path4 = attrs[header : header+length]
+		}
+		attrs = attrs[header+length:]
+	}
+	if path4 != nil && asSize == 2 {
+		path, asSize = path4, 4
+	}
+
+	var origins []uint32
+	for len(path) >= 2 {
+		segmentType, count := path[0], int(path[1])
+		if len(path) < 2+count*asSize {
+			return origins
+		}
+		if segmentType == bgpASSequence || segmentType == bgpASSet {
+			origins = origins[:0]
+			for i := range count {
+				as := path[2+i*asSize : 2+(i+1)*asSize]
+				if asSize == 2 {
+					origins = append(origins, uint32(binary.BigEndian.Uint16(as)))
+				} else {
+					origins = append(origins, binary.BigEndian.Uint32(as))
+				}
+			}
+			if segmentType == bgpASSequence && len(origins) > 0 {
+				origins = origins[len(origins)-1:]
+			}
+		}
+		path = path[2+count*asSize:]
+	}
+	return origins
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// normalization records an input entry whose canonical notation differs from
+// the way it was written.
+type normalization struct {
+	Entry     string
+	Canonical []string
+}
+
+// normalized returns the range with its host bits masked out, so that it
+// covers the whole block starting at the network address.
+func (c CIDRRange) normalized() CIDRRange {
+	c.start = c.network()
+	c.end = c.broadcast()
+	c.length = c.end - c.start + 1
+	return c
+}
+
+// hasHostBits reports whether the range was written with host bits set,
+// e.g. 10.0.0.5/24.
+func (c CIDRRange) hasHostBits() bool {
+	return c.start != c.network()
+}
+
+// normalizeCIDRRanges normalizes every range and returns, for each input
+// entry whose canonical CIDR notation differs from how it was written, the
+// blocks it was rewritten to. This covers host bits being set, bare IPs,
+// wildcard masks and resolved hostnames.
+func normalizeCIDRRanges(cidrRanges []CIDRRange) ([]CIDRRange, []normalization) {
+	normalized := make([]CIDRRange, 0, len(cidrRanges))
+	var normalizations []normalization
+	for i := 0; i < len(cidrRanges); {
+		// Ranges parsed from the same entry are adjacent. Sources such as
+		// cloud range files share an origin between their entries.
+		entry, origin := cidrRanges[i].entry, cidrRanges[i].origin
+		var canonical []string
+		for ; i < len(cidrRanges) && cidrRanges[i].origin == origin && cidrRanges[i].entry == entry; i++ {
+			cidr := cidrRanges[i].normalized()
+			normalized = append(normalized, cidr)
+			canonical = append(canonical, cidr.String())
+		}
+		if len(canonical) != 1 || canonical[0] != entry {
+			normalizations = append(normalizations, normalization{Entry: entry, Canonical: canonical})
+		}
+	}
+	return normalized, normalizations
+}
+
+// parseNormalizedCIDR parses a single CIDR block and normalizes it.
+func parseNormalizedCIDR(cidrStr string) (CIDRRange, error) {
+	cidr, err := parseCIDR(strings.TrimSpace(cidrStr))
+	if err != nil {
+		return CIDRRange{}, err
+	}
+	return cidr.normalized(), nil
+}
+
+// reportNormalizations writes one line per rewritten entry.
+func reportNormalizations(w io.Writer, normalizations []normalization) {
+	for _, n := range normalizations {
+		fmt.Fprintf(w, "Normalized %q to %s\n", n.Entry, strings.Join(n.Canonical, ","))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+)
+
+// isObjectURI reports whether path names an object in S3 or Google Cloud
+// Storage, e.g. s3://bucket/lists/blocked.txt.
+func isObjectURI(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// readObject returns the entries of the list stored in the object at uri.
+// The object is read as it downloads, so it does not have to fit in memory.
+func readObject(ctx context.Context, fetcher *fetcher, uri string, format inputFormat) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		scheme, path, _ := strings.Cut(uri, "://")
+		bucket, key, ok := strings.Cut(path, "/")
+		if !ok || bucket == "" || key == "" {
+			yield(inputEntry{}, fmt.Errorf("invalid object URI %s (expected %s://bucket/key)", uri, scheme))
+			return
+		}
+
+		var body io.ReadCloser
+		var err error
+		if scheme == "s3" {
+			body, err = fetcher.s3.open(ctx, bucket, key)
+		} else {
+			body, err = fetcher.gcs.open(ctx, bucket, key)
+		}
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+		defer body.Close()
+
+		for entry, err := range readFormatted(body, uri, format) {
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestS3Object(t *testing.T) {
+	var scopes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.URL.Path != "/netops-lists/blocked.txt" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			t.Errorf("the object was requested at %s with %q", r.URL.Path, auth)
+		}
+		scope, _, _ := strings.Cut(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), ",")
+		scopes = append(scopes, scope[strings.Index(scope, "/")+1:])
+		if !strings.Contains(scope, "/us-west-2/") {
+			// The bucket is in another region than the configured one
+			w.Header().Set("X-Amz-Bucket-Region", "us-west-2")
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		io.WriteString(w, "10.0.0.0/30\n")
+	}))
+	defer server.Close()
+	t.Setenv("AWS_ENDPOINT_URL_S3", server.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+
+	f := newFetcher(time.Minute, 0, "", true)
+	body, err := f.s3.open(t.Context(), "netops-lists", "blocked.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(body)
+	if string(data) != "10.0.0.0/30\n" {
+		t.Errorf("the object reads %q", data)
+	}
+	if want := []string{"eu-west-1/s3/aws4_request", "us-west-2/s3/aws4_request"}; strings.Join(scopes, " ") != strings.Join(want, " ") {
+		t.Errorf("the requests were signed for %v, want %v", scopes, want)
+	}
+}
+
+func TestGCSObject(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "netops-lists") || !strings.HasSuffix(r.URL.Path, "allowed.txt") {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "192.168.0.0/24\n")
+	}))
+	defer server.Close()
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+
+	f := newFetcher(time.Minute, 0, "", true)
+	body, err := f.gcs.open(t.Context(), "netops-lists", "allowed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(body)
+	if string(data) != "192.168.0.0/24\n" {
+		t.Errorf("the object reads %q", data)
+	}
+}
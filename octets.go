@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// octetRange is an inclusive range of values for one octet of an
+// nmap-style target.
+type octetRange struct {
+	lo, hi uint32
+}
+
+// isOctetRangeEntry reports whether entry is an nmap-style target with an
+// octet range or wildcard, e.g. 192.168.0-5.1-254 or 10.0.0.*.
+func isOctetRangeEntry(entry string) bool {
+	return strings.Count(entry, ".") == 3 && strings.ContainsAny(entry, "-*")
+}
+
+// parseOctetRange parses an nmap-style target in which each octet is a
+// number, a range such as 1-254, or * for 0-255. A range may omit either
+// bound, so 10- is 10-255 and -5 is 0-5. Octets after the last one that is
+// not a full 0-255 are contiguous, so the target yields one range per
+// combination of the octets before it.
+func parseOctetRange(entry string) ([]CIDRRange, error) {
+	var octets [4]octetRange
+	for i, part := range strings.Split(entry, ".") {
+		octet, err := parseOctet(part)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing octet range %s: %w", entry, err)
+		}
+		octets[i] = octet
+	}
+
+	// Find the last octet that does not cover every value; it and the
+	// full octets after it form a single contiguous range.
+	last := 0
+	for i := 3; i >= 0; i-- {
+		if octets[i] != (octetRange{0, 255}) {
+			last = i
+			break
+		}
+	}
+	count := uint64(1)
+	for _, octet := range octets[:last] {
+		count *= uint64(octet.hi - octet.lo + 1)
+	}
+	if count > maxWildcardRanges {
+		return nil, fmt.Errorf("error parsing octet range %s: expands to %d ranges, more than the limit of %d", entry, count, maxWildcardRanges)
+	}
+
+	shift := uint(8 * (3 - last))
+	var cidrRanges []CIDRRange
+	var expand func(i int, prefix uint32)
+	expand = func(i int, prefix uint32) {
+		if i == last {
+			start := prefix | octets[last].lo<<shift
+			end := prefix | octets[last].hi<<shift | (1<<shift - 1)
+			cidrRanges = append(cidrRanges, rangeToCIDRs(ipRange{Start: start, End: end})...)
+			return
+		}
+		for value := octets[i].lo; value <= octets[i].hi; value++ {
+			expand(i+1, prefix|value<<(8*(3-i)))
+		}
+	}
+	expand(0, 0)
+	return cidrRanges, nil
+}
+
+// parseOctet parses a single octet of an nmap-style target.
+func parseOctet(part string) (octetRange, error) {
+	if part == "*" {
+		return octetRange{0, 255}, nil
+	}
+	loStr, hiStr, isRange := strings.Cut(part, "-")
+	if !isRange {
+		hiStr = loStr
+	}
+	lo, err := parseOctetBound(loStr, 0)
+	if err != nil {
+		return octetRange{}, err
+	}
+	hi, err := parseOctetBound(hiStr, 255)
+	if err != nil {
+		return octetRange{}, err
+	}
+	if lo > hi {
+		return octetRange{}, fmt.Errorf("octet range %s is reversed", part)
+	}
+	return octetRange{lo, hi}, nil
+}
+
+// parseOctetBound parses one bound of an octet range, which is def when it
+// was omitted.
+func parseOctetBound(s string, def uint32) (uint32, error) {
+	if s == "" {
+		return def, nil
+	}
+	value, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid octet %q", s)
+	}
+	return uint32(value), nil
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"plugin"
+	"strings"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+// outputSinkFormat is an -output format, written through the sinks newSink
+// returns.
+type outputSinkFormat struct {
+	// extension names the output files generated for the format. Output in
+	// a format without one goes to stdout unless -outfile is given.
+	extension string
+	// writesFile is set for sinks creating the output file themselves.
+	writesFile bool
+	// borrowsRecords is set for sinks done with the record WriteRecord is
+	// given when it returns, which may then be given records in a buffer
+	// reused for the next. Plugins' sinks are not assumed to be.
+	borrowsRecords bool
+	newSink        func(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error)
+}
+
+// outputSinks are the formats of outputFormats, by name. Plugins loaded with
+// -output-plugin add theirs with registerOutputSink.
+var outputSinks = map[string]outputSinkFormat{
+	"json":     {extension: "json", borrowsRecords: true, newSink: newJSONSink},
+	"ndjson":   {extension: "ndjson", borrowsRecords: true, newSink: newNDJSONSink},
+	"yaml":     {extension: "yaml", borrowsRecords: true, newSink: newYAMLSink},
+	"csv":      {extension: "csv", borrowsRecords: true, newSink: newCSVSink},
+	"parquet":  {extension: "parquet", borrowsRecords: true, newSink: newParquetSink},
+	"sqlite":   {extension: "sqlite", writesFile: true, newSink: newSQLiteSink},
+	"template": {borrowsRecords: true, newSink: newTemplateSink},
+	"binary":   {extension: "bin", borrowsRecords: true, newSink: newBinarySink},
+	"roaring":  {extension: "roaring", borrowsRecords: true, newSink: newRoaringSink},
+	"hosts":    {extension: "hosts", borrowsRecords: true, newSink: newHostsSink},
+	"dnsmasq":  {extension: "dnsmasq", borrowsRecords: true, newSink: newHostsSink},
+	"xlsx":     {extension: "xlsx", newSink: newXLSXSink},
+	"terminal": {borrowsRecords: true, newSink: newTerminalSink},
+}
+
+// fileOutputFormats returns the output formats written to a file, in the
+// order of outputFormats.
+func fileOutputFormats() []string {
+	var formats []string
+	for _, format := range outputFormats {
+		if output, ok := outputSinks[format]; ok && output.extension != "" {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// registerOutputSink makes a format written through the sinks newSink
+// returns selectable with -output.
+func registerOutputSink(name string, format outputSinkFormat) error {
+	if name == "" || format.newSink == nil {
+		return fmt.Errorf("an output format needs a name and a sink")
+	}
+	if _, ok := outputSinks[name]; ok || isSinkURL(name) {
+		return fmt.Errorf("the output format %s is already registered", name)
+	}
+	outputSinks[name] = format
+	outputFormats = append(outputFormats, name)
+	return nil
+}
+
+// loadOutputPlugin opens the Go plugin at path, built with
+// -buildmode=plugin, and calls its RegisterOutputSinks function with a
+// function registering a format written to files of the extension, or to
+// stdout when it is empty:
+//
+//	func RegisterOutputSinks(register func(format, extension string, newSink func() cidrsensei.OutputSink) error) error
+func loadOutputPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("error loading the output plugin %s: %w", path, err)
+	}
+	symbol, err := p.Lookup("RegisterOutputSinks")
+	if err != nil {
+		return fmt.Errorf("the output plugin %s has no RegisterOutputSinks function", path)
+	}
+	register, ok := symbol.(func(func(string, string, func() cidrsensei.OutputSink) error) error)
+	if !ok {
+		return fmt.Errorf("the RegisterOutputSinks function of the output plugin %s has the type %T, not func(func(string, string, func() cidrsensei.OutputSink) error) error", path, symbol)
+	}
+	err = register(func(name, extension string, newSink func() cidrsensei.OutputSink) error {
+		if newSink == nil {
+			return fmt.Errorf("the output format %s has no sink", name)
+		}
+		return registerOutputSink(name, outputSinkFormat{
+			extension: extension,
+			newSink: func(Config, []CIDRRange) (cidrsensei.OutputSink, error) {
+				return newSink(), nil
+			},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error registering the output formats of the plugin %s: %w", path, err)
+	}
+	return nil
+}
+
+// jsonSink writes a JSON array of address objects, or with -json-envelope
+// an object holding the array along with the metadata of the run.
+type jsonSink struct {
+	fields   *fieldWriter  // nil when only the address is written
+	envelope *jsonEnvelope // nil without -json-envelope
+	w        io.Writer
+	count    int
+}
+
+func newJSONSink(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error) {
+	fields, err := newFieldWriter(config.Fields, config.Algorithm, cidrRanges)
+	if err != nil {
+		return nil, err
+	}
+	s := &jsonSink{fields: fields}
+	if config.JSONEnvelope {
+		s.envelope = newJSONEnvelope(config, cidrRanges, fields)
+	}
+	return s, nil
+}
+
+func (s *jsonSink) Open(w io.Writer, _ string) error {
+	s.w, s.count = w, 0
+	if s.envelope != nil {
+		return s.envelope.writeHeader(w)
+	}
+	return nil
+}
+
+func (s *jsonSink) Resume(w io.Writer, records int) error {
+	s.w, s.count = w, records
+	return nil
+}
+
+func (s *jsonSink) WriteRecord(ip string) error {
+	// Match the layout json.MarshalIndent gives an array of addresses.
+	separator := ",\n"
+	if s.count++; s.count == 1 {
+		separator = "[\n"
+		if s.envelope != nil {
+			separator = "\n"
+		}
+	}
+	if s.fields == nil && s.envelope == nil {
+		return writeStrings(s.w, separator, "  {\n    \"address\": \"", ip, "\"\n  }")
+	}
+	object := fmt.Sprintf("{\n    \"address\": \"%s\"\n  }", ip)
+	if s.fields != nil {
+		var err error
+		if object, err = s.fields.jsonObject(ip, true); err != nil {
+			return err
+		}
+	}
+	if s.envelope != nil {
+		// The array is a member of the envelope, indented a level deeper.
+		object = "  " + strings.ReplaceAll(object, "\n", "\n  ")
+	}
+	_, err := fmt.Fprintf(s.w, "%s  %s", separator, object)
+	return err
+}
+
+func (s *jsonSink) Close() error {
+	if s.envelope != nil {
+		return s.envelope.writeTrailer(s.w, s.count)
+	}
+	if s.count == 0 {
+		_, err := io.WriteString(s.w, "null")
+		return err
+	}
+	_, err := io.WriteString(s.w, "\n]")
+	return err
+}
+
+// ndjsonSink writes an address object on each line.
+type ndjsonSink struct {
+	fields *fieldWriter // nil when only the address is written
+	w      io.Writer
+}
+
+func newNDJSONSink(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error) {
+	fields, err := newFieldWriter(config.Fields, config.Algorithm, cidrRanges)
+	if err != nil {
+		return nil, err
+	}
+	return &ndjsonSink{fields: fields}, nil
+}
+
+func (s *ndjsonSink) Open(w io.Writer, _ string) error {
+	s.w = w
+	return nil
+}
+
+func (s *ndjsonSink) Resume(w io.Writer, _ int) error {
+	return s.Open(w, "")
+}
+
+func (s *ndjsonSink) WriteRecord(ip string) error {
+	if s.fields != nil {
+		object, err := s.fields.jsonObject(ip, false)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(s.w, object)
+		return err
+	}
+	return writeStrings(s.w, "{\"address\":\"", ip, "\"}\n")
+}
+
+func (s *ndjsonSink) Close() error {
+	return nil
+}
+
+// yamlSink writes a YAML sequence of address mappings.
+type yamlSink struct {
+	w     io.Writer
+	count int
+}
+
+func newYAMLSink(Config, []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &yamlSink{}, nil
+}
+
+func (s *yamlSink) Open(w io.Writer, _ string) error {
+	s.w, s.count = w, 0
+	return nil
+}
+
+func (s *yamlSink) Resume(w io.Writer, records int) error {
+	s.w, s.count = w, records
+	return nil
+}
+
+func (s *yamlSink) WriteRecord(ip string) error {
+	s.count++
+	return writeStrings(s.w, "- address: ", ip, "\n")
+}
+
+func (s *yamlSink) Close() error {
+	if s.count == 0 {
+		_, err := io.WriteString(s.w, "[]\n")
+		return err
+	}
+	return nil
+}
+
+// csvSink writes a CSV row for each address, after a header row of the
+// -fields.
+type csvSink struct {
+	fields *fieldWriter // nil when only the address is written
+	csv    *csv.Writer
+	record [1]string // the row of an address without fields
+}
+
+func newCSVSink(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error) {
+	fields, err := newFieldWriter(config.Fields, config.Algorithm, cidrRanges)
+	if err != nil {
+		return nil, err
+	}
+	return &csvSink{fields: fields}, nil
+}
+
+func (s *csvSink) Open(w io.Writer, _ string) error {
+	s.csv = csv.NewWriter(w)
+	if s.fields != nil {
+		return s.csv.Write(s.fields.fields)
+	}
+	return nil
+}
+
+// Resume continues the rows after the header row written before.
+func (s *csvSink) Resume(w io.Writer, _ int) error {
+	s.csv = csv.NewWriter(w)
+	return nil
+}
+
+func (s *csvSink) WriteRecord(ip string) error {
+	if s.fields != nil {
+		record, err := s.fields.csvRecord(ip)
+		if err != nil {
+			return err
+		}
+		return s.csv.Write(record)
+	}
+	s.record[0] = ip
+	return s.csv.Write(s.record[:])
+}
+
+func (s *csvSink) Close() error {
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+// Flush writes the rows the csv.Writer buffers.
+func (s *csvSink) Flush() error {
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+// terminalSink writes an address on each line.
+type terminalSink struct {
+	w io.Writer
+}
+
+func newTerminalSink(Config, []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &terminalSink{}, nil
+}
+
+func (s *terminalSink) Open(w io.Writer, _ string) error {
+	s.w = w
+	return nil
+}
+
+func (s *terminalSink) Resume(w io.Writer, _ int) error {
+	return s.Open(w, "")
+}
+
+func (s *terminalSink) WriteRecord(ip string) error {
+	return writeStrings(s.w, ip, "\n")
+}
+
+func (s *terminalSink) Close() error {
+	return nil
+}
+
+// binarySink writes each address as 4 big-endian bytes, after the header of
+// -binary-header.
+type binarySink struct {
+	header bool
+	w      io.Writer
+	buf    []byte // the bytes of the address written
+}
+
+func newBinarySink(config Config, _ []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &binarySink{header: config.BinaryHeader}, nil
+}
+
+func (s *binarySink) Open(w io.Writer, _ string) error {
+	s.w = w
+	if s.header {
+		_, err := w.Write(binaryHeader(4))
+		return err
+	}
+	return nil
+}
+
+// Resume continues the addresses after the header written before.
+func (s *binarySink) Resume(w io.Writer, _ int) error {
+	s.w = w
+	return nil
+}
+
+func (s *binarySink) WriteRecord(ip string) error {
+	n, err := parseIPv4(ip)
+	if err != nil {
+		return err
+	}
+	s.buf = binary.BigEndian.AppendUint32(s.buf[:0], n)
+	_, err = s.w.Write(s.buf)
+	return err
+}
+
+func (s *binarySink) Close() error {
+	return nil
+}
+
+// roaringSink collects the addresses into a roaring bitmap, written when
+// the output is closed.
+type roaringSink struct {
+	w      io.Writer
+	bitmap *roaringBitmap
+}
+
+func newRoaringSink(Config, []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &roaringSink{}, nil
+}
+
+func (s *roaringSink) Open(w io.Writer, _ string) error {
+	s.w, s.bitmap = w, newRoaringBitmap()
+	return nil
+}
+
+func (s *roaringSink) WriteRecord(ip string) error {
+	n, err := parseIPv4(ip)
+	if err == nil {
+		s.bitmap.add(n)
+	}
+	return err
+}
+
+func (s *roaringSink) Close() error {
+	return s.bitmap.writeTo(s.w)
+}
+
+// parquetSink writes a Parquet file of the addresses and the blocks they
+// were expanded from.
+type parquetSink struct {
+	algorithm  string
+	cidrRanges []CIDRRange
+	pq         *parquetWriter
+}
+
+func newParquetSink(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &parquetSink{algorithm: config.Algorithm, cidrRanges: cidrRanges}, nil
+}
+
+func (s *parquetSink) Open(w io.Writer, _ string) error {
+	pq, err := newParquetWriter(w, s.algorithm, s.cidrRanges)
+	s.pq = pq
+	return err
+}
+
+func (s *parquetSink) WriteRecord(ip string) error {
+	return s.pq.write(ip)
+}
+
+func (s *parquetSink) Close() error {
+	return s.pq.close()
+}
+
+// sqliteSink writes the addresses and the blocks they were expanded from to
+// a table of a SQLite database.
+type sqliteSink struct {
+	table      string
+	algorithm  string
+	cidrRanges []CIDRRange
+	db         *sqliteWriter
+}
+
+func newSQLiteSink(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &sqliteSink{table: config.OutputTable, algorithm: config.Algorithm, cidrRanges: cidrRanges}, nil
+}
+
+func (s *sqliteSink) Open(_ io.Writer, path string) error {
+	if path == "" {
+		return fmt.Errorf("sqlite output cannot be written to stdout")
+	}
+	db, err := newSQLiteWriter(path, s.table, s.algorithm, s.cidrRanges)
+	s.db = db
+	return err
+}
+
+func (s *sqliteSink) WriteRecord(ip string) error {
+	return s.db.write(ip)
+}
+
+func (s *sqliteSink) Close() error {
+	return s.db.close()
+}
+
+// templateSink renders each address through the -template file.
+type templateSink struct {
+	path       string
+	algorithm  string
+	cidrRanges []CIDRRange
+	tmpl       *templateWriter
+}
+
+func newTemplateSink(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &templateSink{path: config.TemplateFile, algorithm: config.Algorithm, cidrRanges: cidrRanges}, nil
+}
+
+func (s *templateSink) Open(w io.Writer, _ string) error {
+	tmpl, err := newTemplateWriter(w, s.path, s.algorithm, s.cidrRanges)
+	s.tmpl = tmpl
+	return err
+}
+
+func (s *templateSink) WriteRecord(ip string) error {
+	return s.tmpl.write(ip)
+}
+
+func (s *templateSink) Close() error {
+	return nil
+}
+
+// hostsSink writes a hosts file or dnsmasq configuration line for each
+// address.
+type hostsSink struct {
+	format, hostNameTemplate string
+	hosts                    *hostsWriter
+}
+
+func newHostsSink(config Config, _ []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &hostsSink{format: config.OutputFormat, hostNameTemplate: config.HostNameTemplate}, nil
+}
+
+func (s *hostsSink) Open(w io.Writer, _ string) error {
+	hosts, err := newHostsWriter(w, s.format, s.hostNameTemplate)
+	s.hosts = hosts
+	return err
+}
+
+func (s *hostsSink) Resume(w io.Writer, _ int) error {
+	return s.Open(w, "")
+}
+
+func (s *hostsSink) WriteRecord(ip string) error {
+	return s.hosts.write(ip)
+}
+
+func (s *hostsSink) Close() error {
+	return nil
+}
+
+// xlsxSink writes an Excel workbook of the addresses.
+type xlsxSink struct {
+	config     Config
+	cidrRanges []CIDRRange
+	xlsx       *xlsxWriter
+}
+
+func newXLSXSink(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &xlsxSink{config: config, cidrRanges: cidrRanges}, nil
+}
+
+func (s *xlsxSink) Open(w io.Writer, _ string) error {
+	xlsx, err := newXLSXWriter(w, s.config, s.cidrRanges)
+	s.xlsx = xlsx
+	return err
+}
+
+func (s *xlsxSink) WriteRecord(ip string) error {
+	return s.xlsx.write(ip)
+}
+
+func (s *xlsxSink) Close() error {
+	return s.xlsx.close()
+}
+
+// networkSink sends the addresses to the network sink of an -output URL,
+// connecting to it when opened.
+type networkSink struct {
+	config     Config
+	cidrRanges []CIDRRange
+	sink       outputSink
+}
+
+func newNetworkSink(config Config, cidrRanges []CIDRRange) (cidrsensei.OutputSink, error) {
+	return &networkSink{config: config, cidrRanges: cidrRanges}, nil
+}
+
+func (s *networkSink) Open(io.Writer, string) error {
+	sink, err := newOutputSink(s.config, s.cidrRanges)
+	s.sink = sink
+	return err
+}
+
+func (s *networkSink) WriteRecord(ip string) error {
+	return s.sink.send(ip)
+}
+
+func (s *networkSink) Close() error {
+	return s.sink.close()
+}
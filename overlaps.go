@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// overlap describes two CIDR ranges that share addresses.
+type overlap struct {
+	First     string `json:"first"`
+	Second    string `json:"second"`
+	Relation  string `json:"relation"`
+	Addresses uint64 `json:"overlapping_addresses"`
+
+	FirstMetadata  map[string]string `json:"first_metadata,omitempty"`
+	SecondMetadata map[string]string `json:"second_metadata,omitempty"`
+}
+
+// runOverlaps writes a report of every pair of CIDR ranges that overlap.
+// When the blocks carry metadata, such as the other columns of a CSV
+// inventory, it is reported alongside them.
+func runOverlaps(config Config, cidrRanges []CIDRRange) error {
+	overlaps := findOverlaps(cidrRanges)
+	withMetadata := slices.ContainsFunc(overlaps, func(o overlap) bool {
+		return o.FirstMetadata != nil || o.SecondMetadata != nil
+	})
+
+	header := []string{"first", "second", "relation", "overlapping_addresses"}
+	if withMetadata {
+		header = append(header, "first_metadata", "second_metadata")
+	}
+	rows := make([][]string, 0, len(overlaps))
+	for _, o := range overlaps {
+		row := []string{o.First, o.Second, o.Relation, strconv.FormatUint(o.Addresses, 10)}
+		if withMetadata {
+			row = append(row, formatMetadata(o.FirstMetadata), formatMetadata(o.SecondMetadata))
+		}
+		rows = append(rows, row)
+	}
+	return writeReport(os.Stdout, config.OutputFormat, overlaps, header, rows)
+}
+
+// findOverlaps returns every pair of ranges that share addresses. The
+// relation is "duplicate" when both cover the same addresses, "contains"
+// when the first fully contains the second, and "overlaps" otherwise.
+func findOverlaps(cidrRanges []CIDRRange) []overlap {
+	// Sort by start, widest first, so a range is always compared against
+	// the earlier ranges that are still active when it starts.
+	sorted := make([]CIDRRange, len(cidrRanges))
+	copy(sorted, cidrRanges)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].start != sorted[j].start {
+			return sorted[i].start < sorted[j].start
+		}
+		return sorted[i].end > sorted[j].end
+	})
+
+	overlaps := []overlap{}
+	var active []CIDRRange
+	for _, cidr := range sorted {
+		// Drop the active ranges that end before this one starts.
+		kept := active[:0]
+		for _, a := range active {
+			if a.end >= cidr.start {
+				kept = append(kept, a)
+			}
+		}
+		active = kept
+
+		for _, a := range active {
+			o := overlap{
+				First:     a.String(),
+				Second:    cidr.String(),
+				Addresses: ipRange{Start: cidr.start, End: min(a.end, cidr.end)}.Size(),
+
+				FirstMetadata:  a.metadata,
+				SecondMetadata: cidr.metadata,
+			}
+			switch {
+			case a.start == cidr.start && a.end == cidr.end:
+				o.Relation = "duplicate"
+			case a.end >= cidr.end:
+				o.Relation = "contains"
+			default:
+				o.Relation = "overlaps"
+			}
+			overlaps = append(overlaps, o)
+		}
+		active = append(active, cidr)
+	}
+	return overlaps
+}
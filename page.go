@@ -0,0 +1,31 @@
+package main
+
+// pageIPs passes up to limit IPs, starting at the zero-based position offset
+// of the expansion order of the merged CIDR ranges, to emit, formatted by
+// format. The start of the page is located with index arithmetic rather than
+// by iterating from the first address. A limit of 0 emits every IP from
+// offset onwards.
+func pageIPs(cidrRanges []CIDRRange, offset, limit uint64, format *ipFormatter, emit func(string) error) error {
+	index := newRangeIndex(mergeIPRanges(toIPRanges(cidrRanges)))
+	if offset >= index.total {
+		return nil
+	}
+
+	end := index.total
+	if limit > 0 && limit < end-offset {
+		end = offset + limit
+	}
+
+	for i, pos := index.rangeAt(offset), offset; pos < end; i++ {
+		r := index.ranges[i]
+		first := r.Start + uint32(pos-index.offsets[i])
+		count := min(r.Size()-(pos-index.offsets[i]), end-pos)
+		for n := uint64(0); n < count; n++ {
+			if err := emit(format.format(first + uint32(n))); err != nil {
+				return err
+			}
+		}
+		pos += count
+	}
+	return nil
+}
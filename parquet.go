@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei/radixtrie"
+)
+
+// parquetRowGroupRows is the number of rows buffered before they are written
+// as a row group, which bounds the memory a Parquet expansion uses.
+const parquetRowGroupRows = 1 << 17
+
+// parquetMagic starts and ends every Parquet file.
+const parquetMagic = "PAR1"
+
+// Parquet physical types, converted types, repetition types, encodings and
+// compression codecs used by parquetWriter, as numbered in parquet.thrift.
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+	parquetUTF8      = 0
+	parquetRequired  = 0
+	parquetPlain     = 0
+	parquetRLE       = 3
+	parquetGzip      = 2
+	parquetDataPage  = 0
+)
+
+// parquetColumn is a column of the Parquet output.
+type parquetColumn struct {
+	name         string
+	physicalType int32
+	utf8         bool
+}
+
+// parquetColumns are the columns of the Parquet output: the address, its
+// integer form, the block it was expanded from and the metadata of the
+// block's entry, such as "owner=network-team;site=ams1".
+var parquetColumns = []parquetColumn{
+	{"address", parquetByteArray, true},
+	{"integer", parquetInt64, false},
+	{"source", parquetByteArray, true},
+	{"tags", parquetByteArray, true},
+}
+
+// parquetChunk records where a column chunk of a row group was written.
+type parquetChunk struct {
+	offset           int64
+	compressedSize   int64
+	uncompressedSize int64
+}
+
+// parquetRowGroup records a row group that was written.
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// parquetWriter writes expanded IPs as a Parquet file. Rows are buffered as
+// PLAIN-encoded column values and written as a row group, with a single
+// gzip-compressed data page per column, every parquetRowGroupRows rows. The
+// file metadata is written by close.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	sources *sourceIndex
+
+	columns   []bytes.Buffer
+	rows      int
+	rowGroups []parquetRowGroup
+}
+
+// newParquetWriter starts a Parquet file on w for IPs expanded from
+// cidrRanges, whose blocks are found with the index of algorithm.
+func newParquetWriter(w io.Writer, algorithm string, cidrRanges []CIDRRange) (*parquetWriter, error) {
+	p := &parquetWriter{
+		w:       w,
+		sources: newSourceIndex(algorithm, cidrRanges),
+		columns: make([]bytes.Buffer, len(parquetColumns)),
+	}
+	if err := p.writeBytes([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// write adds the row of an IP.
+func (p *parquetWriter) write(ip string) error {
+	n, source, tags, err := p.sources.describe(ip)
+	if err != nil {
+		return err
+	}
+
+	putParquetString(&p.columns[0], ip)
+	binary.Write(&p.columns[1], binary.LittleEndian, int64(n))
+	putParquetString(&p.columns[2], source)
+	putParquetString(&p.columns[3], tags)
+	p.rows++
+	if p.rows == parquetRowGroupRows {
+		return p.flush()
+	}
+	return nil
+}
+
+// putParquetString appends s to buf in the PLAIN encoding of byte arrays.
+func putParquetString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+// flush writes the buffered rows as a row group.
+func (p *parquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(p.rows)}
+	for i := range p.columns {
+		chunk, err := p.writePage(&p.columns[i])
+		if err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		p.columns[i].Reset()
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.rows = 0
+	return nil
+}
+
+// writePage writes the values in data as a data page.
+func (p *parquetWriter) writePage(data *bytes.Buffer) (parquetChunk, error) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(data.Bytes()); err != nil {
+		return parquetChunk{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return parquetChunk{}, err
+	}
+
+	var header thriftWriter
+	header.i32(1, parquetDataPage)
+	header.i32(2, int32(data.Len()))
+	header.i32(3, int32(compressed.Len()))
+	header.beginStruct(5)
+	header.i32(1, int32(p.rows))
+	header.i32(2, parquetPlain)
+	header.i32(3, parquetRLE)
+	header.i32(4, parquetRLE)
+	header.endStruct()
+	header.stop()
+
+	chunk := parquetChunk{
+		offset:           p.offset,
+		compressedSize:   int64(len(header.buf) + compressed.Len()),
+		uncompressedSize: int64(len(header.buf) + data.Len()),
+	}
+	if err := p.writeBytes(header.buf); err != nil {
+		return parquetChunk{}, err
+	}
+	return chunk, p.writeBytes(compressed.Bytes())
+}
+
+// close writes the remaining rows and the file metadata.
+func (p *parquetWriter) close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1)
+	meta.beginList(2, thriftStruct, len(parquetColumns)+1)
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(parquetColumns)))
+	meta.endElement()
+	for _, column := range parquetColumns {
+		meta.i32(1, column.physicalType)
+		meta.i32(3, parquetRequired)
+		meta.binary(4, column.name)
+		if column.utf8 {
+			meta.i32(6, parquetUTF8)
+		}
+		meta.endElement()
+	}
+	meta.endList()
+	var numRows int64
+	for _, group := range p.rowGroups {
+		numRows += group.rows
+	}
+	meta.i64(3, numRows)
+	meta.beginList(4, thriftStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		var totalSize int64
+		meta.beginList(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			column := parquetColumns[i]
+			meta.i64(2, chunk.offset)
+			meta.beginStruct(3)
+			meta.i32(1, column.physicalType)
+			meta.beginList(2, thriftI32, 1)
+			meta.listI32(parquetPlain)
+			meta.beginList(3, thriftBinary, 1)
+			meta.listBinary(column.name)
+			meta.i32(4, parquetGzip)
+			meta.i64(5, group.rows)
+			meta.i64(6, chunk.uncompressedSize)
+			meta.i64(7, chunk.compressedSize)
+			meta.i64(9, chunk.offset)
+			meta.endStruct()
+			meta.endElement()
+			totalSize += chunk.uncompressedSize
+		}
+		meta.endList()
+		meta.i64(2, totalSize)
+		meta.i64(3, group.rows)
+		meta.endElement()
+	}
+	meta.endList()
+	meta.binary(6, "cidr-sensei")
+	meta.stop()
+
+	if err := p.writeBytes(meta.buf); err != nil {
+		return err
+	}
+	if err := p.writeBytes(binary.LittleEndian.AppendUint32(nil, uint32(len(meta.buf)))); err != nil {
+		return err
+	}
+	return p.writeBytes([]byte(parquetMagic))
+}
+
+// writeBytes writes data to the file, keeping track of the offset.
+func (p *parquetWriter) writeBytes(data []byte) error {
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+// sourceIndex finds the block an expanded IP came from.
+type sourceIndex struct {
+	ranges []CIDRRange // sorted by start, and the largest first
+
+	// trie holds the prefixes of the ranges, each with its range, when the
+	// -algorithm is radix-trie, to find the block of each IP with a
+	// longest-prefix match instead.
+	trie *radixtrie.Trie[*CIDRRange]
+
+	// The previous lookup: the IP, the last range starting before it and
+	// the match, so that ascending runs of IPs are found without scanning
+	// again.
+	ip          uint32
+	last, match int
+}
+
+// newSourceIndex indexes cidrRanges, in a radix trie when algorithm is
+// radix-trie.
+func newSourceIndex(algorithm string, cidrRanges []CIDRRange) *sourceIndex {
+	ranges := make([]CIDRRange, len(cidrRanges))
+	copy(ranges, cidrRanges)
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].start != ranges[j].start {
+			return ranges[i].start < ranges[j].start
+		}
+		return ranges[i].end > ranges[j].end
+	})
+	s := &sourceIndex{ranges: ranges, last: -1, match: -1}
+	if algorithm == "radix-trie" {
+		s.trie = &radixtrie.Trie[*CIDRRange]{}
+		for i := range ranges {
+			insertRange(s.trie, ipRange{Start: ranges[i].start, End: ranges[i].end}, func(*CIDRRange) *CIDRRange { return &ranges[i] })
+		}
+	}
+	return s
+}
+
+// lookup returns the most specific block containing ip, that is the one
+// starting last before it, or nil if there is none.
+func (s *sourceIndex) lookup(ip uint32) *CIDRRange {
+	if s.trie != nil {
+		prefix, _ := s.trie.Lookup(ip)
+		return prefix.Value
+	}
+	i := sort.Search(len(s.ranges), func(j int) bool { return s.ranges[j].start > ip }) - 1
+	if i == s.last && ip >= s.ip && s.match >= 0 && s.ranges[s.match].end >= ip {
+		s.ip = ip
+		return &s.ranges[s.match]
+	}
+	s.ip, s.last, s.match = ip, i, -1
+	for ; i >= 0; i-- {
+		if s.ranges[i].end >= ip {
+			s.match = i
+			return &s.ranges[i]
+		}
+	}
+	return nil
+}
+
+// describe returns the integer form of ip, and the block it came from and
+// the metadata of the block's entry, which are empty if there is none.
+func (s *sourceIndex) describe(ip string) (n uint32, source, tags string, err error) {
+	if n, err = parseIPv4(ip); err != nil {
+		return 0, "", "", err
+	}
+	if cidr := s.lookup(n); cidr != nil {
+		source, tags = cidr.String(), formatMetadata(cidr.metadata)
+	}
+	return n, source, tags, nil
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, which the
+// Parquet page headers and file metadata are written in.
+type thriftWriter struct {
+	buf   []byte
+	last  int16   // the id of the previous field of the current struct
+	stack []int16 // the previous field ids of the enclosing structs
+}
+
+// field writes the header of a field.
+func (t *thriftWriter) field(id int16, kind byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|kind)
+	} else {
+		t.buf = append(t.buf, kind)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+// beginStruct starts a struct field, which endStruct ends.
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thriftWriter) endStruct() {
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// beginList starts a list field of n elements. The fields of struct
+// elements follow, each element ended by endElement and the list by endList.
+func (t *thriftWriter) beginList(id int16, kind byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|kind)
+	} else {
+		t.buf = append(t.buf, 0xf0|kind)
+		t.buf = binary.AppendUvarint(t.buf, uint64(n))
+	}
+	if kind == thriftStruct {
+		t.stack = append(t.stack, t.last)
+		t.last = 0
+	}
+}
+
+// endElement ends a struct element of a list.
+func (t *thriftWriter) endElement() {
+	t.stop()
+	t.last = 0
+}
+
+// endList ends a list of structs, continuing the enclosing struct.
+func (t *thriftWriter) endList() {
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+// stop ends the current struct.
+func (t *thriftWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow is a row of Parquet output, as another Parquet reader decodes
+// it.
+type parquetRow struct {
+	Address string `parquet:"address"`
+	Integer int64  `parquet:"integer"`
+	Source  string `parquet:"source"`
+	Tags    string `parquet:"tags"`
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	blocks := testBlocks(t, "10.0.0.0/15", "192.168.0.0/30")
+	blocks[1].metadata = map[string]string{"site": "ams1", "owner": "network-team"}
+	ips := eachIP(blocks)
+	var buf bytes.Buffer
+	w, err := newParquetWriter(&buf, defaultAlgorithm, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range ips {
+		if err := w.write(formatIPv4(ip)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The /15 fills a row group, and the /30 starts another
+	if n := len(file.RowGroups()); n != 2 {
+		t.Errorf("the file has %d row groups, want 2", n)
+	}
+	for i, column := range file.Schema().Fields() {
+		if column.Name() != parquetColumns[i].name || !column.Required() {
+			t.Errorf("column %d is %s, want the required column %s", i, column.Name(), parquetColumns[i].name)
+		}
+	}
+	reader := parquet.NewGenericReader[parquetRow](file)
+	defer reader.Close()
+	rows := make([]parquetRow, len(ips)+1)
+	n, err := reader.Read(rows)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if n != len(ips) {
+		t.Fatalf("read %d rows, want %d", n, len(ips))
+	}
+	for i, ip := range ips {
+		want := parquetRow{Address: formatIPv4(ip), Integer: int64(ip), Source: "10.0.0.0/15"}
+		if ip >= 0xc0a80000 {
+			want.Source, want.Tags = "192.168.0.0/30", "owner=network-team;site=ams1"
+		}
+		if rows[i] != want {
+			t.Fatalf("row %d is %+v, want %+v", i, rows[i], want)
+		}
+	}
+}
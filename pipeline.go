@@ -0,0 +1,79 @@
+package main
+
+import "fmt"
+
+// The expansion is a pipeline: a generator, such as expandIPs, emits each IP
+// through the stages enabled, which may filter, pace or count them, to the
+// sink writing the outputs. Each IP goes through every stage before the next
+// one is generated, so no stage holds more than the IP it is given, and the
+// memory of the pipeline is its fixed -buffer-size, whichever the number of
+// IPs and the formats they are written in.
+
+// A stage is a step of the pipeline, returning the function taking each IP
+// and passing those it keeps on to the next stage, next.
+type stage func(next func(string) error) func(string) error
+
+// pipeline returns the function taking each IP through the stages, in the
+// order given, to sink. nil stages, of the steps not enabled, are skipped.
+func pipeline(sink func(string) error, stages ...stage) func(string) error {
+	emit := sink
+	for i := len(stages) - 1; i >= 0; i-- {
+		if stages[i] != nil {
+			emit = stages[i](emit)
+		}
+	}
+	return emit
+}
+
+const (
+	defaultBufferSize = "1MiB"
+	minBufferSize     = 64 << 10
+
+	// bufferedIPSize is about the memory of an IP string waiting in the
+	// channel of the parallel workers: its header and its digits.
+	bufferedIPSize = 32
+)
+
+// bufferBudget is the -buffer-size, in bytes, that the buffers between the
+// generator and the sinks share: those of the output files, and the channel
+// the -parallel workers send their IPs on.
+type bufferBudget int64
+
+// parseBufferSize parses the -buffer-size.
+func parseBufferSize(s string) (bufferBudget, error) {
+	size, err := parseByteSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if size < minBufferSize {
+		return 0, fmt.Errorf("the -buffer-size must be at least %dKiB", minBufferSize>>10)
+	}
+	return bufferBudget(size), nil
+}
+
+// buffers returns the budget of the -buffer-size of config, which is valid
+// once parseFlags has returned it.
+func (config Config) buffers() bufferBudget {
+	budget, err := parseBufferSize(config.BufferSize)
+	if err != nil {
+		budget, _ = parseBufferSize(defaultBufferSize)
+	}
+	return budget
+}
+
+// writerSize returns the size of the buffer of each of the outputs of
+// config, which share the budget with the channel of the -parallel workers
+// when the expansion is parallel.
+func (b bufferBudget) writerSize(config Config) int {
+	share := int64(b)
+	if config.expandsInParallel() {
+		share /= 2
+	}
+	return int(share / int64(max(len(config.Outputs), 1)))
+}
+
+// channelCapacity returns the number of IPs the channel of the -parallel
+// workers holds, half the budget.
+func (b bufferBudget) channelCapacity() int {
+	return int(int64(b) / 2 / bufferedIPSize)
+}
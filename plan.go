@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// planRequest is a single subnet requirement for the VLSM planner.
+type planRequest struct {
+	name  string
+	hosts uint64
+}
+
+// plannedSubnet is a subnet allocated by the VLSM planner.
+type plannedSubnet struct {
+	Name      string `json:"name"`
+	Hosts     uint64 `json:"hosts"`
+	Network   string `json:"network"`
+	Mask      string `json:"mask"`
+	FirstHost string `json:"first_host"`
+	LastHost  string `json:"last_host"`
+	Broadcast string `json:"broadcast,omitempty"`
+	Usable    uint64 `json:"usable_hosts"`
+}
+
+// runPlan implements the plan subcommand and returns the process exit code.
+func runPlan(args []string) int {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	parentStr := flags.String("parent", "", "the parent CIDR block to allocate subnets from")
+	hostsStr := flags.String("hosts", "", "a comma-separated list of required host counts, optionally named (e.g. web=500,db=200,50)")
+	outputFormat := flags.String("output", "terminal", "the output format ("+strings.Join(reportFormats, ", ")+")")
+	var logging logOptions
+	logging.addFlags(flags)
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s plan [OPTIONS]\n", os.Args[0])
+		fmt.Println("Plan a VLSM allocation of subnets within a parent CIDR block, largest first")
+		fmt.Println("")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		fmt.Println("")
+		fmt.Println("Examples:")
+		fmt.Printf("%s plan -parent=10.0.0.0/22 -hosts=web=500,db=200,50\n", os.Args[0])
+	}
+	_ = flags.Parse(args)
+	if err := logging.setup(); err != nil {
+		slog.Error("invalid command line", "error", err)
+		return 1
+	}
+
+	if *parentStr == "" || *hostsStr == "" {
+		slog.Error("the -parent and -hosts flags are required")
+		return 1
+	}
+	if !slices.Contains(reportFormats, *outputFormat) {
+		slog.Error("invalid command line", "error", unsupportedReportFormat(*outputFormat))
+		return 1
+	}
+
+	parent, err := parseNormalizedCIDR(*parentStr)
+	if err != nil {
+		slog.Error("invalid -parent block", "error", err)
+		return 1
+	}
+	requests, err := parsePlanRequests(*hostsStr)
+	if err != nil {
+		slog.Error("invalid -hosts list", "error", err)
+		return 1
+	}
+	subnets, err := planSubnets(parent, requests)
+	if err != nil {
+		slog.Error("cannot plan the subnets", "error", err)
+		return 1
+	}
+
+	header := []string{"name", "hosts", "network", "mask", "first_host", "last_host", "broadcast", "usable_hosts"}
+	rows := make([][]string, 0, len(subnets))
+	for _, s := range subnets {
+		broadcast := s.Broadcast
+		if broadcast == "" && *outputFormat == "terminal" {
+			broadcast = "-"
+		}
+		rows = append(rows, []string{s.Name, strconv.FormatUint(s.Hosts, 10), s.Network, s.Mask, s.FirstHost, s.LastHost, broadcast, strconv.FormatUint(s.Usable, 10)})
+	}
+	if err := writeReport(os.Stdout, *outputFormat, subnets, header, rows); err != nil {
+		slog.Error("cannot write output", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// parsePlanRequests parses a comma-separated list of host counts, each
+// optionally prefixed with a name and "=". Unnamed requests are numbered.
+func parsePlanRequests(s string) ([]planRequest, error) {
+	var requests []planRequest
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		name, count, found := strings.Cut(entry, "=")
+		if !found {
+			name, count = fmt.Sprintf("subnet%d", i+1), entry
+		}
+		hosts, err := strconv.ParseUint(count, 10, 64)
+		if err != nil || hosts == 0 {
+			return nil, fmt.Errorf("invalid host count %q for %s", count, name)
+		}
+		requests = append(requests, planRequest{name: name, hosts: hosts})
+	}
+	return requests, nil
+}
+
+// prefixForHosts returns the longest prefix length whose blocks have at
+// least the given number of usable hosts. A /31 provides two usable hosts and
+// a /32 one (RFC 3021); larger blocks lose their network and broadcast
+// address.
+func prefixForHosts(hosts uint64) (int, error) {
+	switch {
+	case hosts == 1:
+		return 32, nil
+	case hosts == 2:
+		return 31, nil
+	case hosts > 1<<32-2:
+		return 0, fmt.Errorf("%d hosts do not fit in an IPv4 block", hosts)
+	}
+	return 32 - bits.Len64(hosts+1), nil
+}
+
+// planSubnets allocates a subnet for each request within parent, largest
+// first, packing them from the start of the parent block without overlap.
+// The subnets are returned in address order.
+func planSubnets(parent CIDRRange, requests []planRequest) ([]plannedSubnet, error) {
+	type sized struct {
+		planRequest
+		prefix int
+	}
+	var sizedRequests []sized
+	for _, r := range requests {
+		prefix, err := prefixForHosts(r.hosts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.name, err)
+		}
+		sizedRequests = append(sizedRequests, sized{planRequest: r, prefix: prefix})
+	}
+	sort.SliceStable(sizedRequests, func(i, j int) bool { return sizedRequests[i].prefix < sizedRequests[j].prefix })
+
+	// Allocating largest first keeps the cursor aligned for every
+	// following, smaller block.
+	cursor := uint64(parent.start)
+	subnets := make([]plannedSubnet, 0, len(sizedRequests))
+	for _, r := range sizedRequests {
+		size := uint64(1) << (32 - r.prefix)
+		if cursor+size-1 > uint64(parent.end) {
+			return nil, fmt.Errorf("not enough space in %s for %s (%d hosts, /%d)", parent, r.name, r.hosts, r.prefix)
+		}
+		subnets = append(subnets, describeSubnet(r.name, r.hosts, newCIDRRange(uint32(cursor), r.prefix)))
+		cursor += size
+	}
+	return subnets, nil
+}
+
+// describeSubnet returns the addressing details of a planned subnet.
+func describeSubnet(name string, hosts uint64, cidr CIDRRange) plannedSubnet {
+	subnet := plannedSubnet{
+		Name:    name,
+		Hosts:   hosts,
+		Network: cidr.String(),
+		Mask:    net.IP(cidr.ipNet.Mask).String(),
+	}
+	first, last := cidr.hostBounds()
+	if !cidr.isPointToPoint() {
+		subnet.Broadcast = formatIPv4(cidr.broadcast())
+	}
+	subnet.FirstHost = formatIPv4(first)
+	subnet.LastHost = formatIPv4(last)
+	subnet.Usable = uint64(last) - uint64(first) + 1
+	return subnet
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultPostgresBatchRows = 100000
+	postgresTimeout          = 30 * time.Second
+)
+
+// parsePostgresURL parses a PostgreSQL sink,
+// postgres://[user[:password]@]host[:port]/database[?sslmode=...], with the
+// connection string rules of libpq that pgx implements: the parts left out
+// default to the PG* environment variables, and sslmode to prefer, which
+// uses TLS when the server offers it without verifying it.
+func parsePostgresURL(output string) (*pgx.ConnConfig, error) {
+	config, err := pgx.ParseConfig(output)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output sink: %w (expected postgres://[user[:password]@]host[:port]/database)", err)
+	}
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = postgresTimeout
+	}
+	if config.RuntimeParams["application_name"] == "" {
+		config.RuntimeParams["application_name"] = "cidr-sensei"
+	}
+	return config, nil
+}
+
+// postgresWriter streams expanded IPs into a PostgreSQL table with COPY, in
+// transactions of -pg-batch-size rows, replacing the CSV export and \copy
+// two-step. The table is created, with an index on the integer form of the
+// addresses, if it does not exist, and rows are added to those already in
+// it. The columns are the ones SQLite output has, with -pg-typed making the
+// address an inet and the source block a cidr.
+type postgresWriter struct {
+	conn    *pgx.Conn
+	sources *sourceIndex
+	table   pgx.Identifier
+	typed   bool
+	rows    [][]any
+	batch   int
+}
+
+// postgresColumns are the columns of the table, in the order rows are
+// copied.
+var postgresColumns = []string{"address", "integer", "source", "tags"}
+
+// newPostgresWriter connects to the -output database and creates the table.
+func newPostgresWriter(config Config, cidrRanges []CIDRRange) (*postgresWriter, error) {
+	connConfig, err := parsePostgresURL(config.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+	if config.OutputTable == "" {
+		return nil, fmt.Errorf("the -output-table flag cannot be empty")
+	}
+	ctx := context.Background()
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to PostgreSQL at %s: %w", connConfig.Host, err)
+	}
+	w := &postgresWriter{
+		conn:    conn,
+		sources: newSourceIndex(config.Algorithm, cidrRanges),
+		table:   pgx.Identifier(strings.Split(config.OutputTable, ".")),
+		typed:   config.PostgresTyped,
+		batch:   max(config.PostgresBatchSize, 1),
+	}
+
+	table := w.table.Sanitize()
+	addressType, sourceType := "TEXT NOT NULL", "TEXT NOT NULL"
+	if config.PostgresTyped {
+		addressType, sourceType = "INET NOT NULL", "CIDR"
+	}
+	index := pgx.Identifier{w.table[len(w.table)-1] + "_integer"}.Sanitize()
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (address ` + addressType + `, integer BIGINT NOT NULL, source ` + sourceType + `, tags TEXT NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS ` + index + ` ON ` + table + ` (integer)`,
+	} {
+		if _, err := conn.Exec(ctx, statement); err != nil {
+			conn.Close(ctx)
+			return nil, fmt.Errorf("error creating table %s: %w", config.OutputTable, err)
+		}
+	}
+	return w, nil
+}
+
+// send adds the row of an IP to the batch, copying the batch once it is
+// full.
+func (w *postgresWriter) send(ip string) error {
+	n, source, tags, err := w.sources.describe(ip)
+	if err != nil {
+		return err
+	}
+	row := []any{ip, int64(n), source, tags}
+	if w.typed {
+		// The columns are inet and cidr, which pgx copies from netip values,
+		// and an IP without a source block has a null one
+		row[0], row[2] = netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}), nil
+		if source != "" {
+			row[2] = netip.MustParsePrefix(source)
+		}
+	}
+	w.rows = append(w.rows, row)
+	if len(w.rows) == w.batch {
+		return w.commit()
+	}
+	return nil
+}
+
+// commit copies the batch into the table, in a transaction of its own.
+func (w *postgresWriter) commit() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	_, err := w.conn.CopyFrom(context.Background(), w.table, postgresColumns, pgx.CopyFromRows(w.rows))
+	w.rows = w.rows[:0]
+	return err
+}
+
+// close commits the remaining rows and closes the connection.
+func (w *postgresWriter) close() error {
+	err := w.commit()
+	if closeErr := w.conn.Close(context.Background()); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakePostgres is a PostgreSQL server answering the statements and binary
+// COPYs of postgres:// output, which records the rows copied in each COPY.
+type fakePostgres struct {
+	addr       string
+	statements []string
+	copies     [][][]string
+	done       chan error
+}
+
+// postgresColumnOIDs are the types of the table columns -pg-typed creates.
+var postgresColumnOIDs = []uint32{pgtype.InetOID, pgtype.Int8OID, pgtype.CIDROID, pgtype.TextOID}
+
+func startFakePostgres(t *testing.T) *fakePostgres {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	pg := &fakePostgres{addr: l.Addr().String(), done: make(chan error, 1)}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			pg.done <- err
+			return
+		}
+		defer conn.Close()
+		pg.done <- pg.serve(pgproto3.NewBackend(conn, conn))
+	}()
+	return pg
+}
+
+func (pg *fakePostgres) serve(b *pgproto3.Backend) error {
+	if _, err := b.ReceiveStartupMessage(); err != nil {
+		return err
+	}
+	b.Send(&pgproto3.AuthenticationOk{})
+	b.Send(&pgproto3.ParameterStatus{Name: "server_version", Value: "17.0"})
+	b.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := b.Flush(); err != nil {
+		return err
+	}
+	for {
+		msg, err := b.Receive()
+		if err != nil {
+			return err
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			pg.statements = append(pg.statements, msg.String)
+			if strings.HasPrefix(msg.String, "copy ") {
+				rows, err := pg.receiveCopy(b)
+				if err != nil {
+					return err
+				}
+				pg.copies = append(pg.copies, rows)
+				b.Send(&pgproto3.CommandComplete{CommandTag: fmt.Appendf(nil, "COPY %d", len(rows))})
+			} else {
+				b.Send(&pgproto3.CommandComplete{CommandTag: []byte("CREATE")})
+			}
+			b.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		case *pgproto3.Parse:
+			pg.statements = append(pg.statements, msg.Query)
+			b.Send(&pgproto3.ParseComplete{})
+		case *pgproto3.Describe:
+			fields := make([]pgproto3.FieldDescription, len(postgresColumns))
+			for i, name := range postgresColumns {
+				fields[i] = pgproto3.FieldDescription{Name: []byte(name), DataTypeOID: postgresColumnOIDs[i], DataTypeSize: -1, TypeModifier: -1}
+			}
+			b.Send(&pgproto3.ParameterDescription{})
+			b.Send(&pgproto3.RowDescription{Fields: fields})
+		case *pgproto3.Sync:
+			b.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		case *pgproto3.Terminate:
+			return nil
+		default:
+			return fmt.Errorf("unexpected message %T", msg)
+		}
+		if err := b.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// receiveCopy reads a COPY in the binary format, decoding the fields of
+// each row with the types of postgresColumnOIDs.
+func (pg *fakePostgres) receiveCopy(b *pgproto3.Backend) ([][]string, error) {
+	b.Send(&pgproto3.CopyInResponse{OverallFormat: 1, ColumnFormatCodes: []uint16{1, 1, 1, 1}})
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	var data []byte
+	for {
+		msg, err := b.Receive()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := msg.(*pgproto3.CopyDone); ok {
+			break
+		}
+		copyData, ok := msg.(*pgproto3.CopyData)
+		if !ok {
+			return nil, fmt.Errorf("unexpected message %T in a COPY", msg)
+		}
+		data = append(data, copyData.Data...)
+	}
+
+	const header = "PGCOPY\n\377\r\n\000"
+	if !strings.HasPrefix(string(data), header) || len(data) < len(header)+8 {
+		return nil, errors.New("the COPY has no binary header")
+	}
+	data = data[len(header)+8:]
+	types := pgtype.NewMap()
+	var rows [][]string
+	// pgx ends the COPY without the trailer of a binary COPY file
+	for len(data) > 0 {
+		n := int16(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if n == -1 {
+			break
+		}
+		row := make([]string, n)
+		for i := range row {
+			size := int32(binary.BigEndian.Uint32(data))
+			data = data[4:]
+			if size == -1 {
+				row[i] = "NULL"
+				continue
+			}
+			var value any
+			if err := types.Scan(postgresColumnOIDs[i], pgtype.BinaryFormatCode, data[:size], &value); err != nil {
+				return nil, err
+			}
+			row[i] = fmt.Sprint(value)
+			data = data[size:]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func TestPostgresCopy(t *testing.T) {
+	pg := startFakePostgres(t)
+	config := Config{
+		OutputFormat:      "postgres://inventory@" + pg.addr + "/inventory?sslmode=disable",
+		OutputTable:       "net.ips",
+		PostgresTyped:     true,
+		PostgresBatchSize: 3,
+		Algorithm:         defaultAlgorithm,
+	}
+	blocks := testBlocks(t, "10.0.0.0/30")
+	w, err := newPostgresWriter(config, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "192.168.0.1"} {
+		if err := w.send(ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-pg.done; err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(pg.statements[0], `CREATE TABLE IF NOT EXISTS "net"."ips" (address INET NOT NULL`) {
+		t.Errorf("the table was created with %s", pg.statements[0])
+	}
+	// -pg-batch-size splits the 5 rows into a COPY of 3 and one of 2
+	want := [][][]string{
+		{{"10.0.0.0/32", "167772160", "10.0.0.0/30", ""}, {"10.0.0.1/32", "167772161", "10.0.0.0/30", ""}, {"10.0.0.2/32", "167772162", "10.0.0.0/30", ""}},
+		{{"10.0.0.3/32", "167772163", "10.0.0.0/30", ""}, {"192.168.0.1/32", "3232235521", "NULL", ""}},
+	}
+	if !slices.EqualFunc(pg.copies, want, func(a, b [][]string) bool { return slices.EqualFunc(a, b, slices.Equal) }) {
+		t.Errorf("the rows copied were %q, want %q", pg.copies, want)
+	}
+}
+
+func TestParsePostgresURL(t *testing.T) {
+	for _, tt := range []struct {
+		url              string
+		tls, skipVerify  bool
+		serverName, fail string
+	}{
+		{url: "postgres://u@db.internal/inventory?sslmode=disable"},
+		{url: "postgres://u@db.internal/inventory?sslmode=require", tls: true, skipVerify: true, serverName: "db.internal"},
+		{url: "postgres://u@db.internal/inventory?sslmode=verify-full", tls: true, serverName: "db.internal"},
+		{url: "postgres://u@db.internal/inventory?sslmode=on", fail: "sslmode is invalid"},
+	} {
+		config, err := parsePostgresURL(tt.url)
+		if tt.fail != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.fail) {
+				t.Errorf("parsePostgresURL(%s) failed with %v, want %q", tt.url, err, tt.fail)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tls := config.TLSConfig; (tls != nil) != tt.tls || tls != nil && (tls.InsecureSkipVerify != tt.skipVerify || tls.ServerName != tt.serverName) {
+			t.Errorf("parsePostgresURL(%s) has the TLS config %+v", tt.url, tls)
+		}
+		if config.User != "u" || config.Database != "inventory" || config.RuntimeParams["application_name"] != "cidr-sensei" {
+			t.Errorf("parsePostgresURL(%s) connects as %s to %s", tt.url, config.User, config.Database)
+		}
+	}
+}
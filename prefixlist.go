@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxPrefixListExpansion is the most prefixes a single prefix-list entry
+// may expand into, e.g. 10.0.0.0/8 le 28 would be 2^21.
+const maxPrefixListExpansion = 1 << 20
+
+// prefixListFirstLine matches the first line, that is not blank or a
+// comment, of a Cisco IOS, NX-OS or IOS XR prefix list or a Juniper
+// prefix-list or route-filter configuration.
+var prefixListFirstLine = regexp.MustCompile(`^(ipv?6? prefix-list |prefix-set |set policy-options |policy-options\s*\{|prefix-list \S+\s*\{)`)
+
+// prefixListItem is a prefix matched by a prefix list, along with the range
+// of prefix lengths the le, ge and eq modifiers, or Juniper's upto and
+// orlonger, allow.
+type prefixListItem struct {
+	text    string // the prefix as written
+	network uint32
+	length  int
+	minLen  int
+	maxLen  int
+}
+
+// readPrefixListEntries extracts the prefixes permitted by router prefix
+// lists, such as "ip prefix-list EDGE seq 5 permit 10.0.0.0/8 le 24", as
+// entries. Each entry with a range of lengths is expanded into every prefix
+// it covers, from 10.0.0.0/8 through the 65536 /24s within it. Deny entries
+// are skipped.
+func readPrefixListEntries(r io.Reader, name string) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1<<20)
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			origin := fmt.Sprintf("%s:%d", name, lineNum)
+			if !yieldPrefixList(scanner.Text(), origin, yield) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", name, err))
+		}
+	}
+}
+
+// yieldPrefixList yields the prefixes a line of a prefix list permits. It
+// returns false once yield asks to stop or an error was yielded.
+func yieldPrefixList(line, origin string, yield func(inputEntry, error) bool) bool {
+	items, err := prefixListItems(line)
+	if err != nil {
+		yield(inputEntry{}, fmt.Errorf("%s: %w", origin, err))
+		return false
+	}
+	for _, item := range items {
+		for prefix := range item.prefixes() {
+			if !yield(inputEntry{text: prefix, origin: origin}, nil) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// prefixListItems parses the prefixes in a line of a prefix list and their
+// modifiers.
+func prefixListItems(line string) ([]prefixListItem, error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "!") || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	line, _, _ = strings.Cut(line, "#")
+	tokens := strings.FieldsFunc(line, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ',' || r == ';' || r == '{' || r == '}'
+	})
+
+	var items []prefixListItem
+	for i := 0; i < len(tokens); i++ {
+		switch strings.ToLower(tokens[i]) {
+		case "description", "remark":
+			return items, nil
+		case "deny":
+			return items, nil
+		}
+		ip, ipNet, err := net.ParseCIDR(tokens[i])
+		if err != nil || ip.To4() == nil {
+			continue
+		}
+		length, _ := ipNet.Mask.Size()
+		item := prefixListItem{text: tokens[i], network: ipToUint(ip.To4()), length: length, minLen: length, maxLen: length}
+		n, err := item.parseModifiers(tokens[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", tokens[i], err)
+		}
+		i += n
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseModifiers applies the modifiers following a prefix and returns how
+// many tokens they took up.
+func (item *prefixListItem) parseModifiers(tokens []string) (int, error) {
+	ge, le := -1, -1
+	n := 0
+	for n < len(tokens) {
+		keyword := strings.ToLower(tokens[n])
+		switch keyword {
+		case "ge", "le", "eq", "upto", "prefix-length-range":
+			if n+1 >= len(tokens) {
+				return 0, fmt.Errorf("missing length after %s", keyword)
+			}
+			value := strings.TrimPrefix(tokens[n+1], "/")
+			if keyword == "prefix-length-range" {
+				low, high, ok := strings.Cut(value, "-")
+				var err error
+				if ge, err = parsePrefixLength(low); !ok || err != nil {
+					return 0, fmt.Errorf("invalid prefix-length-range %s", tokens[n+1])
+				}
+				if le, err = parsePrefixLength(strings.TrimPrefix(high, "/")); err != nil {
+					return 0, fmt.Errorf("invalid prefix-length-range %s", tokens[n+1])
+				}
+			} else {
+				length, err := parsePrefixLength(value)
+				if err != nil {
+					return 0, fmt.Errorf("invalid length after %s: %s", keyword, tokens[n+1])
+				}
+				switch keyword {
+				case "ge":
+					ge = length
+				case "le", "upto":
+					le = length
+				case "eq":
+					ge, le = length, length
+				}
+			}
+			n += 2
+		case "orlonger":
+			le = 32
+			n++
+		case "longer":
+			ge, le = item.length+1, 32
+			n++
+		case "exact":
+			n++
+		default:
+			return n, item.setLengths(ge, le)
+		}
+	}
+	return n, item.setLengths(ge, le)
+}
+
+// setLengths sets the range of lengths from ge and le, either of which is
+// -1 when not given. Only ge allows every longer prefix, as on Cisco.
+func (item *prefixListItem) setLengths(ge, le int) error {
+	switch {
+	case ge >= 0 && le >= 0:
+		item.minLen, item.maxLen = ge, le
+	case ge >= 0:
+		item.minLen, item.maxLen = ge, 32
+	case le >= 0:
+		item.maxLen = le
+	}
+	if item.minLen < item.length || item.minLen > item.maxLen {
+		return fmt.Errorf("lengths /%d to /%d are not within /%d to /32", item.minLen, item.maxLen, item.length)
+	}
+	if count := item.count(); count > maxPrefixListExpansion {
+		return fmt.Errorf("expands into %d prefixes, more than the limit of %d", count, maxPrefixListExpansion)
+	}
+	return nil
+}
+
+// parsePrefixLength parses a prefix length between 0 and 32.
+func parsePrefixLength(s string) (int, error) {
+	length, err := strconv.Atoi(s)
+	if err != nil || length < 0 || length > 32 {
+		return 0, fmt.Errorf("invalid prefix length %q", s)
+	}
+	return length, nil
+}
+
+// count returns the number of prefixes the item covers.
+func (item prefixListItem) count() uint64 {
+	var count uint64
+	for length := item.minLen; length <= item.maxLen; length++ {
+		count += 1 << (length - item.length)
+	}
+	return count
+}
+
+// prefixes returns every prefix the item covers, shortest first and in
+// address order within each length. A prefix matched exactly is returned as
+// written, so that it is normalized like any other entry.
+func (item prefixListItem) prefixes() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		if item.minLen == item.length && item.maxLen == item.length {
+			yield(item.text)
+			return
+		}
+		network := item.network &^ (uint32(1)<<(32-item.length) - 1)
+		for length := item.minLen; length <= item.maxLen; length++ {
+			for i := uint64(0); i < 1<<(length-item.length); i++ {
+				prefix := uint64(network) + i<<(32-length)
+				if !yield(formatIPv4(uint32(prefix)) + "/" + strconv.Itoa(length)) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,967 @@
+// The gRPC API of cidr-sensei serve and cidr-sensei daemon, which answer it
+// on the same port as the HTTP API. The Go stubs in this directory are
+// generated from this file with protoc-gen-go and protoc-gen-go-grpc, by
+// running make proto.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: cidrsensei/v1/cidrsensei.proto
+
+package cidrsenseiv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SetOpRequest_Operation int32
+
+const (
+	SetOpRequest_OPERATION_UNSPECIFIED SetOpRequest_Operation = 0
+	// The addresses in either a or b.
+	SetOpRequest_OPERATION_UNION SetOpRequest_Operation = 1
+	// The addresses in both a and b.
+	SetOpRequest_OPERATION_INTERSECT SetOpRequest_Operation = 2
+	// The addresses in a but not b.
+	SetOpRequest_OPERATION_SUBTRACT SetOpRequest_Operation = 3
+)
+
+// Enum value maps for SetOpRequest_Operation.
+var (
+	SetOpRequest_Operation_name = map[int32]string{
+		0: "OPERATION_UNSPECIFIED",
+		1: "OPERATION_UNION",
+		2: "OPERATION_INTERSECT",
+		3: "OPERATION_SUBTRACT",
+	}
+	SetOpRequest_Operation_value = map[string]int32{
+		"OPERATION_UNSPECIFIED": 0,
+		"OPERATION_UNION":       1,
+		"OPERATION_INTERSECT":   2,
+		"OPERATION_SUBTRACT":    3,
+	}
+)
+
+func (x SetOpRequest_Operation) Enum() *SetOpRequest_Operation {
+	p := new(SetOpRequest_Operation)
+	*p = x
+	return p
+}
+
+func (x SetOpRequest_Operation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SetOpRequest_Operation) Descriptor() protoreflect.EnumDescriptor {
+	return file_cidrsensei_v1_cidrsensei_proto_enumTypes[0].Descriptor()
+}
+
+func (SetOpRequest_Operation) Type() protoreflect.EnumType {
+	return &file_cidrsensei_v1_cidrsensei_proto_enumTypes[0]
+}
+
+func (x SetOpRequest_Operation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SetOpRequest_Operation.Descriptor instead.
+func (SetOpRequest_Operation) EnumDescriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{7, 0}
+}
+
+type ExpandRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cidrs         []string               `protobuf:"bytes,1,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	Exclude       []string               `protobuf:"bytes,2,rep,name=exclude,proto3" json:"exclude,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpandRequest) Reset() {
+	*x = ExpandRequest{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpandRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpandRequest) ProtoMessage() {}
+
+func (x *ExpandRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpandRequest.ProtoReflect.Descriptor instead.
+func (*ExpandRequest) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ExpandRequest) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+func (x *ExpandRequest) GetExclude() []string {
+	if x != nil {
+		return x.Exclude
+	}
+	return nil
+}
+
+type Address struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Address string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	// The address as an unsigned 32-bit integer.
+	Integer       uint32 `protobuf:"varint,2,opt,name=integer,proto3" json:"integer,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Address) Reset() {
+	*x = Address{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Address) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Address) ProtoMessage() {}
+
+func (x *Address) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Address.ProtoReflect.Descriptor instead.
+func (*Address) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Address) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Address) GetInteger() uint32 {
+	if x != nil {
+		return x.Integer
+	}
+	return 0
+}
+
+type AggregateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cidrs         []string               `protobuf:"bytes,1,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateRequest) Reset() {
+	*x = AggregateRequest{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateRequest) ProtoMessage() {}
+
+func (x *AggregateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateRequest.ProtoReflect.Descriptor instead.
+func (*AggregateRequest) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AggregateRequest) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+type AggregateResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cidrs         []string               `protobuf:"bytes,1,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	Addresses     uint64                 `protobuf:"varint,2,opt,name=addresses,proto3" json:"addresses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AggregateResponse) Reset() {
+	*x = AggregateResponse{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AggregateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AggregateResponse) ProtoMessage() {}
+
+func (x *AggregateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AggregateResponse.ProtoReflect.Descriptor instead.
+func (*AggregateResponse) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *AggregateResponse) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+func (x *AggregateResponse) GetAddresses() uint64 {
+	if x != nil {
+		return x.Addresses
+	}
+	return 0
+}
+
+type ContainsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cidrs         []string               `protobuf:"bytes,1,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	Ips           []string               `protobuf:"bytes,2,rep,name=ips,proto3" json:"ips,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ContainsRequest) Reset() {
+	*x = ContainsRequest{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ContainsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContainsRequest) ProtoMessage() {}
+
+func (x *ContainsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContainsRequest.ProtoReflect.Descriptor instead.
+func (*ContainsRequest) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ContainsRequest) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+func (x *ContainsRequest) GetIps() []string {
+	if x != nil {
+		return x.Ips
+	}
+	return nil
+}
+
+type ContainsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*ContainsResult      `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ContainsResponse) Reset() {
+	*x = ContainsResponse{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ContainsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContainsResponse) ProtoMessage() {}
+
+func (x *ContainsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContainsResponse.ProtoReflect.Descriptor instead.
+func (*ContainsResponse) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ContainsResponse) GetResults() []*ContainsResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type ContainsResult struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Ip        string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Contained bool                   `protobuf:"varint,2,opt,name=contained,proto3" json:"contained,omitempty"`
+	// The blocks containing the IP.
+	Cidrs         []string `protobuf:"bytes,3,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ContainsResult) Reset() {
+	*x = ContainsResult{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ContainsResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContainsResult) ProtoMessage() {}
+
+func (x *ContainsResult) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContainsResult.ProtoReflect.Descriptor instead.
+func (*ContainsResult) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ContainsResult) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *ContainsResult) GetContained() bool {
+	if x != nil {
+		return x.Contained
+	}
+	return false
+}
+
+func (x *ContainsResult) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+type SetOpRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Operation     SetOpRequest_Operation `protobuf:"varint,1,opt,name=operation,proto3,enum=cidrsensei.v1.SetOpRequest_Operation" json:"operation,omitempty"`
+	A             []string               `protobuf:"bytes,2,rep,name=a,proto3" json:"a,omitempty"`
+	B             []string               `protobuf:"bytes,3,rep,name=b,proto3" json:"b,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetOpRequest) Reset() {
+	*x = SetOpRequest{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetOpRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetOpRequest) ProtoMessage() {}
+
+func (x *SetOpRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetOpRequest.ProtoReflect.Descriptor instead.
+func (*SetOpRequest) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SetOpRequest) GetOperation() SetOpRequest_Operation {
+	if x != nil {
+		return x.Operation
+	}
+	return SetOpRequest_OPERATION_UNSPECIFIED
+}
+
+func (x *SetOpRequest) GetA() []string {
+	if x != nil {
+		return x.A
+	}
+	return nil
+}
+
+func (x *SetOpRequest) GetB() []string {
+	if x != nil {
+		return x.B
+	}
+	return nil
+}
+
+type SetOpResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cidrs         []string               `protobuf:"bytes,1,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	Addresses     uint64                 `protobuf:"varint,2,opt,name=addresses,proto3" json:"addresses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetOpResponse) Reset() {
+	*x = SetOpResponse{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetOpResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetOpResponse) ProtoMessage() {}
+
+func (x *SetOpResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetOpResponse.ProtoReflect.Descriptor instead.
+func (*SetOpResponse) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SetOpResponse) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+func (x *SetOpResponse) GetAddresses() uint64 {
+	if x != nil {
+		return x.Addresses
+	}
+	return 0
+}
+
+type SubmitJobRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// expand or aggregate.
+	Type    string   `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Cidrs   []string `protobuf:"bytes,2,rep,name=cidrs,proto3" json:"cidrs,omitempty"`
+	Exclude []string `protobuf:"bytes,3,rep,name=exclude,proto3" json:"exclude,omitempty"`
+	// The format of the result, json by default.
+	Output        string `protobuf:"bytes,4,opt,name=output,proto3" json:"output,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitJobRequest) Reset() {
+	*x = SubmitJobRequest{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobRequest) ProtoMessage() {}
+
+func (x *SubmitJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobRequest.ProtoReflect.Descriptor instead.
+func (*SubmitJobRequest) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SubmitJobRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest) GetCidrs() []string {
+	if x != nil {
+		return x.Cidrs
+	}
+	return nil
+}
+
+func (x *SubmitJobRequest) GetExclude() []string {
+	if x != nil {
+		return x.Exclude
+	}
+	return nil
+}
+
+func (x *SubmitJobRequest) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+type GetJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobRequest) Reset() {
+	*x = GetJobRequest{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobRequest) ProtoMessage() {}
+
+func (x *GetJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobRequest.ProtoReflect.Descriptor instead.
+func (*GetJobRequest) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CancelJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelJobRequest) Reset() {
+	*x = CancelJobRequest{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJobRequest) ProtoMessage() {}
+
+func (x *CancelJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJobRequest.ProtoReflect.Descriptor instead.
+func (*CancelJobRequest) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CancelJobRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Job struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type  string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	// queued, running, done, failed or canceled.
+	Status string `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Error  string `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// The name of the result file, downloaded from GET /jobs/{id}/result.
+	Result string `protobuf:"bytes,5,opt,name=result,proto3" json:"result,omitempty"`
+	// The number of addresses the blocks of the job cover.
+	Addresses uint64 `protobuf:"varint,6,opt,name=addresses,proto3" json:"addresses,omitempty"`
+	// RFC 3339 times.
+	Created       string `protobuf:"bytes,7,opt,name=created,proto3" json:"created,omitempty"`
+	Started       string `protobuf:"bytes,8,opt,name=started,proto3" json:"started,omitempty"`
+	Finished      string `protobuf:"bytes,9,opt,name=finished,proto3" json:"finished,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_cidrsensei_v1_cidrsensei_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Job) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetResult() string {
+	if x != nil {
+		return x.Result
+	}
+	return ""
+}
+
+func (x *Job) GetAddresses() uint64 {
+	if x != nil {
+		return x.Addresses
+	}
+	return 0
+}
+
+func (x *Job) GetCreated() string {
+	if x != nil {
+		return x.Created
+	}
+	return ""
+}
+
+func (x *Job) GetStarted() string {
+	if x != nil {
+		return x.Started
+	}
+	return ""
+}
+
+func (x *Job) GetFinished() string {
+	if x != nil {
+		return x.Finished
+	}
+	return ""
+}
+
+var File_cidrsensei_v1_cidrsensei_proto protoreflect.FileDescriptor
+
+const file_cidrsensei_v1_cidrsensei_proto_rawDesc = "" +
+	"\n" +
+	"\x1ecidrsensei/v1/cidrsensei.proto\x12\rcidrsensei.v1\"?\n" +
+	"\rExpandRequest\x12\x14\n" +
+	"\x05cidrs\x18\x01 \x03(\tR\x05cidrs\x12\x18\n" +
+	"\aexclude\x18\x02 \x03(\tR\aexclude\"=\n" +
+	"\aAddress\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x18\n" +
+	"\ainteger\x18\x02 \x01(\rR\ainteger\"(\n" +
+	"\x10AggregateRequest\x12\x14\n" +
+	"\x05cidrs\x18\x01 \x03(\tR\x05cidrs\"G\n" +
+	"\x11AggregateResponse\x12\x14\n" +
+	"\x05cidrs\x18\x01 \x03(\tR\x05cidrs\x12\x1c\n" +
+	"\taddresses\x18\x02 \x01(\x04R\taddresses\"9\n" +
+	"\x0fContainsRequest\x12\x14\n" +
+	"\x05cidrs\x18\x01 \x03(\tR\x05cidrs\x12\x10\n" +
+	"\x03ips\x18\x02 \x03(\tR\x03ips\"K\n" +
+	"\x10ContainsResponse\x127\n" +
+	"\aresults\x18\x01 \x03(\v2\x1d.cidrsensei.v1.ContainsResultR\aresults\"T\n" +
+	"\x0eContainsResult\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x1c\n" +
+	"\tcontained\x18\x02 \x01(\bR\tcontained\x12\x14\n" +
+	"\x05cidrs\x18\x03 \x03(\tR\x05cidrs\"\xdd\x01\n" +
+	"\fSetOpRequest\x12C\n" +
+	"\toperation\x18\x01 \x01(\x0e2%.cidrsensei.v1.SetOpRequest.OperationR\toperation\x12\f\n" +
+	"\x01a\x18\x02 \x03(\tR\x01a\x12\f\n" +
+	"\x01b\x18\x03 \x03(\tR\x01b\"l\n" +
+	"\tOperation\x12\x19\n" +
+	"\x15OPERATION_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fOPERATION_UNION\x10\x01\x12\x17\n" +
+	"\x13OPERATION_INTERSECT\x10\x02\x12\x16\n" +
+	"\x12OPERATION_SUBTRACT\x10\x03\"C\n" +
+	"\rSetOpResponse\x12\x14\n" +
+	"\x05cidrs\x18\x01 \x03(\tR\x05cidrs\x12\x1c\n" +
+	"\taddresses\x18\x02 \x01(\x04R\taddresses\"n\n" +
+	"\x10SubmitJobRequest\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x14\n" +
+	"\x05cidrs\x18\x02 \x03(\tR\x05cidrs\x12\x18\n" +
+	"\aexclude\x18\x03 \x03(\tR\aexclude\x12\x16\n" +
+	"\x06output\x18\x04 \x01(\tR\x06output\"\x1f\n" +
+	"\rGetJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\"\n" +
+	"\x10CancelJobRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\xdd\x01\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x16\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x16\n" +
+	"\x06result\x18\x05 \x01(\tR\x06result\x12\x1c\n" +
+	"\taddresses\x18\x06 \x01(\x04R\taddresses\x12\x18\n" +
+	"\acreated\x18\a \x01(\tR\acreated\x12\x18\n" +
+	"\astarted\x18\b \x01(\tR\astarted\x12\x1a\n" +
+	"\bfinished\x18\t \x01(\tR\bfinished2\xef\x03\n" +
+	"\n" +
+	"CIDRSensei\x12@\n" +
+	"\x06Expand\x12\x1c.cidrsensei.v1.ExpandRequest\x1a\x16.cidrsensei.v1.Address0\x01\x12N\n" +
+	"\tAggregate\x12\x1f.cidrsensei.v1.AggregateRequest\x1a .cidrsensei.v1.AggregateResponse\x12K\n" +
+	"\bContains\x12\x1e.cidrsensei.v1.ContainsRequest\x1a\x1f.cidrsensei.v1.ContainsResponse\x12B\n" +
+	"\x05SetOp\x12\x1b.cidrsensei.v1.SetOpRequest\x1a\x1c.cidrsensei.v1.SetOpResponse\x12@\n" +
+	"\tSubmitJob\x12\x1f.cidrsensei.v1.SubmitJobRequest\x1a\x12.cidrsensei.v1.Job\x12:\n" +
+	"\x06GetJob\x12\x1c.cidrsensei.v1.GetJobRequest\x1a\x12.cidrsensei.v1.Job\x12@\n" +
+	"\tCancelJob\x12\x1f.cidrsensei.v1.CancelJobRequest\x1a\x12.cidrsensei.v1.JobB@Z>github.com/ozfive/CIDR-Sensei/proto/cidrsensei/v1;cidrsenseiv1b\x06proto3"
+
+var (
+	file_cidrsensei_v1_cidrsensei_proto_rawDescOnce sync.Once
+	file_cidrsensei_v1_cidrsensei_proto_rawDescData []byte
+)
+
+func file_cidrsensei_v1_cidrsensei_proto_rawDescGZIP() []byte {
+	file_cidrsensei_v1_cidrsensei_proto_rawDescOnce.Do(func() {
+		file_cidrsensei_v1_cidrsensei_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_cidrsensei_v1_cidrsensei_proto_rawDesc), len(file_cidrsensei_v1_cidrsensei_proto_rawDesc)))
+	})
+	return file_cidrsensei_v1_cidrsensei_proto_rawDescData
+}
+
+var file_cidrsensei_v1_cidrsensei_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_cidrsensei_v1_cidrsensei_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_cidrsensei_v1_cidrsensei_proto_goTypes = []any{
+	(SetOpRequest_Operation)(0), // 0: cidrsensei.v1.SetOpRequest.Operation
+	(*ExpandRequest)(nil),       // 1: cidrsensei.v1.ExpandRequest
+	(*Address)(nil),             // 2: cidrsensei.v1.Address
+	(*AggregateRequest)(nil),    // 3: cidrsensei.v1.AggregateRequest
+	(*AggregateResponse)(nil),   // 4: cidrsensei.v1.AggregateResponse
+	(*ContainsRequest)(nil),     // 5: cidrsensei.v1.ContainsRequest
+	(*ContainsResponse)(nil),    // 6: cidrsensei.v1.ContainsResponse
+	(*ContainsResult)(nil),      // 7: cidrsensei.v1.ContainsResult
+	(*SetOpRequest)(nil),        // 8: cidrsensei.v1.SetOpRequest
+	(*SetOpResponse)(nil),       // 9: cidrsensei.v1.SetOpResponse
+	(*SubmitJobRequest)(nil),    // 10: cidrsensei.v1.SubmitJobRequest
+	(*GetJobRequest)(nil),       // 11: cidrsensei.v1.GetJobRequest
+	(*CancelJobRequest)(nil),    // 12: cidrsensei.v1.CancelJobRequest
+	(*Job)(nil),                 // 13: cidrsensei.v1.Job
+}
+var file_cidrsensei_v1_cidrsensei_proto_depIdxs = []int32{
+	7,  // 0: cidrsensei.v1.ContainsResponse.results:type_name -> cidrsensei.v1.ContainsResult
+	0,  // 1: cidrsensei.v1.SetOpRequest.operation:type_name -> cidrsensei.v1.SetOpRequest.Operation
+	1,  // 2: cidrsensei.v1.CIDRSensei.Expand:input_type -> cidrsensei.v1.ExpandRequest
+	3,  // 3: cidrsensei.v1.CIDRSensei.Aggregate:input_type -> cidrsensei.v1.AggregateRequest
+	5,  // 4: cidrsensei.v1.CIDRSensei.Contains:input_type -> cidrsensei.v1.ContainsRequest
+	8,  // 5: cidrsensei.v1.CIDRSensei.SetOp:input_type -> cidrsensei.v1.SetOpRequest
+	10, // 6: cidrsensei.v1.CIDRSensei.SubmitJob:input_type -> cidrsensei.v1.SubmitJobRequest
+	11, // 7: cidrsensei.v1.CIDRSensei.GetJob:input_type -> cidrsensei.v1.GetJobRequest
+	12, // 8: cidrsensei.v1.CIDRSensei.CancelJob:input_type -> cidrsensei.v1.CancelJobRequest
+	2,  // 9: cidrsensei.v1.CIDRSensei.Expand:output_type -> cidrsensei.v1.Address
+	4,  // 10: cidrsensei.v1.CIDRSensei.Aggregate:output_type -> cidrsensei.v1.AggregateResponse
+	6,  // 11: cidrsensei.v1.CIDRSensei.Contains:output_type -> cidrsensei.v1.ContainsResponse
+	9,  // 12: cidrsensei.v1.CIDRSensei.SetOp:output_type -> cidrsensei.v1.SetOpResponse
+	13, // 13: cidrsensei.v1.CIDRSensei.SubmitJob:output_type -> cidrsensei.v1.Job
+	13, // 14: cidrsensei.v1.CIDRSensei.GetJob:output_type -> cidrsensei.v1.Job
+	13, // 15: cidrsensei.v1.CIDRSensei.CancelJob:output_type -> cidrsensei.v1.Job
+	9,  // [9:16] is the sub-list for method output_type
+	2,  // [2:9] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_cidrsensei_v1_cidrsensei_proto_init() }
+func file_cidrsensei_v1_cidrsensei_proto_init() {
+	if File_cidrsensei_v1_cidrsensei_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_cidrsensei_v1_cidrsensei_proto_rawDesc), len(file_cidrsensei_v1_cidrsensei_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_cidrsensei_v1_cidrsensei_proto_goTypes,
+		DependencyIndexes: file_cidrsensei_v1_cidrsensei_proto_depIdxs,
+		EnumInfos:         file_cidrsensei_v1_cidrsensei_proto_enumTypes,
+		MessageInfos:      file_cidrsensei_v1_cidrsensei_proto_msgTypes,
+	}.Build()
+	File_cidrsensei_v1_cidrsensei_proto = out.File
+	file_cidrsensei_v1_cidrsensei_proto_goTypes = nil
+	file_cidrsensei_v1_cidrsensei_proto_depIdxs = nil
+}
@@ -0,0 +1,378 @@
+// The gRPC API of cidr-sensei serve and cidr-sensei daemon, which answer it
+// on the same port as the HTTP API. The Go stubs in this directory are
+// generated from this file with protoc-gen-go and protoc-gen-go-grpc, by
+// running make proto.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: cidrsensei/v1/cidrsensei.proto
+
+package cidrsenseiv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CIDRSensei_Expand_FullMethodName    = "/cidrsensei.v1.CIDRSensei/Expand"
+	CIDRSensei_Aggregate_FullMethodName = "/cidrsensei.v1.CIDRSensei/Aggregate"
+	CIDRSensei_Contains_FullMethodName  = "/cidrsensei.v1.CIDRSensei/Contains"
+	CIDRSensei_SetOp_FullMethodName     = "/cidrsensei.v1.CIDRSensei/SetOp"
+	CIDRSensei_SubmitJob_FullMethodName = "/cidrsensei.v1.CIDRSensei/SubmitJob"
+	CIDRSensei_GetJob_FullMethodName    = "/cidrsensei.v1.CIDRSensei/GetJob"
+	CIDRSensei_CancelJob_FullMethodName = "/cidrsensei.v1.CIDRSensei/CancelJob"
+)
+
+// CIDRSenseiClient is the client API for CIDRSensei service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CIDRSenseiClient interface {
+	// Expand streams each address of the blocks, less the excluded ones, in
+	// ascending order.
+	Expand(ctx context.Context, in *ExpandRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Address], error)
+	// Aggregate merges the blocks into the fewest blocks covering them.
+	Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResponse, error)
+	// Contains reports which of the blocks contain each IP.
+	Contains(ctx context.Context, in *ContainsRequest, opts ...grpc.CallOption) (*ContainsResponse, error)
+	// SetOp combines two lists of blocks.
+	SetOp(ctx context.Context, in *SetOpRequest, opts ...grpc.CallOption) (*SetOpResponse, error)
+	// SubmitJob queues an expansion or aggregation job, returning it queued.
+	// The job methods are only answered by cidr-sensei daemon.
+	SubmitJob(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// GetJob returns the status of a job.
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// CancelJob cancels a job that has not finished, or deletes a finished
+	// job and its result.
+	CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*Job, error)
+}
+
+type cIDRSenseiClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCIDRSenseiClient(cc grpc.ClientConnInterface) CIDRSenseiClient {
+	return &cIDRSenseiClient{cc}
+}
+
+func (c *cIDRSenseiClient) Expand(ctx context.Context, in *ExpandRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Address], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CIDRSensei_ServiceDesc.Streams[0], CIDRSensei_Expand_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExpandRequest, Address]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CIDRSensei_ExpandClient = grpc.ServerStreamingClient[Address]
+
+func (c *cIDRSenseiClient) Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AggregateResponse)
+	err := c.cc.Invoke(ctx, CIDRSensei_Aggregate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cIDRSenseiClient) Contains(ctx context.Context, in *ContainsRequest, opts ...grpc.CallOption) (*ContainsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ContainsResponse)
+	err := c.cc.Invoke(ctx, CIDRSensei_Contains_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cIDRSenseiClient) SetOp(ctx context.Context, in *SetOpRequest, opts ...grpc.CallOption) (*SetOpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetOpResponse)
+	err := c.cc.Invoke(ctx, CIDRSensei_SetOp_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cIDRSenseiClient) SubmitJob(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, CIDRSensei_SubmitJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cIDRSenseiClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, CIDRSensei_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cIDRSenseiClient) CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, CIDRSensei_CancelJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CIDRSenseiServer is the server API for CIDRSensei service.
+// All implementations must embed UnimplementedCIDRSenseiServer
+// for forward compatibility.
+type CIDRSenseiServer interface {
+	// Expand streams each address of the blocks, less the excluded ones, in
+	// ascending order.
+	Expand(*ExpandRequest, grpc.ServerStreamingServer[Address]) error
+	// Aggregate merges the blocks into the fewest blocks covering them.
+	Aggregate(context.Context, *AggregateRequest) (*AggregateResponse, error)
+	// Contains reports which of the blocks contain each IP.
+	Contains(context.Context, *ContainsRequest) (*ContainsResponse, error)
+	// SetOp combines two lists of blocks.
+	SetOp(context.Context, *SetOpRequest) (*SetOpResponse, error)
+	// SubmitJob queues an expansion or aggregation job, returning it queued.
+	// The job methods are only answered by cidr-sensei daemon.
+	SubmitJob(context.Context, *SubmitJobRequest) (*Job, error)
+	// GetJob returns the status of a job.
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// CancelJob cancels a job that has not finished, or deletes a finished
+	// job and its result.
+	CancelJob(context.Context, *CancelJobRequest) (*Job, error)
+	mustEmbedUnimplementedCIDRSenseiServer()
+}
+
+// UnimplementedCIDRSenseiServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCIDRSenseiServer struct{}
+
+func (UnimplementedCIDRSenseiServer) Expand(*ExpandRequest, grpc.ServerStreamingServer[Address]) error {
+	return status.Error(codes.Unimplemented, "method Expand not implemented")
+}
+func (UnimplementedCIDRSenseiServer) Aggregate(context.Context, *AggregateRequest) (*AggregateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Aggregate not implemented")
+}
+func (UnimplementedCIDRSenseiServer) Contains(context.Context, *ContainsRequest) (*ContainsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Contains not implemented")
+}
+func (UnimplementedCIDRSenseiServer) SetOp(context.Context, *SetOpRequest) (*SetOpResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetOp not implemented")
+}
+func (UnimplementedCIDRSenseiServer) SubmitJob(context.Context, *SubmitJobRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method SubmitJob not implemented")
+}
+func (UnimplementedCIDRSenseiServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedCIDRSenseiServer) CancelJob(context.Context, *CancelJobRequest) (*Job, error) {
+	return nil, status.Error(codes.Unimplemented, "method CancelJob not implemented")
+}
+func (UnimplementedCIDRSenseiServer) mustEmbedUnimplementedCIDRSenseiServer() {}
+func (UnimplementedCIDRSenseiServer) testEmbeddedByValue()                    {}
+
+// UnsafeCIDRSenseiServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CIDRSenseiServer will
+// result in compilation errors.
+type UnsafeCIDRSenseiServer interface {
+	mustEmbedUnimplementedCIDRSenseiServer()
+}
+
+func RegisterCIDRSenseiServer(s grpc.ServiceRegistrar, srv CIDRSenseiServer) {
+	// If the following call panics, it indicates UnimplementedCIDRSenseiServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CIDRSensei_ServiceDesc, srv)
+}
+
+func _CIDRSensei_Expand_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExpandRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CIDRSenseiServer).Expand(m, &grpc.GenericServerStream[ExpandRequest, Address]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CIDRSensei_ExpandServer = grpc.ServerStreamingServer[Address]
+
+func _CIDRSensei_Aggregate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AggregateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CIDRSenseiServer).Aggregate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CIDRSensei_Aggregate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CIDRSenseiServer).Aggregate(ctx, req.(*AggregateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CIDRSensei_Contains_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ContainsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CIDRSenseiServer).Contains(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CIDRSensei_Contains_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CIDRSenseiServer).Contains(ctx, req.(*ContainsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CIDRSensei_SetOp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CIDRSenseiServer).SetOp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CIDRSensei_SetOp_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CIDRSenseiServer).SetOp(ctx, req.(*SetOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CIDRSensei_SubmitJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CIDRSenseiServer).SubmitJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CIDRSensei_SubmitJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CIDRSenseiServer).SubmitJob(ctx, req.(*SubmitJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CIDRSensei_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CIDRSenseiServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CIDRSensei_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CIDRSenseiServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CIDRSensei_CancelJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CIDRSenseiServer).CancelJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CIDRSensei_CancelJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CIDRSenseiServer).CancelJob(ctx, req.(*CancelJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CIDRSensei_ServiceDesc is the grpc.ServiceDesc for CIDRSensei service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CIDRSensei_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cidrsensei.v1.CIDRSensei",
+	HandlerType: (*CIDRSenseiServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Aggregate",
+			Handler:    _CIDRSensei_Aggregate_Handler,
+		},
+		{
+			MethodName: "Contains",
+			Handler:    _CIDRSensei_Contains_Handler,
+		},
+		{
+			MethodName: "SetOp",
+			Handler:    _CIDRSensei_SetOp_Handler,
+		},
+		{
+			MethodName: "SubmitJob",
+			Handler:    _CIDRSensei_SubmitJob_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _CIDRSensei_GetJob_Handler,
+		},
+		{
+			MethodName: "CancelJob",
+			Handler:    _CIDRSensei_CancelJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Expand",
+			Handler:       _CIDRSensei_Expand_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "cidrsensei/v1/cidrsensei.proto",
+}
@@ -0,0 +1,5 @@
+// Package cidrsenseiv1 holds the stubs of the gRPC API of cidr-sensei
+// serve and cidr-sensei daemon, generated from cidrsensei.proto.
+package cidrsenseiv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative cidrsensei/v1/cidrsensei.proto
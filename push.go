@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const (
+	cloudflareAPI = "https://api.cloudflare.com/client/v4"
+	// cloudflarePageSize is the most list items Cloudflare returns per page,
+	// and cloudflareBatchSize the most pushed in one bulk operation.
+	cloudflarePageSize  = 500
+	cloudflareBatchSize = 1000
+	// cloudflareMinPrefix is the shortest IPv4 prefix a Cloudflare list
+	// accepts.
+	cloudflareMinPrefix = 8
+
+	// wafIPSetLimit is the most addresses an AWS WAF IP set holds.
+	wafIPSetLimit = 10000
+	wafTarget     = "AWSWAF_20190729."
+)
+
+// pushTarget is a remote IP list that -push keeps in sync with the blocks:
+// cloudflare://ACCOUNT_ID/LIST_ID for a Cloudflare IP list, or
+// wafv2://SCOPE/NAME/ID for an AWS WAF IP set, where SCOPE is REGIONAL or
+// CLOUDFRONT.
+type pushTarget struct {
+	kind string // "cloudflare" or "wafv2"
+
+	account, list string // Cloudflare
+
+	scope, name, id string // AWS WAF
+}
+
+// parsePushTarget parses a -push target.
+func parsePushTarget(s string) (pushTarget, error) {
+	kind, rest, _ := strings.Cut(s, "://")
+	parts := strings.Split(rest, "/")
+	switch {
+	case kind == "cloudflare" && len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return pushTarget{kind: kind, account: parts[0], list: parts[1]}, nil
+	case kind == "wafv2" && len(parts) == 3 && (parts[0] == "REGIONAL" || parts[0] == "CLOUDFRONT") && parts[1] != "" && parts[2] != "":
+		return pushTarget{kind: kind, scope: parts[0], name: parts[1], id: parts[2]}, nil
+	}
+	return pushTarget{}, fmt.Errorf("invalid -push target: %s (expected cloudflare://ACCOUNT_ID/LIST_ID or wafv2://REGIONAL|CLOUDFRONT/NAME/ID)", s)
+}
+
+// pushDiff is what changes in a remote list: the blocks to add, and the
+// blocks to remove along with the remote IDs of their items, if any.
+type pushDiff struct {
+	add    []string
+	remove map[string]string
+}
+
+// diffPush compares the blocks wanted in a list with those it holds, keyed
+// by block and mapped to the ID of their item.
+func diffPush(want []string, have map[string]string) pushDiff {
+	diff := pushDiff{remove: make(map[string]string)}
+	wanted := make(map[string]bool, len(want))
+	for _, block := range want {
+		wanted[block] = true
+		if _, ok := have[block]; !ok {
+			diff.add = append(diff.add, block)
+		}
+	}
+	for block, id := range have {
+		if !wanted[block] {
+			diff.remove[block] = id
+		}
+	}
+	return diff
+}
+
+// removed returns the blocks to remove in ascending order.
+func (d pushDiff) removed() []string {
+	blocks := make([]string, 0, len(d.remove))
+	for block := range d.remove {
+		blocks = append(blocks, block)
+	}
+	slices.SortFunc(blocks, compareCIDRText)
+	return blocks
+}
+
+// compareCIDRText orders CIDR blocks by address and then prefix.
+func compareCIDRText(a, b string) int {
+	ca, errA := parseCIDR(a)
+	cb, errB := parseCIDR(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	if ca.start != cb.start {
+		return int(int64(ca.start) - int64(cb.start))
+	}
+	return int(int64(cb.end) - int64(ca.end))
+}
+
+// canonicalBlock returns a remote list item as a CIDR block, as lists give
+// single addresses without a prefix.
+func canonicalBlock(item string) string {
+	if !strings.Contains(item, "/") {
+		item += "/32"
+	}
+	if cidr, err := parseCIDR(item); err == nil {
+		return cidr.String()
+	}
+	return item
+}
+
+// runPush brings the -push list in line with the merged CIDR blocks, adding
+// and removing only the blocks that differ. The changes are printed as
+// "+ block" and "- block" lines, and with -push-dry-run nothing else is
+// done.
+func runPush(ctx context.Context, config Config, fetcher *fetcher, cidrRanges []CIDRRange) error {
+	target, err := parsePushTarget(config.Push)
+	if err != nil {
+		return err
+	}
+	blocks := rangesToCIDRs(mergeIPRanges(toIPRanges(cidrRanges)))
+
+	var push func(diff pushDiff) error
+	var diff pushDiff
+	switch target.kind {
+	case "cloudflare":
+		client, err := newCloudflareClient(fetcher)
+		if err != nil {
+			return err
+		}
+		have, err := client.listItems(ctx, target)
+		if err != nil {
+			return err
+		}
+		diff = diffPush(cloudflareBlocks(blocks), have)
+		push = func(diff pushDiff) error { return client.apply(ctx, target, diff) }
+	case "wafv2":
+		if len(blocks) > wafIPSetLimit {
+			return fmt.Errorf("the %d blocks are more than the %d an AWS WAF IP set holds", len(blocks), wafIPSetLimit)
+		}
+		client, err := newWAFClient(ctx, fetcher, target)
+		if err != nil {
+			return err
+		}
+		have, lockToken, err := client.getIPSet(ctx, target)
+		if err != nil {
+			return err
+		}
+		want := make([]string, 0, len(blocks))
+		for _, block := range blocks {
+			want = append(want, block.String())
+		}
+		diff = diffPush(want, have)
+		push = func(pushDiff) error { return client.updateIPSet(ctx, target, want, lockToken) }
+	}
+
+	for _, block := range diff.add {
+		fmt.Printf("+ %s\n", block)
+	}
+	for _, block := range diff.removed() {
+		fmt.Printf("- %s\n", block)
+	}
+	fmt.Printf("%s: %d to add, %d to remove\n", config.Push, len(diff.add), len(diff.remove))
+	if config.PushDryRun || len(diff.add)+len(diff.remove) == 0 {
+		return nil
+	}
+	return push(diff)
+}
+
+// cloudflareBlocks returns the blocks a Cloudflare list can hold them as,
+// splitting blocks shorter than a /8 into /8s.
+func cloudflareBlocks(blocks []CIDRRange) []string {
+	var items []string
+	for _, block := range blocks {
+		prefix, _ := block.ipNet.Mask.Size()
+		if prefix < cloudflareMinPrefix {
+			for start := uint64(block.start); start <= uint64(block.end); start += 1 << (32 - cloudflareMinPrefix) {
+				items = append(items, newCIDRRange(uint32(start), cloudflareMinPrefix).String())
+			}
+			continue
+		}
+		items = append(items, block.String())
+	}
+	return items
+}
+
+// cloudflareClient calls the Cloudflare API with the token in
+// CLOUDFLARE_API_TOKEN. Requests go to CLOUDFLARE_API_URL instead when set.
+type cloudflareClient struct {
+	fetcher  *fetcher
+	endpoint string
+	token    string
+}
+
+func newCloudflareClient(fetcher *fetcher) (*cloudflareClient, error) {
+	token := os.Getenv("CLOUDFLARE_API_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("pushing to Cloudflare needs an API token with List edit permission in CLOUDFLARE_API_TOKEN")
+	}
+	endpoint := cloudflareAPI
+	if override := os.Getenv("CLOUDFLARE_API_URL"); override != "" {
+		endpoint = strings.TrimSuffix(override, "/")
+	}
+	return &cloudflareClient{fetcher: fetcher, endpoint: endpoint, token: token}, nil
+}
+
+// cloudflareResponse is the envelope of every Cloudflare API response.
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo struct {
+		Cursors struct {
+			After string `json:"after"`
+		} `json:"cursors"`
+	} `json:"result_info"`
+}
+
+// call makes an API request and returns its response, retrying failures
+// worth retrying.
+func (c *cloudflareClient) call(ctx context.Context, method, path string, body any) (*cloudflareResponse, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	name := "Cloudflare API " + method + " " + path
+	var result cloudflareResponse
+	err := c.fetcher.retry(ctx, func() (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, bytes.NewReader(payload))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.fetcher.client.Do(req)
+		if err != nil {
+			return ctx.Err() == nil, fmt.Errorf("error calling %s: %w", name, err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return true, fmt.Errorf("error calling %s: %w", name, err)
+		}
+		result = cloudflareResponse{}
+		if err := json.Unmarshal(data, &result); err != nil || !result.Success {
+			retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+			detail := strings.TrimSpace(string(data[:min(len(data), 512)]))
+			if len(result.Errors) > 0 {
+				detail = fmt.Sprintf("%s (code %d)", result.Errors[0].Message, result.Errors[0].Code)
+			}
+			return retry, &httpStatusError{name: name, status: resp.Status, header: resp.Header, detail: detail}
+		}
+		return false, nil
+	})
+	return &result, err
+}
+
+// listItems returns the blocks in the list, mapped to their item IDs, going
+// through every page.
+func (c *cloudflareClient) listItems(ctx context.Context, target pushTarget) (map[string]string, error) {
+	items := make(map[string]string)
+	cursor := ""
+	for {
+		query := url.Values{"per_page": {fmt.Sprint(cloudflarePageSize)}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		resp, err := c.call(ctx, http.MethodGet, c.itemsPath(target)+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		var page []struct {
+			ID string `json:"id"`
+			IP string `json:"ip"`
+		}
+		if err := json.Unmarshal(resp.Result, &page); err != nil {
+			return nil, fmt.Errorf("error parsing the items of Cloudflare list %s: %w", target.list, err)
+		}
+		for _, item := range page {
+			if item.IP != "" {
+				items[canonicalBlock(item.IP)] = item.ID
+			}
+		}
+		cursor = resp.ResultInfo.Cursors.After
+		if cursor == "" || len(page) == 0 {
+			return items, nil
+		}
+	}
+}
+
+func (c *cloudflareClient) itemsPath(target pushTarget) string {
+	return fmt.Sprintf("/accounts/%s/rules/lists/%s/items", url.PathEscape(target.account), url.PathEscape(target.list))
+}
+
+// apply adds and removes list items in batches, giving single addresses
+// without a prefix as Cloudflare lists hold them. Cloudflare runs each batch
+// as an asynchronous bulk operation, and only one at a time per account, so
+// each is waited for before the next.
+func (c *cloudflareClient) apply(ctx context.Context, target pushTarget, diff pushDiff) error {
+	for batch := range slices.Chunk(diff.add, cloudflareBatchSize) {
+		items := make([]map[string]string, 0, len(batch))
+		for _, block := range batch {
+			items = append(items, map[string]string{"ip": strings.TrimSuffix(block, "/32"), "comment": "cidr-sensei"})
+		}
+		if err := c.bulk(ctx, http.MethodPost, target, items); err != nil {
+			return err
+		}
+	}
+	for batch := range slices.Chunk(diff.removed(), cloudflareBatchSize) {
+		items := make([]map[string]string, 0, len(batch))
+		for _, block := range batch {
+			items = append(items, map[string]string{"id": diff.remove[block]})
+		}
+		if err := c.bulk(ctx, http.MethodDelete, target, map[string]any{"items": items}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bulk starts a bulk operation on the list items and waits for it to
+// finish.
+func (c *cloudflareClient) bulk(ctx context.Context, method string, target pushTarget, body any) error {
+	resp, err := c.call(ctx, method, c.itemsPath(target), body)
+	if err != nil {
+		return err
+	}
+	var operation struct {
+		ID string `json:"operation_id"`
+	}
+	if err := json.Unmarshal(resp.Result, &operation); err != nil || operation.ID == "" {
+		return nil
+	}
+	for {
+		resp, err := c.call(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/rules/lists/bulk_operations/%s", url.PathEscape(target.account), url.PathEscape(operation.ID)), nil)
+		if err != nil {
+			return err
+		}
+		var status struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := json.Unmarshal(resp.Result, &status); err != nil {
+			return fmt.Errorf("error parsing Cloudflare bulk operation %s: %w", operation.ID, err)
+		}
+		switch status.Status {
+		case "completed":
+			return nil
+		case "failed":
+			return fmt.Errorf("Cloudflare bulk operation %s failed: %s", operation.ID, status.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// wafClient calls the AWS WAF API with the credentials and region found the
+// way the AWS CLI finds them, signing its requests with the SDK's SigV4
+// signer. CloudFront IP sets live in us-east-1. Requests go to
+// AWS_ENDPOINT_URL_WAFV2 or AWS_ENDPOINT_URL instead when set.
+type wafClient struct {
+	fetcher  *fetcher
+	creds    aws.Credentials
+	signer   *v4.Signer
+	region   string
+	endpoint string
+}
+
+func newWAFClient(ctx context.Context, fetcher *fetcher, target pushTarget) (*wafClient, error) {
+	cfg, err := loadAWSConfig(ctx, fetcher, false)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pushing to AWS WAF needs AWS credentials: %w", err)
+	}
+	region := cfg.Region
+	if target.scope == "CLOUDFRONT" {
+		region = "us-east-1"
+	}
+	endpoint := firstEnv("AWS_ENDPOINT_URL_WAFV2", "AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://wafv2.%s.amazonaws.com", region)
+	}
+	return &wafClient{fetcher: fetcher, creds: creds, signer: v4.NewSigner(), region: region, endpoint: strings.TrimSuffix(endpoint, "/") + "/"}, nil
+}
+
+// call makes a signed request for the action and decodes its response into
+// v, retrying failures worth retrying.
+func (c *wafClient) call(ctx context.Context, action string, body, v any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	name := "AWS WAF " + action
+	return c.fetcher.retry(ctx, func() (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", wafTarget+action)
+		if err := c.signer.SignHTTP(ctx, c.creds, req, payloadHash, "wafv2", c.region, time.Now()); err != nil {
+			return false, err
+		}
+		resp, err := c.fetcher.client.Do(req)
+		if err != nil {
+			return ctx.Err() == nil, fmt.Errorf("error calling %s: %w", name, err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return true, fmt.Errorf("error calling %s: %w", name, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			var failure struct {
+				Type    string `json:"__type"`
+				Message string `json:"message"`
+			}
+			detail := strings.TrimSpace(string(data[:min(len(data), 512)]))
+			if json.Unmarshal(data, &failure) == nil && failure.Message != "" {
+				detail = failure.Type + ": " + failure.Message
+			}
+			retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+			return retry, &httpStatusError{name: name, status: resp.Status, header: resp.Header, detail: detail}
+		}
+		return false, json.Unmarshal(data, v)
+	})
+}
+
+// getIPSet returns the blocks in the IP set and the lock token to update it
+// with.
+func (c *wafClient) getIPSet(ctx context.Context, target pushTarget) (map[string]string, string, error) {
+	var resp struct {
+		IPSet struct {
+			Addresses []string `json:"Addresses"`
+		} `json:"IPSet"`
+		LockToken string `json:"LockToken"`
+	}
+	if err := c.call(ctx, "GetIPSet", map[string]string{"Name": target.name, "Scope": target.scope, "Id": target.id}, &resp); err != nil {
+		return nil, "", err
+	}
+	have := make(map[string]string, len(resp.IPSet.Addresses))
+	for _, address := range resp.IPSet.Addresses {
+		have[canonicalBlock(address)] = ""
+	}
+	return have, resp.LockToken, nil
+}
+
+// updateIPSet replaces the addresses of the IP set. AWS WAF only takes the
+// whole list, so the lock token of the read makes the update fail rather
+// than undo a change made since.
+func (c *wafClient) updateIPSet(ctx context.Context, target pushTarget, addresses []string, lockToken string) error {
+	body := map[string]any{
+		"Name":      target.name,
+		"Scope":     target.scope,
+		"Id":        target.id,
+		"Addresses": addresses,
+		"LockToken": lockToken,
+	}
+	var resp struct{}
+	return c.call(ctx, "UpdateIPSet", body, &resp)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+// ipRange is an inclusive range of IPv4 addresses used for set arithmetic.
+type ipRange = cidrsensei.Range
+
+// toIPRanges returns the address range covered by each CIDR range.
+func toIPRanges(cidrRanges []CIDRRange) []ipRange {
+	ranges := make([]ipRange, 0, len(cidrRanges))
+	for _, cidr := range cidrRanges {
+		ranges = append(ranges, ipRange{Start: cidr.start, End: cidr.end})
+	}
+	return ranges
+}
+
+// mergeIPRanges sorts the ranges and merges any that overlap or are adjacent.
+func mergeIPRanges(ranges []ipRange) []ipRange {
+	return cidrsensei.Merge(ranges)
+}
+
+// mergeCIDRRanges returns the fewest CIDR blocks covering the addresses of
+// the CIDR ranges, traced as a span of ctx.
+func mergeCIDRRanges(ctx context.Context, cidrRanges []CIDRRange) []CIDRRange {
+	_, span := startSpan(ctx, spanInternal, "merge", slog.Int("blocks", len(cidrRanges)))
+	merged := rangesToCIDRs(mergeIPRanges(toIPRanges(cidrRanges)))
+	span.set(slog.Int("merged_blocks", len(merged)))
+	span.finish(nil)
+	return merged
+}
+
+// subtractIPRanges removes every address in exclude from ranges.
+func subtractIPRanges(ranges, exclude []ipRange) []ipRange {
+	return cidrsensei.Subtract(ranges, exclude)
+}
+
+// totalSize returns the number of addresses in the ranges.
+func totalSize(ranges []ipRange) uint64 {
+	return cidrsensei.Size(ranges)
+}
+
+// excludeCIDRRanges removes the excluded addresses from each CIDR range,
+// splitting a range into several when an exclusion falls inside it. The
+// resulting ranges keep the block they originated from. exclude must already
+// be merged.
+func excludeCIDRRanges(cidrRanges []CIDRRange, exclude []ipRange) []CIDRRange {
+	if len(exclude) == 0 {
+		return cidrRanges
+	}
+
+	var result []CIDRRange
+	for _, cidr := range cidrRanges {
+		remaining := subtractIPRanges([]ipRange{{Start: cidr.start, End: cidr.end}}, exclude)
+		for _, r := range remaining {
+			part := cidr
+			part.start, part.end, part.length = r.Start, r.End, r.End-r.Start+1
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// dedupeCIDRRanges drops every range that covers exactly the same addresses
+// as an earlier one, such as a block listed in several input files. Ranges
+// that only overlap are kept.
+func dedupeCIDRRanges(cidrRanges []CIDRRange) []CIDRRange {
+	seen := make(map[ipRange]bool, len(cidrRanges))
+	deduped := make([]CIDRRange, 0, len(cidrRanges))
+	for _, cidr := range cidrRanges {
+		key := ipRange{Start: cidr.start, End: cidr.end}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, cidr)
+	}
+	return deduped
+}
+
+// rangeIndex maps positions in the deterministic expansion order of a set of
+// merged ranges to addresses, without iterating over the ranges.
+type rangeIndex struct {
+	ranges  []ipRange
+	offsets []uint64 // offsets[i] is the position of ranges[i].start
+	total   uint64
+}
+
+// newRangeIndex builds a rangeIndex over ranges, which must already be merged.
+func newRangeIndex(ranges []ipRange) *rangeIndex {
+	index := &rangeIndex{ranges: ranges, offsets: make([]uint64, len(ranges))}
+	for i, r := range ranges {
+		index.offsets[i] = index.total
+		index.total += r.Size()
+	}
+	return index
+}
+
+// addressAt returns the address at position pos, which must be less than
+// the total number of addresses in the index.
+func (x *rangeIndex) addressAt(pos uint64) uint32 {
+	i := x.rangeAt(pos)
+	return x.ranges[i].Start + uint32(pos-x.offsets[i])
+}
+
+// positionOf returns the position of the first address at or after ip, and
+// whether that address is ip. The position is the total number of addresses
+// when every address is before ip.
+func (x *rangeIndex) positionOf(ip uint32) (uint64, bool) {
+	i := sort.Search(len(x.ranges), func(i int) bool { return x.ranges[i].End >= ip })
+	if i == len(x.ranges) {
+		return x.total, false
+	}
+	if ip < x.ranges[i].Start {
+		return x.offsets[i], false
+	}
+	return x.offsets[i] + uint64(ip-x.ranges[i].Start), true
+}
+
+// rangeAt returns the index of the range containing position pos.
+func (x *rangeIndex) rangeAt(pos uint64) int {
+	return sort.Search(len(x.offsets), func(i int) bool { return x.offsets[i] > pos }) - 1
+}
+
+// rangeToCIDRs returns the minimal list of CIDR blocks that exactly cover r.
+func rangeToCIDRs(r ipRange) []CIDRRange {
+	var cidrRanges []CIDRRange
+	for _, prefix := range r.Prefixes() {
+		cidrRanges = append(cidrRanges, newCIDRRange(cidrsensei.Uint32(prefix.Addr()), prefix.Bits()))
+	}
+	return cidrRanges
+}
+
+// isAddressRange reports whether entry is an inclusive range of addresses
+// such as 10.0.0.1-10.0.0.9.
+func isAddressRange(entry string) bool {
+	first, last, ok := strings.Cut(entry, "-")
+	return ok && isIPv4(first) && isIPv4(last)
+}
+
+// parseAddressRange parses an address range into the CIDR blocks covering
+// it exactly.
+func parseAddressRange(entry string) ([]CIDRRange, error) {
+	first, last, _ := strings.Cut(entry, "-")
+	start, end := ipToUint(net.ParseIP(first)), ipToUint(net.ParseIP(last))
+	if start > end {
+		return nil, fmt.Errorf("error parsing address range %s: %s is after %s", entry, first, last)
+	}
+	return rangeToCIDRs(ipRange{Start: start, End: end}), nil
+}
+
+// rangesToCIDRs returns the minimal list of CIDR blocks that exactly cover
+// the ranges, which must already be merged.
+func rangesToCIDRs(ranges []ipRange) []CIDRRange {
+	var cidrRanges []CIDRRange
+	for _, r := range ranges {
+		cidrRanges = append(cidrRanges, rangeToCIDRs(r)...)
+	}
+	return cidrRanges
+}
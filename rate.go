@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits events to a rate a second, shared by every goroutine
+// taking from it. The bucket holds up to burst tokens, refilled at rate a
+// second, and each event takes one, waiting for it when the bucket is
+// empty.
+type tokenBucket struct {
+	rate, burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket of rate tokens a second, holding a
+// tenth of a second's worth, and at least one.
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := max(rate/10, 1)
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve takes a token, and returns how long to wait before using it.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	// The token taken from an empty bucket is owed, so that the goroutines
+	// waiting for one are each given their own.
+	b.tokens--
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// rateLimited returns emit, passing at most -rate IPs a second to it, and
+// stopping the expansion with errInterrupted when ctx is done while
+// waiting. The IPs emitted are flushed out with flush before waiting, so
+// that the system they feed receives them as they are paced rather than in
+// bursts of a buffer at a time.
+func rateLimited(ctx context.Context, rate float64, flush func() error, emit func(string) error) func(string) error {
+	bucket := newTokenBucket(rate)
+	return func(ip string) error {
+		if wait := bucket.reserve(); wait > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return errInterrupted
+			}
+		}
+		return emit(ip)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisTypes lists the values of -redis-type.
+var redisTypes = []string{"set", "bitmap"}
+
+const (
+	defaultRedisKey       = "cidr-sensei:ips"
+	defaultRedisBatchSize = 10000
+	defaultRedisPort      = "6379"
+	// redisMembersPerCommand is the most members given to one SADD.
+	redisMembersPerCommand = 1000
+	redisTimeout           = 30 * time.Second
+)
+
+// redisTarget is where a redis:// or rediss:// (TLS) sink connects:
+// redis://[[user]:password@]host[:port][/db].
+type redisTarget struct {
+	address  string
+	tls      bool
+	user     string
+	password string
+	db       int
+}
+
+// parseRedisURL parses a Redis sink.
+func parseRedisURL(output string) (redisTarget, error) {
+	invalid := fmt.Errorf("invalid output sink: %s (expected redis://[[user]:password@]host[:port][/db])", output)
+	u, err := url.Parse(output)
+	if err != nil || u.Hostname() == "" {
+		return redisTarget{}, invalid
+	}
+	target := redisTarget{tls: u.Scheme == "rediss"}
+	port := u.Port()
+	if port == "" {
+		port = defaultRedisPort
+	}
+	target.address = net.JoinHostPort(u.Hostname(), port)
+	if u.User != nil {
+		target.user = u.User.Username()
+		target.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if target.db, err = strconv.Atoi(db); err != nil || target.db < 0 {
+			return redisTarget{}, invalid
+		}
+	}
+	return target, nil
+}
+
+// redisSink writes the IPs into a Redis set, or a bitmap with the bit of
+// each IP's integer value set, so that SISMEMBER or GETBIT answers whether
+// an address is in the expansion. The IPs are written to a temporary key in
+// pipelined batches and renamed over -redis-key when the output is closed,
+// so that readers never see a partial expansion. SADD and SETBIT can be
+// repeated safely, so a batch lost with its connection is sent again on a
+// new one, up to retries times.
+type redisSink struct {
+	target  redisTarget
+	kind    string
+	key     string
+	tempKey string
+	batch   int
+	retries int
+
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	pending []string
+	count   int
+}
+
+// newRedisSink connects to the -output Redis server.
+func newRedisSink(config Config) (*redisSink, error) {
+	target, err := parseRedisURL(config.OutputFormat)
+	if err != nil {
+		return nil, err
+	}
+	s := &redisSink{
+		target:  target,
+		kind:    config.RedisType,
+		key:     config.RedisKey,
+		tempKey: fmt.Sprintf("%s:cidr-sensei-%d-%d", config.RedisKey, os.Getpid(), time.Now().UnixNano()),
+		batch:   max(config.RedisBatchSize, 1),
+		retries: config.SinkRetries,
+	}
+	if err := s.do([][]string{{"DEL", s.tempKey}}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect connects to the server, authenticates and selects the database.
+func (s *redisSink) connect() error {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if s.target.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.target.address, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", s.target.address)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to Redis at %s: %w", s.target.address, err)
+	}
+	s.conn, s.r, s.w = conn, bufio.NewReader(conn), bufio.NewWriter(conn)
+
+	var setup [][]string
+	if s.target.password != "" {
+		if s.target.user != "" {
+			setup = append(setup, []string{"AUTH", s.target.user, s.target.password})
+		} else {
+			setup = append(setup, []string{"AUTH", s.target.password})
+		}
+	}
+	if s.target.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.target.db)})
+	}
+	if len(setup) > 0 {
+		if err := s.pipeline(setup); err != nil {
+			conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// retry calls attempt, connecting first, until it succeeds or has been
+// retried s.retries times. Errors returned by the server are not retried.
+func (s *redisSink) retry(attempt func() error) error {
+	var err error
+	for i := 0; i <= s.retries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(1<<(i-1)) * 500 * time.Millisecond)
+		}
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				if _, ok := err.(redisError); ok {
+					return err
+				}
+				continue
+			}
+		}
+		if err = attempt(); err == nil {
+			return nil
+		}
+		if _, ok := err.(redisError); ok {
+			return err
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return fmt.Errorf("%w (after %d attempts)", err, s.retries+1)
+}
+
+// do sends commands in one pipelined round trip, connecting first, and
+// retrying on a new connection if it is lost.
+func (s *redisSink) do(commands [][]string) error {
+	return s.retry(func() error { return s.pipeline(commands) })
+}
+
+// pipeline writes commands and reads their replies, returning the first
+// error reply as a redisError.
+func (s *redisSink) pipeline(commands [][]string) error {
+	s.conn.SetDeadline(time.Now().Add(redisTimeout))
+	for _, args := range commands {
+		fmt.Fprintf(s.w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(s.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	var firstErr error
+	for range commands {
+		reply, err := readRedisReply(s.r)
+		if err != nil {
+			return err
+		}
+		if replyErr, ok := reply.(redisError); ok && firstErr == nil {
+			firstErr = replyErr
+		}
+	}
+	return firstErr
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "Redis: " + string(e) }
+
+// readRedisReply reads a RESP reply: a status or bulk string, an integer, an
+// array of replies, nil or a redisError.
+func readRedisReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("invalid Redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("invalid Redis reply: %q", line)
+}
+
+// send queues an IP, writing the queue once a batch is full.
+func (s *redisSink) send(ip string) error {
+	if s.kind == "bitmap" {
+		n, err := parseIPv4(ip)
+		if err != nil {
+			return err
+		}
+		ip = strconv.FormatUint(uint64(n), 10)
+	}
+	s.pending = append(s.pending, ip)
+	s.count++
+	if len(s.pending) >= s.batch {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush writes the queued IPs with SADD commands of up to
+// redisMembersPerCommand members, or a SETBIT command each.
+func (s *redisSink) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	var commands [][]string
+	if s.kind == "bitmap" {
+		for _, offset := range s.pending {
+			commands = append(commands, []string{"SETBIT", s.tempKey, offset, "1"})
+		}
+	} else {
+		for start := 0; start < len(s.pending); start += redisMembersPerCommand {
+			end := min(start+redisMembersPerCommand, len(s.pending))
+			commands = append(commands, append([]string{"SADD", s.tempKey}, s.pending[start:end]...))
+		}
+	}
+	s.pending = s.pending[:0]
+	return s.do(commands)
+}
+
+// close writes the queued IPs and replaces -redis-key with the new set, or
+// deletes it when the expansion was empty.
+func (s *redisSink) close() error {
+	err := s.flush()
+	if err == nil {
+		commands := [][]string{{"RENAME", s.tempKey, s.key}}
+		if s.count == 0 {
+			commands = [][]string{{"DEL", s.key}}
+		}
+		err = s.do(commands)
+	}
+	if err != nil && s.conn != nil {
+		s.pipeline([][]string{{"DEL", s.tempKey}})
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return err
+}
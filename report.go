@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormats lists the formats of outputSinks -output accepts, the
+// built-in ones followed by those plugins register. Only JSON, NDJSON,
+// YAML, CSV and terminal output are written for modes other than expansion.
+var outputFormats = []string{"json", "ndjson", "yaml", "csv", "parquet", "sqlite", "template", "binary", "roaring", "hosts", "dnsmasq", "xlsx", "terminal"}
+
+// reportFormats lists the formats of outputFormats reports are written in.
+var reportFormats = []string{"json", "ndjson", "yaml", "csv", "terminal"}
+
+// writeReport renders the result of a non-expansion mode in the requested
+// output format. JSON and YAML output encode v, and NDJSON output each
+// element of v on a line of its own, while CSV and terminal output render the
+// header and rows as a table.
+func writeReport(w io.Writer, format string, v any, header []string, rows [][]string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "ndjson":
+		return writeJSONLines(w, v)
+	case "yaml":
+		return writeYAML(w, v)
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	case "terminal":
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	default:
+		return unsupportedReportFormat(format)
+	}
+}
+
+// writeCIDRList writes a list of CIDR blocks in the requested output format.
+// Terminal output is one block per line so it can be fed back into -cidr.
+func writeCIDRList(w io.Writer, format string, cidrRanges []CIDRRange) error {
+	type CIDR struct {
+		CIDR string `json:"cidr"`
+	}
+
+	switch format {
+	case "json":
+		data := make([]CIDR, 0, len(cidrRanges))
+		for _, cidr := range cidrRanges {
+			data = append(data, CIDR{cidr.String()})
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, cidr := range cidrRanges {
+			if err := encoder.Encode(CIDR{cidr.String()}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "yaml":
+		data := make([]CIDR, 0, len(cidrRanges))
+		for _, cidr := range cidrRanges {
+			data = append(data, CIDR{cidr.String()})
+		}
+		return writeYAML(w, data)
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"cidr"}); err != nil {
+			return err
+		}
+		for _, cidr := range cidrRanges {
+			if err := writer.Write([]string{cidr.String()}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "terminal":
+		writer := bufio.NewWriter(w)
+		for _, cidr := range cidrRanges {
+			fmt.Fprintln(writer, cidr.String())
+		}
+		return writer.Flush()
+	default:
+		return unsupportedReportFormat(format)
+	}
+}
+
+// unsupportedReportFormat returns the error of a report asked for in a format
+// it cannot be written in, which may be one only written for expansions.
+func unsupportedReportFormat(format string) error {
+	if slices.Contains(outputFormats, format) || isSinkURL(format) {
+		return fmt.Errorf("%s output is only supported when expanding IPs", format)
+	}
+	return fmt.Errorf("unsupported output format: %s", format)
+}
+
+// writeJSONLines writes each element of v, which is a slice, as a line of
+// JSON. Any other value is written as a single line.
+func writeJSONLines(w io.Writer, v any) error {
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	if value := reflect.ValueOf(v); value.Kind() == reflect.Slice {
+		for i := range value.Len() {
+			if err := encoder.Encode(value.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	} else if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// writeYAML writes v as a YAML document. It is encoded through JSON so that
+// the field names and omitted fields are the same as in JSON output.
+func writeYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// blockStyle clears the flow style and quoting that parsing JSON leaves on
+// the nodes, so that they are written in the usual block style. Non-empty
+// sequences and mappings only, as empty ones can only be written inline.
+func blockStyle(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode || len(node.Content) > 0 {
+		node.Style = 0
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// formatMetadata renders the metadata of an entry for CSV and terminal
+// output, e.g. "owner=network-team;site=ams1".
+func formatMetadata(metadata map[string]string) string {
+	fields := make([]string, 0, len(metadata))
+	for _, name := range slices.Sorted(maps.Keys(metadata)) {
+		fields = append(fields, name+"="+metadata[name])
+	}
+	return strings.Join(fields, ";")
+}
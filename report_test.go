@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestReportFormats(t *testing.T) {
+	// The -output help of the report commands lists reportFormats, which
+	// must be the formats writeReport writes
+	header, rows := []string{"name"}, [][]string{{"web"}}
+	v := []struct{ Name string }{{"web"}}
+	for _, format := range reportFormats {
+		if err := writeReport(io.Discard, format, v, header, rows); err != nil {
+			t.Errorf("writeReport(%s) failed: %v", format, err)
+		}
+	}
+	for _, format := range outputFormats {
+		if err := writeReport(io.Discard, format, v, header, rows); err == nil && !slices.Contains(reportFormats, format) {
+			t.Errorf("writeReport(%s) writes a format reportFormats leaves out", format)
+		}
+	}
+}
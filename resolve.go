@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultResolveTimeout     = 5 * time.Second
+	defaultResolveConcurrency = 10
+)
+
+// hostResolver resolves hostname entries with a per-lookup timeout and a
+// limit on the number of concurrent lookups. The lookups stop when the run
+// ctx is done.
+type hostResolver struct {
+	ctx      context.Context
+	resolver *net.Resolver
+	timeout  time.Duration
+	sem      chan struct{}
+}
+
+// newHostResolver returns a hostResolver that queries the given
+// comma-separated DNS servers in turn, or the system resolver when servers
+// is empty.
+func newHostResolver(ctx context.Context, servers string, timeout time.Duration, concurrency int) *hostResolver {
+	r := &hostResolver{
+		ctx:      ctx,
+		resolver: net.DefaultResolver,
+		timeout:  timeout,
+		sem:      make(chan struct{}, concurrency),
+	}
+
+	if servers != "" {
+		var addrs []string
+		for _, server := range strings.Split(servers, ",") {
+			server = strings.TrimSpace(server)
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(server, "53")
+			}
+			addrs = append(addrs, server)
+		}
+
+		var next atomic.Uint32
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				server := addrs[int(next.Add(1)-1)%len(addrs)]
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return r
+}
+
+// resolve looks up the IPv4 addresses of host and returns the block with the
+// given prefix length around each of them.
+func (r *hostResolver) resolve(host string, prefix int) ([]CIDRRange, error) {
+	select {
+	case r.sem <- struct{}{}:
+	case <-r.ctx.Done():
+		return nil, fmt.Errorf("error resolving %s: %w", host, r.ctx.Err())
+	}
+	defer func() { <-r.sem }()
+
+	ctx, cancel := context.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+
+	ips, err := r.resolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("error resolving %s: no IPv4 addresses found", host)
+	}
+
+	mask := ipToUint(net.IP(net.CIDRMask(prefix, 32)))
+	cidrRanges := make([]CIDRRange, 0, len(ips))
+	for _, ip := range ips {
+		cidrRanges = append(cidrRanges, newCIDRRange(ipToUint(ip)&mask, prefix))
+	}
+	return cidrRanges, nil
+}
+
+// parseHostnameEntry reports whether entry is a hostname, optionally
+// followed by a prefix length such as "db.example.com/32", and returns its
+// parts. Bare hostnames use a /32 prefix.
+func parseHostnameEntry(entry string) (string, int, bool) {
+	host, prefixStr, hasPrefix := strings.Cut(entry, "/")
+	if !isHostname(host) {
+		return "", 0, false
+	}
+
+	prefix := 32
+	if hasPrefix {
+		var err error
+		prefix, err = strconv.Atoi(prefixStr)
+		if err != nil || prefix < 0 || prefix > 32 {
+			return "", 0, false
+		}
+	}
+	return host, prefix, true
+}
+
+// isHostname reports whether s is a syntactically valid DNS hostname that is
+// not an IP address.
+func isHostname(s string) bool {
+	if s == "" || len(s) > 253 || net.ParseIP(s) != nil {
+		return false
+	}
+
+	hasLetter := false
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+				hasLetter = true
+			case c >= '0' && c <= '9', c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return hasLetter
+}
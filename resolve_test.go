@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestResolveCanceled(t *testing.T) {
+	// A DNS server that never answers
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithCancel(t.Context())
+	r := newHostResolver(ctx, conn.LocalAddr().String(), time.Minute, 1)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = r.resolve("db.example.com", 32)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("the lookup canceled with the run failed with %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Defaults of the -reverse-zones options, which are placeholders to replace
+// with the real name servers and host names.
+const (
+	defaultPTRTemplate = "host-{{.Dashed}}.example.com."
+	defaultSOAMName    = "ns1.example.com."
+	defaultSOARName    = "hostmaster.example.com."
+	defaultZoneTTL     = 3600
+)
+
+// hostNameData is what the -ptr-template and -hostname-template templates
+// are executed with for each address, e.g. "host-{{.Dashed}}.example.com."
+// or "{{.D}}.{{.C}}.pool.example.net.".
+type hostNameData struct {
+	Address    string // the IP, such as "192.0.2.1"
+	Dashed     string // the IP with dashes for dots, such as "192-0-2-1"
+	A, B, C, D int    // the octets of the IP
+}
+
+// newHostNameData returns the template data of ip.
+func newHostNameData(ip uint32) hostNameData {
+	address := formatIPv4(ip)
+	return hostNameData{
+		Address: address,
+		Dashed:  strings.ReplaceAll(address, ".", "-"),
+		A:       int(ip >> 24),
+		B:       int(ip >> 16 & 0xff),
+		C:       int(ip >> 8 & 0xff),
+		D:       int(ip & 0xff),
+	}
+}
+
+// reverseZone is a reverse DNS zone: a whole /24, or an RFC 2317 zone for a
+// block smaller than a /24, which the /24's zone delegates to with CNAME
+// records.
+type reverseZone struct {
+	name       string
+	start, end uint32
+	parent     string // the /24 zone of an RFC 2317 zone, or empty
+}
+
+// reverseZones returns the zones covering the ranges: one for each /24 of
+// blocks of /24 or larger, and an RFC 2317 zone, such as
+// 0/26.2.0.192.in-addr.arpa, for each smaller block.
+func reverseZones(ranges []ipRange) []reverseZone {
+	var zones []reverseZone
+	for _, cidr := range rangesToCIDRs(ranges) {
+		prefix, _ := cidr.ipNet.Mask.Size()
+		if prefix <= 24 {
+			for start := uint64(cidr.start); start <= uint64(cidr.end); start += 256 {
+				zones = append(zones, reverseZone{name: classfulReverseZone(uint32(start)), start: uint32(start), end: uint32(start) + 255})
+			}
+			continue
+		}
+		parent := classfulReverseZone(cidr.start)
+		zones = append(zones, reverseZone{
+			name:   fmt.Sprintf("%d/%d.%s", cidr.start&0xff, prefix, parent),
+			start:  cidr.start,
+			end:    cidr.end,
+			parent: parent,
+		})
+	}
+	return zones
+}
+
+// classfulReverseZone returns the in-addr.arpa zone of the /24 holding ip.
+func classfulReverseZone(ip uint32) string {
+	return fmt.Sprintf("%d.%d.%d.in-addr.arpa", ip>>8&0xff, ip>>16&0xff, ip>>24)
+}
+
+// fqdn returns name as a fully qualified domain name, with a final dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// parseHostNameTemplate parses the template of the flag named name, such
+// as -ptr-template.
+func parseHostNameTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -%s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// runReverseZones writes a zone file skeleton for each reverse zone of the
+// CIDR ranges, to a file named after the zone in -output-dir, or else to
+// stdout.
+func runReverseZones(config Config, cidrRanges []CIDRRange) error {
+	tmpl, err := parseHostNameTemplate("ptr-template", config.PTRTemplate)
+	if err != nil {
+		return err
+	}
+	nameServers := splitList(config.ZoneNS)
+	if len(nameServers) == 0 {
+		nameServers = []string{config.SOAMName}
+	}
+
+	zones := reverseZones(mergeIPRanges(toIPRanges(cidrRanges)))
+	if config.OutputDir != "" {
+		if err := os.MkdirAll(config.OutputDir, 0o755); err != nil {
+			return err
+		}
+		for _, zone := range zones {
+			path := filepath.Join(config.OutputDir, strings.ReplaceAll(zone.name, "/", "-")+".zone")
+			if err := writeReverseZoneFile(path, zone, tmpl, config, nameServers); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	for i, zone := range zones {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if err := writeReverseZone(out, zone, tmpl, config, nameServers); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// writeReverseZoneFile writes the zone file of a zone to path.
+func writeReverseZoneFile(path string, zone reverseZone, tmpl *template.Template, config Config, nameServers []string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	err = writeReverseZone(w, zone, tmpl, config, nameServers)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeReverseZone writes the zone file of a zone: the SOA and NS records,
+// a PTR record for each of its addresses and, for an RFC 2317 zone, the
+// records delegating to it as comments to copy into the parent zone.
+func writeReverseZone(w io.Writer, zone reverseZone, tmpl *template.Template, config Config, nameServers []string) error {
+	if zone.parent != "" {
+		label := strings.TrimSuffix(zone.name, "."+zone.parent)
+		fmt.Fprintf(w, "; Delegated from %s with these records there (RFC 2317):\n", zone.parent)
+		for _, ns := range nameServers {
+			fmt.Fprintf(w, ";   %s IN NS %s\n", label, fqdn(ns))
+		}
+		fmt.Fprintf(w, ";   $GENERATE %d-%d $ IN CNAME $.%s\n", zone.start&0xff, zone.end&0xff, label)
+		fmt.Fprintln(w)
+	}
+
+	rname := fqdn(strings.Replace(config.SOARName, "@", ".", 1))
+	fmt.Fprintf(w, "$ORIGIN %s.\n", zone.name)
+	fmt.Fprintf(w, "$TTL %d\n", config.ZoneTTL)
+	fmt.Fprintf(w, "@ IN SOA %s %s (\n", fqdn(config.SOAMName), rname)
+	fmt.Fprintf(w, "\t%s01 ; serial\n", time.Now().Format("20060102"))
+	fmt.Fprintf(w, "\t3600 ; refresh\n\t900 ; retry\n\t1209600 ; expire\n\t%d ; minimum\n)\n", config.ZoneTTL)
+	for _, ns := range nameServers {
+		fmt.Fprintf(w, "@ IN NS %s\n", fqdn(ns))
+	}
+	fmt.Fprintln(w)
+
+	var name strings.Builder
+	for n := uint64(zone.start); n <= uint64(zone.end); n++ {
+		ip := uint32(n)
+		name.Reset()
+		if err := tmpl.Execute(&name, newHostNameData(ip)); err != nil {
+			return fmt.Errorf("error executing -ptr-template: %w", err)
+		}
+		if _, err := fmt.Fprintf(w, "%d IN PTR %s\n", ip&0xff, fqdn(name.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
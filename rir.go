@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultRIRStatus = "allocated,assigned"
+
+// rirDelegatedURLs maps each Regional Internet Registry to the URL of its
+// latest delegated-extended statistics file.
+var rirDelegatedURLs = map[string]string{
+	"afrinic": "https://ftp.afrinic.net/pub/stats/afrinic/delegated-afrinic-extended-latest",
+	"apnic":   "https://ftp.apnic.net/stats/apnic/delegated-apnic-extended-latest",
+	"arin":    "https://ftp.arin.net/pub/stats/arin/delegated-arin-extended-latest",
+	"lacnic":  "https://ftp.lacnic.net/pub/stats/lacnic/delegated-lacnic-extended-latest",
+	"ripencc": "https://ftp.ripe.net/pub/stats/ripencc/delegated-ripencc-extended-latest",
+}
+
+// rirNames lists the registries in the order "all" downloads them in.
+var rirNames = []string{"afrinic", "apnic", "arin", "lacnic", "ripencc"}
+
+// rirFilter selects records of a delegated file by registry, country code
+// and status. An empty list matches everything.
+type rirFilter struct {
+	registries []string
+	countries  []string
+	statuses   []string
+}
+
+// parseRIRNames parses a comma-separated list of registries, where "ripe" is
+// accepted for "ripencc" and "all" selects every registry.
+func parseRIRNames(list string) ([]string, error) {
+	var names []string
+	for _, name := range splitList(list) {
+		name = strings.ToLower(name)
+		switch name {
+		case "all":
+			return rirNames, nil
+		case "ripe":
+			name = "ripencc"
+		}
+		if _, ok := rirDelegatedURLs[name]; !ok {
+			return nil, fmt.Errorf("unknown registry %q (expected %s or all)", name, strings.Join(rirNames, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// rirSources returns a source for each registry selected with -rir, or for
+// the delegated file given with -rir-file, in which case -rir only filters
+// the records by registry.
+func rirSources(ctx context.Context, config Config, fetcher *fetcher) []iter.Seq2[inputEntry, error] {
+	names, err := parseRIRNames(config.RIR)
+	if err != nil {
+		return []iter.Seq2[inputEntry, error]{func(yield func(inputEntry, error) bool) { yield(inputEntry{}, err) }}
+	}
+	filter := rirFilter{
+		countries: splitList(config.RIRCountries),
+		statuses:  splitList(config.RIRStatuses),
+	}
+
+	if config.RIRFile != "" {
+		filter.registries = names
+		return []iter.Seq2[inputEntry, error]{fromSource(config.RIRFile, readDelegatedFile(config.RIRFile, filter))}
+	}
+
+	sources := make([]iter.Seq2[inputEntry, error], 0, len(names))
+	for _, name := range names {
+		url := rirDelegatedURLs[name]
+		sources = append(sources, fromSource(name, func(yield func(inputEntry, error) bool) {
+			body, err := fetcher.fetch(ctx, url)
+			if err != nil {
+				yield(inputEntry{}, err)
+				return
+			}
+			for entry, err := range readDelegated(bytes.NewReader(body), name, filter) {
+				if !yield(entry, err) {
+					return
+				}
+			}
+		}))
+	}
+	return sources
+}
+
+// readDelegatedFile opens a delegated file lazily and returns its matching
+// IPv4 blocks.
+func readDelegatedFile(path string, filter rirFilter) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		file, err := os.Open(path)
+		if err != nil {
+			yield(inputEntry{}, fmt.Errorf("error opening delegated file: %w", err))
+			return
+		}
+		defer file.Close()
+
+		for entry, err := range readDelegated(file, path, filter) {
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
+
+// readDelegated parses a delegated or delegated-extended statistics file,
+// whose records have the form registry|cc|type|start|value|date|status, and
+// returns the IPv4 records that match the filter as CIDR blocks. An IPv4
+// record's value is its number of addresses, which need not be a power of
+// two, so a record may yield several blocks. The version line, summary
+// lines, comments and other record types are skipped.
+func readDelegated(r io.Reader, name string, filter rirFilter) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		scanner := bufio.NewScanner(r)
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.Split(line, "|")
+			if len(fields) < 7 || fields[2] != "ipv4" || fields[1] == "*" {
+				continue
+			}
+			registry, cc, status := fields[0], fields[1], fields[6]
+			if !matchesAny(filter.registries, registry) || !matchesAny(filter.countries, cc) || !matchesAny(filter.statuses, status) {
+				continue
+			}
+
+			origin := fmt.Sprintf("%s:%d", name, lineNum)
+			record, err := parseDelegatedRange(fields[3], fields[4])
+			if err != nil {
+				yield(inputEntry{}, fmt.Errorf("%s: %w", origin, err))
+				return
+			}
+			cidrs := rangeToCIDRs(record)
+			for _, cidr := range cidrs {
+				if !yield(inputEntry{text: cidr.String(), origin: origin, piece: len(cidrs) > 1}, nil) {
+					return
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", name, err))
+		}
+	}
+}
+
+// parseDelegatedRange returns the range of count addresses starting at
+// start.
+func parseDelegatedRange(start, count string) (ipRange, error) {
+	ip := net.ParseIP(start)
+	if ip == nil || ip.To4() == nil {
+		return ipRange{}, fmt.Errorf("invalid IPv4 address %q", start)
+	}
+	n, err := strconv.ParseUint(count, 10, 64)
+	first := uint64(ipToUint(ip))
+	if err != nil || n == 0 || first+n-1 > 1<<32-1 {
+		return ipRange{}, fmt.Errorf("invalid address count %q for %s", count, start)
+	}
+	return ipRange{Start: uint32(first), End: uint32(first + n - 1)}, nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+	"math/bits"
+	"os"
+	"slices"
+)
+
+// Cookies starting a serialized roaring bitmap, in the portable format the
+// Java, C and Go implementations share
+// (https://github.com/RoaringBitmap/RoaringFormatSpec).
+const (
+	roaringCookieNoRuns = 12346
+	roaringCookieRuns   = 12347
+
+	// roaringMaxArray is the largest cardinality of an array container.
+	roaringMaxArray = 4096
+	// roaringNoOffsetThreshold is the number of containers below which a
+	// bitmap with run containers has no offset header.
+	roaringNoOffsetThreshold = 4
+)
+
+// roaringBitmap is a set of IPv4 addresses, split by their upper 16 bits
+// into containers of 65,536 bits each. Containers are kept as plain bitmaps
+// in memory and written in whichever of the array, bitmap and run forms is
+// the smallest.
+type roaringBitmap struct {
+	containers map[uint16]*[1024]uint64
+}
+
+func newRoaringBitmap() *roaringBitmap {
+	return &roaringBitmap{containers: make(map[uint16]*[1024]uint64)}
+}
+
+// add adds ip to the set.
+func (b *roaringBitmap) add(ip uint32) {
+	c := b.containers[uint16(ip>>16)]
+	if c == nil {
+		c = new([1024]uint64)
+		b.containers[uint16(ip>>16)] = c
+	}
+	low := ip & 0xffff
+	c[low/64] |= 1 << (low % 64)
+}
+
+// addRange adds the IPs from start to end, inclusive, a word at a time.
+func (b *roaringBitmap) addRange(start, end uint32) {
+	for key := start >> 16; key <= end>>16; key++ {
+		c := b.containers[uint16(key)]
+		if c == nil {
+			c = new([1024]uint64)
+			b.containers[uint16(key)] = c
+		}
+		first, last := containerBounds(key, start, end)
+		for i := first / 64; i <= last/64; i++ {
+			c[i] |= wordMask(i, first, last)
+		}
+	}
+}
+
+// containerBounds returns the first and last of the low 16 bits of the IPs
+// from start to end in the container of key.
+func containerBounds(key, start, end uint32) (first, last uint32) {
+	first, last = 0, 0xffff
+	if key == start>>16 {
+		first = start & 0xffff
+	}
+	if key == end>>16 {
+		last = end & 0xffff
+	}
+	return first, last
+}
+
+// wordMask returns the bits of the word i of a container from first to
+// last.
+func wordMask(i, first, last uint32) uint64 {
+	mask := ^uint64(0)
+	if i == first/64 {
+		mask &= ^uint64(0) << (first % 64)
+	}
+	if i == last/64 {
+		mask &= ^uint64(0) >> (63 - last%64)
+	}
+	return mask
+}
+
+// andNot removes the IPs of other from the set, container by container,
+// dropping the containers left empty.
+func (b *roaringBitmap) andNot(other *roaringBitmap) {
+	for key, o := range other.containers {
+		c := b.containers[key]
+		if c == nil {
+			continue
+		}
+		empty := true
+		for i := range c {
+			c[i] &^= o[i]
+			empty = empty && c[i] == 0
+		}
+		if empty {
+			delete(b.containers, key)
+		}
+	}
+}
+
+// len returns the number of IPs in the set.
+func (b *roaringBitmap) len() uint64 {
+	var n uint64
+	for _, c := range b.containers {
+		n += uint64(cardinality(c))
+	}
+	return n
+}
+
+// each passes the IPs of the set from start to end to emit, in ascending
+// order, and stops at the first error emit returns. Only the set bits are
+// visited, a word at a time.
+func (b *roaringBitmap) each(start, end uint32, emit func(uint32) error) error {
+	for key := start >> 16; key <= end>>16; key++ {
+		c := b.containers[uint16(key)]
+		if c == nil {
+			continue
+		}
+		first, last := containerBounds(key, start, end)
+		for i := first / 64; i <= last/64; i++ {
+			for word := c[i] & wordMask(i, first, last); word != 0; word &= word - 1 {
+				if err := emit(key<<16 | i*64 + uint32(bits.TrailingZeros64(word))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rangesBitmap returns the bitmap of the IPs of ranges, which may overlap.
+func rangesBitmap(ranges []ipRange) *roaringBitmap {
+	b := newRoaringBitmap()
+	for _, r := range ranges {
+		b.addRange(r.Start, r.End)
+	}
+	return b
+}
+
+// keys returns the keys of the containers in ascending order.
+func (b *roaringBitmap) keys() []uint16 {
+	keys := make([]uint16, 0, len(b.containers))
+	for key := range b.containers {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// cardinality returns the number of bits set in c.
+func cardinality(c *[1024]uint64) int {
+	n := 0
+	for _, word := range c {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+// runs returns the runs of set bits in c as start and inclusive end pairs.
+// Words that are all clear or all set are skipped over whole.
+func runs(c *[1024]uint64) [][2]uint16 {
+	var result [][2]uint16
+	for i := 0; i < 65536; {
+		word := c[i/64] >> (i % 64)
+		if word == 0 {
+			i = (i/64 + 1) * 64
+			continue
+		}
+		i += bits.TrailingZeros64(word)
+		start := i
+		for i < 65536 {
+			if word := ^c[i/64] >> (i % 64); word == 0 {
+				i = (i/64 + 1) * 64
+			} else {
+				i += bits.TrailingZeros64(word)
+				break
+			}
+		}
+		result = append(result, [2]uint16{uint16(start), uint16(i - 1)})
+	}
+	return result
+}
+
+// writeTo writes the set in the portable serialized format.
+func (b *roaringBitmap) writeTo(w io.Writer) error {
+	keys := b.keys()
+	type container struct {
+		key         uint16
+		cardinality int
+		runs        [][2]uint16
+		data        []byte
+	}
+	containers := make([]container, 0, len(keys))
+	hasRuns := false
+	for _, key := range keys {
+		bitmap := b.containers[key]
+		c := container{key: key, cardinality: cardinality(bitmap)}
+		if c.cardinality == 0 {
+			continue
+		}
+		c.runs = runs(bitmap)
+		size := 8192
+		if c.cardinality <= roaringMaxArray {
+			size = 2 * c.cardinality
+		}
+		switch {
+		case 2+4*len(c.runs) < size:
+			hasRuns = true
+			c.data = binary.LittleEndian.AppendUint16(nil, uint16(len(c.runs)))
+			for _, run := range c.runs {
+				c.data = binary.LittleEndian.AppendUint16(c.data, run[0])
+				c.data = binary.LittleEndian.AppendUint16(c.data, run[1]-run[0])
+			}
+		case c.cardinality <= roaringMaxArray:
+			for _, run := range c.runs {
+				for v := uint32(run[0]); v <= uint32(run[1]); v++ {
+					c.data = binary.LittleEndian.AppendUint16(c.data, uint16(v))
+				}
+			}
+			c.runs = nil
+		default:
+			for _, word := range bitmap {
+				c.data = binary.LittleEndian.AppendUint64(c.data, word)
+			}
+			c.runs = nil
+		}
+		containers = append(containers, c)
+	}
+
+	var header []byte
+	if hasRuns {
+		header = binary.LittleEndian.AppendUint32(header, roaringCookieRuns|uint32(len(containers)-1)<<16)
+		runFlags := make([]byte, (len(containers)+7)/8)
+		for i, c := range containers {
+			if c.runs != nil {
+				runFlags[i/8] |= 1 << (i % 8)
+			}
+		}
+		header = append(header, runFlags...)
+	} else {
+		header = binary.LittleEndian.AppendUint32(header, roaringCookieNoRuns)
+		header = binary.LittleEndian.AppendUint32(header, uint32(len(containers)))
+	}
+	for _, c := range containers {
+		header = binary.LittleEndian.AppendUint16(header, c.key)
+		header = binary.LittleEndian.AppendUint16(header, uint16(c.cardinality-1))
+	}
+	if !hasRuns || len(containers) >= roaringNoOffsetThreshold {
+		offset := len(header) + 4*len(containers)
+		for _, c := range containers {
+			header = binary.LittleEndian.AppendUint32(header, uint32(offset))
+			offset += len(c.data)
+		}
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, c := range containers {
+		if _, err := w.Write(c.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRoaring reads a set in the portable serialized format.
+func readRoaring(r io.Reader) (*roaringBitmap, error) {
+	br := bufio.NewReader(r)
+	read := func(v any) error {
+		if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+			return fmt.Errorf("truncated bitmap: %w", err)
+		}
+		return nil
+	}
+
+	var cookie uint32
+	if err := read(&cookie); err != nil {
+		return nil, err
+	}
+	var size uint32
+	var runFlags []byte
+	switch {
+	case cookie&0xffff == roaringCookieRuns:
+		size = cookie>>16 + 1
+		runFlags = make([]byte, (size+7)/8)
+		if err := read(runFlags); err != nil {
+			return nil, err
+		}
+	case cookie == roaringCookieNoRuns:
+		if err := read(&size); err != nil {
+			return nil, err
+		}
+		if size > 65536 {
+			return nil, fmt.Errorf("invalid bitmap: %d containers", size)
+		}
+	default:
+		return nil, fmt.Errorf("not a roaring bitmap")
+	}
+
+	descriptions := make([]uint16, 2*size)
+	if err := read(descriptions); err != nil {
+		return nil, err
+	}
+	if runFlags == nil || size >= roaringNoOffsetThreshold {
+		if err := read(make([]uint32, size)); err != nil {
+			return nil, err
+		}
+	}
+
+	b := newRoaringBitmap()
+	for i := range size {
+		key, n := descriptions[2*i], int(descriptions[2*i+1])+1
+		isRun := runFlags != nil && runFlags[i/8]&(1<<(i%8)) != 0
+		switch {
+		case isRun:
+			var count uint16
+			if err := read(&count); err != nil {
+				return nil, err
+			}
+			pairs := make([]uint16, 2*int(count))
+			if err := read(pairs); err != nil {
+				return nil, err
+			}
+			for j := 0; j < len(pairs); j += 2 {
+				start := uint32(key)<<16 | uint32(pairs[j])
+				b.addRange(start, start+uint32(pairs[j+1]))
+			}
+		case n <= roaringMaxArray:
+			values := make([]uint16, n)
+			if err := read(values); err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				b.add(uint32(key)<<16 | uint32(v))
+			}
+		default:
+			c := new([1024]uint64)
+			if err := read(c[:]); err != nil {
+				return nil, err
+			}
+			b.containers[key] = c
+		}
+	}
+	return b, nil
+}
+
+// ranges returns the runs of consecutive IPs in the set in ascending order.
+func (b *roaringBitmap) ranges() []ipRange {
+	var result []ipRange
+	for _, key := range b.keys() {
+		for _, run := range runs(b.containers[key]) {
+			start, end := uint32(key)<<16|uint32(run[0]), uint32(key)<<16|uint32(run[1])
+			if n := len(result); n > 0 && result[n-1].End != ^uint32(0) && result[n-1].End+1 == start {
+				result[n-1].End = end
+				continue
+			}
+			result = append(result, ipRange{Start: start, End: end})
+		}
+	}
+	return result
+}
+
+// bitmapEntries yields the CIDR blocks covering the set in the -input-bitmap
+// file. Each entry's origin is the file and the position of the block.
+func bitmapEntries(path string) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		file, err := os.Open(path)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+		defer file.Close()
+		b, err := readRoaring(file)
+		if err != nil {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", path, err))
+			return
+		}
+		for i, cidr := range rangesToCIDRs(b.ranges()) {
+			if !yield(inputEntry{text: cidr.String(), origin: fmt.Sprintf("%s:block %d", path, i+1)}, nil) {
+				return
+			}
+		}
+	}
+}
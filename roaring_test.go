@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestRoaringBitmapRanges(t *testing.T) {
+	b := newRoaringBitmap()
+	// Across the containers of 10.0.0.0/16 and 10.1.0.0/16, and up to the
+	// last address.
+	b.addRange(0x0a00fff0, 0x0a01000f)
+	b.addRange(math.MaxUint32-5, math.MaxUint32)
+	b.andNot(rangesBitmap([]ipRange{{Start: 0x0a00fffe, End: 0x0a010001}, {Start: math.MaxUint32 - 5, End: math.MaxUint32}}))
+
+	var want []uint32
+	for ip := uint32(0x0a00fff0); ip <= 0x0a01000f; ip++ {
+		if ip < 0x0a00fffe || ip > 0x0a010001 {
+			want = append(want, ip)
+		}
+	}
+	var got []uint32
+	if err := b.each(0, math.MaxUint32, func(ip uint32) error {
+		got = append(got, ip)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("each = %x, want %x", got, want)
+	}
+	if b.len() != uint64(len(want)) {
+		t.Fatalf("len = %d, want %d", b.len(), len(want))
+	}
+	if len(b.containers) != 2 {
+		t.Fatalf("the bitmap has %d containers, want the 2 left with IPs", len(b.containers))
+	}
+
+	got = nil
+	if err := b.each(0x0a00fff4, 0x0a010003, func(ip uint32) error {
+		got = append(got, ip)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want = slices.DeleteFunc(want, func(ip uint32) bool { return ip < 0x0a00fff4 || ip > 0x0a010003 })
+	if !slices.Equal(got, want) {
+		t.Fatalf("each from 10.0.255.244 to 10.1.0.3 = %x, want %x", got, want)
+	}
+}
+
+func TestBitmapExpandsEachBlock(t *testing.T) {
+	blocks := testBlocks(t, "10.0.0.0/14", "10.2.0.0/16", "10.2.3.0/24", "10.9.0.0/24", "255.255.255.0/24")
+	want := eachIP(blocks)
+	union := slices.Compact(slices.Clone(want))
+	for _, config := range []Config{
+		{Algorithm: "bitmap"},
+		{Algorithm: "bitmap", Parallel: true, Concurrency: 4},
+	} {
+		if got := sorted(expand(t, config, blocks)); !slices.Equal(got, want) {
+			t.Errorf("the bitmap expansion with -parallel=%v wrote %d IPs, want the %d of each block", config.Parallel, len(got), len(want))
+		}
+		if size := expansionSize(config, blocks); size != uint64(len(want)) {
+			t.Errorf("expansionSize with -parallel=%v = %d, want %d", config.Parallel, size, len(want))
+		}
+		// -dedupe writes the union, as it does with the other algorithms
+		config.Dedupe = true
+		if size := expansionSize(config, blocks); size != uint64(len(union)) {
+			t.Errorf("expansionSize with -parallel=%v -dedupe = %d, want %d", config.Parallel, size, len(union))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ruleFormats lists the firewalls -rules writes rules for.
+var ruleFormats = []string{"iptables", "nftables"}
+
+// Defaults of the -rules options.
+const (
+	defaultRuleChain  = "INPUT"
+	defaultRuleAction = "drop"
+	defaultRuleSet    = "cidr_sensei"
+	defaultRuleTable  = "filter"
+)
+
+// runRules writes the merged CIDR blocks as firewall rules matching their
+// source addresses, to -outfile or stdout.
+func runRules(config Config, cidrRanges []CIDRRange) error {
+	blocks := rangesToCIDRs(mergeIPRanges(toIPRanges(cidrRanges)))
+
+	var out io.Writer = os.Stdout
+	if config.OutFile != "" && config.OutFile != "-" {
+		file, err := os.Create(config.OutFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	if config.Rules == "nftables" {
+		writeNftablesSet(w, config, blocks)
+	} else {
+		writeIptablesRules(w, config, blocks)
+	}
+	return w.Flush()
+}
+
+// writeIptablesRules writes an -A rule for each block in iptables-restore
+// format, so that the file can be loaded with iptables-restore --noflush:
+//
+//	*filter
+//	-A INPUT -s 10.0.0.0/8 -j DROP
+//	COMMIT
+func writeIptablesRules(w io.Writer, config Config, blocks []CIDRRange) {
+	fmt.Fprintf(w, "*%s\n", config.RuleTable)
+	for _, block := range blocks {
+		fmt.Fprintf(w, "-A %s -s %s -j %s\n", config.RuleChain, block, strings.ToUpper(config.RuleAction))
+	}
+	fmt.Fprintln(w, "COMMIT")
+}
+
+// writeNftablesSet writes a named set of the blocks and a rule in the chain
+// matching it, for nft -f:
+//
+//	table inet filter {
+//		set cidr_sensei {
+//			type ipv4_addr
+//			flags interval
+//			elements = { 10.0.0.0/8, 192.168.0.0/16 }
+//		}
+//		chain input {
+//			ip saddr @cidr_sensei drop
+//		}
+//	}
+func writeNftablesSet(w io.Writer, config Config, blocks []CIDRRange) {
+	fmt.Fprintf(w, "table inet %s {\n", config.RuleTable)
+	fmt.Fprintf(w, "\tset %s {\n", config.RuleSet)
+	fmt.Fprintln(w, "\t\ttype ipv4_addr")
+	fmt.Fprintln(w, "\t\tflags interval")
+	if len(blocks) > 0 {
+		fmt.Fprint(w, "\t\telements = {")
+		for i, block := range blocks {
+			switch {
+			case i == 0:
+				fmt.Fprint(w, " ")
+			case i%8 == 0:
+				fmt.Fprint(w, ",\n\t\t\t     ")
+			default:
+				fmt.Fprint(w, ", ")
+			}
+			fmt.Fprint(w, block)
+		}
+		fmt.Fprintln(w, " }")
+	}
+	fmt.Fprintln(w, "\t}")
+	fmt.Fprintf(w, "\tchain %s {\n", strings.ToLower(config.RuleChain))
+	fmt.Fprintf(w, "\t\tip saddr @%s %s\n", config.RuleSet, strings.ToLower(config.RuleAction))
+	fmt.Fprintln(w, "\t}")
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const defaultAWSRegion = "us-east-1"
+
+// s3Store reads objects from S3 or an S3-compatible endpoint with the AWS
+// SDK, using the credentials and region found in the environment the way
+// the AWS CLI does.
+type s3Store struct {
+	fetcher *fetcher
+
+	once   sync.Once
+	client *s3.Client
+	err    error
+}
+
+// loadAWSConfig loads the region and credentials the AWS SDK finds: the
+// environment, the AWS_PROFILE of the shared config and credentials files,
+// the ECS or EKS container endpoint and the EC2 instance profile. The region
+// falls back to us-east-1, and requests time out and are retried like
+// fetches, or only wait for a response for as long when streaming is set.
+func loadAWSConfig(ctx context.Context, f *fetcher, streaming bool) (aws.Config, error) {
+	// AWS_CA_BUNDLE can only be added to the SDK's own HTTP client
+	client := awshttp.NewBuildableClient().WithTimeout(f.client.Timeout)
+	if streaming {
+		client = awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			tr.ResponseHeaderTimeout = f.client.Timeout
+		})
+	}
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithDefaultRegion(defaultAWSRegion),
+		config.WithHTTPClient(client),
+		config.WithRetryMaxAttempts(f.retries+1),
+		config.WithAppID("cidr-sensei"),
+	)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("error loading the AWS configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// open starts reading the object at key in bucket. An S3 bucket in another
+// region than the configured one redirects to it, so the request is made
+// again in the bucket's region.
+func (s *s3Store) open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	s.once.Do(func() { s.client, s.err = newS3Client(ctx, s.fetcher) })
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	out, err := s.client.GetObject(ctx, input)
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		if region := respErr.Response.Header.Get("X-Amz-Bucket-Region"); region != "" && region != s.client.Options().Region {
+			out, err = s.client.GetObject(ctx, input, func(o *s3.Options) { o.Region = region })
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching s3://%s/%s: %w", bucket, key, err)
+	}
+	return out.Body, nil
+}
+
+// newS3Client returns a client reading objects as they download. Requests are anonymous when no credentials are
+// found, so that public objects can still be read, and go path-style to the
+// endpoint set with AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, such as a
+// MinIO server.
+func newS3Client(ctx context.Context, f *fetcher) (*s3.Client, error) {
+	cfg, err := loadAWSConfig(ctx, f, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		cfg.Credentials = aws.AnonymousCredentials{}
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = o.BaseEndpoint != nil
+	}), nil
+}
+
+// firstEnv returns the value of the first of the environment variables that
+// is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
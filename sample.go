@@ -0,0 +1,38 @@
+package main
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// sampleIPs returns a uniform random sample of n distinct IPs drawn from the
+// CIDR ranges, in ascending order. Positions are drawn directly from the
+// merged ranges with Floyd's algorithm, so only the sample itself is held in
+// memory. When n is at least the number of addresses, every address is
+// returned.
+func sampleIPs(cidrRanges []CIDRRange, n uint64, seed uint64) []string {
+	index := newRangeIndex(mergeIPRanges(toIPRanges(cidrRanges)))
+	n = min(n, index.total)
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	selected := make(map[uint64]struct{}, n)
+	for j := index.total - n; j < index.total; j++ {
+		t := rng.Uint64N(j + 1)
+		if _, ok := selected[t]; ok {
+			t = j
+		}
+		selected[t] = struct{}{}
+	}
+
+	positions := make([]uint64, 0, len(selected))
+	for pos := range selected {
+		positions = append(positions, pos)
+	}
+	slices.Sort(positions)
+
+	ips := make([]string, 0, len(positions))
+	for _, pos := range positions {
+		ips = append(ips, formatIPv4(index.addressAt(pos)))
+	}
+	return ips
+}
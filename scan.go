@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// scanTools lists the scanners -scan-targets writes target lists for.
+var scanTools = []string{"nmap", "masscan"}
+
+// runScanTargets writes the CIDR ranges as a target list for nmap -iL or
+// masscan -iL. With -scan-aggregate the ranges are merged first, so that the
+// scanner is handed the fewest targets, and with -scan-shard-size the list is
+// split into files of at most that many addresses, named after -outfile.
+func runScanTargets(config Config, cidrRanges []CIDRRange) error {
+	ranges := toIPRanges(cidrRanges)
+	if config.ScanAggregate {
+		ranges = mergeIPRanges(ranges)
+	}
+
+	if config.ScanShardSize == 0 {
+		if config.OutFile == "" || config.OutFile == "-" {
+			w := bufio.NewWriter(os.Stdout)
+			writeScanTargets(w, config.ScanTargets, ranges)
+			return w.Flush()
+		}
+		return writeScanTargetsFile(config.OutFile, config.ScanTargets, ranges)
+	}
+
+	ext := filepath.Ext(config.OutFile)
+	base := strings.TrimSuffix(config.OutFile, ext)
+	for i, shard := range shardIPRanges(ranges, config.ScanShardSize) {
+		path := fmt.Sprintf("%s-%03d%s", base, i+1, ext)
+		if err := writeScanTargetsFile(path, config.ScanTargets, shard); err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%d\n", path, totalSize(shard))
+	}
+	return nil
+}
+
+// shardIPRanges splits ranges into groups of at most size addresses each,
+// splitting a range between groups where needed. A size of 0 keeps them in a
+// single group.
+func shardIPRanges(ranges []ipRange, size uint64) [][]ipRange {
+	if size == 0 {
+		return [][]ipRange{ranges}
+	}
+	var shards [][]ipRange
+	var shard []ipRange
+	var count uint64
+	for _, r := range ranges {
+		for {
+			if count == size {
+				shards, shard, count = append(shards, shard), nil, 0
+			}
+			if r.Size() <= size-count {
+				shard, count = append(shard, r), count+r.Size()
+				break
+			}
+			split := ipRange{Start: r.Start, End: r.Start + uint32(size-count-1)}
+			shard, count = append(shard, split), size
+			r.Start = split.End + 1
+		}
+	}
+	if len(shard) > 0 {
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+// writeScanTargetsFile writes a target list to path.
+func writeScanTargetsFile(path, tool string, ranges []ipRange) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	writeScanTargets(w, tool, ranges)
+	err = w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeScanTargets writes one target per line. nmap is given CIDR blocks,
+// while masscan is given a block, or a first-last range when a range is not
+// a single block, which both accept in their -iL files.
+func writeScanTargets(w io.Writer, tool string, ranges []ipRange) {
+	for _, r := range ranges {
+		cidrs := rangeToCIDRs(r)
+		if tool == "masscan" && len(cidrs) > 1 {
+			fmt.Fprintf(w, "%s-%s\n", uint2ip(r.Start), uint2ip(r.End))
+			continue
+		}
+		for _, cidr := range cidrs {
+			fmt.Fprintln(w, cidr.String())
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// script is a -script file, whose block and address functions are hooks
+// run on each block before it is expanded or reported on, and on each IP
+// before it is written.
+type script struct {
+	file    string
+	thread  *starlark.Thread
+	block   starlark.Callable // nil when the script defines no block function
+	address starlark.Callable // nil when the script defines no address function
+}
+
+// blockFields and addressFields are the fields of the records the block
+// and address hooks are called with.
+var (
+	blockFields   = []string{"cidr", "entry", "origin", "source", "prefix", "network", "broadcast", "size", "tags"}
+	addressFields = []string{"address", "integer", "block"}
+)
+
+// scriptOptions are the language options of scripts: Starlark's, with set,
+// while loops, recursion and control flow at the top level allowed. Globals
+// are frozen once the top level has run, as in Starlark.
+var scriptOptions = &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, Recursion: true}
+
+// loadScript runs the top level of the Starlark script at path, and
+// returns its hooks.
+func loadScript(path string) (*script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading script: %w", err)
+	}
+	thread := &starlark.Thread{
+		Name:  path,
+		Print: func(_ *starlark.Thread, msg string) { fmt.Fprintln(os.Stderr, msg) },
+	}
+	globals, err := starlark.ExecFileOptions(scriptOptions, thread, path, src, scriptBuiltins())
+	if err != nil {
+		return nil, scriptError(err)
+	}
+
+	s := &script{file: path, thread: thread}
+	for name, hook := range map[string]*starlark.Callable{"block": &s.block, "address": &s.address} {
+		v, ok := globals[name]
+		if !ok {
+			continue
+		}
+		if *hook, ok = v.(starlark.Callable); !ok {
+			return nil, fmt.Errorf("%s: %s is of type %s, not a function", path, name, v.Type())
+		}
+	}
+	if s.block == nil && s.address == nil {
+		return nil, fmt.Errorf("%s: the script defines neither a block nor an address function", path)
+	}
+	return s, nil
+}
+
+// scriptError returns err with the Starlark call stack it happened in,
+// which ends with the line of the script.
+func scriptError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
+
+// call calls the hook with the record.
+func (s *script) call(hook starlark.Callable, record starlark.Value) (starlark.Value, error) {
+	result, err := starlark.Call(s.thread, hook, starlark.Tuple{record}, nil)
+	return result, scriptError(err)
+}
+
+// scriptBuiltins returns the functions scripts can call besides the
+// builtins of Starlark.
+func scriptBuiltins() starlark.StringDict {
+	return starlark.StringDict{
+		"in_cidr": starlark.NewBuiltin("in_cidr", func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var ip, block string
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &ip, &block); err != nil {
+				return nil, err
+			}
+			n, err := parseIPv4(ip)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			cidr, err := parseCIDR(block)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return starlark.Bool(n >= cidr.start && n <= cidr.end), nil
+		}),
+		"ip_to_int": starlark.NewBuiltin("ip_to_int", func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var ip string
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &ip); err != nil {
+				return nil, err
+			}
+			n, err := parseIPv4(ip)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), err)
+			}
+			return starlark.MakeUint(uint(n)), nil
+		}),
+		"int_to_ip": starlark.NewBuiltin("int_to_ip", func(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var n starlark.Int
+			if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &n); err != nil {
+				return nil, err
+			}
+			ip, ok := n.Int64()
+			if !ok || ip < 0 || ip > 1<<32-1 {
+				return nil, fmt.Errorf("%s: got %s, want an int between 0 and 4294967295", fn.Name(), n)
+			}
+			return starlark.String(formatIPv4(uint32(ip))), nil
+		}),
+	}
+}
+
+// blockRecord returns the record the hooks see cidr as.
+func blockRecord(cidr CIDRRange) *starlarkstruct.Struct {
+	tags := starlark.NewDict(len(cidr.metadata))
+	for _, name := range slices.Sorted(maps.Keys(cidr.metadata)) {
+		_ = tags.SetKey(starlark.String(name), starlark.String(cidr.metadata[name]))
+	}
+	prefix, _ := cidr.ipNet.Mask.Size()
+	return newRecord("block", blockFields,
+		starlark.String(cidr.String()), starlark.String(cidr.entry), starlark.String(cidr.origin), starlark.String(cidr.source),
+		starlark.MakeInt(prefix), starlark.String(formatIPv4(cidr.network())), starlark.String(formatIPv4(cidr.broadcast())),
+		starlark.MakeUint64(uint64(cidr.end-cidr.start)+1), tags)
+}
+
+// newRecord returns a struct of the fields with the values, in order.
+func newRecord(name string, fields []string, values ...starlark.Value) *starlarkstruct.Struct {
+	members := make(starlark.StringDict, len(fields))
+	for i, field := range fields {
+		members[field] = values[i]
+	}
+	return starlarkstruct.FromStringDict(starlark.String(name), members)
+}
+
+// filterBlocks runs the block hook on each block. Returning False drops
+// the block, returning a string or list of strings replaces it with the
+// entries they hold, and returning anything else keeps it. The tags the
+// hook leaves in block.tags become the tags of the block, and of the
+// blocks replacing it.
+func (s *script) filterBlocks(cidrRanges []CIDRRange) ([]CIDRRange, error) {
+	if s.block == nil {
+		return cidrRanges, nil
+	}
+	var filtered []CIDRRange
+	for _, cidr := range cidrRanges {
+		record := blockRecord(cidr)
+		result, err := s.call(s.block, record)
+		if err != nil {
+			return nil, err
+		}
+		if cidr.metadata, err = recordTags(record); err != nil {
+			return nil, fmt.Errorf("%s: block %s: %w", s.file, cidr, err)
+		}
+
+		entries, keep, err := hookResult(result)
+		if err != nil {
+			return nil, fmt.Errorf("%s: the block function returned %w", s.file, err)
+		}
+		if entries == nil {
+			if keep {
+				filtered = append(filtered, cidr)
+			}
+			continue
+		}
+		for _, entry := range entries {
+			ranges, err := parseEntry(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s: block %s: %w", s.file, cidr, err)
+			}
+			ranges, _ = normalizeCIDRRanges(ranges)
+			for _, r := range ranges {
+				r.entry, r.origin, r.source, r.piece, r.metadata = cidr.entry, cidr.origin, cidr.source, cidr.piece, cidr.metadata
+				filtered = append(filtered, r)
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// recordTags returns the tags of a block record as metadata.
+func recordTags(record *starlarkstruct.Struct) (map[string]string, error) {
+	v, _ := record.Attr("tags")
+	tags, ok := v.(*starlark.Dict)
+	if !ok || tags.Len() == 0 {
+		return nil, nil
+	}
+	metadata := make(map[string]string, tags.Len())
+	for _, item := range tags.Items() {
+		name, ok := item[0].(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("tag names must be strings, not %s", item[0].Type())
+		}
+		if value, ok := item[1].(starlark.String); ok {
+			metadata[string(name)] = string(value)
+		} else {
+			metadata[string(name)] = item[1].String()
+		}
+	}
+	return metadata, nil
+}
+
+// hookResult interprets the value a hook returned: the strings of a string
+// or list of strings, or whether to keep the record otherwise.
+func hookResult(result starlark.Value) (entries []string, keep bool, err error) {
+	switch result := result.(type) {
+	case starlark.NoneType:
+		return nil, true, nil
+	case starlark.Bool:
+		return nil, bool(result), nil
+	case starlark.String:
+		return []string{string(result)}, true, nil
+	case *starlark.List:
+		entries = []string{}
+		for elem := range result.Elements() {
+			s, ok := elem.(starlark.String)
+			if !ok {
+				return nil, false, fmt.Errorf("a list holding a value of type %s, expected only strings", elem.Type())
+			}
+			entries = append(entries, string(s))
+		}
+		return entries, true, nil
+	}
+	return nil, false, fmt.Errorf("a value of type %s, expected None, a bool, a string or a list of strings", result.Type())
+}
+
+// filterAddresses returns emit running the address hook on each IP first.
+// Returning False drops the IP, returning a string or list of strings
+// writes the IPs they hold instead, and returning anything else writes the
+// IP.
+func (s *script) filterAddresses(cidrRanges []CIDRRange, algorithm string, emit func(string) error) func(string) error {
+	if s.address == nil {
+		return emit
+	}
+	index := newSourceIndex(algorithm, cidrRanges)
+	blocks := make(map[*CIDRRange]*starlarkstruct.Struct)
+	return func(ip string) error {
+		n, err := parseIPv4(ip)
+		if err != nil {
+			return err
+		}
+		var block starlark.Value = starlark.None
+		if cidr := index.lookup(n); cidr != nil {
+			record, ok := blocks[cidr]
+			if !ok {
+				record = blockRecord(*cidr)
+				blocks[cidr] = record
+			}
+			block = record
+		}
+		result, err := s.call(s.address, newRecord("address", addressFields, starlark.String(ip), starlark.MakeUint(uint(n)), block))
+		if err != nil {
+			return err
+		}
+
+		ips, keep, err := hookResult(result)
+		if err != nil {
+			return fmt.Errorf("%s: the address function returned %w", s.file, err)
+		}
+		if ips == nil {
+			if keep {
+				return emit(ip)
+			}
+			return nil
+		}
+		for _, ip := range ips {
+			if _, err := parseIPv4(ip); err != nil {
+				return fmt.Errorf("%s: the address function returned %w", s.file, err)
+			}
+			if err := emit(ip); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
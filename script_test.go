@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testScript loads the script of src.
+func testScript(t *testing.T, src string) (*script, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hooks.star")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return loadScript(path)
+}
+
+func TestScriptBlocks(t *testing.T) {
+	s, err := testScript(t, `
+SITES = {"10.1.": "ams", "10.2.": "fra"}
+
+def block(b):
+    if b.cidr == "192.168.0.0/24":
+        return False
+    if b.cidr == "172.16.0.0/30":
+        return ["172.16.1.0/31", "172.16.2.1"]
+    for prefix, site in SITES.items():
+        if b.cidr.startswith(prefix):
+            b.tags["site"] = site
+    b.tags["size"] = b.size
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := s.filterBlocks(testBlocks(t, "10.1.0.0/16", "192.168.0.0/24", "172.16.0.0/30", "10.2.0.0/24"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range blocks {
+		got = append(got, b.String()+" "+b.metadata["site"]+" "+b.metadata["size"])
+	}
+	want := []string{"10.1.0.0/16 ams 65536", "172.16.1.0/31  ", "172.16.2.1/32  ", "10.2.0.0/24 fra 256"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("the block hook left %q, want %q", got, want)
+	}
+}
+
+func TestScriptAddresses(t *testing.T) {
+	s, err := testScript(t, `
+skip = lambda a: a.address.endswith(".1")
+
+def address(a):
+    if skip(a):
+        return False
+    if a.address == "10.0.0.2":
+        return [int_to_ip(a.integer + 100), "10.0.0.202"]
+    return in_cidr(a.address, a.block.cidr) and ip_to_int(a.address) == a.integer
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := testBlocks(t, "10.0.0.0/30")
+	var got []string
+	emit := s.filterAddresses(blocks, "binary-search", func(ip string) error {
+		got = append(got, ip)
+		return nil
+	})
+	for _, ip := range []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if err := emit(ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"10.0.0.0", "10.0.0.102", "10.0.0.202", "10.0.0.3"}; !slices.Equal(got, want) {
+		t.Fatalf("the address hook wrote %q, want %q", got, want)
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // in the error, of loading the script or running its hooks
+	}{
+		{"no hooks", "x = 1\n", "defines neither"},
+		{"hook not a function", "block = 1\n", "block is of type int, not a function"},
+		{"syntax error", "def block(b)\n    pass\n", "hooks.star:2:1"},
+		{"global reassigned", "n = 0\nn = 1\ndef block(b):\n    pass\n", "cannot reassign global n"},
+		{"frozen global", "seen = []\ndef block(b):\n    seen.append(b.cidr)\n", "frozen list"},
+		{"failing hook", "def block(b):\n    return 1 // 0\n", "hooks.star:2"},
+		{"bad result", "def block(b):\n    return 1\n", "a value of type int"},
+		{"bad builtin argument", "def block(b):\n    return in_cidr(b.cidr, \"10.0.0.0/8\")\n", "in_cidr"},
+	}
+	for _, tt := range tests {
+		s, err := testScript(t, tt.src)
+		if err == nil {
+			_, err = s.filterBlocks(testBlocks(t, "10.0.0.0/24"))
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got the error %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
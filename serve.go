@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+const (
+	defaultListen          = "localhost:8080"
+	defaultMaxRequestSize  = "1MB"
+	defaultMaxAddresses    = 1 << 24
+	defaultShutdownTimeout = 10 * time.Second
+	// maxJSONAddresses is the largest expansion written as a single JSON
+	// response, which clients hold in memory to parse; larger ones must be
+	// streamed as NDJSON.
+	maxJSONAddresses = 1 << 16
+	// streamFlushLines is the number of lines, or gRPC messages, of a
+	// streamed expansion sent in each chunk.
+	streamFlushLines  = 4096
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// expandRequest is the body of a POST /expand request.
+type expandRequest struct {
+	CIDRs   []string `json:"cidrs"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// aggregateRequest is the body of a POST /aggregate request.
+type aggregateRequest struct {
+	CIDRs []string `json:"cidrs"`
+}
+
+// aggregateResponse is the response to a POST /aggregate request.
+type aggregateResponse struct {
+	CIDRs     []string `json:"cidrs"`
+	Addresses uint64   `json:"addresses"`
+}
+
+// checkRequest is the body of a POST /check request.
+type checkRequest struct {
+	CIDRs []string `json:"cidrs"`
+	IPs   []string `json:"ips"`
+}
+
+// checkResponse is the response to a POST /check request.
+type checkResponse struct {
+	Results []containsResult `json:"results"`
+}
+
+// errorResponse is the body of a response to a request that failed.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// server serves the HTTP and gRPC APIs: the expansion, aggregation and
+// membership checks of the CIDR blocks in each request, and with jobs the
+// job queue of the daemon command.
+type server struct {
+	maxRequestSize int64
+	maxAddresses   uint64
+	metrics        *metrics
+	jobs           *jobQueue // nil for the serve command
+}
+
+// serveOptions are the flags of the serve and daemon commands.
+type serveOptions struct {
+	listen          *string
+	maxRequestSize  *string
+	maxAddresses    *uint64
+	shutdownTimeout *time.Duration
+	otlpEndpoint    *string
+	logging         *logOptions
+}
+
+// addServeFlags defines the flags of the API on flags.
+func addServeFlags(flags *flag.FlagSet) serveOptions {
+	logging := new(logOptions)
+	logging.addFlags(flags)
+	return serveOptions{
+		listen:          flags.String("listen", defaultListen, "the address to listen on"),
+		maxRequestSize:  flags.String("max-request-size", defaultMaxRequestSize, "the largest request body accepted, such as 1MB or 64KiB"),
+		maxAddresses:    flags.Uint64("max-addresses", defaultMaxAddresses, "the most addresses a single /expand request may expand to (0 for no limit)"),
+		shutdownTimeout: flags.Duration("shutdown-timeout", defaultShutdownTimeout, "how long to wait for requests in flight to finish when shutting down"),
+		otlpEndpoint:    flags.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "the base URL of an OpenTelemetry collector to export traces to over OTLP/HTTP, such as http://localhost:4318"),
+		logging:         logging,
+	}
+}
+
+// printServeEndpoints prints the endpoints of the API in the usage of the
+// serve and daemon commands.
+func printServeEndpoints() {
+	fmt.Println("")
+	fmt.Println("Endpoints:")
+	fmt.Println("  POST /expand     expand {\"cidrs\": [...], \"exclude\": [...]} into IPs, streamed as NDJSON with Accept: " + ndjsonContentType)
+	fmt.Println("  GET /expand      a WebSocket streaming the expansion of an expand request message, with progress messages")
+	fmt.Println("  POST /aggregate  merge {\"cidrs\": [...]} into the fewest blocks covering them")
+	fmt.Println("  POST /check      report which of {\"cidrs\": [...]} contain each of {\"ips\": [...]}")
+	fmt.Println("  GET /metrics     the metrics of the server, in the Prometheus text format")
+	fmt.Println("  gRPC " + strings.TrimSuffix(grpcService, "/") + " over HTTP/2 without TLS (proto/cidrsensei/v1/cidrsensei.proto)")
+}
+
+// runServe implements the serve command and returns the process exit code.
+// It serves until ctx is done, then shuts down gracefully, letting requests
+// in flight finish for up to the -shutdown-timeout.
+func runServe(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	options := addServeFlags(flags)
+	flags.Usage = func() {
+		printCommandUsage("serve")
+		printServeEndpoints()
+		fmt.Println("")
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+		printCommandExamples("serve")
+	}
+	_ = flags.Parse(args)
+	if err := options.setup(); err != nil {
+		slog.Error("invalid command line", "error", err)
+		return 1
+	}
+
+	s, err := options.server()
+	if err != nil {
+		slog.Error("invalid command line", "error", err)
+		return 1
+	}
+	code := listenAndServe(ctx, s, options)
+	stopTracing()
+	return code
+}
+
+// setup sets up the logging and tracing the options configure.
+func (o serveOptions) setup() error {
+	if err := o.logging.setup(); err != nil {
+		return err
+	}
+	return startTracing(*o.otlpEndpoint)
+}
+
+// server returns the server the options configure.
+func (o serveOptions) server() (*server, error) {
+	size, err := parseByteSize(*o.maxRequestSize)
+	if err != nil {
+		return nil, err
+	}
+	return &server{maxRequestSize: size, maxAddresses: *o.maxAddresses, metrics: newMetrics()}, nil
+}
+
+// listenAndServe serves the API of s on the -listen address until ctx is
+// done, then shuts down gracefully, and returns the process exit code.
+func listenAndServe(ctx context.Context, s *server, options serveOptions) int {
+	listener, err := net.Listen("tcp", *options.listen)
+	if err != nil {
+		slog.Error("cannot listen", "error", err)
+		return 1
+	}
+	httpServer := &http.Server{
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Stop streaming expansions as soon as the server shuts down
+		BaseContext: func(net.Listener) context.Context { return ctx },
+		// Serve gRPC, which clients call over HTTP/2 without TLS, on the same port
+		Protocols: new(http.Protocols),
+	}
+	httpServer.Protocols.SetHTTP1(true)
+	httpServer.Protocols.SetUnencryptedHTTP2(true)
+	slog.Info("listening", "url", "http://"+listener.Addr().String())
+
+	errChan := make(chan error, 1)
+	go func() { errChan <- httpServer.Serve(listener) }()
+	select {
+	case err := <-errChan:
+		slog.Error("the server failed", "error", err)
+		return 1
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *options.shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("cannot shut down gracefully", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// handler returns the handler of the API's endpoints.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /expand", s.handleExpand)
+	mux.HandleFunc("GET /expand", s.handleWebSocket)
+	mux.HandleFunc("POST /aggregate", s.handleAggregate)
+	mux.HandleFunc("POST /check", s.handleCheck)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("POST "+grpcService+"{method}", handleGRPC(s.newGRPCServer()))
+	if s.jobs != nil {
+		mux.HandleFunc("POST /jobs", s.handleSubmitJob)
+		mux.HandleFunc("GET /jobs", s.handleListJobs)
+		mux.HandleFunc("GET /jobs/{id}", s.handleGetJob)
+		mux.HandleFunc("GET /jobs/{id}/result", s.handleJobResult)
+		mux.HandleFunc("DELETE /jobs/{id}", s.handleDeleteJob)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Debug("request", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+		_, handler := mux.Handler(r)
+		if handler == "" {
+			handler = "other"
+		}
+		ctx, span := startSpan(withTraceparent(r.Context(), r.Header.Get("Traceparent")), spanServer, handler,
+			slog.String("http.request.method", r.Method), slog.String("url.path", r.URL.Path))
+		sw := s.metrics.startRequest(w)
+		mux.ServeHTTP(sw, r.WithContext(ctx))
+		s.metrics.finishRequest(sw, handler)
+		span.set(slog.Int("http.response.status_code", sw.status))
+		if sw.status >= 500 {
+			span.finish(errors.New(http.StatusText(sw.status)))
+		} else {
+			span.finish(nil)
+		}
+	})
+}
+
+// handleExpand expands the blocks of the request, less the excluded ones,
+// into a JSON response, or into a stream of NDJSON lines when the client
+// accepts them.
+func (s *server) handleExpand(w http.ResponseWriter, r *http.Request) {
+	var req expandRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+	ranges, err := s.expandRanges(req)
+	if _, ok := err.(*overLimitError); ok {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	count := cidrsensei.Size(ranges)
+
+	start := time.Now()
+	if strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		lines, err := streamExpansion(w, r, ranges)
+		s.metrics.observeExpansion("ndjson", lines, time.Since(start), err)
+		return
+	}
+	if count > maxJSONAddresses {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("the blocks expand to %d addresses, more than %d can be returned as JSON; request them with Accept: %s", count, maxJSONAddresses, ndjsonContentType))
+		return
+	}
+	err = writeExpandResponse(w, count, ranges)
+	s.metrics.observeExpansion("json", count, time.Since(start), err)
+}
+
+// writeExpandResponse writes the JSON response to a POST /expand request,
+// {"count": count, "ips": [...]}, with the addresses of the ranges written
+// as they are expanded rather than held to be encoded.
+func writeExpandResponse(w http.ResponseWriter, count uint64, ranges []cidrsensei.Range) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `{"count":%d,"ips":[`, count)
+	sep := ""
+	err := cidrsensei.Expand(ranges, func(addr netip.Addr) error {
+		_, err := fmt.Fprintf(bw, `%s"%s"`, sep, addr)
+		sep = ","
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("]}\n")
+	return bw.Flush()
+}
+
+// streamExpansion writes each address of the ranges as an NDJSON line,
+// flushing a chunk every streamFlushLines lines, and returns the number of
+// lines written. It stops when the client goes away or the server shuts
+// down.
+func streamExpansion(w http.ResponseWriter, r *http.Request, ranges []cidrsensei.Range) (uint64, error) {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	var lines uint64
+	err := cidrsensei.Expand(ranges, func(addr netip.Addr) error {
+		if _, err := fmt.Fprintf(w, "{\"address\":\"%s\"}\n", addr); err != nil {
+			return err
+		}
+		if lines++; lines%streamFlushLines == 0 {
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return r.Context().Err()
+		}
+		return nil
+	})
+	return lines, err
+}
+
+// handleAggregate merges the blocks of the request.
+func (s *server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	var req aggregateRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+	ranges, err := parseRequestRanges(req.CIDRs)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp := aggregateResponse{CIDRs: []string{}, Addresses: cidrsensei.Size(cidrsensei.Merge(ranges))}
+	for _, prefix := range cidrsensei.Prefixes(ranges) {
+		resp.CIDRs = append(resp.CIDRs, prefix.String())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleCheck reports which blocks of the request contain each of its IPs.
+func (s *server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	var req checkRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+	results, err := checkRequestIPs(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, checkResponse{Results: results})
+}
+
+// decode reads the JSON body of the request into v, answering the request
+// with an error and returning false when it cannot: 413 for a body over the
+// -max-request-size, and 400 for one that is not a valid request.
+func (s *server) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("the request body is larger than the limit of %d bytes", tooLarge.Limit))
+			return false
+		}
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// overLimitError is the error of a request expanding to more addresses
+// than the -max-addresses.
+type overLimitError struct {
+	count, limit uint64
+}
+
+func (e *overLimitError) Error() string {
+	return fmt.Sprintf("the blocks expand to %d addresses, more than the limit of %d", e.count, e.limit)
+}
+
+// expandRanges returns the ranges of the addresses an expand request
+// expands to.
+func (s *server) expandRanges(req expandRequest) ([]cidrsensei.Range, error) {
+	ranges, err := parseRequestRanges(req.CIDRs)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := parseRequestRanges(req.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	ranges = cidrsensei.Subtract(ranges, exclude)
+
+	if count := cidrsensei.Size(ranges); s.maxAddresses > 0 && count > s.maxAddresses {
+		return nil, &overLimitError{count: count, limit: s.maxAddresses}
+	}
+	return ranges, nil
+}
+
+// checkRequestIPs reports which blocks of a check request contain each of
+// its IPs.
+func checkRequestIPs(req checkRequest) ([]containsResult, error) {
+	ranges, err := parseRequestRanges(req.CIDRs)
+	if err != nil {
+		return nil, err
+	}
+	var cidrRanges []CIDRRange
+	for _, r := range ranges {
+		cidrRanges = append(cidrRanges, rangeToCIDRs(r)...)
+	}
+	return checkContains(req.IPs, cidrRanges, defaultAlgorithm)
+}
+
+// parseRequestRanges parses the CIDR blocks, IPs and address ranges of a
+// request. Unlike -cidr entries, they are never looked up on the network.
+func parseRequestRanges(entries []string) ([]cidrsensei.Range, error) {
+	ranges := make([]cidrsensei.Range, 0, len(entries))
+	for _, entry := range entries {
+		r, err := cidrsensei.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// writeJSON writes v as the JSON body of a response with the status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes err as the JSON body of a response with the status
+// code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,66 @@
+package main
+
+//go:generate go run gen_sets.go
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// builtinSet is a named list of special-purpose blocks that can be given as
+// an entry with an "@" prefix, e.g. -exclude @bogons.
+type builtinSet struct {
+	description string
+	cidrs       []string
+}
+
+// parseBuiltinSet returns the ranges of the built-in set with the given
+// name.
+func parseBuiltinSet(name string) ([]CIDRRange, error) {
+	set, ok := builtinSets[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown address set @%s (use -list-sets to list them)", name)
+	}
+	cidrRanges := make([]CIDRRange, 0, len(set.cidrs))
+	for _, cidrStr := range set.cidrs {
+		cidr, err := parseCIDR(cidrStr)
+		if err != nil {
+			return nil, err
+		}
+		cidrRanges = append(cidrRanges, cidr)
+	}
+	return cidrRanges, nil
+}
+
+// runListSets writes the built-in address sets, followed by the aliases of
+// the settings file, and returns the process exit code.
+func runListSets(config Config) int {
+	type listedSet struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		CIDRs       []string `json:"cidrs"`
+	}
+
+	header := []string{"name", "description", "cidrs"}
+	var sets []listedSet
+	var rows [][]string
+	for _, name := range slices.Sorted(maps.Keys(builtinSets)) {
+		set := builtinSets[name]
+		sets = append(sets, listedSet{Name: "@" + name, Description: set.description, CIDRs: set.cidrs})
+		rows = append(rows, []string{"@" + name, set.description, strings.Join(set.cidrs, ";")})
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.Aliases)) {
+		entries := config.Aliases[name]
+		sets = append(sets, listedSet{Name: "@" + name, Description: "Alias", CIDRs: entries})
+		rows = append(rows, []string{"@" + name, "Alias", strings.Join(entries, ";")})
+	}
+	if err := writeReport(os.Stdout, config.OutputFormat, sets, header, rows); err != nil {
+		slog.Error("cannot write output", "error", err)
+		return 1
+	}
+	return 0
+}
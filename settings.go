@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	settingsFileName = ".cidr-sensei.yaml"
+	settingsEnvVar   = "CIDR_SENSEI_CONFIG"
+	envPrefix        = "CIDR_SENSEI_"
+)
+
+// settingsFlags are the flags whose defaults the settings file and
+// environment can change. Each is named the same in the file, and by its
+// upper-case name with an underscore for each dash in the environment, e.g.
+// CIDR_SENSEI_OUTPUT_DIR for -output-dir.
+var settingsFlags = []string{"output", "concurrency", "algorithm", "output-dir", "cache-dir"}
+
+// settings holds the defaults read from ~/.cidr-sensei.yaml, such as:
+//
+//	output: json
+//	concurrency: 200
+//	output-dir: ~/cidr-sensei
+//	aliases:
+//	  corp-lan: [10.0.0.0/8, 172.16.0.0/12]
+type settings struct {
+	Output      *string `yaml:"output"`
+	Concurrency *int    `yaml:"concurrency"`
+	Algorithm   *string `yaml:"algorithm"`
+	OutputDir   *string `yaml:"output-dir"`
+	CacheDir    *string `yaml:"cache-dir"`
+
+	Aliases map[string]aliasEntries `yaml:"aliases"`
+}
+
+// aliasEntries are the entries of a named alias, written either as a list
+// or as a comma-separated string.
+type aliasEntries []string
+
+// UnmarshalYAML accepts a sequence of entries or a comma-separated scalar.
+func (a *aliasEntries) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*a = splitList(node.Value)
+		return nil
+	}
+	var entries []string
+	if err := node.Decode(&entries); err != nil {
+		return err
+	}
+	*a = entries
+	return nil
+}
+
+// values returns the flag values the settings file sets, by flag name.
+func (s settings) values() map[string]string {
+	values := make(map[string]string)
+	for name, value := range map[string]*string{"output": s.Output, "algorithm": s.Algorithm, "output-dir": s.OutputDir, "cache-dir": s.CacheDir} {
+		if value != nil {
+			values[name] = *value
+		}
+	}
+	if s.Concurrency != nil {
+		values["concurrency"] = fmt.Sprint(*s.Concurrency)
+	}
+	return values
+}
+
+// settingsPath returns the settings file to read, which is the one named by
+// CIDR_SENSEI_CONFIG or else ~/.cidr-sensei.yaml, and whether it was named
+// explicitly, in which case it must exist.
+func settingsPath() (string, bool) {
+	if path := os.Getenv(settingsEnvVar); path != "" {
+		return path, true
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(home, settingsFileName), false
+}
+
+// loadSettings reads the settings file and CIDR_SENSEI_* environment
+// variables and makes them the defaults of the flags in flags, so that the
+// flags given on the command line override the environment, which in turn
+// overrides the file. It returns the settings read from the file.
+func loadSettings(flags *flag.FlagSet) (settings, error) {
+	var s settings
+	path, explicit := settingsPath()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			decoder := yaml.NewDecoder(bytes.NewReader(data))
+			decoder.KnownFields(true)
+			if err := decoder.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+				return s, fmt.Errorf("error parsing %s: %w", path, err)
+			}
+			if err := checkAliases(s.Aliases); err != nil {
+				return s, fmt.Errorf("%s: %w", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return s, fmt.Errorf("error reading %s: %w", path, err)
+		}
+	}
+
+	values := s.values()
+	for name, value := range values {
+		if err := setDefault(flags, name, value); err != nil {
+			return s, fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+	for _, name := range settingsFlags {
+		env := envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if value, ok := os.LookupEnv(env); ok {
+			if err := setDefault(flags, name, value); err != nil {
+				return s, fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// setDefault sets the value of a flag before the command line is parsed and
+// shows it as the default in the usage message, replacing rather than adding
+// to the -output formats. A leading ~ in directories is expanded to the home
+// directory.
+func setDefault(flags *flag.FlagSet, name, value string) error {
+	f := flags.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("unknown setting")
+	}
+	if strings.HasSuffix(name, "-dir") {
+		value = expandHome(value)
+	}
+	if output, ok := f.Value.(*outputFlag); ok {
+		output.replace = true
+	}
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	f.DefValue = value
+	return nil
+}
+
+// expandHome replaces a leading ~ in path with the home directory.
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~")
+	if !ok || (rest != "" && rest[0] != '/' && rest[0] != filepath.Separator) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return home + rest
+}
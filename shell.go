@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const shellPrompt = "cidr-sensei> "
+
+// shellCommand is a command of the shell.
+type shellCommand struct {
+	name    string
+	usage   string // the arguments after the name
+	summary string
+	// lists is the number of arguments naming a loaded list, which Tab
+	// completes, and -1 for a command taking a list and then list files.
+	lists int
+}
+
+// shellCommands lists the commands of the shell.
+var shellCommands = []shellCommand{
+	{"load", "NAME SOURCE...", "Load CIDR blocks, IPs, ranges, list files or URLs into a list, replacing it", -1},
+	{"add", "NAME SOURCE...", "Add CIDR blocks, IPs, ranges, list files or URLs to a list", -1},
+	{"lists", "", "Show the loaded lists with their numbers of blocks and addresses", 0},
+	{"show", "NAME", "Show the merged blocks of a list", 1},
+	{"expand", "NAME [LIMIT]", "Print the IPs of a list, up to LIMIT of them", 1},
+	{"check", "NAME IP...", "Report which blocks of a list contain each IP", 1},
+	{"diff", "OLD NEW", "Report the addresses added and removed between two lists", 2},
+	{"drop", "NAME", "Forget a list", 1},
+	{"history", "", "Show the commands entered", 0},
+	{"help", "", "Show the commands", 0},
+	{"exit", "", "Leave the shell (or Ctrl-D)", 0},
+}
+
+// shellSession is the state of the shell: the lists loaded so far, by name.
+type shellSession struct {
+	config  Config
+	fetcher *fetcher
+	parser  *cidrParser
+	lists   map[string][]CIDRRange
+	editor  *lineEditor
+}
+
+// runShell implements the shell command and returns the process exit code:
+// that of the last command, 0 for success and 1 for an error. The blocks of
+// -cidr and the other input sources are loaded as the list named default.
+func runShell(config Config) int {
+	s := &shellSession{
+		config:  config,
+		fetcher: newFetcher(config.FetchTimeout, config.FetchRetries, config.CacheDir, config.NoCache),
+		lists:   make(map[string][]CIDRRange),
+		editor:  newLineEditor(os.Stdin, os.Stdout),
+	}
+	s.parser = newCIDRParser(context.Background(), config, s.fetcher)
+	s.editor.complete = s.complete
+	historyPath := shellHistoryPath(config)
+	if s.editor.terminal {
+		s.editor.history = readShellHistory(historyPath)
+		fmt.Println("Type help for the commands, and exit or Ctrl-D to leave.")
+	}
+
+	status := 0
+	if config.hasSource() {
+		status = s.run(func(ctx context.Context) error {
+			cidrRanges, err := loadCIDRRanges(config, s.parser, collectEntries(config.CIDRListStr, "-cidr", inputSources(ctx, config, s.fetcher)...))
+			s.lists["default"] = cidrRanges
+			return err
+		})
+	}
+	for {
+		line, err := s.editor.readLine(shellPrompt)
+		if errors.Is(err, errLineInterrupted) {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s.editor.addHistory(line)
+		args := strings.Fields(line)
+		if args[0] == "exit" || args[0] == "quit" {
+			break
+		}
+		status = s.run(func(ctx context.Context) error {
+			return s.dispatch(ctx, args[0], args[1:])
+		})
+	}
+
+	if s.editor.terminal {
+		if err := writeShellHistory(historyPath, s.editor.history); err != nil {
+			slog.Warn("cannot write the shell history", "error", err)
+		}
+	}
+	return status
+}
+
+// errReported is the error of a command that printed its error itself.
+var errReported = errors.New("command failed")
+
+// run runs a command, which SIGINT interrupts, and returns its status.
+func (s *shellSession) run(command func(ctx context.Context) error) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := command(ctx); err != nil {
+		if err != errReported {
+			fmt.Printf("Error: %s\n", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+// dispatch runs the shell command name with its arguments.
+func (s *shellSession) dispatch(ctx context.Context, name string, args []string) error {
+	c, ok := s.lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown command %q (type help for the commands)", name)
+	}
+	if c.lists > 0 && len(args) < c.lists || c.lists < 0 && len(args) < 2 {
+		return fmt.Errorf("usage: %s %s", c.name, c.usage)
+	}
+
+	switch name {
+	case "load", "add":
+		cidrRanges, err := s.load(ctx, args[1:])
+		if err != nil {
+			return err
+		}
+		if name == "add" {
+			cidrRanges = append(s.lists[args[0]], cidrRanges...)
+		}
+		s.lists[args[0]] = dedupeCIDRRanges(cidrRanges)
+		fmt.Printf("%s: %d blocks, %d addresses\n", args[0], len(s.lists[args[0]]), totalSize(mergeIPRanges(toIPRanges(s.lists[args[0]]))))
+		return nil
+
+	case "lists":
+		header := []string{"name", "blocks", "addresses"}
+		type listSize struct {
+			Name      string `json:"name"`
+			Blocks    int    `json:"blocks"`
+			Addresses uint64 `json:"addresses"`
+		}
+		sizes := []listSize{}
+		var rows [][]string
+		for _, name := range slices.Sorted(maps.Keys(s.lists)) {
+			size := listSize{name, len(s.lists[name]), totalSize(mergeIPRanges(toIPRanges(s.lists[name])))}
+			sizes = append(sizes, size)
+			rows = append(rows, []string{name, strconv.Itoa(size.Blocks), strconv.FormatUint(size.Addresses, 10)})
+		}
+		return writeReport(os.Stdout, s.config.OutputFormat, sizes, header, rows)
+
+	case "show":
+		list, err := s.list(args[0])
+		if err != nil {
+			return err
+		}
+		return writeCIDRList(os.Stdout, s.config.OutputFormat, rangesToCIDRs(mergeIPRanges(toIPRanges(list))))
+
+	case "expand":
+		list, err := s.list(args[0])
+		if err != nil {
+			return err
+		}
+		var limit uint64
+		if len(args) > 1 {
+			if limit, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+				return fmt.Errorf("invalid limit: %s", args[1])
+			}
+		}
+		w := bufio.NewWriter(os.Stdout)
+		err = pageIPs(list, 0, limit, nil, interruptible(ctx, func(ip string) error {
+			_, err := fmt.Fprintln(w, ip)
+			return err
+		}))
+		if flushErr := w.Flush(); err == nil {
+			err = flushErr
+		}
+		return err
+
+	case "check":
+		list, err := s.list(args[0])
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("usage: %s %s", c.name, c.usage)
+		}
+		if runContains(Config{Contains: strings.Join(args[1:], ","), OutputFormat: s.config.OutputFormat, Algorithm: s.config.Algorithm}, list) == 1 {
+			return errReported
+		}
+		return nil
+
+	case "diff":
+		before, err := s.list(args[0])
+		if err != nil {
+			return err
+		}
+		after, err := s.list(args[1])
+		if err != nil {
+			return err
+		}
+		return writeDiff(os.Stdout, s.config.OutputFormat, diffRanges(toIPRanges(before), toIPRanges(after)))
+
+	case "drop":
+		if _, err := s.list(args[0]); err != nil {
+			return err
+		}
+		delete(s.lists, args[0])
+		return nil
+
+	case "history":
+		for i, line := range s.editor.history {
+			fmt.Printf("%5d  %s\n", i+1, line)
+		}
+		return nil
+
+	default: // help
+		for _, c := range shellCommands {
+			fmt.Printf("  %-28s %s\n", strings.TrimSpace(c.name+" "+c.usage), c.summary)
+		}
+		fmt.Println("")
+		fmt.Println("A SOURCE is a comma-separated list of entries as taken by -cidr, or a list file, glob pattern or URL.")
+		return nil
+	}
+}
+
+// lookup returns the shell command named name.
+func (s *shellSession) lookup(name string) (shellCommand, bool) {
+	i := slices.IndexFunc(shellCommands, func(c shellCommand) bool { return c.name == name })
+	if i < 0 {
+		return shellCommand{}, false
+	}
+	return shellCommands[i], true
+}
+
+// list returns the loaded list named name.
+func (s *shellSession) list(name string) ([]CIDRRange, error) {
+	list, ok := s.lists[name]
+	if !ok {
+		return nil, fmt.Errorf("no list named %s is loaded (see lists)", name)
+	}
+	return list, nil
+}
+
+// load parses the blocks of the sources of a load or add command. Sources
+// naming existing files or glob patterns matching some, URLs, and S3 and
+// Cloud Storage objects are read as list files, and the others are entries.
+func (s *shellSession) load(ctx context.Context, sources []string) ([]CIDRRange, error) {
+	var entries []string
+	var files []iter.Seq2[inputEntry, error]
+	format := s.config.inputFormat()
+	for _, source := range sources {
+		switch {
+		case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+			files = append(files, fromSource(source, s.fetcher.entries(ctx, source, "", format)))
+		case isObjectURI(source) || isShellFile(source):
+			files = append(files, fileSources(ctx, s.fetcher, []string{source}, format)...)
+		default:
+			entries = append(entries, source)
+		}
+	}
+	return loadCIDRRanges(s.config, s.parser, collectEntries(strings.Join(entries, ","), "load", files...))
+}
+
+// isShellFile reports whether a source names a file, or is a glob pattern
+// matching some. Octet ranges such as 10.0.*.1 are patterns matching none.
+func isShellFile(source string) bool {
+	if _, err := os.Stat(source); err == nil {
+		return true
+	}
+	matches, _ := filepath.Glob(source)
+	return len(matches) > 0
+}
+
+// complete returns the candidates for the last word of line: the commands
+// for the first word, and the names of the loaded lists or files after
+// commands taking them.
+func (s *shellSession) complete(line string) (int, []string) {
+	start := strings.LastIndexByte(line, ' ') + 1
+	word := line[start:]
+	fields := strings.Fields(line[:start])
+
+	var words []string
+	switch {
+	case len(fields) == 0:
+		for _, c := range shellCommands {
+			words = append(words, c.name)
+		}
+	default:
+		c, ok := s.lookup(fields[0])
+		if !ok {
+			return start, nil
+		}
+		arg := len(fields) - 1
+		if arg < c.lists || c.lists < 0 && arg == 0 {
+			words = slices.Sorted(maps.Keys(s.lists))
+		} else if c.lists < 0 {
+			return start, completeFiles(word)
+		}
+	}
+	var candidates []string
+	for _, w := range words {
+		if strings.HasPrefix(w, word) {
+			candidates = append(candidates, w)
+		}
+	}
+	return start, candidates
+}
+
+// completeFiles returns the files and directories starting with prefix,
+// with a slash after each directory.
+func completeFiles(prefix string) []string {
+	matches, _ := filepath.Glob(escapeGlob(prefix) + "*")
+	for i, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			matches[i] += string(filepath.Separator)
+		}
+	}
+	return matches
+}
+
+// escapeGlob escapes the metacharacters of filepath.Match in s.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// shellHistoryPath returns the file the shell history is kept in, in the
+// -cache-dir or the user's cache directory.
+func shellHistoryPath(config Config) string {
+	dir := config.CacheDir
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(userCacheDir, "cidr-sensei")
+	}
+	return filepath.Join(dir, "shell_history")
+}
+
+// readShellHistory returns the lines of the history file, if there is one.
+func readShellHistory(path string) []string {
+	data, err := os.ReadFile(path)
+	if path == "" || err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	return slices.DeleteFunc(lines, func(line string) bool { return line == "" })
+}
+
+// writeShellHistory writes the history to its file.
+func writeShellHistory(path string, history []string) error {
+	if path == "" || len(history) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0o600)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sinkSchemes lists the network sinks -output takes as a URL instead of a
+// format, such as tcp://collector:9000. syslog:// sends RFC 5424 messages
+// over UDP and syslog+tcp:// over TCP with octet-counting framing (RFC
+// 6587).
+var sinkSchemes = []string{"tcp", "udp", "syslog", "syslog+tcp", "kafka", "redis", "rediss", "postgres", "postgresql"}
+
+// outputSink is a network destination the IPs, or the merged blocks, are
+// sent to one at a time.
+type outputSink interface {
+	send(ip string) error
+	close() error
+}
+
+// newOutputSink connects to the -output sink. Sinks keying messages by
+// their block look the IPs up in cidrRanges.
+func newOutputSink(config Config, cidrRanges []CIDRRange) (outputSink, error) {
+	switch {
+	case strings.HasPrefix(config.OutputFormat, "kafka://"):
+		return newKafkaProducer(config, cidrRanges)
+	case strings.HasPrefix(config.OutputFormat, "redis"):
+		return newRedisSink(config)
+	case strings.HasPrefix(config.OutputFormat, "postgres"):
+		return newPostgresWriter(config, cidrRanges)
+	}
+	return newSocketSink(config.OutputFormat, config.SinkRetries)
+}
+
+// checkSinkURL reports whether an -output sink is well formed, without
+// connecting to it.
+func checkSinkURL(output string) error {
+	switch {
+	case strings.HasPrefix(output, "kafka://"):
+		_, _, err := parseKafkaURL(output)
+		return err
+	case strings.HasPrefix(output, "redis"):
+		_, err := parseRedisURL(output)
+		return err
+	case strings.HasPrefix(output, "postgres"):
+		_, err := parsePostgresURL(output)
+		return err
+	}
+	_, _, err := parseSinkURL(output)
+	return err
+}
+
+// writeCIDRSink sends the blocks to the -output sink.
+func writeCIDRSink(config Config, blocks []CIDRRange) error {
+	sink, err := newOutputSink(config, blocks)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if err := sink.send(block.String()); err != nil {
+			sink.close()
+			return err
+		}
+	}
+	return sink.close()
+}
+
+const (
+	defaultSyslogPort = "514"
+	// sinkBufferSize is how much stream output is held before it is written
+	// to the connection.
+	sinkBufferSize = 64 << 10
+	// sinkWriteTimeout is how long a write may block on a collector that is
+	// not reading before the connection is given up and made again.
+	sinkWriteTimeout = 30 * time.Second
+	// syslogPriority is the user facility at the informational severity.
+	syslogPriority = 1*8 + 6
+	// syslogTimestamp is the RFC 5424 timestamp layout.
+	syslogTimestamp = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// isSinkURL reports whether an -output value is a network sink.
+func isSinkURL(output string) bool {
+	scheme, _, ok := strings.Cut(output, "://")
+	return ok && slices.Contains(sinkSchemes, scheme)
+}
+
+// parseSinkURL returns the scheme and host:port of a network sink, with
+// syslog's port defaulting to 514.
+func parseSinkURL(output string) (string, string, error) {
+	u, err := url.Parse(output)
+	if err != nil || u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return "", "", fmt.Errorf("invalid output sink: %s (expected %s://host:port)", output, strings.SplitN(output, ":", 2)[0])
+	}
+	port := u.Port()
+	if port == "" {
+		if !strings.HasPrefix(u.Scheme, "syslog") {
+			return "", "", fmt.Errorf("invalid output sink: %s (a port is needed)", output)
+		}
+		port = defaultSyslogPort
+	}
+	return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// socketSink streams each IP to a collector as a line, or as a syslog
+// message. Stream output is buffered and written in blocks, so a slow
+// collector holds up the expansion instead of it piling up in memory. A
+// failed write makes the connection again and writes the rest of the block,
+// up to retries times, backing off between attempts, so a collector that
+// restarts may see the line it was cut off in again.
+type socketSink struct {
+	scheme  string
+	address string
+	retries int
+	conn    net.Conn
+	buf     []byte
+
+	hostname string
+	pid      int
+}
+
+// newSocketSink connects to the sink at output.
+func newSocketSink(output string, retries int) (*socketSink, error) {
+	scheme, address, err := parseSinkURL(output)
+	if err != nil {
+		return nil, err
+	}
+	s := &socketSink{scheme: scheme, address: address, retries: retries, hostname: "-", pid: os.Getpid()}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		s.hostname = hostname
+	}
+	if err := s.retry(s.connect); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// stream reports whether the sink is a TCP connection rather than
+// datagrams.
+func (s *socketSink) stream() bool {
+	return s.scheme == "tcp" || s.scheme == "syslog+tcp"
+}
+
+func (s *socketSink) connect() error {
+	network := "udp"
+	if s.stream() {
+		network = "tcp"
+	}
+	conn, err := net.DialTimeout(network, s.address, sinkWriteTimeout)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s://%s: %w", s.scheme, s.address, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// retry calls attempt until it succeeds or has been retried s.retries times,
+// making the connection again before each retry.
+func (s *socketSink) retry(attempt func() error) error {
+	var err error
+	for i := 0; i <= s.retries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(1<<(i-1)) * 500 * time.Millisecond)
+			if s.conn != nil {
+				s.conn.Close()
+				s.conn = nil
+			}
+			if err = s.connect(); err != nil {
+				continue
+			}
+		}
+		if err = attempt(); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w (after %d attempts)", err, s.retries+1)
+}
+
+// send sends a single IP.
+func (s *socketSink) send(ip string) error {
+	var message string
+	switch s.scheme {
+	case "tcp", "udp":
+		message = ip + "\n"
+	default:
+		message = fmt.Sprintf("<%d>1 %s %s cidr-sensei %d - - %s", syslogPriority, time.Now().Format(syslogTimestamp), s.hostname, s.pid, ip)
+		if s.scheme == "syslog+tcp" {
+			message = fmt.Sprintf("%d %s", len(message), message)
+		}
+	}
+
+	if !s.stream() {
+		return s.retry(func() error {
+			_, err := s.conn.Write([]byte(message))
+			return err
+		})
+	}
+	s.buf = append(s.buf, message...)
+	if len(s.buf) >= sinkBufferSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered stream output.
+func (s *socketSink) flush() error {
+	pending := s.buf
+	err := s.retry(func() error {
+		for len(pending) > 0 {
+			s.conn.SetWriteDeadline(time.Now().Add(sinkWriteTimeout))
+			n, err := s.conn.Write(pending)
+			pending = pending[n:]
+			if err != nil {
+				return fmt.Errorf("error writing to %s://%s: %w", s.scheme, s.address, err)
+			}
+		}
+		return nil
+	})
+	s.buf = s.buf[:0]
+	return err
+}
+
+// close writes out the buffered output and closes the connection.
+func (s *socketSink) close() error {
+	err := s.flush()
+	if s.conn != nil {
+		if closeErr := s.conn.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
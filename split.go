@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// byteUnits are the suffixes -split-size takes, in decimal and binary
+// multiples of a byte.
+var byteUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// parseByteSize parses a size such as 500MB or 2GiB into bytes.
+func parseByteSize(s string) (int64, error) {
+	number := strings.TrimRightFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[len(number):]))]
+	n, err := strconv.ParseInt(number, 10, 64)
+	if !ok || err != nil || n <= 0 || n > (1<<62)/unit {
+		return 0, fmt.Errorf("invalid size: %s (expected bytes, or a whole number with a unit such as 500MB or 2GiB)", s)
+	}
+	return n * unit, nil
+}
+
+// checkSplit reports whether the outputs can be split as -split-size or
+// -split-count asks. Split files are numbered after the output file, so
+// output written to stdout or a network sink cannot be split, and output
+// written only once the expansion has finished cannot be split by size.
+func checkSplit(config Config) error {
+	if config.SplitSize == "" && config.SplitCount == 0 {
+		return nil
+	}
+	if config.SplitSize != "" && config.SplitCount != 0 {
+		return fmt.Errorf("the -split-size and -split-count flags cannot be used together")
+	}
+	if config.SplitCount < 0 {
+		return fmt.Errorf("invalid -split-count: %d", config.SplitCount)
+	}
+	if config.SplitSize != "" {
+		if _, err := parseByteSize(config.SplitSize); err != nil {
+			return err
+		}
+	}
+	if config.report() {
+		return fmt.Errorf("only expansions can be split into several files")
+	}
+	for _, output := range config.Outputs {
+		switch {
+		case isSinkURL(output):
+			return fmt.Errorf("network -output sinks cannot be split into files")
+		case config.OutFile == "-" || (config.OutFile == "" && (output == "terminal" || output == "template")):
+			return fmt.Errorf("split output is written to numbered files, and stdout cannot be split (%s output needs an -outfile)", output)
+		case config.SplitSize != "" && slices.Contains([]string{"parquet", "roaring", "sqlite"}, output):
+			return fmt.Errorf("%s output is not written as the IPs are expanded, and can only be split with -split-count", output)
+		}
+	}
+	return nil
+}
+
+// outputSplit numbers the files an output is split into, after the path the
+// output would have been written to unsplit: ips.csv becomes ips-0001.csv,
+// ips-0002.csv and so on, listed with their record counts in
+// ips.csv.manifest.json.
+type outputSplit struct {
+	base    string
+	format  string
+	size    int64  // the bytes a file is closed at with -split-size
+	files   int    // the number of files with -split-count
+	perFile uint64 // the IPs of each but the last file with -split-count
+	written []splitFile
+}
+
+// splitFile is a file of a split output, as listed in the manifest.
+type splitFile struct {
+	Name    string `json:"name"`
+	Records int    `json:"records"`
+}
+
+// newOutputSplit splits the output that would be written to path. With
+// -split-count, the IPs are spread evenly over the files, using the size
+// of the expansion of cidrRanges.
+func newOutputSplit(config Config, path string, cidrRanges []CIDRRange) (*outputSplit, error) {
+	s := &outputSplit{base: path, format: config.OutputFormat, files: config.SplitCount}
+	if config.SplitSize != "" {
+		size, err := parseByteSize(config.SplitSize)
+		if err != nil {
+			return nil, err
+		}
+		s.size = size
+	} else {
+		total := expansionSize(config, cidrRanges)
+		s.perFile = max((total+uint64(s.files)-1)/uint64(s.files), 1)
+	}
+	return s, nil
+}
+
+// expansionSize returns the number of IPs the expansion of cidrRanges emits,
+// taking -sample, -offset, -limit and the union -dedupe writes into
+// account.
+func expansionSize(config Config, cidrRanges []CIDRRange) uint64 {
+	merged := totalSize(mergeIPRanges(toIPRanges(cidrRanges)))
+	switch {
+	case config.Sample > 0:
+		return min(config.Sample, merged)
+	case config.Offset > 0 || config.Limit > 0:
+		if config.Offset >= merged {
+			return 0
+		}
+		n := merged - config.Offset
+		if config.Limit > 0 {
+			n = min(n, config.Limit)
+		}
+		return n
+	case config.Dedupe:
+		return merged
+	}
+	return totalSize(toIPRanges(cidrRanges))
+}
+
+// next returns the path of the next file.
+func (s *outputSplit) next() string {
+	ext := filepath.Ext(s.base)
+	path := fmt.Sprintf("%s-%04d%s", strings.TrimSuffix(s.base, ext), len(s.written)+1, ext)
+	s.written = append(s.written, splitFile{Name: filepath.Base(path)})
+	return path
+}
+
+// done records the number of IPs written to the current file.
+func (s *outputSplit) done(records int) {
+	s.written[len(s.written)-1].Records = records
+}
+
+// full reports whether the file w is writing is full, and the next IP
+// starts a new one. A file is full once it reaches -split-size, so it goes
+// over by at most one IP and the end of the format, or at its share of the
+// expansion with -split-count, where any IPs over the expected number go to
+// the last file.
+func (s *outputSplit) full(w *ipWriter) bool {
+	if w.count == 0 {
+		return false
+	}
+	if s.size > 0 {
+		return w.out.n+int64(w.w.Buffered()) >= s.size
+	}
+	return len(s.written) < s.files && uint64(w.count) >= s.perFile
+}
+
+// writeManifest writes the manifest listing the files next to them.
+func (s *outputSplit) writeManifest() error {
+	manifest := struct {
+		Format  string      `json:"format"`
+		Records int         `json:"records"`
+		Files   []splitFile `json:"files"`
+	}{Format: s.format, Files: s.written}
+	for _, file := range s.written {
+		manifest.Records += file.Records
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.base+".manifest.json", append(data, '\n'), 0o644)
+}
+
+// rotate finishes the current file of a split output and opens the next.
+func (w *ipWriter) rotate() error {
+	if err := w.finish(); err != nil {
+		return err
+	}
+	w.split.done(w.count)
+	w.count = 0
+	return w.open(w.split.next())
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
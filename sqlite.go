@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// sqliteDriver is the database/sql driver name of the SQLite driver, which
+// is only registered on the platforms it supports.
+const sqliteDriver = "sqlite"
+
+// sqliteQuery returns the query selecting the rows of -input-sqlite.
+func sqliteQuery(config Config) (string, error) {
+	switch {
+	case config.SQLiteQuery != "" && config.SQLiteTable != "":
+		return "", fmt.Errorf("the -sqlite-query and -sqlite-table flags cannot be used together")
+	case config.SQLiteQuery != "":
+		return config.SQLiteQuery, nil
+	case config.SQLiteTable != "":
+		return `SELECT * FROM "` + strings.ReplaceAll(config.SQLiteTable, `"`, `""`) + `"`, nil
+	}
+	return "", fmt.Errorf("the -sqlite-query or -sqlite-table flag is required with -input-sqlite")
+}
+
+// sqliteDSN returns the data source name to open dsn with. A plain path is
+// opened read-only, so that a mistyped path is reported instead of creating
+// an empty database.
+func sqliteDSN(dsn string) (string, error) {
+	if strings.HasPrefix(dsn, "file:") {
+		return dsn, nil
+	}
+	if _, err := os.Stat(dsn); err != nil {
+		return "", err
+	}
+	return "file:" + (&url.URL{Path: dsn}).EscapedPath() + "?mode=ro", nil
+}
+
+// readSQLiteEntries yields the entries selected by the -input-sqlite query.
+// The entries are taken from the -sqlite-column column, or else from the
+// first column named like a CIDR column (see csvCIDRColumns) or holding a
+// CIDR block or IP in the first row. Each entry's origin is its row number.
+func readSQLiteEntries(ctx context.Context, config Config) iter.Seq2[inputEntry, error] {
+	return func(yield func(inputEntry, error) bool) {
+		name := config.InputSQLite
+		fail := func(err error) {
+			yield(inputEntry{}, fmt.Errorf("error reading %s: %w", name, err))
+		}
+		if !slices.Contains(sql.Drivers(), sqliteDriver) {
+			fail(fmt.Errorf("SQLite input is not supported on %s/%s", runtime.GOOS, runtime.GOARCH))
+			return
+		}
+		query, err := sqliteQuery(config)
+		if err != nil {
+			yield(inputEntry{}, err)
+			return
+		}
+		dsn, err := sqliteDSN(name)
+		if err != nil {
+			fail(err)
+			return
+		}
+		db, err := sql.Open(sqliteDriver, dsn)
+		if err != nil {
+			fail(err)
+			return
+		}
+		defer db.Close()
+
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			fail(err)
+			return
+		}
+		defer rows.Close()
+		columns, err := rows.Columns()
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		column := -1
+		if config.SQLiteColumn != "" {
+			if column = slices.IndexFunc(columns, func(c string) bool { return strings.EqualFold(c, config.SQLiteColumn) }); column < 0 {
+				fail(fmt.Errorf("the query has no column %q (columns: %s)", config.SQLiteColumn, strings.Join(columns, ", ")))
+				return
+			}
+		} else {
+			column = csvHeaderColumn(columns)
+		}
+
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for row := 1; rows.Next(); row++ {
+			if err := rows.Scan(dest...); err != nil {
+				fail(err)
+				return
+			}
+			if column < 0 {
+				record := make([]string, len(values))
+				for i, value := range values {
+					record[i] = value.String
+				}
+				if column = csvEntryColumn(record); column < 0 {
+					fail(fmt.Errorf("no column named such as %q or holding CIDR blocks (columns: %s); select one with -sqlite-column", csvCIDRColumns[0], strings.Join(columns, ", ")))
+					return
+				}
+			}
+
+			value := strings.TrimSpace(values[column].String)
+			if !values[column].Valid || value == "" {
+				continue
+			}
+			if !yield(inputEntry{text: value, origin: fmt.Sprintf("%s:row %d", name, row)}, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			fail(err)
+		}
+	}
+}
+
+// sqliteBatchRows is the number of rows of SQLite output inserted in each
+// transaction.
+const sqliteBatchRows = 10000
+
+// sqliteWriter inserts expanded IPs into a table of a SQLite database, in
+// transactions of sqliteBatchRows rows. The table is created, along with an
+// index on the integer form of the addresses, if it does not exist, and rows
+// are added to those already in it.
+type sqliteWriter struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	insert  *sql.Stmt
+	query   string
+	sources *sourceIndex
+	rows    int
+}
+
+// newSQLiteWriter opens or creates the database at path and the table.
+func newSQLiteWriter(path, table, algorithm string, cidrRanges []CIDRRange) (*sqliteWriter, error) {
+	if !slices.Contains(sql.Drivers(), sqliteDriver) {
+		return nil, fmt.Errorf("SQLite output is not supported on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	if table == "" {
+		return nil, fmt.Errorf("the -output-table flag cannot be empty")
+	}
+	dsn := path
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + (&url.URL{Path: path}).EscapedPath()
+	}
+	db, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	quoted := sqliteIdentifier(table)
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS ` + quoted + ` (address TEXT NOT NULL, integer INTEGER NOT NULL, source TEXT NOT NULL, tags TEXT NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS ` + sqliteIdentifier(table+"_integer") + ` ON ` + quoted + ` (integer)`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating table %s in %s: %w", table, path, err)
+		}
+	}
+	return &sqliteWriter{
+		db:      db,
+		query:   `INSERT INTO ` + quoted + ` (address, integer, source, tags) VALUES (?, ?, ?, ?)`,
+		sources: newSourceIndex(algorithm, cidrRanges),
+	}, nil
+}
+
+// sqliteIdentifier quotes name for use as an identifier.
+func sqliteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// write inserts the row of an IP, starting a transaction if there is none.
+func (w *sqliteWriter) write(ip string) error {
+	n, source, tags, err := w.sources.describe(ip)
+	if err != nil {
+		return err
+	}
+	if w.tx == nil {
+		if w.tx, err = w.db.Begin(); err != nil {
+			return err
+		}
+		if w.insert, err = w.tx.Prepare(w.query); err != nil {
+			return err
+		}
+	}
+	if _, err := w.insert.Exec(ip, int64(n), source, tags); err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows%sqliteBatchRows == 0 {
+		return w.commit()
+	}
+	return nil
+}
+
+// commit commits the current transaction.
+func (w *sqliteWriter) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+	w.insert.Close()
+	err := w.tx.Commit()
+	w.tx, w.insert = nil, nil
+	return err
+}
+
+// close commits the remaining rows and closes the database.
+func (w *sqliteWriter) close() error {
+	err := w.commit()
+	if closeErr := w.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,7 @@
+//go:build (darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm || arm64)) || (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (netbsd && amd64) || (openbsd && (amd64 || arm64)) || (windows && (386 || amd64 || arm64))
+
+package main
+
+// The pure Go SQLite driver only supports the platforms listed above; on the
+// others -input-sqlite reports that it is unsupported.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultStrictMinPrefix is the shortest prefix length -strict accepts unless
+// -strict-min-prefix is given.
+const defaultStrictMinPrefix = 8
+
+// checkStrict validates the parsed ranges for -strict, before they are
+// normalized. It rejects entries written with host bits set, entries that
+// duplicate an earlier one, and blocks broader than minPrefix. Every problem
+// is reported along with where the entry came from.
+func checkStrict(cidrRanges []CIDRRange, minPrefix int) error {
+	var problems []string
+	seen := make(map[ipRange]string)
+	for _, cidr := range cidrRanges {
+		if cidr.hasHostBits() {
+			problems = append(problems, fmt.Sprintf("%s: %s has host bits set (the network address is %s)", cidr.origin, cidr.entry, cidr.ipNet.IP))
+		}
+
+		if ones, _ := cidr.ipNet.Mask.Size(); ones < minPrefix {
+			problems = append(problems, fmt.Sprintf("%s: %s is broader than /%d", cidr.origin, cidr.entry, minPrefix))
+		}
+
+		block := cidr.normalized()
+		key := ipRange{Start: block.start, End: block.end}
+		if first, ok := seen[key]; ok {
+			problems = append(problems, fmt.Sprintf("%s: %s duplicates %s", cidr.origin, cidr.entry, first))
+			continue
+		}
+		seen[key] = cidr.origin
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("strict mode rejected the input:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
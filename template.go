@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateIP is what the -template-file template is executed with for each
+// expanded IP, e.g. "{{.Address}} host-{{.Index}}.{{index .Metadata "site"}}".
+type templateIP struct {
+	Address  string            // the IP, such as "10.0.0.1"
+	Integer  uint32            // the IP as an integer
+	Index    int               // the zero-based position of the IP in the output
+	Source   string            // the CIDR block the IP was expanded from
+	Entry    string            // the input entry the block was parsed from
+	Origin   string            // where the entry came from, e.g. "-cidr entry 3"
+	Metadata map[string]string // the fields of the entry's CSV row
+}
+
+// templateFuncs are the functions available to templates in addition to the
+// text/template built-ins.
+var templateFuncs = template.FuncMap{
+	"replace": strings.ReplaceAll,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"join":    strings.Join,
+	"split":   strings.Split,
+}
+
+// templateWriter renders each expanded IP through a template.
+type templateWriter struct {
+	w       io.Writer
+	tmpl    *template.Template
+	sources *sourceIndex
+	count   int
+}
+
+// parseTemplateFile parses the -template-file template.
+func parseTemplateFile(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading template: %w", err)
+	}
+	tmpl, err := template.New(path).Funcs(templateFuncs).Option("missingkey=zero").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// newTemplateWriter renders IPs expanded from cidrRanges through the
+// template in path onto w.
+func newTemplateWriter(w io.Writer, path, algorithm string, cidrRanges []CIDRRange) (*templateWriter, error) {
+	tmpl, err := parseTemplateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &templateWriter{w: w, tmpl: tmpl, sources: newSourceIndex(algorithm, cidrRanges)}, nil
+}
+
+// write renders an IP.
+func (t *templateWriter) write(ip string) error {
+	n, err := parseIPv4(ip)
+	if err != nil {
+		return err
+	}
+	data := templateIP{Address: ip, Integer: n, Index: t.count}
+	if cidr := t.sources.lookup(n); cidr != nil {
+		data.Source, data.Entry, data.Origin, data.Metadata = cidr.String(), cidr.entry, cidr.origin, cidr.metadata
+	}
+	t.count++
+	if err := t.tmpl.Execute(t.w, data); err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// terraformCIDRAttributes are the attributes holding CIDR blocks in the
+// resources of the common providers. Attributes ending in one of them, such
+// as secondary_cidr_blocks or source_address_prefix, are matched too.
+var terraformCIDRAttributes = []string{"cidr_block", "cidr_blocks", "address_prefix", "address_prefixes", "address_space", "ip_cidr_range"}
+
+// isTerraformCIDRAttribute reports whether a resource attribute holds CIDR
+// blocks.
+func isTerraformCIDRAttribute(key string) bool {
+	for _, attribute := range terraformCIDRAttributes {
+		if key == attribute || strings.HasSuffix(key, "_"+attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerraformDocument reports whether a JSON document is a Terraform state
+// file, or the output of terraform show -json for a state or plan.
+func isTerraformDocument(value any) bool {
+	doc, ok := value.(map[string]any)
+	if !ok {
+		return false
+	}
+	if _, ok := doc["terraform_version"]; !ok {
+		return false
+	}
+	for _, key := range []string{"resources", "values", "planned_values"} {
+		if _, ok := doc[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// walkTerraform yields the CIDR blocks of every resource in a Terraform
+// document, each with the address of its resource and attribute, such as
+// "terraform.tfstate:module.network.aws_subnet.private[0].cidr_block". A
+// state file lists the resources as they exist, and a plan the planned
+// values of every resource after the change. It returns false once yield
+// asks to stop.
+func walkTerraform(doc map[string]any, name string, yield func(inputEntry, error) bool) bool {
+	if resources, ok := doc["resources"].([]any); ok {
+		for _, resource := range resources {
+			r, _ := resource.(map[string]any)
+			module, _ := r["module"].(string)
+			mode, _ := r["mode"].(string)
+			resourceType, _ := r["type"].(string)
+			resourceName, _ := r["name"].(string)
+			address := resourceType + "." + resourceName
+			if mode == "data" {
+				address = "data." + address
+			}
+			if module != "" {
+				address = module + "." + address
+			}
+
+			instances, _ := r["instances"].([]any)
+			for _, instance := range instances {
+				i, _ := instance.(map[string]any)
+				instanceAddress := address
+				switch key := i["index_key"].(type) {
+				case float64:
+					instanceAddress += fmt.Sprintf("[%d]", int(key))
+				case string:
+					instanceAddress += fmt.Sprintf("[%q]", key)
+				}
+				if !walkTerraformAttributes(i["attributes"], instanceAddress, name+":"+instanceAddress, yield) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	values, ok := doc["planned_values"].(map[string]any)
+	if !ok {
+		values, _ = doc["values"].(map[string]any)
+	}
+	root, _ := values["root_module"].(map[string]any)
+	return walkTerraformModule(root, name, yield)
+}
+
+// walkTerraformModule yields the CIDR blocks of the resources of a module
+// in terraform show -json output, and of its child modules.
+func walkTerraformModule(module map[string]any, name string, yield func(inputEntry, error) bool) bool {
+	resources, _ := module["resources"].([]any)
+	for _, resource := range resources {
+		r, _ := resource.(map[string]any)
+		address, _ := r["address"].(string)
+		if !walkTerraformAttributes(r["values"], address, name+":"+address, yield) {
+			return false
+		}
+	}
+	children, _ := module["child_modules"].([]any)
+	for _, child := range children {
+		c, _ := child.(map[string]any)
+		if !walkTerraformModule(c, name, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkTerraformAttributes yields the IPv4 CIDR blocks of the CIDR
+// attributes within value, including those of nested blocks such as the
+// ingress rules of a security group. The entries come from the resource at
+// address, which -by-source reports them under.
+func walkTerraformAttributes(value any, address, location string, yield func(inputEntry, error) bool) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			if isTerraformCIDRAttribute(key) {
+				if !yieldTerraformCIDRs(v[key], address, location+"."+key, yield) {
+					return false
+				}
+			} else if !walkTerraformAttributes(v[key], address, location+"."+key, yield) {
+				return false
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if !walkTerraformAttributes(item, address, fmt.Sprintf("%s[%d]", location, i), yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// yieldTerraformCIDRs yields the value of a CIDR attribute, which is either
+// a single block or a list of them. IPv6 blocks are skipped.
+func yieldTerraformCIDRs(value any, address, location string, yield func(inputEntry, error) bool) bool {
+	switch v := value.(type) {
+	case string:
+		if isEntryValue(v) {
+			return yield(inputEntry{text: v, origin: location, source: address}, nil)
+		}
+	case []any:
+		for i, item := range v {
+			if s, ok := item.(string); ok && isEntryValue(s) {
+				if !yield(inputEntry{text: s, origin: fmt.Sprintf("%s[%d]", location, i), source: address}, nil) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
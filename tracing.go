@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// spanBatchSize is the number of finished spans sent in each export,
+	// and spanBatchInterval the longest a finished span waits to be sent.
+	spanBatchSize     = 512
+	spanBatchInterval = 5 * time.Second
+	// maxQueuedSpans is the most finished spans waiting to be exported,
+	// beyond which spans are dropped rather than held in memory.
+	maxQueuedSpans     = 16 * spanBatchSize
+	spanExportTimeout  = 10 * time.Second
+	otlpTracesPath     = "/v1/traces"
+	tracerName         = "github.com/ozfive/CIDR-Sensei"
+	defaultServiceName = "cidr-sensei"
+)
+
+// The kinds of span: an operation within the process, or one end of a
+// request between processes.
+const (
+	spanInternal = trace.SpanKindInternal
+	spanServer   = trace.SpanKindServer
+	spanClient   = trace.SpanKindClient
+)
+
+// span is a timed operation of a trace, such as parsing the blocks or one
+// worker of an expansion, exported to the -otlp-endpoint when it ends.
+// When tracing is off it records nothing, and neither does a nil span.
+type span struct {
+	trace.Span
+}
+
+// activeProvider exports the spans of the process, and is nil when tracing
+// is off.
+var activeProvider *sdktrace.TracerProvider
+
+// traceContext reads and writes the traceparent header of W3C Trace
+// Context, which passes a span between processes.
+var traceContext propagation.TraceContext
+
+// startSpan starts a span named name, a child of the span of ctx or the
+// root of a new trace, and returns it with a context carrying it.
+func startSpan(ctx context.Context, kind trace.SpanKind, name string, attrs ...slog.Attr) (context.Context, *span) {
+	ctx, s := otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(spanAttributes(attrs)...))
+	return ctx, &span{s}
+}
+
+// currentSpan returns the span of ctx, which records nothing when there is
+// none or it belongs to a remote parent.
+func currentSpan(ctx context.Context) *span {
+	return &span{trace.SpanFromContext(ctx)}
+}
+
+// set adds attributes to the span.
+func (s *span) set(attrs ...slog.Attr) {
+	if s != nil && s.IsRecording() {
+		s.SetAttributes(spanAttributes(attrs)...)
+	}
+}
+
+// finish ends the span, as failed when err is not nil, and queues it for
+// export.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.SetStatus(codes.Error, err.Error())
+	}
+	s.End()
+}
+
+// spanAttributes converts log attributes to span attributes. Durations are
+// recorded in seconds.
+func spanAttributes(attrs []slog.Attr) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		v := a.Value.Resolve()
+		switch v.Kind() {
+		case slog.KindBool:
+			kvs = append(kvs, attribute.Bool(a.Key, v.Bool()))
+		case slog.KindInt64:
+			kvs = append(kvs, attribute.Int64(a.Key, v.Int64()))
+		case slog.KindUint64:
+			kvs = append(kvs, attribute.Int64(a.Key, int64(min(v.Uint64(), math.MaxInt64))))
+		case slog.KindFloat64:
+			kvs = append(kvs, attribute.Float64(a.Key, v.Float64()))
+		case slog.KindDuration:
+			kvs = append(kvs, attribute.Float64(a.Key, v.Duration().Seconds()))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, v.String()))
+		}
+	}
+	return kvs
+}
+
+// exitError returns the error a span ending with the process exit code
+// reports, or nil for success.
+func exitError(code int) error {
+	if code == 0 {
+		return nil
+	}
+	return fmt.Errorf("exit status %d", code)
+}
+
+// traceparent returns the traceparent header passing the span of ctx to
+// another process, or "" when there is none.
+func traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// withTraceparent returns ctx carrying the remote span of a traceparent
+// header, so that the spans started from it join the trace of the caller.
+// An invalid header is ignored.
+func withTraceparent(ctx context.Context, header string) context.Context {
+	if header == "" {
+		return ctx
+	}
+	return traceContext.Extract(ctx, propagation.MapCarrier{"traceparent": header})
+}
+
+// startTracing starts exporting the spans of the process to the OTLP/HTTP
+// collector at endpoint, a base URL such as http://localhost:4318 that
+// /v1/traces is added to. The exporter is configured further by the
+// OTEL_SERVICE_NAME and OTEL_EXPORTER_OTLP_* variables of the OpenTelemetry
+// SDKs. Tracing stays off when endpoint is empty.
+func startTracing(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid -otlp-endpoint: %s (expected an http:// or https:// URL)", endpoint)
+	}
+	if !strings.HasSuffix(u.Path, otlpTracesPath) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + otlpTracesPath
+	}
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(u.String()),
+		otlptracehttp.WithTimeout(spanExportTimeout),
+		otlptracehttp.WithHeaders(map[string]string{"User-Agent": userAgent}),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid -otlp-endpoint: %w", err)
+	}
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceName(defaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithHost(),
+		resource.WithProcessPID(),
+	)
+	if err != nil {
+		// The detectors that failed are left out of the resource
+		slog.Warn("cannot describe the process to the collector", "error", err)
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("cannot export the spans", "error", err)
+	}))
+	activeProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithMaxExportBatchSize(spanBatchSize),
+			sdktrace.WithBatchTimeout(spanBatchInterval),
+			sdktrace.WithMaxQueueSize(maxQueuedSpans),
+			sdktrace.WithExportTimeout(spanExportTimeout),
+		),
+	)
+	otel.SetTracerProvider(activeProvider)
+	return nil
+}
+
+// stopTracing exports the spans left and stops tracing.
+func stopTracing() {
+	if activeProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), spanExportTimeout)
+	defer cancel()
+	if err := activeProvider.Shutdown(ctx); err != nil {
+		slog.Warn("cannot export the spans", "error", err)
+	}
+}
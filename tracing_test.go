@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTraceparent(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if got := traceparent(withTraceparent(t.Context(), header)); got != header {
+		t.Errorf("traceparent(withTraceparent(%q)) = %q", header, got)
+	}
+	for _, invalid := range []string{"", "00-4bf92f3577b34da6a3ce929d0e0e4736", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"} {
+		if got := traceparent(withTraceparent(t.Context(), invalid)); got != "" {
+			t.Errorf("traceparent(withTraceparent(%q)) = %q, want none", invalid, got)
+		}
+	}
+}
+
+func TestTracingExport(t *testing.T) {
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpTracesPath || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("the spans were posted to %s as %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(coltracepb.ExportTraceServiceRequest)
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Error(err)
+		}
+		requests <- req
+	}))
+	defer collector.Close()
+	t.Setenv("OTEL_SERVICE_NAME", "test")
+	t.Cleanup(func() {
+		activeProvider = nil
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	if err := startTracing(collector.URL); err != nil {
+		t.Fatal(err)
+	}
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	ctx := withTraceparent(t.Context(), "00-"+traceID+"-"+parentID+"-01")
+	_, s := startSpan(ctx, spanServer, "request", slog.String("path", "/expand"))
+	s.set(slog.Uint64("addresses", 256), slog.Bool("cached", true))
+	s.finish(errors.New("over the limit"))
+	stopTracing()
+
+	var got *tracepb.Span
+	var service string
+	for _, rs := range (<-requests).GetResourceSpans() {
+		for _, a := range rs.GetResource().GetAttributes() {
+			if a.GetKey() == "service.name" {
+				service = a.GetValue().GetStringValue()
+			}
+		}
+		for _, ss := range rs.GetScopeSpans() {
+			for _, sp := range ss.GetSpans() {
+				got = sp
+			}
+		}
+	}
+	if got == nil {
+		t.Fatal("no span was exported")
+	}
+	if service != "test" {
+		t.Errorf("the service name is %q, want test", service)
+	}
+	if hex.EncodeToString(got.GetTraceId()) != traceID || hex.EncodeToString(got.GetParentSpanId()) != parentID {
+		t.Errorf("the span is in trace %x under %x, want %s under %s", got.GetTraceId(), got.GetParentSpanId(), traceID, parentID)
+	}
+	if got.GetName() != "request" || got.GetKind() != tracepb.Span_SPAN_KIND_SERVER {
+		t.Errorf("the span is %s of kind %s, want request of kind server", got.GetName(), got.GetKind())
+	}
+	attrs := make(map[string]string)
+	for _, a := range got.GetAttributes() {
+		attrs[a.GetKey()] = a.GetValue().String()
+	}
+	if len(attrs) != 3 || attrs["addresses"] != "int_value:256" || attrs["cached"] != "bool_value:true" {
+		t.Errorf("the span has the attributes %v", attrs)
+	}
+	if got.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_ERROR || got.GetStatus().GetMessage() != "over the limit" {
+		t.Errorf("the span has the status %v, want an error", got.GetStatus())
+	}
+}
@@ -0,0 +1,681 @@
+//go:build !plan9
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+// tuiRefresh is how often the terminal UI redraws, and tuiRateWindow the
+// period over which it measures throughput.
+const (
+	tuiRefresh    = 100 * time.Millisecond
+	tuiRateWindow = time.Second
+)
+
+// tuiMaxSets and tuiMaxWorkers are the most input sets and workers the
+// terminal UI lists, leaving the rest of the screen to the results.
+const (
+	tuiMaxSets    = 6
+	tuiMaxWorkers = 8
+)
+
+// The styles of the title bar, the section headings, the selected row and
+// the key help of the terminal UI.
+var (
+	tuiTitleStyle   = lipgloss.NewStyle().Reverse(true)
+	tuiHeadingStyle = lipgloss.NewStyle().Bold(true)
+	tuiCursorStyle  = lipgloss.NewStyle().Reverse(true)
+	tuiHelpStyle    = lipgloss.NewStyle().Faint(true)
+	tuiPlainStyle   = lipgloss.NewStyle()
+)
+
+// tuiSet is an input set listed by the terminal UI: the blocks of a source.
+type tuiSet struct {
+	source    string
+	blocks    int
+	addresses uint64
+}
+
+// tuiPrompt is a line of input the terminal UI is reading at its bottom.
+type tuiPrompt struct {
+	label      string
+	input      []rune
+	candidates []string // what Tab completes the input to
+	hint       string   // the candidates matching the input, after Tab
+	done       func(input string) tea.Cmd
+}
+
+// tuiExport is the outcome of exporting the results view to a file.
+type tuiExport struct {
+	format string
+	path   string
+	count  int
+	err    error
+}
+
+// tuiTick is the message redrawing the terminal UI every tuiRefresh, and
+// tuiExpanded the message of the end of the expansion.
+type (
+	tuiTick     struct{}
+	tuiExpanded struct{}
+)
+
+// tui is the bubbletea model of the terminal UI. It is only used by the
+// program running the UI: the expansion reports to it through the worker
+// counters, and the expansion and exports through messages once they end.
+type tui struct {
+	config       Config
+	ctx          context.Context    // done once the UI quits
+	cancel       context.CancelFunc // quits
+	stop         context.CancelFunc // interrupts the expansion
+	sets         []tuiSet
+	results      *rangeIndex // every address of the blocks, in ascending order
+	view         *rangeIndex // the results within the filter
+	filter       string
+	search       string
+	top          uint64 // the position of the first row shown
+	cursor       uint64 // the position of the selected row
+	rows         int    // the number of rows the results view has room for
+	width        int
+	height       int
+	progress     []workerProgress
+	total        uint64 // the number of IPs the expansion emits
+	started      time.Time
+	elapsed      time.Duration
+	running      bool
+	err          error         // the error the expansion ended with
+	expanded     chan struct{} // closed once the expansion ends, with its error in expansionErr
+	expansionErr error
+	sampled      time.Time
+	last         []uint64  // the IPs of each worker when last sampled
+	rates        []float64 // the IPs per second of each worker
+	exporting    sync.WaitGroup
+	busy         bool // an export is running
+	status       string
+	prompt       *tuiPrompt
+}
+
+// runTUI implements the tui command and returns the process exit code. It
+// expands the blocks into the -output files as expand does, leaving out
+// terminal output, while showing the input sets, the progress and
+// throughput of each worker, and a scrollable, searchable view of the
+// addresses of the blocks, which can be filtered and exported to a file.
+// Quitting before the expansion ends interrupts it, keeping the output
+// written until then.
+func runTUI(ctx context.Context, config Config) int {
+	fetcher := newFetcher(config.FetchTimeout, config.FetchRetries, config.CacheDir, config.NoCache)
+	parser := newCIDRParser(ctx, config, fetcher)
+	cidrRanges, err := loadCIDRRanges(config, parser, collectEntries(config.CIDRListStr, "-cidr", inputSources(ctx, config, fetcher)...))
+	if err != nil {
+		slog.Error("cannot load the CIDR blocks", "error", err)
+		return 1
+	}
+	cidrRanges = filterHostAddresses(cidrRanges, config.IncludeNetwork, config.IncludeBroadcast)
+	excludeRanges, err := loadCIDRRanges(config, parser, collectEntries(config.Exclude, "-exclude", excludeSources(ctx, config, fetcher)...))
+	if err != nil {
+		slog.Error("cannot load the -exclude blocks", "error", err)
+		return 1
+	}
+	cidrRanges = dedupeCIDRRanges(excludeCIDRRanges(cidrRanges, mergeIPRanges(toIPRanges(excludeRanges))))
+
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		slog.Error("the tui command needs a terminal", "error", "stdin is not a terminal")
+		return 1
+	}
+	width, height, err := term.GetSize(os.Stdout.Fd())
+	if err != nil {
+		slog.Error("the tui command needs a terminal", "error", err)
+		return 1
+	}
+
+	// Terminal output is what the results view shows
+	expansion := config
+	expansion.Outputs = slices.DeleteFunc(slices.Clone(config.Outputs), func(output string) bool { return output == "terminal" })
+	output, err := newIPWriters(ctx, expansion, cidrRanges, nil)
+	if err != nil {
+		slog.Error("cannot write output", "error", err)
+		return 1
+	}
+
+	t := newTUI(ctx, config, cidrRanges, width, height)
+	expansionCtx, stop := context.WithCancel(t.ctx)
+	t.stop = stop
+	go func() {
+		defer close(t.expanded)
+		err := expandIPs(expansionCtx, config, cidrRanges, t.progress, interruptible(expansionCtx, output.write))
+		if closeErr := output.close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("error writing output: %w", closeErr)
+		}
+		if err == nil && config.Manifest != "" {
+			if err = writeManifest(expansion, output); err != nil {
+				err = fmt.Errorf("error writing manifest: %w", err)
+			}
+		}
+		t.expansionErr = err
+	}()
+
+	// Draw on the alternate screen, leaving the terminal as it was on quit
+	_, err = tea.NewProgram(t, tea.WithContext(ctx), tea.WithAltScreen()).Run()
+	t.cancel()
+	if t.running {
+		<-t.expanded
+		t.finish(t.expansionErr)
+	}
+	t.exporting.Wait()
+	if err != nil && !errors.Is(err, tea.ErrProgramKilled) && !errors.Is(err, tea.ErrInterrupted) {
+		slog.Error("the terminal UI failed", "error", err)
+		return 1
+	}
+
+	if t.err != nil {
+		slog.Error("the expansion failed", "error", t.err)
+		return 1
+	}
+	slog.Info("expansion complete", "duration", t.elapsed.Round(time.Millisecond))
+	return 0
+}
+
+// newTUI returns the terminal UI for the expansion of cidrRanges, with the
+// expansion about to start.
+func newTUI(ctx context.Context, config Config, cidrRanges []CIDRRange, width, height int) *tui {
+	workers := 1
+	total := expansionSize(config, cidrRanges)
+	if config.expandsInParallel() {
+		workers = config.Concurrency
+	}
+	t := &tui{
+		config:   config,
+		sets:     tuiSets(cidrRanges),
+		results:  newRangeIndex(mergeIPRanges(toIPRanges(cidrRanges))),
+		progress: make([]workerProgress, workers),
+		total:    total,
+		started:  time.Now(),
+		running:  true,
+		expanded: make(chan struct{}),
+		sampled:  time.Now(),
+		last:     make([]uint64, workers),
+		rates:    make([]float64, workers),
+	}
+	t.ctx, t.cancel = context.WithCancel(ctx)
+	t.view = t.results
+	t.resize(width, height)
+	return t
+}
+
+// tuiSets groups the blocks by source, in the order the sources were first
+// seen, counting the unique addresses of each.
+func tuiSets(cidrRanges []CIDRRange) []tuiSet {
+	var sources []string
+	bySource := make(map[string][]CIDRRange)
+	for _, cidr := range cidrRanges {
+		if _, ok := bySource[cidr.source]; !ok {
+			sources = append(sources, cidr.source)
+		}
+		bySource[cidr.source] = append(bySource[cidr.source], cidr)
+	}
+	sets := make([]tuiSet, 0, len(sources))
+	for _, source := range sources {
+		blocks := bySource[source]
+		sets = append(sets, tuiSet{source: source, blocks: len(blocks), addresses: totalSize(mergeIPRanges(toIPRanges(blocks)))})
+	}
+	return sets
+}
+
+// Init starts redrawing the terminal UI every tuiRefresh, and waiting for
+// the end of the expansion.
+func (t *tui) Init() tea.Cmd {
+	return tea.Batch(tuiTickAfter(), t.waitExpansion)
+}
+
+// tuiTickAfter returns the command sending the next tuiTick.
+func tuiTickAfter() tea.Cmd {
+	return tea.Tick(tuiRefresh, func(time.Time) tea.Msg { return tuiTick{} })
+}
+
+// waitExpansion is the command sending tuiExpanded once the expansion ends.
+func (t *tui) waitExpansion() tea.Msg {
+	<-t.expanded
+	return tuiExpanded{}
+}
+
+// Update acts on a key pressed, a change of the terminal size, the ticks
+// and the end of the expansion and exports.
+func (t *tui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		cmd = t.handleKey(msg)
+	case tea.WindowSizeMsg:
+		t.resize(msg.Width, msg.Height)
+	case tuiTick:
+		t.sample()
+		cmd = tuiTickAfter()
+	case tuiExpanded:
+		if t.running {
+			t.finish(t.expansionErr)
+		}
+	case tuiExport:
+		t.exported(msg)
+	}
+	t.scroll()
+	return t, cmd
+}
+
+// handleKey acts on a key pressed, returning the command it starts.
+func (t *tui) handleKey(msg tea.KeyMsg) tea.Cmd {
+	if t.prompt != nil {
+		return t.editPrompt(msg)
+	}
+	t.status = ""
+	switch msg.String() {
+	case "q":
+		return tea.Quit
+	case "ctrl+c":
+		if !t.running {
+			return tea.Quit
+		}
+		t.stop()
+		t.status = "Interrupting the expansion"
+	case "up", "k":
+		t.move(-1)
+	case "down", "j":
+		t.move(1)
+	case "pgup":
+		t.move(-t.rows)
+	case "pgdown":
+		t.move(t.rows)
+	case "home", "g":
+		t.cursor = 0
+	case "end", "G":
+		t.cursor = max(t.view.total, 1) - 1
+	case "/":
+		t.prompt = &tuiPrompt{label: "Search (IP or text): ", done: func(query string) tea.Cmd { t.searchFor(query); return nil }}
+	case "n":
+		t.find(true)
+	case "N":
+		t.find(false)
+	case "f":
+		t.prompt = &tuiPrompt{label: "Filter (blocks, empty for all): ", input: []rune(t.filter), done: func(filter string) tea.Cmd { t.setFilter(filter); return nil }}
+	case "e":
+		if t.busy {
+			t.status = "An export is already running"
+			return nil
+		}
+		t.prompt = &tuiPrompt{label: "Export as: ", candidates: fileOutputFormats(), done: t.export}
+	}
+	return nil
+}
+
+// editPrompt edits the input of the prompt shown, completing it with Tab
+// and passing it on with Enter, returning the command that starts. Escape
+// and Ctrl-C abandon it.
+func (t *tui) editPrompt(msg tea.KeyMsg) tea.Cmd {
+	p := t.prompt
+	switch msg.String() {
+	case "enter":
+		t.prompt = nil
+		return p.done(strings.TrimSpace(string(p.input)))
+	case "esc", "ctrl+c":
+		t.prompt = nil
+	case "backspace":
+		if len(p.input) > 0 {
+			p.input = p.input[:len(p.input)-1]
+		}
+	case "tab":
+		var matches []string
+		for _, c := range p.candidates {
+			if strings.HasPrefix(c, string(p.input)) {
+				matches = append(matches, c)
+			}
+		}
+		if len(matches) == 0 {
+			return nil
+		}
+		completion := matches[0]
+		for _, m := range matches[1:] {
+			for !strings.HasPrefix(m, completion) {
+				completion = completion[:len(completion)-1]
+			}
+		}
+		p.input = []rune(completion)
+		p.hint = ""
+		if len(matches) > 1 {
+			p.hint = strings.Join(matches, " ")
+		}
+	default:
+		// Named keys other than those above are not typed into the input
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			p.input = append(p.input, msg.Runes...)
+		}
+	}
+	return nil
+}
+
+// move moves the cursor by delta rows, within the rows of the view.
+func (t *tui) move(delta int) {
+	if t.view.total == 0 {
+		return
+	}
+	if delta < 0 {
+		t.cursor -= min(t.cursor, uint64(-delta))
+	} else {
+		t.cursor = min(t.cursor+uint64(delta), t.view.total-1)
+	}
+}
+
+// searchFor moves the cursor to query: to the address itself for an IP, and
+// to the next address containing the text otherwise.
+func (t *tui) searchFor(query string) {
+	t.search = query
+	if query == "" {
+		return
+	}
+	if ip := net.ParseIP(query).To4(); ip != nil {
+		pos, ok := t.view.positionOf(ipToUint(ip))
+		if !ok {
+			t.status = fmt.Sprintf("%s is not in the view", query)
+			return
+		}
+		t.cursor = pos
+		return
+	}
+	t.find(true)
+}
+
+// find moves the cursor to the next address of the view containing the
+// search text, or with forward false to the previous one, wrapping around
+// the ends of the view.
+func (t *tui) find(forward bool) {
+	if t.search == "" {
+		t.status = "Nothing to search for: press / to search"
+		return
+	}
+	total := t.view.total
+	for i := uint64(1); i <= total; i++ {
+		pos := (t.cursor + i) % total
+		if !forward {
+			pos = (t.cursor + total - i) % total
+		}
+		if strings.Contains(formatIPv4(t.view.addressAt(pos)), t.search) {
+			t.cursor = pos
+			return
+		}
+	}
+	t.status = fmt.Sprintf("No address contains %q", t.search)
+}
+
+// setFilter limits the view to the addresses within the blocks, IPs and
+// ranges of the filter, or shows every address for an empty filter.
+func (t *tui) setFilter(filter string) {
+	view := t.results
+	if filter != "" {
+		var ranges []ipRange
+		for _, entry := range splitList(filter) {
+			cidrRanges, err := parseEntry(entry)
+			if err != nil {
+				t.status = fmt.Sprintf("Invalid filter: %s", err)
+				return
+			}
+			ranges = append(ranges, toIPRanges(cidrRanges)...)
+		}
+		view = newRangeIndex(cidrsensei.Intersect(t.results.ranges, mergeIPRanges(ranges)))
+	}
+	t.filter, t.view = filter, view
+	t.top, t.cursor = 0, 0
+}
+
+// export writes the addresses of the view to a file in the background,
+// returning the command reporting the outcome.
+func (t *tui) export(format string) tea.Cmd {
+	if format == "" {
+		return nil
+	}
+	if !slices.Contains(fileOutputFormats(), format) {
+		t.status = fmt.Sprintf("Cannot export as %s: choose one of %s", format, strings.Join(fileOutputFormats(), ", "))
+		return nil
+	}
+	t.busy = true
+	t.status = fmt.Sprintf("Exporting %d addresses as %s", t.view.total, format)
+	config, filter, view := t.config, t.filter, t.view
+	// The export runs on its own, so that quitting waits for it even when the
+	// command is never run.
+	exported := make(chan tuiExport, 1)
+	t.exporting.Add(1)
+	go func() {
+		defer t.exporting.Done()
+		exported <- exportTUIView(t.ctx, config, filter, view, format)
+	}()
+	return func() tea.Msg { return <-exported }
+}
+
+// exported reports the outcome of an export.
+func (t *tui) exported(e tuiExport) {
+	t.busy = false
+	if e.err != nil {
+		t.status = fmt.Sprintf("Error exporting as %s: %s", e.format, e.err)
+		return
+	}
+	t.status = fmt.Sprintf("Exported %d addresses to %s", e.count, e.path)
+}
+
+// exportTUIView writes the addresses of view as format to a file named like
+// the output files of the expansion, after the filter when there is one,
+// with .export before the extension so as not to overwrite them.
+func exportTUIView(ctx context.Context, config Config, filter string, view *rangeIndex, format string) tuiExport {
+	e := tuiExport{format: format}
+	cidrRanges := rangesToCIDRs(view.ranges)
+	if filter != "" {
+		config.CIDRListStr = filter
+	}
+	config.OutputFormat = format
+	config.SplitSize, config.SplitCount = "", 0
+	filename, err := outputFilename(config, cidrRanges, "export."+outputSinks[format].extension)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	if config.OutputDir != "" {
+		if err := os.MkdirAll(config.OutputDir, 0o755); err != nil {
+			e.err = err
+			return e
+		}
+	}
+	config.OutFile = filepath.Join(config.OutputDir, filename)
+
+	w, err := newIPWriter(config, cidrRanges, nil)
+	if err != nil {
+		e.err = err
+		return e
+	}
+	e.err = pageIPs(cidrRanges, 0, 0, nil, interruptible(ctx, w.write))
+	if closeErr := w.close(); e.err == nil {
+		e.err = closeErr
+	}
+	e.path, e.count = w.path, w.count
+	return e
+}
+
+// finish records the end of the expansion, leaving the throughput of each
+// worker at its average over the whole expansion.
+func (t *tui) finish(err error) {
+	t.running = false
+	t.elapsed = time.Since(t.started)
+	t.err = err
+	for i := range t.progress {
+		t.rates[i] = float64(t.progress[i].ips.Load()) / t.elapsed.Seconds()
+	}
+}
+
+// sample measures the throughput of each worker since the last sample, once
+// a tuiRateWindow has passed.
+func (t *tui) sample() {
+	now := time.Now()
+	if !t.running || now.Sub(t.sampled) < tuiRateWindow {
+		return
+	}
+	seconds := now.Sub(t.sampled).Seconds()
+	for i := range t.progress {
+		ips := t.progress[i].ips.Load()
+		t.rates[i] = float64(ips-t.last[i]) / seconds
+		t.last[i] = ips
+	}
+	t.sampled = now
+}
+
+// resize lays the screen out for a terminal of width columns and height
+// rows: the results fill the rest of it, below the input sets and the
+// progress and above the bottom line.
+func (t *tui) resize(width, height int) {
+	t.width, t.height = width, height
+	above := 4 + min(len(t.sets), tuiMaxSets) + min(len(t.progress), tuiMaxWorkers)
+	t.rows = max(t.height-above-2, 1)
+}
+
+// scroll keeps the cursor within the rows shown.
+func (t *tui) scroll() {
+	if t.cursor < t.top {
+		t.top = t.cursor
+	} else if t.cursor >= t.top+uint64(t.rows) {
+		t.top = t.cursor - uint64(t.rows) + 1
+	}
+}
+
+// View draws the whole screen, sized to the terminal.
+func (t *tui) View() string {
+	var lines []string
+	add := func(style lipgloss.Style, format string, args ...any) {
+		line := fmt.Sprintf(format, args...)
+		if runes := []rune(line); len(runes) > t.width {
+			line = string(runes[:max(t.width, 0)])
+		}
+		lines = append(lines, style.Width(t.width).Render(line))
+	}
+
+	add(tuiTitleStyle, " CIDR-Sensei  %s", t.state())
+
+	add(tuiHeadingStyle, "Input sets")
+	for i, set := range t.sets {
+		if i == tuiMaxSets-1 && len(t.sets) > tuiMaxSets {
+			add(tuiPlainStyle, "  ... and %d more", len(t.sets)-i)
+			break
+		}
+		add(tuiPlainStyle, "  %-30s %8d blocks %12d addresses", set.source, set.blocks, set.addresses)
+	}
+
+	var ips uint64
+	var rate float64
+	for i := range t.progress {
+		ips += t.progress[i].ips.Load()
+		rate += t.rates[i]
+	}
+	add(tuiHeadingStyle, "Progress")
+	remaining := ""
+	if t.running {
+		remaining = eta(ips, t.total, rate)
+	}
+	add(tuiPlainStyle, "  %s %5.1f%%  %d of %d IPs  %.0f IPs/s%s", progressBar(ips, t.total, 30), percent(ips, t.total), ips, t.total, rate, remaining)
+	for i := range t.progress {
+		if i == tuiMaxWorkers-1 && len(t.progress) > tuiMaxWorkers {
+			add(tuiPlainStyle, "  ... and %d more workers", len(t.progress)-i)
+			break
+		}
+		block := "-"
+		if cidr := t.progress[i].block.Load(); cidr != nil {
+			block = cidr.String()
+		}
+		add(tuiPlainStyle, "  worker %-4d %-20s %12d IPs %12.0f IPs/s", i+1, block, t.progress[i].ips.Load(), t.rates[i])
+	}
+
+	header := fmt.Sprintf("Results  %d addresses", t.view.total)
+	if t.view.total > 0 {
+		header = fmt.Sprintf("Results  %d-%d of %d", t.top+1, min(t.top+uint64(t.rows), t.view.total), t.view.total)
+	}
+	if t.filter != "" {
+		header += fmt.Sprintf("  filter: %s", t.filter)
+	}
+	if t.search != "" {
+		header += fmt.Sprintf("  search: %s", t.search)
+	}
+	add(tuiHeadingStyle, "%s", header)
+	for row := 0; row < t.rows; row++ {
+		pos := t.top + uint64(row)
+		if pos >= t.view.total {
+			add(tuiPlainStyle, "")
+			continue
+		}
+		style := tuiPlainStyle
+		if pos == t.cursor {
+			style = tuiCursorStyle
+		}
+		add(style, "  %12d  %s", pos+1, uint2ip(t.view.addressAt(pos)))
+	}
+
+	switch {
+	case t.prompt != nil:
+		line := t.prompt.label + string(t.prompt.input) + "_"
+		if t.prompt.hint != "" {
+			line += "  (" + t.prompt.hint + ")"
+		}
+		add(tuiPlainStyle, "%s", line)
+	case t.status != "":
+		add(tuiPlainStyle, "%s", t.status)
+	default:
+		add(tuiHelpStyle, "up/down/PgUp/PgDn/Home/End scroll  / search  n/N next/previous  f filter  e export  Ctrl-C stop  q quit")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// state describes how far the expansion has got.
+func (t *tui) state() string {
+	switch {
+	case t.running:
+		return fmt.Sprintf("expanding  %.1fs", time.Since(t.started).Seconds())
+	case t.err != nil:
+		return fmt.Sprintf("stopped: %s  %.1fs", t.err, t.elapsed.Seconds())
+	}
+	return fmt.Sprintf("done  %.2fs", t.elapsed.Seconds())
+}
+
+// progressBar draws a bar width characters wide, filled in proportion to
+// done out of total.
+func progressBar(done, total uint64, width int) string {
+	filled := width
+	if total > 0 {
+		filled = int(min(done, total) * uint64(width) / total)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+// percent returns done as a percentage of total.
+func percent(done, total uint64) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(min(done, total)) * 100 / float64(total)
+}
+
+// eta estimates how long the rest of the expansion takes at rate IPs per
+// second, empty when the rate is not yet known.
+func eta(done, total uint64, rate float64) string {
+	if rate <= 0 || done >= total {
+		return ""
+	}
+	remaining := time.Duration(float64(total-done) / rate * float64(time.Second))
+	return "  ETA " + remaining.Round(time.Second).String()
+}
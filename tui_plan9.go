@@ -0,0 +1,13 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// runTUI implements the tui command, which is not supported on Plan 9: the
+// terminal library it is built on has no Plan 9 terminal support.
+func runTUI(ctx context.Context, config Config) int {
+	slog.Error("the tui command is not supported on plan9")
+	return 1
+}
@@ -0,0 +1,90 @@
+//go:build !plan9
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// typeKeys passes the keys of s to the terminal UI one at a time, as typed,
+// returning the command of the last.
+func typeKeys(t *tui, s string) tea.Cmd {
+	var cmd tea.Cmd
+	for _, r := range s {
+		_, cmd = t.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return cmd
+}
+
+// pressKey passes a named key to the terminal UI, returning its command.
+func pressKey(t *tui, key tea.KeyType) tea.Cmd {
+	_, cmd := t.Update(tea.KeyMsg{Type: key})
+	return cmd
+}
+
+func TestTUIResults(t *testing.T) {
+	ui := newTUI(t.Context(), Config{}, testBlocks(t, "10.0.0.0/24", "192.168.0.0/30"), 80, 20)
+	if ui.view.total != 260 {
+		t.Fatalf("the results view holds %d addresses, want 260", ui.view.total)
+	}
+
+	// Searching for an address moves the cursor to it, scrolling it into view.
+	typeKeys(ui, "/10.0.0.200")
+	pressKey(ui, tea.KeyEnter)
+	if ui.cursor != 200 || ui.top > ui.cursor || ui.cursor >= ui.top+uint64(ui.rows) {
+		t.Fatalf("the cursor is at %d, the view at %d with %d rows, after searching for 10.0.0.200", ui.cursor, ui.top, ui.rows)
+	}
+	if view := ui.View(); !strings.Contains(view, "10.0.0.200") || len(strings.Split(view, "\n")) != 20 {
+		t.Fatalf("the view does not show 10.0.0.200 in 20 lines:\n%s", view)
+	}
+	pressKey(ui, tea.KeyPgDown)
+	if ui.cursor != 200+uint64(ui.rows) {
+		t.Fatalf("the cursor is at %d after PgDn, want %d", ui.cursor, 200+ui.rows)
+	}
+
+	// Filtering limits the view, with Backspace editing the input.
+	typeKeys(ui, "f192.168.0.0/31x")
+	pressKey(ui, tea.KeyBackspace)
+	pressKey(ui, tea.KeyEnter)
+	typeKeys(ui, "G")
+	if ui.filter != "192.168.0.0/31" || ui.view.total != 2 || ui.cursor != 1 {
+		t.Fatalf("the view holds %d addresses with the cursor at %d after filtering by %q, want 2 and 1", ui.view.total, ui.cursor, ui.filter)
+	}
+	typeKeys(ui, "/nowhere")
+	pressKey(ui, tea.KeyEnter)
+	if !strings.Contains(ui.status, "No address contains") {
+		t.Fatalf("the status is %q after a search finding nothing", ui.status)
+	}
+
+	// Escape abandons a prompt, and q quits once it is gone.
+	if cmd := typeKeys(ui, "fq"); cmd != nil {
+		t.Fatal("q typed into a prompt quits")
+	}
+	pressKey(ui, tea.KeyEsc)
+	if cmd := typeKeys(ui, "q"); cmd == nil || cmd() != tea.Quit() {
+		t.Fatal("q does not quit")
+	}
+}
+
+func TestTUIExport(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{OutputDir: dir, FilenameTemplate: defaultFilenameTemplate, Fields: defaultFields, CIDRListStr: "10.0.0.0/30"}
+	ui := newTUI(t.Context(), config, testBlocks(t, "10.0.0.0/30"), 80, 20)
+	typeKeys(ui, "ecs")
+	pressKey(ui, tea.KeyTab)
+	if got := string(ui.prompt.input); got != "csv" {
+		t.Fatalf("Tab completes cs to %q, want csv", got)
+	}
+	cmd := pressKey(ui, tea.KeyEnter)
+	if !ui.busy || cmd == nil {
+		t.Fatal("Enter does not start the export")
+	}
+	ui.Update(cmd())
+	ui.exporting.Wait()
+	if ui.busy || !strings.HasPrefix(ui.status, "Exported 4 addresses to "+dir) {
+		t.Fatalf("the status is %q after the export", ui.status)
+	}
+}
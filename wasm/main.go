@@ -0,0 +1,154 @@
+//go:build js && wasm
+
+// Command wasm exposes the range arithmetic of the cidrsensei package to
+// JavaScript, so that it runs in the browser without a server. Loaded with
+// wasm_exec.js, it sets globalThis.cidrSensei to an object of functions
+// taking lists of CIDR blocks, IPs and address ranges, as arrays of strings
+// or as comma-separated strings:
+//
+//	cidrSensei.expand(cidrs, {exclude, limit})  // ["10.0.0.0", ...]
+//	cidrSensei.aggregate(cidrs)                 // {cidrs: [...], addresses: n}
+//	cidrSensei.check(cidrs, ips)                // [{ip, contained, cidrs}, ...]
+//
+// A function given invalid input returns an Error instead.
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"syscall/js"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+// defaultLimit is the largest expansion expand returns unless its limit
+// option is given, to keep a page from running out of memory.
+const defaultLimit = 1 << 16
+
+func main() {
+	js.Global().Set("cidrSensei", js.ValueOf(map[string]any{
+		"expand":    js.FuncOf(expand),
+		"aggregate": js.FuncOf(aggregate),
+		"check":     js.FuncOf(check),
+	}))
+	// Keep the functions callable
+	select {}
+}
+
+// expand returns the addresses of the blocks, less the exclude option's, in
+// ascending order.
+func expand(_ js.Value, args []js.Value) any {
+	ranges, err := rangesArg(args, 0)
+	if err != nil {
+		return jsError(err)
+	}
+	limit := uint64(defaultLimit)
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		exclude, err := rangesArg([]js.Value{args[1].Get("exclude")}, 0)
+		if err != nil {
+			return jsError(err)
+		}
+		ranges = cidrsensei.Subtract(ranges, exclude)
+		if l := args[1].Get("limit"); l.Type() == js.TypeNumber {
+			limit = uint64(l.Int())
+		}
+	}
+
+	if count := cidrsensei.Size(cidrsensei.Merge(ranges)); count > limit {
+		return jsError(fmt.Errorf("the blocks expand to %d addresses, more than the limit of %d", count, limit))
+	}
+	var ips []any
+	_ = cidrsensei.Expand(ranges, func(addr netip.Addr) error {
+		ips = append(ips, addr.String())
+		return nil
+	})
+	return js.ValueOf(ips)
+}
+
+// aggregate returns the fewest blocks covering the blocks, and the number of
+// addresses in them.
+func aggregate(_ js.Value, args []js.Value) any {
+	ranges, err := rangesArg(args, 0)
+	if err != nil {
+		return jsError(err)
+	}
+	var cidrs []any
+	for _, prefix := range cidrsensei.Prefixes(ranges) {
+		cidrs = append(cidrs, prefix.String())
+	}
+	return js.ValueOf(map[string]any{
+		"cidrs":     cidrs,
+		"addresses": float64(cidrsensei.Size(cidrsensei.Merge(ranges))),
+	})
+}
+
+// check returns, for each IP, the blocks containing it.
+func check(_ js.Value, args []js.Value) any {
+	entries, err := listArg(args, 0)
+	if err != nil {
+		return jsError(err)
+	}
+	ranges := make([]cidrsensei.Range, len(entries))
+	for i, entry := range entries {
+		if ranges[i], err = cidrsensei.ParseCIDR(entry); err != nil {
+			return jsError(err)
+		}
+	}
+	ips, err := listArg(args, 1)
+	if err != nil {
+		return jsError(err)
+	}
+
+	var results []any
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !addr.Is4() {
+			return jsError(fmt.Errorf("invalid IPv4 address: %s", ip))
+		}
+		var cidrs []any
+		for _, i := range cidrsensei.Containing(ranges, cidrsensei.Uint32(addr)) {
+			cidrs = append(cidrs, entries[i])
+		}
+		results = append(results, map[string]any{"ip": ip, "contained": len(cidrs) > 0, "cidrs": cidrs})
+	}
+	return js.ValueOf(results)
+}
+
+// rangesArg parses the list of blocks of argument i.
+func rangesArg(args []js.Value, i int) ([]cidrsensei.Range, error) {
+	entries, err := listArg(args, i)
+	if err != nil {
+		return nil, err
+	}
+	return cidrsensei.ParseCIDRs(strings.Join(entries, ","))
+}
+
+// listArg returns the entries of argument i, an array of strings or a
+// comma-separated string. A missing argument is an empty list.
+func listArg(args []js.Value, i int) ([]string, error) {
+	if i >= len(args) || args[i].IsUndefined() || args[i].IsNull() {
+		return nil, nil
+	}
+	arg := args[i]
+	switch {
+	case arg.Type() == js.TypeString:
+		return strings.FieldsFunc(arg.String(), func(r rune) bool { return r == ',' || r == ' ' }), nil
+	case js.Global().Get("Array").Call("isArray", arg).Bool():
+		entries := make([]string, arg.Length())
+		for j := range entries {
+			if arg.Index(j).Type() != js.TypeString {
+				return nil, fmt.Errorf("argument %d must be an array of strings", i+1)
+			}
+			entries[j] = strings.TrimSpace(arg.Index(j).String())
+		}
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("argument %d must be an array of strings or a comma-separated string", i+1)
+	}
+}
+
+// jsError returns err as a JavaScript Error.
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long -watch waits for a burst of changes, such as an
+// editor replacing a file, to settle before re-running.
+const watchDebounce = 250 * time.Millisecond
+
+// watchTargets are the local files a run reads, and the glob patterns that
+// select more of them.
+type watchTargets struct {
+	files    []string
+	patterns []string
+}
+
+// newWatchTargets returns the files and patterns config reads, including
+// the files the list files include. Stdin, URLs and objects are not
+// watched, and are read again whenever a run is triggered by a file.
+func newWatchTargets(config Config) watchTargets {
+	var targets watchTargets
+	addFile := func(path string) {
+		path = filepath.Clean(path)
+		if !slices.Contains(targets.files, path) {
+			targets.files = append(targets.files, path)
+		}
+	}
+	addPattern := func(pattern string) {
+		pattern = filepath.Clean(pattern)
+		if !slices.Contains(targets.patterns, pattern) {
+			targets.patterns = append(targets.patterns, pattern)
+		}
+	}
+	addList := func(path string) {
+		addFile(path)
+		files, patterns := includedFiles(path)
+		for _, included := range files {
+			addFile(included)
+		}
+		for _, pattern := range patterns {
+			addPattern(pattern)
+		}
+	}
+
+	for _, pattern := range slices.Concat(config.InputFiles, config.ExcludeFiles) {
+		switch {
+		case pattern == "-" || isObjectURI(pattern):
+		case strings.ContainsAny(pattern, "*?["):
+			addPattern(pattern)
+			matches, _ := filepath.Glob(pattern)
+			for _, match := range matches {
+				addList(match)
+			}
+		default:
+			addList(pattern)
+		}
+	}
+	for _, path := range []string{config.RIRFile, config.GeoIP, config.MRT, config.InputBitmap} {
+		if path != "" && !isObjectURI(path) && !strings.Contains(path, "://") {
+			addFile(path)
+		}
+	}
+	if path, _, _ := strings.Cut(strings.TrimPrefix(config.InputSQLite, "file:"), "?"); path != "" && path != ":memory:" {
+		addFile(path)
+	}
+	if config.Collapse != "" && config.Collapse != "-" {
+		addFile(config.Collapse)
+	}
+	return targets
+}
+
+// dirs returns the directories to watch for the targets. Directories are
+// watched rather than the files themselves so that files replaced by a
+// rename, as many editors save them, and new files matching a pattern are
+// noticed.
+func (t watchTargets) dirs() []string {
+	var dirs []string
+	for _, path := range slices.Concat(t.files, t.patterns) {
+		dir := filepath.Dir(path)
+		if !strings.ContainsAny(dir, "*?[") && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// matches reports whether a change to the named file affects a run.
+func (t watchTargets) matches(name string) bool {
+	name = filepath.Clean(name)
+	if slices.Contains(t.files, name) {
+		return true
+	}
+	for _, pattern := range t.patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// runWatch runs config once, then again every time one of the files it
+// reads changes, until ctx is canceled. A failed run is reported and the
+// files are watched again, so the list can be fixed while running.
+func runWatch(ctx context.Context, config Config) int {
+	targets := newWatchTargets(config)
+	if len(targets.files) == 0 && len(targets.patterns) == 0 {
+		slog.Error("the -watch flag needs a local input file to watch, such as an -input file")
+		return 1
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("cannot watch the files", "error", err)
+		return 1
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool)
+	watch := func() error {
+		for _, dir := range targets.dirs() {
+			if watched[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				return fmt.Errorf("error watching %s: %w", dir, err)
+			}
+			watched[dir] = true
+		}
+		return nil
+	}
+	if err := watch(); err != nil {
+		slog.Error("cannot watch the files", "error", err)
+		return 1
+	}
+
+	run(ctx, config)
+	slog.Info(fmt.Sprintf("watching %d files for changes", len(targets.files)))
+
+	timer := time.NewTimer(0)
+	<-timer.C
+	var changed string
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return 0
+			}
+			if event.Op == fsnotify.Chmod || !targets.matches(event.Name) {
+				continue
+			}
+			changed = event.Name
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return 0
+			}
+			slog.Error("cannot watch the files", "error", err)
+		case <-timer.C:
+			slog.Info("file changed, running again", "file", changed)
+			run(ctx, config)
+			// Files may have been included or matched since the last run.
+			targets = newWatchTargets(config)
+			if err := watch(); err != nil {
+				slog.Error("cannot watch the files", "error", err)
+			}
+		}
+	}
+}
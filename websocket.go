@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ozfive/CIDR-Sensei/cidrsensei"
+)
+
+const (
+	// websocketGUID is appended to the key of a WebSocket handshake to
+	// compute the accept key (RFC 6455).
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// websocketBatch is the number of addresses in each addresses message.
+	websocketBatch = 1024
+	// websocketProgressInterval is the least time between progress messages.
+	websocketProgressInterval = 250 * time.Millisecond
+	// websocketWriteTimeout is how long a client may take to accept a frame.
+	websocketWriteTimeout = 30 * time.Second
+)
+
+// WebSocket frame opcodes.
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xa
+)
+
+// WebSocket close status codes.
+const (
+	wsCloseNormal    = 1000
+	wsCloseGoingAway = 1001
+	wsClosePolicy    = 1008
+	wsCloseTooBig    = 1009
+)
+
+// websocketMessage is a message the WebSocket endpoint sends: a batch of
+// addresses, the progress of the expansion, its end, or an error.
+type websocketMessage struct {
+	Type      string   `json:"type"`
+	Addresses []string `json:"addresses,omitempty"`
+	Sent      uint64   `json:"sent,omitempty"`
+	Total     uint64   `json:"total,omitempty"`
+	Count     *uint64  `json:"count,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// websocketConn is the server side of a WebSocket connection.
+type websocketConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // serializes writes of frames
+}
+
+// handleWebSocket answers GET /expand, upgraded to a WebSocket: the client
+// sends an expand request as a text message, and the server sends the
+// addresses in batches as they are produced, with progress messages
+// interleaved, and a done message at the end.
+func (s *server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer ws.conn.Close()
+
+	// Control frames may come before the request
+	opcode, payload, err := ws.readFrame(s.maxRequestSize)
+	for err == nil && (opcode == wsPing || opcode == wsPong) {
+		if opcode == wsPing {
+			_ = ws.writeFrame(wsPong, payload)
+		}
+		opcode, payload, err = ws.readFrame(s.maxRequestSize)
+	}
+	if err != nil || opcode != wsText {
+		if errors.Is(err, errFrameTooLarge) {
+			ws.close(wsCloseTooBig, fmt.Sprintf("the request message is larger than the limit of %d bytes", s.maxRequestSize))
+			return
+		}
+		ws.close(wsClosePolicy, "the first message must be an expand request")
+		return
+	}
+	var req expandRequest
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		ws.fail(fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	ranges, err := s.expandRanges(req)
+	if err != nil {
+		ws.fail(err)
+		return
+	}
+
+	// Answer pings and notice the client closing while the expansion runs
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			opcode, payload, err := ws.readFrame(s.maxRequestSize)
+			if err != nil || opcode == wsClose {
+				return
+			}
+			if opcode == wsPing {
+				_ = ws.writeFrame(wsPong, payload)
+			}
+		}
+	}()
+
+	total := cidrsensei.Size(ranges)
+	var sent uint64
+	lastProgress := time.Now()
+	batch := make([]string, 0, websocketBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := ws.send(websocketMessage{Type: "addresses", Addresses: batch}); err != nil {
+			return err
+		}
+		sent += uint64(len(batch))
+		batch = batch[:0]
+		if time.Since(lastProgress) >= websocketProgressInterval {
+			lastProgress = time.Now()
+			if err := ws.send(websocketMessage{Type: "progress", Sent: sent, Total: total}); err != nil {
+				return err
+			}
+		}
+		return ctx.Err()
+	}
+	start := time.Now()
+	err = cidrsensei.Expand(ranges, func(addr netip.Addr) error {
+		if batch = append(batch, addr.String()); len(batch) == websocketBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	s.metrics.observeExpansion("websocket", sent, time.Since(start), err)
+	if err != nil {
+		if r.Context().Err() != nil {
+			ws.close(wsCloseGoingAway, "the server is shutting down")
+		}
+		return
+	}
+	_ = ws.send(websocketMessage{Type: "progress", Sent: sent, Total: total})
+	_ = ws.send(websocketMessage{Type: "done", Count: &sent})
+	ws.close(wsCloseNormal, "")
+}
+
+// upgradeWebSocket completes the WebSocket handshake of the request and
+// takes over its connection.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("GET %s is a WebSocket endpoint; POST expand requests to it otherwise", r.URL.Path)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("unsupported WebSocket version %q (expected 13)", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("the Sec-WebSocket-Key header is missing")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("WebSockets are only served over HTTP/1.1")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil, fmt.Errorf("WebSockets are only served over HTTP/1.1")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(hash[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocketConn{conn: conn, r: rw.Reader}, nil
+}
+
+// headerContains reports whether a comma-separated header has the token,
+// ignoring case.
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// errFrameTooLarge is the error of a message over the size limit.
+var errFrameTooLarge = errors.New("frame too large")
+
+// readFrame reads a message of at most limit bytes from the client, joining
+// its fragments. A control frame is returned on its own as it arrives.
+func (ws *websocketConn) readFrame(limit int64) (byte, []byte, error) {
+	var message []byte
+	var messageOpcode byte
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(ws.r, header[:]); err != nil {
+			return 0, nil, err
+		}
+		fin, opcode := header[0]&0x80 != 0, header[0]&0x0f
+		size := uint64(header[1] & 0x7f)
+		switch size {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+				return 0, nil, err
+			}
+			size = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+				return 0, nil, err
+			}
+			size = binary.BigEndian.Uint64(ext[:])
+		}
+		if size > uint64(limit)-uint64(len(message)) {
+			return 0, nil, errFrameTooLarge
+		}
+		// Frames from clients are always masked
+		if header[1]&0x80 == 0 {
+			return 0, nil, fmt.Errorf("unmasked frame from the client")
+		}
+		var mask [4]byte
+		if _, err := io.ReadFull(ws.r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(ws.r, payload); err != nil {
+			return 0, nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		if opcode >= wsClose {
+			return opcode, payload, nil
+		}
+		if opcode != 0 {
+			messageOpcode = opcode
+		}
+		message = append(message, payload...)
+		if fin {
+			return messageOpcode, message, nil
+		}
+	}
+}
+
+// writeFrame writes an unfragmented frame to the client.
+func (ws *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, 126), uint16(len(payload)))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 127), uint64(len(payload)))
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	_, err := ws.conn.Write(append(frame, payload...))
+	return err
+}
+
+// send writes a message as a JSON text frame.
+func (ws *websocketConn) send(message websocketMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return ws.writeFrame(wsText, payload)
+}
+
+// fail sends the error as an error message and closes the connection.
+func (ws *websocketConn) fail(err error) {
+	_ = ws.send(websocketMessage{Type: "error", Error: err.Error()})
+	ws.close(wsClosePolicy, "")
+}
+
+// close sends a close frame with the status code and reason.
+func (ws *websocketConn) close(code int, reason string) {
+	// The reason of a close frame is limited to 123 bytes
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	_ = ws.writeFrame(wsClose, append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testWebSocket connects a WebSocket client to GET /expand of s.
+func testWebSocket(t *testing.T, s *server) *websocket.Conn {
+	t.Helper()
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/expand", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestWebSocketExpand(t *testing.T) {
+	conn := testWebSocket(t, testServer())
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		pongs <- data
+		return nil
+	})
+	if err := conn.WriteMessage(websocket.PingMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(expandRequest{CIDRs: []string{"10.0.0.0/21", "192.168.0.0/30"}, Exclude: []string{"10.0.1.0/24"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for _, block := range testBlocks(t, "10.0.0.0/24", "10.0.2.0/23", "10.0.4.0/22", "192.168.0.0/30") {
+		for ip := uint64(block.start); ip <= uint64(block.end); ip++ {
+			want = append(want, formatIPv4(uint32(ip)))
+		}
+	}
+	var got []string
+	var batches int
+	var last websocketMessage
+	for last.Type != "done" {
+		last = websocketMessage{}
+		if err := conn.ReadJSON(&last); err != nil {
+			t.Fatal(err)
+		}
+		switch last.Type {
+		case "addresses":
+			got = append(got, last.Addresses...)
+			batches++
+		case "progress":
+			if last.Total != uint64(len(want)) || last.Sent > last.Total {
+				t.Errorf("the progress is %d of %d, want at most %d", last.Sent, last.Total, len(want))
+			}
+		case "error":
+			t.Fatal(last.Error)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("the WebSocket sent %d addresses, want the %d of the blocks less the exclusion", len(got), len(want))
+	}
+	if batches != 2 || last.Count == nil || *last.Count != uint64(len(want)) {
+		t.Errorf("the WebSocket sent %d batches and the count %v, want 2 and %d", batches, last.Count, len(want))
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("the WebSocket closed with %v, want a normal closure", err)
+	}
+	select {
+	case data := <-pongs:
+		if data != "ping" {
+			t.Errorf("the WebSocket answered the ping with %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Error("the WebSocket did not answer the ping")
+	}
+}
+
+func TestWebSocketErrors(t *testing.T) {
+	conn := testWebSocket(t, testServer())
+	if err := conn.WriteJSON(expandRequest{CIDRs: []string{"10.0.0.0/33"}}); err != nil {
+		t.Fatal(err)
+	}
+	var message websocketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Type != "error" || message.Error == "" {
+		t.Errorf("the WebSocket answered an invalid block with %+v, want an error", message)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("the WebSocket closed with %v, want a policy violation", err)
+	}
+
+	// The request is limited to -max-request-size
+	s := testServer()
+	s.maxRequestSize = 64
+	conn = testWebSocket(t, s)
+	if err := conn.WriteJSON(expandRequest{CIDRs: slices.Repeat([]string{"10.0.0.0/24"}, 10)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("the WebSocket closed a large request with %v, want message too big", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"net"
+)
+
+// maxWildcardRanges caps the number of discrete ranges a single
+// non-contiguous wildcard mask may expand to.
+const maxWildcardRanges = 1 << 16
+
+// parseWildcard parses a Cisco ACL-style address and wildcard mask pair such
+// as "10.0.0.0 0.0.255.255". Bits set in the wildcard are "don't care" bits.
+// A contiguous wildcard yields a single range, while a non-contiguous one
+// yields one range per combination of its don't-care bits above the trailing
+// run of ones, each of which is itself an aligned CIDR block.
+func parseWildcard(addrStr, wildcardStr string) ([]CIDRRange, error) {
+	addr := net.ParseIP(addrStr).To4()
+	if addr == nil {
+		return nil, fmt.Errorf("error parsing wildcard entry %s %s: invalid IPv4 address", addrStr, wildcardStr)
+	}
+	wildcardIP := net.ParseIP(wildcardStr).To4()
+	if wildcardIP == nil {
+		return nil, fmt.Errorf("error parsing wildcard entry %s %s: invalid wildcard mask", addrStr, wildcardStr)
+	}
+	wildcard := ipToUint(wildcardIP)
+
+	// The trailing run of ones forms the contiguous part of each range; any
+	// remaining don't-care bits select between discrete ranges.
+	blockBits := bits.TrailingZeros32(^wildcard)
+	if blockBits == 32 {
+		return []CIDRRange{newCIDRRange(0, 0)}, nil
+	}
+	blockMask := uint32(1)<<blockBits - 1
+	freeMask := wildcard &^ blockMask
+
+	if count := 1 << bits.OnesCount32(freeMask); count > maxWildcardRanges {
+		return nil, fmt.Errorf("wildcard entry %s %s expands to %d discrete ranges, more than the supported %d", addrStr, wildcardStr, count, maxWildcardRanges)
+	}
+
+	base := ipToUint(addr) &^ wildcard
+	var cidrRanges []CIDRRange
+	// Enumerate every subset of freeMask in increasing order.
+	for subset := uint32(0); ; {
+		cidrRanges = append(cidrRanges, newCIDRRange(base|subset, 32-blockBits))
+		subset = (subset - freeMask) & freeMask
+		if subset == 0 {
+			break
+		}
+	}
+	return cidrRanges, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxLayouts lists the values of -xlsx-layout: a worksheet for each source
+// block, or a single worksheet of every IP.
+var xlsxLayouts = []string{"source", "single"}
+
+const (
+	// xlsxMaxRows is the most rows Excel shows in a worksheet, including the
+	// header row.
+	xlsxMaxRows = 1 << 20
+)
+
+// xlsxWriter writes an Excel workbook with a row of the -fields columns for
+// each IP under a styled header row. Rows are streamed into the compressed
+// worksheet being written, so the workbook is never held in memory. A new
+// worksheet is started when the source block of the IPs changes, with the
+// source layout, or when a worksheet is full; the parts listing the
+// worksheets are written last, once they are all known.
+type xlsxWriter struct {
+	zw     *zip.Writer
+	fields *fieldWriter
+	layout string
+
+	sheets []string // the worksheet names, in order
+	names  map[string]int
+	sheet  io.Writer
+	key    string // the block, or "" for the single layout, of the worksheet
+	rows   int
+}
+
+// newXLSXWriter starts a workbook of the IPs expanded from cidrRanges.
+func newXLSXWriter(w io.Writer, config Config, cidrRanges []CIDRRange) (*xlsxWriter, error) {
+	fields, err := parseFields(config.Fields)
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxWriter{
+		zw:     zip.NewWriter(w),
+		fields: &fieldWriter{fields: fields, index: newSourceIndex(config.Algorithm, cidrRanges)},
+		layout: config.XLSXLayout,
+		names:  make(map[string]int),
+	}
+	for _, part := range []struct{ name, data string }{
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		if err := x.writePart(part.name, part.data); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+// writePart writes a part of the workbook in full.
+func (x *xlsxWriter) writePart(name, data string) error {
+	part, err := x.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(part, data)
+	return err
+}
+
+// write writes the row of a single IP.
+func (x *xlsxWriter) write(ip string) error {
+	key := ""
+	if x.layout == "source" {
+		n, err := parseIPv4(ip)
+		if err != nil {
+			return err
+		}
+		key = "other"
+		if cidr := x.fields.index.lookup(n); cidr != nil {
+			key = cidr.String()
+		}
+	}
+	if x.sheet == nil || key != x.key || x.rows == xlsxMaxRows {
+		if err := x.startSheet(key); err != nil {
+			return err
+		}
+	}
+
+	values, err := x.fields.values(ip)
+	if err != nil {
+		return err
+	}
+	x.rows++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.rows)
+	for i, value := range values {
+		ref := xlsxColumn(i) + strconv.Itoa(x.rows)
+		switch value := value.(type) {
+		case string:
+			writeXLSXString(&b, ref, value, 0)
+		case map[string]string:
+			writeXLSXString(&b, ref, formatMetadata(value), 0)
+		case uint32, int:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, value)
+		case bool:
+			v := 0
+			if value {
+				v = 1
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, v)
+		}
+	}
+	b.WriteString("</row>")
+	_, err = io.WriteString(x.sheet, b.String())
+	return err
+}
+
+// startSheet ends the current worksheet and starts the next, for the IPs of
+// the block key, with the header row.
+func (x *xlsxWriter) startSheet(key string) error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	name := x.sheetName(key)
+	x.sheets = append(x.sheets, name)
+	sheet, err := x.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	if err != nil {
+		return err
+	}
+	x.sheet, x.key, x.rows = sheet, key, 1
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"`)
+	if len(x.sheets) == 1 {
+		b.WriteString(` tabSelected="1"`)
+	}
+	b.WriteString(`><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	fmt.Fprintf(&b, `<cols><col min="1" max="%d" width="18" customWidth="1"/></cols>`, len(x.fields.fields))
+	b.WriteString(`<sheetData><row r="1">`)
+	for i, field := range x.fields.fields {
+		writeXLSXString(&b, xlsxColumn(i)+"1", field, 1)
+	}
+	b.WriteString("</row>")
+	_, err = io.WriteString(x.sheet, b.String())
+	return err
+}
+
+// endSheet ends the current worksheet, if there is one.
+func (x *xlsxWriter) endSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+	_, err := io.WriteString(x.sheet, "</sheetData></worksheet>")
+	x.sheet = nil
+	return err
+}
+
+// sheetName returns a unique worksheet name for the block key. Excel does
+// not allow a / in names, so 10.0.0.0/8 is named 10.0.0.0-8, and the
+// worksheets continuing a block, or returning to it, are numbered: 10.0.0.0-8
+// (2) and so on. The names stay within Excel's 31 characters.
+func (x *xlsxWriter) sheetName(key string) string {
+	base := strings.ReplaceAll(key, "/", "-")
+	if base == "" {
+		base = "IPs"
+	}
+	x.names[base]++
+	if n := x.names[base]; n > 1 {
+		return fmt.Sprintf("%s (%d)", base, n)
+	}
+	return base
+}
+
+// close ends the last worksheet, and writes the workbook listing the
+// worksheets and the content types of the parts.
+func (x *xlsxWriter) close() error {
+	if x.sheet == nil {
+		if err := x.startSheet(x.key); err != nil {
+			return err
+		}
+	}
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+
+	var workbook, rels, types strings.Builder
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	types.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i, name := range x.sheets {
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(name))
+		fmt.Fprintf(&workbook, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	workbook.WriteString("</sheets></workbook>")
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`, len(x.sheets)+1)
+	types.WriteString("</Types>")
+
+	for _, part := range []struct{ name, data string }{
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"[Content_Types].xml", types.String()},
+	} {
+		if err := x.writePart(part.name, part.data); err != nil {
+			return err
+		}
+	}
+	return x.zw.Close()
+}
+
+// xlsxColumn returns the letters of the zero-based column i: A to Z, then
+// AA and so on.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// writeXLSXString writes a cell holding the text s inline, in the style of
+// cellXfs index style.
+func writeXLSXString(b *strings.Builder, ref, s string, style int) {
+	fmt.Fprintf(b, `<c r="%s" t="inlineStr"`, ref)
+	if style != 0 {
+		fmt.Fprintf(b, ` s="%d"`, style)
+	}
+	b.WriteString("><is><t>")
+	xml.EscapeText(b, []byte(s))
+	b.WriteString("</t></is></c>")
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles holds the default cell style and, at index 1, the bold, shaded
+// style of the header row.
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`